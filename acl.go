@@ -0,0 +1,96 @@
+package miniredis
+
+// The ACL LOG. See https://redis.io/commands/acl-log/
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	aclLogMaxLen = 128              // acllog-max-len
+	aclLogGroup  = 60 * time.Second // similar entries within this period are grouped
+)
+
+// ACLLogEntry is an entry in the ACL LOG. See Miniredis.ACLLog().
+type ACLLogEntry struct {
+	ID         int    // "entry-id"
+	Count      int    // number of similar denials
+	Reason     string // "auth", "command", "key", or "channel"
+	Context    string // "toplevel", "multi", or "lua"
+	Object     string // the command, key, or channel. "AUTH" for auth failures
+	Username   string
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// ACLLog returns the ACL LOG, newest first. Currently only failed AUTH and
+// HELLO AUTH attempts, and commands denied by AllowOnly(), are logged.
+func (m *Miniredis) ACLLog() []ACLLogEntry {
+	m.Lock()
+	defer m.Unlock()
+
+	res := make([]ACLLogEntry, len(m.aclLog))
+	copy(res, m.aclLog)
+	return res
+}
+
+// ResetACLLog is the equivalent of ACL LOG RESET.
+func (m *Miniredis) ResetACLLog() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.aclLog = nil
+}
+
+// aclLogAdd adds a denial to the log. Similar recent entries get their count
+// increased instead. No locks!
+func (m *Miniredis) aclLogAdd(c *server.Peer, reason, object, username string) {
+	ctx := getCtx(c)
+	context := "toplevel"
+	switch {
+	case ctx.nested:
+		context = "lua"
+	case inTx(ctx):
+		context = "multi"
+	}
+	now := m.effectiveNow()
+
+	for i, e := range m.aclLog {
+		if e.Reason == reason &&
+			e.Context == context &&
+			e.Object == object &&
+			e.Username == username &&
+			now.Sub(e.Updated) < aclLogGroup {
+			e.Count++
+			e.Updated = now
+			copy(m.aclLog[1:i+1], m.aclLog[:i])
+			m.aclLog[0] = e
+			return
+		}
+	}
+
+	user := ctx.user
+	if user == "" {
+		user = "default"
+	}
+	e := ACLLogEntry{
+		ID:         m.aclLogID,
+		Count:      1,
+		Reason:     reason,
+		Context:    context,
+		Object:     object,
+		Username:   username,
+		ClientInfo: fmt.Sprintf("id=%d addr=%s name=%s user=%s", c.ID(), c.RemoteAddr(), ctx.name, user),
+		Created:    now,
+		Updated:    now,
+	}
+	m.aclLogID++
+	m.aclLog = append([]ACLLogEntry{e}, m.aclLog...)
+	if len(m.aclLog) > aclLogMaxLen {
+		m.aclLog = m.aclLog[:aclLogMaxLen]
+	}
+}
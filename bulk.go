@@ -0,0 +1,75 @@
+package miniredis
+
+// Methods to load a lot of data at once, to seed big keys in tests.
+//
+// For sets and lists use SetAdd() and Push(), which already take all
+// elements in a single call.
+
+// ZAddBulk adds score,member pairs to a sorted set, with a single lock.
+// Returns the number of new members.
+func (m *Miniredis) ZAddBulk(k string, members map[string]float64) (int, error) {
+	return m.selected().ZAddBulk(k, members)
+}
+
+// ZAddBulk adds score,member pairs to a sorted set, with a single lock.
+// Returns the number of new members.
+func (db *RedisDB) ZAddBulk(k string, members map[string]float64) (int, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	if db.wrongType(k, "zset") {
+		return 0, ErrWrongType
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+	ss, ok := db.sortedsetKeys[k]
+	if !ok {
+		ss = make(sortedSet, len(members))
+		db.sortedsetKeys[k] = ss
+		db.keys[k] = "zset"
+	}
+	added := 0
+	for member, score := range members {
+		db.before(k, member)
+		if _, ok := ss[member]; !ok {
+			added++
+		}
+		ss[member] = score
+	}
+	db.bump(k)
+	return added, nil
+}
+
+// HSetBulk sets field,value pairs in a hash, with a single lock.
+// If there is another key by the same name it will be gone.
+func (m *Miniredis) HSetBulk(k string, fields map[string]string) {
+	m.selected().HSetBulk(k, fields)
+}
+
+// HSetBulk sets field,value pairs in a hash, with a single lock.
+// If there is another key by the same name it will be gone.
+func (db *RedisDB) HSetBulk(k string, fields map[string]string) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	if len(fields) == 0 {
+		return
+	}
+	if db.wrongType(k, "hash") {
+		db.del(k, true)
+	}
+	h, ok := db.hashKeys[k]
+	if !ok {
+		h = make(map[string]string, len(fields))
+		db.hashKeys[k] = h
+		db.keys[k] = "hash"
+	}
+	for f, v := range fields {
+		db.before(k, f)
+		h[f] = v
+	}
+	db.bump(k)
+}
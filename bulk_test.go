@@ -0,0 +1,81 @@
+package miniredis
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestBulk(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("zset", func(t *testing.T) {
+		n, err := s.ZAddBulk("z", map[string]float64{"one": 1, "two": 2})
+		ok(t, err)
+		equals(t, 2, n)
+		n, err = s.ZAddBulk("z", map[string]float64{"two": 22, "three": 3})
+		ok(t, err)
+		equals(t, 1, n)
+		mustDo(t, c, "ZRANGE", "z", "0", "-1", "WITHSCORES",
+			proto.Strings("one", "1", "three", "3", "two", "22"),
+		)
+		equals(t, uint(2), s.KeyVersion(0, "z"))
+
+		n, err = s.ZAddBulk("new", nil)
+		ok(t, err)
+		equals(t, 0, n)
+		equals(t, false, s.Exists("new"))
+
+		s.Set("str", "value")
+		_, err = s.ZAddBulk("str", map[string]float64{"one": 1})
+		equals(t, ErrWrongType, err)
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		s.HSetBulk("h", map[string]string{"a": "1", "b": "2"})
+		s.HSetBulk("h", map[string]string{"b": "3"})
+		mustDo(t, c, "HGETALL", "h", proto.Strings("a", "1", "b", "3"))
+
+		s.Set("str", "value")
+		s.HSetBulk("str", map[string]string{"a": "1"})
+		equals(t, "hash", s.Type("str"))
+	})
+}
+
+func BenchmarkBulk(b *testing.B) {
+	const n = 500000
+	members := make(map[string]float64, n)
+	elems := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		k := strconv.Itoa(i)
+		members[k] = float64(i)
+		elems = append(elems, k)
+	}
+
+	b.Run("zadd", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := NewMiniRedis()
+			for k, v := range members {
+				m.ZAdd("z", v, k)
+			}
+		}
+	})
+
+	b.Run("zaddbulk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := NewMiniRedis()
+			m.ZAddBulk("z", members)
+		}
+	})
+
+	b.Run("setadd", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := NewMiniRedis()
+			m.SetAdd("s", elems...)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package miniredis
+
+// Capture of all traffic. See Miniredis.StartCapture().
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CaptureFormat is the format of StartCapture().
+type CaptureFormat string
+
+const (
+	CaptureJSON CaptureFormat = "json" // a JSON object per line
+	CaptureCSV  CaptureFormat = "csv"  // a header line, and a line per command
+)
+
+// captureHeader are the CSV columns. The arguments follow the command, so
+// lines have a different number of fields.
+var captureHeader = []string{"time", "client_id", "addr", "db", "duration_us", "error", "command", "args"}
+
+// captureLine is a CaptureJSON line.
+type captureLine struct {
+	Time       string   `json:"time"`
+	ClientID   int      `json:"client_id"`
+	Addr       string   `json:"addr"`
+	DB         int      `json:"db"`
+	DurationUS int64    `json:"duration_us"`
+	Error      string   `json:"error,omitempty"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+}
+
+type capture struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format CaptureFormat
+	csv    *csv.Writer
+	err    error // first write error
+}
+
+// StartCapture writes every command miniredis serves over the network to w,
+// in the given format, for offline analysis of a flaky test. Every command
+// has the time it started, the client, the selected DB, the duration, the
+// first error of its reply, and all its arguments.
+//
+// A command is written after its reply. Capturing stops with StopCapture(),
+// which gives the first error writing to w, if any. w is written to from the
+// connection goroutines, one command at a time. Starting a capture stops the
+// running one, if any.
+func (m *Miniredis) StartCapture(w io.Writer, format CaptureFormat) error {
+	cp := &capture{
+		w:      w,
+		format: format,
+	}
+	switch format {
+	case CaptureJSON:
+	case CaptureCSV:
+		cp.csv = csv.NewWriter(w)
+		cp.csv.Write(captureHeader)
+		cp.csv.Flush()
+		cp.err = cp.csv.Error()
+	default:
+		return fmt.Errorf("invalid capture format: %q", format)
+	}
+
+	m.Lock()
+	old := m.capture
+	m.capture = cp
+	if m.srv != nil {
+		m.srv.SetTraceHook(m.traceHook)
+	}
+	m.Unlock()
+	if old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+// StopCapture stops the StartCapture() capture, if any, and gives the first
+// error writing it.
+func (m *Miniredis) StopCapture() error {
+	m.Lock()
+	cp := m.capture
+	m.capture = nil
+	m.Unlock()
+	if cp == nil {
+		return nil
+	}
+	return cp.stop()
+}
+
+func (cp *capture) write(addr string, s Span) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.w == nil || cp.err != nil {
+		return
+	}
+
+	ts := s.Start.UTC().Format(time.RFC3339Nano)
+	dur := s.Duration.Microseconds()
+	switch cp.format {
+	case CaptureJSON:
+		l := captureLine{
+			Time:       ts,
+			ClientID:   s.ClientID,
+			Addr:       addr,
+			DB:         s.DB,
+			DurationUS: dur,
+			Error:      s.Error,
+			Command:    s.Name,
+			Args:       s.Args,
+		}
+		if l.Args == nil {
+			l.Args = []string{}
+		}
+		cp.err = json.NewEncoder(cp.w).Encode(l)
+	case CaptureCSV:
+		rec := append([]string{
+			ts,
+			strconv.Itoa(s.ClientID),
+			addr,
+			strconv.Itoa(s.DB),
+			strconv.FormatInt(dur, 10),
+			s.Error,
+			s.Name,
+		}, s.Args...)
+		cp.csv.Write(rec)
+		cp.csv.Flush()
+		cp.err = cp.csv.Error()
+	}
+}
+
+// stop makes write() a no-op, and gives the first error.
+func (cp *capture) stop() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.w = nil
+	return cp.err
+}
@@ -0,0 +1,83 @@
+package miniredis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestCapture(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		m := RunT(t)
+		buf := &bytes.Buffer{}
+		ok(t, m.StartCapture(buf, CaptureJSON))
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustOK(t, c, "SET", "foo", "bar")
+		mustOK(t, c, "SELECT", "2")
+		mustDo(t, c, "LPUSH", "foo", proto.Error(errWrongNumber("lpush")))
+		// commands are captured after their reply, this makes sure LPUSH is done.
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+		ok(t, m.StopCapture())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert(t, len(lines) >= 3, "lines")
+		var l captureLine
+		ok(t, json.Unmarshal([]byte(lines[0]), &l))
+		equals(t, "SET", l.Command)
+		equals(t, []string{"foo", "bar"}, l.Args)
+		equals(t, 1, l.ClientID)
+		equals(t, 0, l.DB)
+		equals(t, "", l.Error)
+		assert(t, l.Addr != "", "addr")
+		assert(t, l.Time != "", "time")
+
+		ok(t, json.Unmarshal([]byte(lines[1]), &l))
+		equals(t, "SELECT", l.Command)
+		equals(t, 2, l.DB)
+
+		l = captureLine{}
+		ok(t, json.Unmarshal([]byte(lines[2]), &l))
+		equals(t, "LPUSH", l.Command)
+		equals(t, []string{"foo"}, l.Args)
+		equals(t, errWrongNumber("lpush"), l.Error)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		m := RunT(t)
+		buf := &bytes.Buffer{}
+		ok(t, m.StartCapture(buf, CaptureCSV))
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustOK(t, c, "SET", "foo", "bar, baz")
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+		mustDo(t, c, "ECHO", "done", proto.String("done"))
+		ok(t, m.StopCapture())
+
+		rd := csv.NewReader(buf)
+		rd.FieldsPerRecord = -1
+		recs, err := rd.ReadAll()
+		ok(t, err)
+		assert(t, len(recs) >= 3, "lines")
+		equals(t, captureHeader, recs[0])
+		equals(t, "1", recs[1][1])
+		equals(t, "0", recs[1][3])
+		equals(t, "", recs[1][5])
+		equals(t, []string{"SET", "foo", "bar, baz"}, recs[1][6:])
+		equals(t, []string{"PING"}, recs[2][6:])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		m := RunT(t)
+		mustFail(t, m.StartCapture(&bytes.Buffer{}, "xml"), `invalid capture format: "xml"`)
+		ok(t, m.StopCapture())
+	})
+}
@@ -0,0 +1,389 @@
+package miniredis
+
+// Emulated cluster topology. See Miniredis.Cluster().
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	clusterSlots    = 16384
+	clusterMyselfID = "09dbe9720cda62f7865eabc5fd8857c5d2678366"
+	msgClusterDown  = "CLUSTERDOWN Hash slot not served"
+	msgCrossSlot    = "CROSSSLOT Keys in request don't hash to the same slot"
+
+	msgScriptCrossSlot = "ERR Script attempted to access keys that do not hash to the same slot"
+	msgScriptNonLocal  = "ERR Script attempted to access a non local key in a cluster node script"
+)
+
+var (
+	// ErrUnknownNode is returned when a cluster node ID isn't known.
+	ErrUnknownNode = errors.New("ERR unknown node")
+	// ErrNodeExists is returned when adding a cluster node ID twice.
+	ErrNodeExists = errors.New("ERR node already exists")
+	// ErrInvalidSlot is returned when a slot is not in 0-16383, or not owned
+	// by the expected node.
+	ErrInvalidSlot = errors.New("ERR invalid slot")
+)
+
+type clusterNode struct {
+	id       string
+	addr     string // host:port. Empty for ourselves.
+	hostname string // optional
+	failed   bool
+	master   *clusterNode // set for replicas
+	epoch    int          // config epoch. Replicas use the one of their master.
+}
+
+// Cluster is the emulated cluster topology, as reported by CLUSTER SLOTS and
+// CLUSTER NODES. Commands for keys in slots which are not owned by this
+// miniredis get a MOVED reply, and keys in slots owned by a failed node get a
+// CLUSTERDOWN reply.
+type Cluster struct {
+	m            *Miniredis
+	myself       *clusterNode
+	nodes        []*clusterNode
+	slots        [clusterSlots]*clusterNode
+	announceIP   string
+	announcePort int
+}
+
+// Cluster enables the cluster topology emulation, and returns the topology.
+// Initially this miniredis is the only node, and it has all the slots.
+// Without calling Cluster() commands are never redirected.
+func (m *Miniredis) Cluster() *Cluster {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.cluster == nil {
+		myself := &clusterNode{id: clusterMyselfID, epoch: 1}
+		m.cluster = &Cluster{
+			m:      m,
+			myself: myself,
+			nodes:  []*clusterNode{myself},
+		}
+		for i := range m.cluster.slots {
+			m.cluster.slots[i] = myself
+		}
+	}
+	return m.cluster
+}
+
+// MyID is the node ID of this miniredis.
+func (cl *Cluster) MyID() string {
+	return cl.myself.id
+}
+
+// SetAnnounce changes the address this miniredis reports for itself in CLUSTER
+// SLOTS and CLUSTER NODES, same as the cluster-announce-ip,
+// cluster-announce-port, and cluster-announce-hostname configs. This is
+// useful to test clients which connect via NAT or docker port mappings.
+// Empty ip and 0 port mean: use what we listen on. An empty hostname means no
+// hostname.
+func (cl *Cluster) SetAnnounce(ip string, port int, hostname string) {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	cl.announceIP = ip
+	cl.announcePort = port
+	cl.myself.hostname = hostname
+}
+
+// AddNode adds a node to the topology. The addr is what clients will be
+// redirected to, as "host:port". It doesn't have to be a running server. The
+// new node has no slots, see MigrateSlot().
+func (cl *Cluster) AddNode(id, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	if cl.node(id) != nil {
+		return ErrNodeExists
+	}
+	cl.nodes = append(cl.nodes, &clusterNode{id: id, addr: addr, epoch: 1})
+	return nil
+}
+
+// AddReplica adds a replica of a node to the topology. Replicas never have
+// slots, they are only listed in CLUSTER SLOTS and CLUSTER NODES.
+func (cl *Cluster) AddReplica(id, addr, masterID string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	if cl.node(id) != nil {
+		return ErrNodeExists
+	}
+	master := cl.node(masterID)
+	if master == nil {
+		return ErrUnknownNode
+	}
+	cl.nodes = append(cl.nodes, &clusterNode{id: id, addr: addr, master: master})
+	return nil
+}
+
+// replicas of a node. No locks!
+func (cl *Cluster) replicas(n *clusterNode) []*clusterNode {
+	var rs []*clusterNode
+	for _, r := range cl.nodes {
+		if r.master == n {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// MigrateSlot moves a slot from one node to another. Commands for keys in
+// that slot will get a MOVED (or not anymore) right away.
+func (cl *Cluster) MigrateSlot(slot int, from, to string) error {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	if slot < 0 || slot >= clusterSlots {
+		return ErrInvalidSlot
+	}
+	f, t := cl.node(from), cl.node(to)
+	if f == nil || t == nil {
+		return ErrUnknownNode
+	}
+	if cl.slots[slot] != f || t.master != nil {
+		return ErrInvalidSlot
+	}
+	cl.slots[slot] = t
+	return nil
+}
+
+// FailNode marks a node as failed. Commands for keys in any of its slots
+// will get a CLUSTERDOWN error.
+func (cl *Cluster) FailNode(id string) error {
+	return cl.setFailed(id, true)
+}
+
+// RecoverNode undoes a FailNode().
+func (cl *Cluster) RecoverNode(id string) error {
+	return cl.setFailed(id, false)
+}
+
+func (cl *Cluster) setFailed(id string, failed bool) error {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	n := cl.node(id)
+	if n == nil {
+		return ErrUnknownNode
+	}
+	n.failed = failed
+	return nil
+}
+
+// promote makes a replica the master of its shard, with a new config epoch.
+// The old master, and the other replicas, become replicas of the new master,
+// which gets all slots of the old master. No locks!
+func (cl *Cluster) promote(id string) {
+	n := cl.node(id)
+	if n == nil || n.master == nil {
+		return
+	}
+	old := n.master
+	epoch := 0
+	for _, o := range cl.nodes {
+		if o.epoch > epoch {
+			epoch = o.epoch
+		}
+	}
+	for _, o := range cl.nodes {
+		if o == old || o.master == old {
+			o.master = n
+		}
+	}
+	n.master = nil
+	n.epoch = epoch + 1
+	for i, o := range cl.slots {
+		if o == old {
+			cl.slots[i] = n
+		}
+	}
+}
+
+// No locks!
+func (cl *Cluster) node(id string) *clusterNode {
+	for _, n := range cl.nodes {
+		if n.id == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// addr of a node. No locks!
+func (cl *Cluster) nodeAddr(n *clusterNode) (string, int) {
+	addr := n.addr
+	if addr == "" {
+		a := cl.m.srv.Addr()
+		host, port := a.IP.String(), a.Port
+		if cl.announceIP != "" {
+			host = cl.announceIP
+		}
+		if cl.announcePort != 0 {
+			port = cl.announcePort
+		}
+		return host, port
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+// redirect gives the error for a command which should not be handled by us,
+// or "" if we're fine. All keys need to be in the same slot. No locks!
+func (cl *Cluster) redirect(cmd string, args []string) string {
+	keys := commandKeys(cmd, args)
+	if len(keys) == 0 {
+		return ""
+	}
+	slot := KeySlot(keys[0])
+	for _, k := range keys[1:] {
+		if KeySlot(k) != slot {
+			return msgCrossSlot
+		}
+	}
+	n := cl.slots[slot]
+	switch {
+	case n == nil || n.failed:
+		return msgClusterDown
+	case n == cl.myself:
+		return ""
+	default:
+		host, port := cl.nodeAddr(n)
+		return fmt.Sprintf("MOVED %d %s:%d", slot, host, port)
+	}
+}
+
+// scriptError gives the error for a redis.call() from a script with the given
+// KEYS, or "" if we're fine. Keys need to be in the same slot as the declared
+// keys, and that slot needs to be ours. No locks!
+func (cl *Cluster) scriptError(declared []string, cmd string, args []string) string {
+	keys := commandKeys(cmd, args)
+	if len(keys) == 0 {
+		return ""
+	}
+	slot := KeySlot(keys[0])
+	if len(declared) > 0 {
+		slot = KeySlot(declared[0])
+	}
+	for _, k := range keys {
+		if KeySlot(k) != slot {
+			return msgScriptCrossSlot
+		}
+	}
+	if n := cl.slots[slot]; n == nil || n.failed || n != cl.myself {
+		return msgScriptNonLocal
+	}
+	return ""
+}
+
+type slotRange struct {
+	start, end int
+	node       *clusterNode
+}
+
+// slotRanges gives all continuous slot ranges. No locks!
+func (cl *Cluster) slotRanges() []slotRange {
+	var rs []slotRange
+	for i, n := range cl.slots {
+		if n == nil {
+			continue
+		}
+		if l := len(rs) - 1; l >= 0 && rs[l].node == n && rs[l].end == i-1 {
+			rs[l].end = i
+			continue
+		}
+		rs = append(rs, slotRange{start: i, end: i, node: n})
+	}
+	return rs
+}
+
+// nodesLines is the CLUSTER NODES payload. No locks!
+func (cl *Cluster) nodesLines() string {
+	ranges := cl.slotRanges()
+	var lines []string
+	for _, n := range cl.nodes {
+		host, port := cl.nodeAddr(n)
+		flags, master := "master", "-"
+		if n.master != nil {
+			flags, master = "slave", n.master.id
+		}
+		if n == cl.myself {
+			flags = "myself," + flags
+		}
+		link := "connected"
+		if n.failed {
+			flags += ",fail"
+			link = "disconnected"
+		}
+		var slots []string
+		for _, r := range ranges {
+			if r.node != n {
+				continue
+			}
+			if r.start == r.end {
+				slots = append(slots, strconv.Itoa(r.start))
+			} else {
+				slots = append(slots, fmt.Sprintf("%d-%d", r.start, r.end))
+			}
+		}
+		endpoint := fmt.Sprintf("%s:%d@%d", host, port, port+10000)
+		if n.hostname != "" {
+			endpoint += "," + n.hostname
+		}
+		epoch := n.epoch
+		if n.master != nil {
+			epoch = n.master.epoch
+		}
+		line := fmt.Sprintf("%s %s %s %s 0 0 %d %s", n.id, endpoint, flags, master, epoch, link)
+		if len(slots) > 0 {
+			line += " " + strings.Join(slots, " ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// KeySlot is the cluster slot of a key, same as CLUSTER KEYSLOT. If the key
+// has a "{...}" hash tag only the part between the first "{" and the first "}"
+// after it is hashed. An empty tag, "{}", doesn't count, then the whole key
+// is hashed.
+func KeySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) variant Redis uses.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -41,27 +41,72 @@ func (m *Miniredis) cmdCluster(c *server.Peer, cmd string, args []string) {
 // CLUSTER SLOTS
 func (m *Miniredis) cmdClusterSlots(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		c.WriteLen(1)
-		c.WriteLen(3)
-		c.WriteInt(0)
-		c.WriteInt(16383)
-		c.WriteLen(3)
-		c.WriteBulk(m.srv.Addr().IP.String())
-		c.WriteInt(m.srv.Addr().Port)
-		c.WriteBulk("09dbe9720cda62f7865eabc5fd8857c5d2678366")
+		if m.cluster == nil {
+			c.WriteLen(1)
+			c.WriteLen(3)
+			c.WriteInt(0)
+			c.WriteInt(16383)
+			c.WriteLen(3)
+			c.WriteBulk(m.srv.Addr().IP.String())
+			c.WriteInt(m.srv.Addr().Port)
+			c.WriteBulk(clusterMyselfID)
+			return
+		}
+
+		ranges := m.cluster.slotRanges()
+		c.WriteLen(len(ranges))
+		for _, r := range ranges {
+			replicas := m.cluster.replicas(r.node)
+			c.WriteLen(3 + len(replicas))
+			c.WriteInt(r.start)
+			c.WriteInt(r.end)
+			m.writeClusterSlotsNode(c, r.node)
+			for _, n := range replicas {
+				m.writeClusterSlotsNode(c, n)
+			}
+		}
 	})
 }
 
+// a node in the CLUSTER SLOTS reply. No locks!
+func (m *Miniredis) writeClusterSlotsNode(c *server.Peer, n *clusterNode) {
+	host, port := m.cluster.nodeAddr(n)
+	if n.hostname == "" {
+		c.WriteLen(3)
+	} else {
+		c.WriteLen(4)
+	}
+	c.WriteBulk(host)
+	c.WriteInt(port)
+	c.WriteBulk(n.id)
+	if n.hostname != "" {
+		c.WriteMapLen(1)
+		c.WriteBulk("hostname")
+		c.WriteBulk(n.hostname)
+	}
+}
+
 // CLUSTER KEYSLOT
 func (m *Miniredis) cmdClusterKeySlot(c *server.Peer, cmd string, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("cluster|keyslot"))
+		return
+	}
+	key := args[1]
+
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		c.WriteInt(163)
+		c.WriteInt(KeySlot(key))
 	})
 }
 
 // CLUSTER NODES
 func (m *Miniredis) cmdClusterNodes(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		c.WriteBulk("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:7000@7000 myself,master - 0 0 1 connected 0-16383")
+		if m.cluster == nil {
+			c.WriteBulk("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:7000@7000 myself,master - 0 0 1 connected 0-16383")
+			return
+		}
+		c.WriteBulk(m.cluster.nodesLines())
 	})
 }
@@ -1,8 +1,11 @@
 package miniredis
 
 import (
+	"fmt"
+	"net"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -43,7 +46,317 @@ func TestCluster(t *testing.T) {
 	t.Run("keyslot", func(t *testing.T) {
 		mustDo(t, c,
 			"CLUSTER", "keyslot", "{test_key}",
-			proto.Int(163),
+			proto.Int(15118),
 		)
+		mustDo(t, c,
+			"CLUSTER", "KEYSLOT", "somekey",
+			proto.Int(11058),
+		)
+		mustDo(t, c,
+			"CLUSTER", "KEYSLOT",
+			proto.Error("ERR wrong number of arguments for 'cluster|keyslot' command"),
+		)
+		mustDo(t, c,
+			"CLUSTER", "KEYSLOT", "foo", "bar",
+			proto.Error("ERR wrong number of arguments for 'cluster|keyslot' command"),
+		)
+	})
+}
+
+func TestKeySlot(t *testing.T) {
+	equals(t, uint16(0x31c3), crc16("123456789"))
+
+	for key, slot := range map[string]int{
+		"":                     0,
+		"123456789":            12739,
+		"foo":                  12182,
+		"somekey":              11058,
+		"foo{hash_tag}":        2515,
+		"{test_key}":           15118,
+		"test_key":             15118,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"foo{}{bar}":           8363,
+		"foo{{bar}}zap":        4015,
+		"foo{bar}{zap}":        5061,
+		"{}":                   15257,
+		"{":                    4092,
+		"}{a}":                 15495,
+	} {
+		equals(t, slot, KeySlot(key))
+	}
+}
+
+func TestClusterTopology(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	cl := s.Cluster()
+	ok(t, cl.AddNode("othernode", "10.0.0.2:7001"))
+	mustFail(t, cl.AddNode("othernode", "10.0.0.2:7001"), ErrNodeExists.Error())
+
+	slot := KeySlot("foo") // 12182
+	mustOK(t, c, "SET", "foo", "bar")
+
+	t.Run("migrate", func(t *testing.T) {
+		ok(t, cl.MigrateSlot(slot, cl.MyID(), "othernode"))
+		mustFail(t, cl.MigrateSlot(slot, cl.MyID(), "othernode"), ErrInvalidSlot.Error())
+		mustFail(t, cl.MigrateSlot(slot, cl.MyID(), "nosuch"), ErrUnknownNode.Error())
+
+		mustDo(t, c,
+			"GET", "foo",
+			proto.Error("MOVED 12182 10.0.0.2:7001"),
+		)
+		mustDo(t, c,
+			"GET", "a{foo}b",
+			proto.Error("MOVED 12182 10.0.0.2:7001"),
+		)
+		mustNil(t, c, "GET", "bar")
+		mustContain(t, c, "PING", "PONG")
+
+		port, err := strconv.Atoi(s.Port())
+		ok(t, err)
+		node := func(start, end int, host string, port int, id string) string {
+			return proto.Array(
+				proto.Int(start),
+				proto.Int(end),
+				proto.Array(proto.String(host), proto.Int(port), proto.String(id)),
+			)
+		}
+		mustDo(t, c,
+			"CLUSTER", "SLOTS",
+			proto.Array(
+				node(0, slot-1, s.Host(), port, cl.MyID()),
+				node(slot, slot, "10.0.0.2", 7001, "othernode"),
+				node(slot+1, 16383, s.Host(), port, cl.MyID()),
+			),
+		)
+		mustContain(t, c,
+			"CLUSTER", "NODES",
+			"othernode 10.0.0.2:7001@17001 master - 0 0 1 connected 12182\n",
+		)
+
+		// in a transaction
+		mustOK(t, c, "MULTI")
+		mustDo(t, c,
+			"GET", "foo",
+			proto.Error("MOVED 12182 10.0.0.2:7001"),
+		)
+		mustDo(t, c,
+			"EXEC",
+			proto.Error("EXECABORT Transaction discarded because of previous errors."),
+		)
+
+		ok(t, cl.MigrateSlot(slot, "othernode", cl.MyID()))
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		ok(t, cl.FailNode(cl.MyID()))
+		mustDo(t, c,
+			"GET", "foo",
+			proto.Error(msgClusterDown),
+		)
+		mustContain(t, c,
+			"CLUSTER", "NODES",
+			"myself,master,fail - 0 0 1 disconnected 0-16383",
+		)
+		ok(t, cl.RecoverNode(cl.MyID()))
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		mustFail(t, cl.FailNode("nosuch"), ErrUnknownNode.Error())
 	})
 }
+
+func TestCommandKeys(t *testing.T) {
+	equals(t, []string{"foo"}, commandKeys("GET", []string{"foo"}))
+	equals(t, []string{"k1", "k2"}, commandKeys("mset", []string{"k1", "v1", "k2", "v2"}))
+	equals(t, []string{"l1", "l2"}, commandKeys("BLPOP", []string{"l1", "l2", "0"}))
+	equals(t, []string{"k1"}, commandKeys("EVAL", []string{"return 1", "1", "k1", "arg"}))
+	equals(t, []string{"dst", "a", "b"}, commandKeys("ZUNIONSTORE", []string{"dst", "2", "a", "b", "WEIGHTS", "1", "2"}))
+	equals(t, []string{"s1", "s2"}, commandKeys("XREAD", []string{"COUNT", "1", "STREAMS", "s1", "s2", "0", "0"}))
+	equals(t, []string{"src", "dst"}, commandKeys("LMOVE", []string{"src", "dst", "LEFT", "RIGHT"}))
+	equals(t, []string(nil), commandKeys("PING", nil))
+	equals(t, []string(nil), commandKeys("NOSUCH", []string{"foo"}))
+}
+
+func TestClusterAnnounce(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	cl := s.Cluster()
+	cl.SetAnnounce("203.0.113.7", 30001, "")
+	mustDo(t, c,
+		"CLUSTER", "SLOTS",
+		proto.Array(
+			proto.Array(
+				proto.Int(0),
+				proto.Int(16383),
+				proto.Array(
+					proto.String("203.0.113.7"),
+					proto.Int(30001),
+					proto.String(cl.MyID()),
+				),
+			),
+		),
+	)
+
+	cl.SetAnnounce("", 0, "redis-0.example.com")
+	port, err := strconv.Atoi(s.Port())
+	ok(t, err)
+	mustDo(t, c,
+		"CLUSTER", "SLOTS",
+		proto.Array(
+			proto.Array(
+				proto.Int(0),
+				proto.Int(16383),
+				proto.Array(
+					proto.String(s.Host()),
+					proto.Int(port),
+					proto.String(cl.MyID()),
+					proto.Strings("hostname", "redis-0.example.com"),
+				),
+			),
+		),
+	)
+	mustDo(t, c,
+		"CLUSTER", "NODES",
+		proto.String(fmt.Sprintf("%s %s:%d@%d,redis-0.example.com myself,master - 0 0 1 connected 0-16383\n", cl.MyID(), s.Host(), port, port+10000)),
+	)
+}
+
+func TestStartCluster(t *testing.T) {
+	tc := StartCluster(t, 3, 1)
+	equals(t, 3, len(tc.Shards))
+	equals(t, 6, len(tc.Nodes()))
+	equals(t, 6, len(tc.Addrs()))
+	equals(t, tc.Masters()[0].Addr(), tc.Addrs()[0])
+	equals(t, tc.Shards[0][1].Addr(), tc.Addrs()[3])
+
+	master := tc.ForKey("foo") // slot 12182
+	equals(t, tc.Shards[2][0], master)
+	replica := tc.Shards[2][1]
+
+	c, err := proto.Dial(tc.Addrs()[0])
+	ok(t, err)
+	defer c.Close()
+	mustDo(t, c,
+		"SET", "foo", "bar",
+		proto.Error("MOVED 12182 "+master.Addr()),
+	)
+
+	mc, err := proto.Dial(master.Addr())
+	ok(t, err)
+	defer mc.Close()
+	mustOK(t, mc, "SET", "foo", "bar")
+
+	t.Run("replica", func(t *testing.T) {
+		rc, err := proto.Dial(replica.Addr())
+		ok(t, err)
+		defer rc.Close()
+
+		mustDo(t, rc,
+			"GET", "foo",
+			proto.Error("MOVED 12182 "+master.Addr()),
+		)
+		mustDo(t, rc,
+			"FLUSHALL",
+			proto.Error(DenyReadonly),
+		)
+		got, err := replica.Get("foo")
+		ok(t, err)
+		equals(t, "bar", got)
+	})
+
+	t.Run("topology", func(t *testing.T) {
+		mustContain(t, c,
+			"CLUSTER", "NODES",
+			"myself,master - 0 0 1 connected 0-5460\n",
+			"master - 0 0 2 connected 5461-10921\n",
+			"master - 0 0 3 connected 10922-16383",
+			" slave "+tc.Masters()[2].Cluster().MyID()+" 0 0 3 connected",
+		)
+
+		_, port, _ := net.SplitHostPort(master.Addr())
+		p, _ := strconv.Atoi(port)
+		_, rport, _ := net.SplitHostPort(replica.Addr())
+		rp, _ := strconv.Atoi(rport)
+		res, err := c.Do("CLUSTER", "SLOTS")
+		ok(t, err)
+		slots, err := proto.Parse(res)
+		ok(t, err)
+		equals(t, 3, len(slots.([]interface{})))
+		equals(t,
+			[]interface{}{
+				10922, 16383,
+				[]interface{}{"127.0.0.1", p, master.Cluster().MyID()},
+				[]interface{}{"127.0.0.1", rp, replica.Cluster().MyID()},
+			},
+			slots.([]interface{})[2],
+		)
+	})
+}
+
+func TestClusterFailover(t *testing.T) {
+	tc := StartCluster(t, 2, 1)
+	tc.FailoverDown = 200 * time.Millisecond
+
+	old := tc.ForKey("foo")
+	equals(t, tc.Shards[1][0], old)
+	promoted := tc.Shards[1][1]
+	ok(t, old.Set("foo", "bar"))
+
+	c, err := proto.Dial(old.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	done := make(chan error)
+	go func() { done <- tc.Failover(1) }()
+
+	// during the failover
+	for {
+		res, err := c.Do("GET", "foo")
+		ok(t, err)
+		if res == proto.Error(msgClusterDown) {
+			break
+		}
+		equals(t, proto.String("bar"), res)
+	}
+	ok(t, <-done)
+
+	equals(t, promoted, tc.ForKey("foo"))
+	equals(t, []*Miniredis{promoted, old}, tc.Shards[1])
+	mustDo(t, c,
+		"GET", "foo",
+		proto.Error("MOVED 12182 "+promoted.Addr()),
+	)
+	mustDo(t, c,
+		"FLUSHALL",
+		proto.Error(DenyReadonly),
+	)
+
+	pc, err := proto.Dial(promoted.Addr())
+	ok(t, err)
+	defer pc.Close()
+	mustDo(t, pc, "GET", "foo", proto.String("bar"))
+	mustOK(t, pc, "SET", "foo", "baz")
+	v, err := old.Get("foo")
+	ok(t, err)
+	equals(t, "baz", v)
+
+	id := promoted.Cluster().MyID()
+	mustContain(t, pc,
+		"CLUSTER", "NODES",
+		id+" "+promoted.Addr()+"@",
+		" myself,master - 0 0 3 connected 8192-16383\n",
+		" slave "+id+" 0 0 3 connected\n",
+	)
+
+	mustFail(t, tc.Failover(2), "no such shard")
+	tc.FailoverDown = 0
+	ok(t, tc.Failover(1))
+	equals(t, old, tc.ForKey("foo"))
+}
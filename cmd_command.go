@@ -2,13 +2,62 @@
 
 package miniredis
 
-import "github.com/alicebob/miniredis/v2/server"
+import (
+	"sort"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
 
 func (m *Miniredis) cmdCommand(c *server.Peer, cmd string, args []string) {
-	// Got from redis 5.0.7 with
-	// echo 'COMMAND' | nc redis_addr redis_port
-	//
-	res := `
+	if len(args) > 0 && strings.ToUpper(args[0]) == "DOCS" {
+		m.cmdCommandDocs(c, args[1:])
+		return
+	}
+	c.WriteBulk(commandsReply)
+}
+
+// COMMAND DOCS
+// We don't have the summaries &c., only whether commands are deprecated.
+func (m *Miniredis) cmdCommandDocs(c *server.Peer, names []string) {
+	var cmds []string
+	if len(names) == 0 {
+		for name := range commandSpecs() {
+			cmds = append(cmds, name)
+		}
+		sort.Strings(cmds)
+	}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := commandSpecs()[name]; ok {
+			cmds = append(cmds, name)
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteMapLen(len(cmds))
+		for _, name := range cmds {
+			c.WriteBulk(name)
+			replacement, ok := deprecatedCommands[strings.ToUpper(name)]
+			if !ok {
+				c.WriteMapLen(0)
+				continue
+			}
+			c.WriteMapLen(2)
+			c.WriteBulk("doc_flags")
+			c.WriteSetLen(1)
+			c.WriteInline("deprecated")
+			c.WriteBulk("replaced_by")
+			c.WriteBulk(replacement)
+		}
+	})
+}
+
+// Got from redis 5.0.7 with
+// echo 'COMMAND' | nc redis_addr redis_port
+//
+// Also used by commandSpecs().
+const commandsReply = `
 *200
 *6
 $12
@@ -582,7 +631,7 @@ touch
 +readonly
 +fast
 :1
-:1
+:-1
 :1
 *6
 $6
@@ -2039,7 +2088,5 @@ expire
 :1
 :1
 :1
-	`
 
-	c.WriteBulk(res)
-}
+	`
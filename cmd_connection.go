@@ -4,13 +4,16 @@ package miniredis
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
 
 func commandsConnection(m *Miniredis) {
 	m.srv.Register("AUTH", m.cmdAuth)
+	m.srv.Register("CLIENT", m.cmdClient)
 	m.srv.Register("ECHO", m.cmdEcho)
 	m.srv.Register("HELLO", m.cmdHello)
 	m.srv.Register("PING", m.cmdPing)
@@ -92,44 +95,37 @@ func (m *Miniredis) cmdAuth(c *server.Peer, cmd string, args []string) {
 			c.WriteError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
 			return
 		}
-		setPW, ok := m.passwords[opts.username]
-		if !ok {
-			c.WriteError("WRONGPASS invalid username-password pair")
-			return
-		}
-		if setPW != opts.password {
-			c.WriteError("WRONGPASS invalid username-password pair")
+		if !m.authenticate(ctx, opts.username, opts.password) {
+			m.aclLogAdd(c, "auth", "AUTH", opts.username)
+			c.WriteError(msgWrongPass)
 			return
 		}
-
-		ctx.authenticated = true
 		c.WriteOK()
 	})
 }
 
 // HELLO
 func (m *Miniredis) cmdHello(c *server.Peer, cmd string, args []string) {
-	if len(args) < 1 {
-		c.WriteError(errWrongNumber(cmd))
-		return
-	}
-
 	var opts struct {
 		version  int
 		username string
 		password string
+		name     string
+		setName  bool
 	}
 
-	if ok := optIntErr(c, args[0], &opts.version, "ERR Protocol version is not an integer or out of range"); !ok {
-		return
-	}
-	args = args[1:]
+	if len(args) > 0 {
+		if ok := optIntErr(c, args[0], &opts.version, "ERR Protocol version is not an integer or out of range"); !ok {
+			return
+		}
+		args = args[1:]
 
-	switch opts.version {
-	case 2, 3:
-	default:
-		c.WriteError("NOPROTO unsupported protocol version")
-		return
+		switch opts.version {
+		case 2, 3:
+		default:
+			c.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
 	}
 
 	var checkAuth bool
@@ -147,49 +143,88 @@ func (m *Miniredis) cmdHello(c *server.Peer, cmd string, args []string) {
 				c.WriteError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[0]))
 				return
 			}
-			_, args = args[1], args[2:]
+			opts.name, opts.setName, args = args[1], true, args[2:]
 		default:
 			c.WriteError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[0]))
 			return
 		}
 	}
 
+	ctx := getCtx(c)
+	if ctx.nested {
+		c.WriteError(msgNotFromScripts(ctx.nestedSHA))
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
 	if len(m.passwords) == 0 && opts.username == "default" {
 		// redis ignores legacy "AUTH" if it's not enabled.
 		checkAuth = false
 	}
 	if checkAuth {
-		setPW, ok := m.passwords[opts.username]
-		if !ok {
-			c.WriteError("WRONGPASS invalid username-password pair")
+		if !m.authenticate(ctx, opts.username, opts.password) {
+			m.aclLogAdd(c, "auth", "AUTH", opts.username)
+			c.WriteError(msgWrongPass)
 			return
 		}
-		if setPW != opts.password {
-			c.WriteError("WRONGPASS invalid username-password pair")
+	}
+	if m.authRequired(ctx) {
+		c.WriteError(msgHelloNoAuth)
+		return
+	}
+	if opts.setName {
+		if !validClientName(opts.name) {
+			c.WriteError(msgInvalidClientName)
 			return
 		}
-		getCtx(c).authenticated = true
+		ctx.name = opts.name
 	}
 
-	c.Resp3 = opts.version == 3
+	if opts.version != 0 {
+		c.Resp3 = opts.version == 3
+	}
+	version := 2
+	if c.Resp3 {
+		version = 3
+	}
+	mode := "standalone"
+	if m.cluster != nil {
+		mode = "cluster"
+	}
+	role := "master"
+	if m.master != nil {
+		role = "replica"
+	}
 
 	c.WriteMapLen(7)
 	c.WriteBulk("server")
-	c.WriteBulk("miniredis")
+	c.WriteBulk(m.serverName())
 	c.WriteBulk("version")
-	c.WriteBulk("6.0.5")
+	c.WriteBulk(m.redisVersion())
 	c.WriteBulk("proto")
-	c.WriteInt(opts.version)
+	c.WriteInt(version)
 	c.WriteBulk("id")
-	c.WriteInt(42)
+	c.WriteInt(c.ID())
 	c.WriteBulk("mode")
-	c.WriteBulk("standalone")
+	c.WriteBulk(mode)
 	c.WriteBulk("role")
-	c.WriteBulk("master")
+	c.WriteBulk(role)
 	c.WriteBulk("modules")
 	c.WriteLen(0)
 }
 
+// validClientName checks for the characters redis allows in client names.
+func validClientName(name string) bool {
+	for _, r := range name {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
 // ECHO
 func (m *Miniredis) cmdEcho(c *server.Peer, cmd string, args []string) {
 	if len(args) != 1 {
@@ -230,7 +265,7 @@ func (m *Miniredis) cmdSelect(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		if opts.id < 0 {
+		if !m.validDB(opts.id) {
 			c.WriteError(msgDBIndexOutOfRange)
 			setDirty(c)
 			return
@@ -265,7 +300,7 @@ func (m *Miniredis) cmdSwapdb(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		if opts.id1 < 0 || opts.id2 < 0 {
+		if !m.validDB(opts.id1) || !m.validDB(opts.id2) {
 			c.WriteError(msgDBIndexOutOfRange)
 			setDirty(c)
 			return
@@ -283,3 +318,303 @@ func (m *Miniredis) cmdQuit(c *server.Peer, cmd string, args []string) {
 	c.WriteOK()
 	c.Close()
 }
+
+// CLIENT
+func (m *Miniredis) cmdClient(c *server.Peer, cmd string, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	subCmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subCmd {
+	case "ID":
+		m.cmdClientID(c, args)
+	case "KILL":
+		m.cmdClientKill(c, args)
+	case "TRACKING":
+		m.cmdClientTracking(c, args)
+	case "CACHING":
+		m.cmdClientCaching(c, args)
+	case "GETREDIR":
+		m.cmdClientGetredir(c, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", subCmd))
+	}
+}
+
+// CLIENT KILL
+func (m *Miniredis) cmdClientKill(c *server.Peer, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError("ERR unknown subcommand or wrong number of arguments for 'KILL'. Try CLIENT HELP.")
+		return
+	}
+
+	if len(args) == 1 {
+		// old style: CLIENT KILL addr:port
+		addr := args[0]
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			if m.killClients(c, ClientFilter{Addr: addr}, false) == 0 {
+				c.WriteError("ERR No such client")
+				return
+			}
+			c.WriteOK()
+		})
+		return
+	}
+
+	var (
+		filter ClientFilter
+		skipme = true
+	)
+	for len(args) > 0 {
+		if len(args) < 2 {
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+		opt, v := strings.ToUpper(args[0]), args[1]
+		args = args[2:]
+		switch opt {
+		case "ID":
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				setDirty(c)
+				c.WriteError("ERR client-id should be greater than 0")
+				return
+			}
+			filter.ID = id
+		case "ADDR":
+			filter.Addr = v
+		case "LADDR":
+			filter.LAddr = v
+		case "USER":
+			filter.User = v
+		case "TYPE":
+			t := strings.ToLower(v)
+			if t == "slave" {
+				t = "replica"
+			}
+			switch t {
+			case "normal", "pubsub", "replica", "master":
+			default:
+				setDirty(c)
+				c.WriteError(fmt.Sprintf("ERR Unknown client type '%s'", v))
+				return
+			}
+			filter.Type = t
+		case "MAXAGE":
+			var age int
+			if ok := optInt(c, v, &age); !ok {
+				return
+			}
+			filter.MaxAge = time.Duration(age) * time.Second
+		case "SKIPME":
+			switch strings.ToLower(v) {
+			case "yes":
+				skipme = true
+			case "no":
+				skipme = false
+			default:
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if filter.User != "" && !m.userExists(filter.User) {
+			c.WriteError(fmt.Sprintf("ERR No such user '%s'", filter.User))
+			return
+		}
+		c.WriteInt(m.killClients(c, filter, skipme))
+	})
+}
+
+// CLIENT ID
+func (m *Miniredis) cmdClientID(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|id"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteInt(c.ID())
+	})
+}
+
+// CLIENT TRACKING
+func (m *Miniredis) cmdClientTracking(c *server.Peer, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|tracking"))
+		return
+	}
+
+	var (
+		onOff = strings.ToLower(args[0])
+		opts  tracking
+	)
+	for args = args[1:]; len(args) > 0; args = args[1:] {
+		switch strings.ToUpper(args[0]) {
+		case "REDIRECT":
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			if opts.redirect != 0 {
+				setDirty(c)
+				c.WriteError("ERR A client can only redirect to a single other client")
+				return
+			}
+			id, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			opts.redirect = id
+			args = args[1:]
+		case "PREFIX":
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			opts.prefixes = append(opts.prefixes, args[1])
+			args = args[1:]
+		case "BCAST":
+			opts.bcast = true
+		case "OPTIN":
+			opts.optin = true
+		case "OPTOUT":
+			opts.optout = true
+		case "NOLOOP":
+			opts.noloop = true
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+	if onOff != "on" && onOff != "off" {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if opts.redirect != 0 && m.peer(opts.redirect) == nil {
+			c.WriteError("ERR The client ID you want redirect to does not exist")
+			return
+		}
+		if onOff == "off" {
+			m.stopTracking(c)
+			c.WriteOK()
+			return
+		}
+
+		if !opts.bcast && len(opts.prefixes) > 0 {
+			c.WriteError("ERR PREFIX option requires BCAST mode to be enabled")
+			return
+		}
+		old, on := m.trackers[c]
+		if on && old.bcast != opts.bcast {
+			c.WriteError("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+			return
+		}
+		if opts.bcast && (opts.optin || opts.optout) {
+			c.WriteError("ERR OPTIN and OPTOUT are not compatible with BCAST")
+			return
+		}
+		if opts.optin && opts.optout {
+			c.WriteError("ERR You can't use both OPTIN and OPTOUT")
+			return
+		}
+		if on && (opts.optin && old.optout || opts.optout && old.optin) {
+			c.WriteError("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+			return
+		}
+		if opts.bcast {
+			var existing []string
+			if on {
+				existing = old.prefixes
+			}
+			if msg := prefixOverlap(existing, opts.prefixes); msg != "" {
+				c.WriteError(msg)
+				return
+			}
+		}
+		m.startTracking(c, &opts)
+		c.WriteOK()
+	})
+}
+
+// CLIENT CACHING
+func (m *Miniredis) cmdClientCaching(c *server.Peer, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|caching"))
+		return
+	}
+	yesNo := strings.ToLower(args[0])
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		t, ok := m.trackers[c]
+		if !ok {
+			c.WriteError("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+			return
+		}
+		switch yesNo {
+		case "yes":
+			if !t.optin {
+				c.WriteError("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+				return
+			}
+		case "no":
+			if !t.optout {
+				c.WriteError("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+				return
+			}
+		default:
+			c.WriteError(msgSyntaxError)
+			return
+		}
+		t.caching = yesNo
+		c.WriteOK()
+	})
+}
+
+// CLIENT GETREDIR
+func (m *Miniredis) cmdClientGetredir(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|getredir"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		t, ok := m.trackers[c]
+		if !ok {
+			c.WriteInt(-1)
+			return
+		}
+		c.WriteInt(t.redirect)
+	})
+}
@@ -1,7 +1,10 @@
 package miniredis
 
 import (
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -70,6 +73,69 @@ func TestAuth(t *testing.T) {
 		)
 	})
 
+	t.Run("state", func(t *testing.T) {
+		s, err := Run()
+		ok(t, err)
+		defer s.Close()
+		s.RequireAuth("secret")
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		// everything needs auth, including commands which don't check
+		// anything themselves
+		mustDo(t, c,
+			"XGROUP", "CREATE", "planets", "processing", "$",
+			proto.Error(msgNoAuth),
+		)
+		mustDo(t, c,
+			"MULTI",
+			proto.Error(msgNoAuth),
+		)
+		mustDo(t, c,
+			"HELLO", "2",
+			proto.Error(msgHelloNoAuth),
+		)
+		mustDo(t, c,
+			"HELLO", "2", "AUTH", "default", "wrong",
+			proto.Error(msgWrongPass),
+		)
+		mustDo(t, c,
+			"GET", "foo",
+			proto.Error(msgNoAuth),
+		)
+
+		mustOK(t, c, "AUTH", "secret")
+		mustNil(t, c, "GET", "foo")
+
+		// a failed AUTH doesn't undo the earlier one
+		mustDo(t, c,
+			"AUTH", "wrong",
+			proto.Error(msgWrongPass),
+		)
+		mustNil(t, c, "GET", "foo")
+
+		// other connections start unauthenticated
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2,
+			"GET", "foo",
+			proto.Error(msgNoAuth),
+		)
+		mustContain(t, c2,
+			"HELLO", "2", "AUTH", "default", "secret",
+			"miniredis",
+		)
+		mustNil(t, c2, "GET", "foo")
+		mustOK(t, c2, "QUIT")
+
+		c3, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c3.Close()
+		mustOK(t, c3, "QUIT")
+	})
+
 	t.Run("error cases", func(t *testing.T) {
 		s, err := Run()
 		ok(t, err)
@@ -291,7 +357,7 @@ func TestHello(t *testing.T) {
 			proto.String("server"), proto.String("miniredis"),
 			proto.String("version"), proto.String("6.0.5"),
 			proto.String("proto"), proto.Int(3),
-			proto.String("id"), proto.Int(42),
+			proto.String("id"), proto.Int(1),
 			proto.String("mode"), proto.String("standalone"),
 			proto.String("role"), proto.String("master"),
 			proto.String("modules"), proto.Array(),
@@ -316,10 +382,16 @@ func TestHello(t *testing.T) {
 			payl,
 		)
 
+		// no version: keep the current protocol
+		mustDo(t, c,
+			"HELLO",
+			payl,
+		)
+
 		t.Run("errors", func(t *testing.T) {
 			mustDo(t, c,
-				"HELLO",
-				proto.Error(errWrongNumber("HELLO")),
+				"HELLO", "3", "SETNAME", "santa claus",
+				proto.Error(msgInvalidClientName),
 			)
 			mustDo(t, c,
 				"HELLO", "foo",
@@ -335,4 +407,391 @@ func TestHello(t *testing.T) {
 			)
 		})
 	})
+
+	t.Run("RESP2", func(t *testing.T) {
+		s, err := Run()
+		ok(t, err)
+		defer s.Close()
+		s.RequireUserAuth("alice", "secret")
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustDo(t, c,
+			"HELLO", "2", "AUTH", "alice", "secret", "SETNAME", "rudolph",
+			proto.Array(
+				proto.String("server"), proto.String("miniredis"),
+				proto.String("version"), proto.String("6.0.5"),
+				proto.String("proto"), proto.Int(2),
+				proto.String("id"), proto.Int(1),
+				proto.String("mode"), proto.String("standalone"),
+				proto.String("role"), proto.String("master"),
+				proto.String("modules"), proto.Array(),
+			),
+		)
+		mustDo(t, c,
+			"AUTH", "alice", "wrong",
+			proto.Error(msgWrongPass),
+		)
+		assert(t, strings.Contains(s.ACLLog()[0].ClientInfo, " name=rudolph "), "client name")
+
+		s.Cluster()
+		mustContain(t, c,
+			"HELLO",
+			"cluster",
+		)
+	})
+}
+
+func TestClientKill(t *testing.T) {
+	s := RunT(t)
+	s.RequireUserAuth("user", "pw")
+	dial := func(t *testing.T) *proto.Client {
+		t.Helper()
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		t.Cleanup(func() { c.Close() })
+		mustOK(t, c, "AUTH", "user", "pw")
+		return c
+	}
+	gone := func(t *testing.T, c *proto.Client) {
+		t.Helper()
+		_, err := c.Do("PING")
+		assert(t, err != nil, "connection is closed")
+	}
+
+	t.Run("id", func(t *testing.T) {
+		c1 := dial(t)
+		c2 := dial(t)
+		cs := s.ActiveConnections()
+		mustDo(t, c1, "CLIENT", "KILL", "ID", strconv.Itoa(cs[len(cs)-1].ID), proto.Int(1))
+		gone(t, c2)
+		mustDo(t, c1, "CLIENT", "KILL", "ID", "12345", proto.Int(0))
+	})
+
+	t.Run("addr", func(t *testing.T) {
+		c1 := dial(t)
+		c2 := dial(t)
+		cs := s.ActiveConnections()
+		mustOK(t, c1, "CLIENT", "KILL", cs[len(cs)-1].Addr)
+		gone(t, c2)
+		mustDo(t, c1, "CLIENT", "KILL", "1.2.3.4:5", proto.Error("ERR No such client"))
+	})
+
+	t.Run("laddr and skipme", func(t *testing.T) {
+		c1 := dial(t)
+		dial(t)
+		mustDo(t, c1, "CLIENT", "KILL", "LADDR", "1.2.3.4:5", proto.Int(0))
+		n := len(s.ActiveConnections())
+		mustDo(t, c1, "CLIENT", "KILL", "LADDR", s.Addr(), "SKIPME", "no", proto.Int(n))
+		gone(t, c1)
+		equals(t, 0, len(s.ActiveConnections()))
+	})
+
+	t.Run("type", func(t *testing.T) {
+		c1 := dial(t)
+		sub := dial(t)
+		mustDo(t, sub, "SUBSCRIBE", "ch", proto.Array(proto.String("subscribe"), proto.String("ch"), proto.Int(1)))
+		mustDo(t, c1, "CLIENT", "KILL", "TYPE", "replica", proto.Int(0))
+		mustDo(t, c1, "CLIENT", "KILL", "TYPE", "pubsub", proto.Int(1))
+		gone(t, sub)
+		mustDo(t, c1, "CLIENT", "KILL", "TYPE", "normal", "SKIPME", "yes", proto.Int(0))
+	})
+
+	t.Run("user", func(t *testing.T) {
+		c1 := dial(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2, "PING", proto.Error(msgNoAuth))
+		mustDo(t, c1, "CLIENT", "KILL", "USER", "default", proto.Int(1))
+		gone(t, c2)
+		mustDo(t, c1, "CLIENT", "KILL", "USER", "nosuch", proto.Error("ERR No such user 'nosuch'"))
+	})
+
+	t.Run("maxage", func(t *testing.T) {
+		c1 := dial(t)
+		mustDo(t, c1, "CLIENT", "KILL", "MAXAGE", "100", "SKIPME", "no", proto.Int(0))
+		time.Sleep(10 * time.Millisecond)
+		equals(t, 0, s.KillClients(ClientFilter{MaxAge: time.Hour}))
+		equals(t, 1, s.KillClients(ClientFilter{MaxAge: 5 * time.Millisecond}))
+		gone(t, c1)
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		c1 := dial(t)
+		c2 := dial(t)
+		go c2.Do("BLPOP", "nosuch", "0")
+		for i := 0; i < 100; i++ {
+			cs := s.ActiveConnections()
+			if len(cs) == 2 && cs[1].Blocked {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		mustDo(t, c1, "CLIENT", "KILL", "TYPE", "normal", proto.Int(1))
+		gone(t, c2)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		c := dial(t)
+		mustDo(t, c, "CLIENT", proto.Error(errWrongNumber("client")))
+		mustDo(t, c, "CLIENT", "FOO", proto.Error("ERR unknown subcommand 'FOO'. Try CLIENT HELP."))
+		mustDo(t, c, "CLIENT", "KILL", proto.Error("ERR unknown subcommand or wrong number of arguments for 'KILL'. Try CLIENT HELP."))
+		mustDo(t, c, "CLIENT", "KILL", "ID", "1", "TYPE", proto.Error(msgSyntaxError))
+		mustDo(t, c, "CLIENT", "KILL", "ID", "0", proto.Error("ERR client-id should be greater than 0"))
+		mustDo(t, c, "CLIENT", "KILL", "TYPE", "foo", proto.Error("ERR Unknown client type 'foo'"))
+		mustDo(t, c, "CLIENT", "KILL", "MAXAGE", "foo", proto.Error(msgInvalidInt))
+		mustDo(t, c, "CLIENT", "KILL", "SKIPME", "maybe", proto.Error(msgSyntaxError))
+		mustDo(t, c, "CLIENT", "KILL", "FOO", "bar", proto.Error(msgSyntaxError))
+	})
+}
+
+func TestClientTracking(t *testing.T) {
+	s := RunT(t)
+	dial := func(t *testing.T, resp3 bool) *proto.Client {
+		t.Helper()
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		t.Cleanup(func() { c.Close() })
+		if resp3 {
+			useRESP3(t, c)
+		}
+		return c
+	}
+	// pushes gets the push messages which came in, via a PING.
+	pushes := func(t *testing.T, c *proto.Client) []string {
+		t.Helper()
+		res, err := c.Do("PING")
+		ok(t, err)
+		var ps []string
+		for res != proto.Inline("PONG") {
+			ps = append(ps, res)
+			res, err = c.Read()
+			ok(t, err)
+		}
+		return ps
+	}
+	invalidate := func(keys ...string) string {
+		return proto.Push(proto.String("invalidate"), proto.Strings(keys...))
+	}
+
+	t.Run("default", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c1, "GET", "k", proto.NilResp3)
+		mustOK(t, c2, "SET", "k", "v")
+		equals(t, []string{invalidate("k")}, pushes(t, c1))
+
+		// only once, until the next read
+		mustOK(t, c2, "SET", "k", "v")
+		equals(t, []string(nil), pushes(t, c1))
+
+		// writes of the connection itself count too
+		mustDo(t, c1, "GET", "k", proto.String("v"))
+		mustOK(t, c1, "SET", "k", "v2")
+		equals(t, []string{invalidate("k")}, pushes(t, c1))
+
+		// not tracked
+		mustOK(t, c1, "SET", "other", "v")
+		equals(t, []string(nil), pushes(t, c1))
+
+		mustDo(t, c1, "MGET", "k", "k2", proto.Array(proto.String("v2"), proto.NilResp3))
+		s.Set("k2", "v") // Go methods count too
+		equals(t, []string{invalidate("k2")}, pushes(t, c1))
+
+		mustOK(t, c1, "CLIENT", "TRACKING", "OFF")
+		mustDo(t, c1, "GET", "k", proto.String("v2"))
+		mustOK(t, c2, "SET", "k", "v")
+		equals(t, []string(nil), pushes(t, c1))
+	})
+
+	t.Run("noloop", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON", "NOLOOP")
+		mustDo(t, c1, "GET", "n", proto.NilResp3)
+		mustOK(t, c1, "SET", "n", "v")
+		equals(t, []string(nil), pushes(t, c1))
+		// the write still ended the tracking of the key
+		mustOK(t, c2, "SET", "n", "v")
+		equals(t, []string(nil), pushes(t, c1))
+
+		mustDo(t, c1, "GET", "n", proto.String("v"))
+		mustOK(t, c2, "SET", "n", "v2")
+		equals(t, []string{invalidate("n")}, pushes(t, c1))
+
+		// the same in a MULTI, and in a script
+		mustDo(t, c1, "GET", "n", proto.String("v2"))
+		mustOK(t, c1, "MULTI")
+		mustDo(t, c1, "SET", "n", "v3", proto.Inline("QUEUED"))
+		mustDo(t, c1, "EXEC", proto.Array(proto.Inline("OK")))
+		mustDo(t, c1, "GET", "n", proto.String("v3"))
+		mustDo(t, c1, "EVAL", "return redis.call('SET', KEYS[1], 'v4')", "1", "n", proto.Inline("OK"))
+		equals(t, []string(nil), pushes(t, c1))
+	})
+
+	t.Run("getex", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		s.Set("g", "v")
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c1, "GET", "g", proto.String("v"))
+
+		// no change
+		mustDo(t, c2, "GETEX", "g", proto.String("v"))
+		mustDo(t, c2, "GETEX", "g", "PERSIST", proto.String("v"))
+		equals(t, []string(nil), pushes(t, c1))
+
+		mustDo(t, c2, "GETEX", "g", "EX", "10", proto.String("v"))
+		equals(t, []string{invalidate("g")}, pushes(t, c1))
+
+		mustDo(t, c1, "GET", "g", proto.String("v"))
+		mustDo(t, c2, "GETEX", "g", "PERSIST", proto.String("v"))
+		equals(t, []string{invalidate("g")}, pushes(t, c1))
+
+		// GETEX isn't a read
+		mustDo(t, c1, "GETEX", "g", proto.String("v"))
+		mustOK(t, c2, "SET", "g", "v")
+		equals(t, []string(nil), pushes(t, c1))
+	})
+
+	t.Run("bcast", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "b", "PREFIX", "a")
+		mustOK(t, c2, "MULTI")
+		mustDo(t, c2, "SET", "a1", "v", proto.Inline("QUEUED"))
+		mustDo(t, c2, "SET", "b1", "v", proto.Inline("QUEUED"))
+		mustDo(t, c2, "SET", "c1", "v", proto.Inline("QUEUED"))
+		mustDo(t, c2, "SET", "a2", "v", proto.Inline("QUEUED"))
+		mustDo(t, c2, "SET", "a1", "v2", proto.Inline("QUEUED"))
+		mustContain(t, c2, "EXEC", "OK")
+		equals(t, []string{invalidate("a1", "a2"), invalidate("b1")}, pushes(t, c1))
+
+		// not only once
+		mustOK(t, c2, "SET", "a1", "v")
+		equals(t, []string{invalidate("a1")}, pushes(t, c1))
+
+		// more prefixes
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "c", "NOLOOP")
+		mustOK(t, c1, "SET", "c2", "v")
+		mustOK(t, c2, "SET", "c1", "v")
+		equals(t, []string{invalidate("c1")}, pushes(t, c1))
+
+		c3 := dial(t, true)
+		mustOK(t, c3, "CLIENT", "TRACKING", "ON", "BCAST")
+		mustOK(t, c2, "SET", "foo", "v")
+		equals(t, []string{invalidate("foo")}, pushes(t, c3))
+		mustDo(t, c3, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "x",
+			proto.Error("ERR Prefix 'x' overlaps with an existing prefix ''. Prefixes for a single client must not overlap."),
+		)
+	})
+
+	t.Run("optin and optout", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON", "OPTIN")
+		mustDo(t, c1, "GET", "o", proto.NilResp3)
+		mustOK(t, c2, "SET", "o", "v")
+		equals(t, []string(nil), pushes(t, c1))
+
+		mustOK(t, c1, "CLIENT", "CACHING", "YES")
+		mustDo(t, c1, "GET", "o", proto.String("v"))
+		mustDo(t, c1, "GET", "o2", proto.NilResp3) // CACHING is only for the next command
+		mustOK(t, c2, "MSET", "o", "v", "o2", "v")
+		equals(t, []string{invalidate("o")}, pushes(t, c1))
+
+		c3 := dial(t, true)
+		mustOK(t, c3, "CLIENT", "TRACKING", "ON", "OPTOUT")
+		mustOK(t, c3, "CLIENT", "CACHING", "NO")
+		mustDo(t, c3, "GET", "o", proto.String("v"))
+		mustDo(t, c3, "GET", "o2", proto.String("v"))
+		mustOK(t, c2, "MSET", "o", "v", "o2", "v")
+		equals(t, []string{invalidate("o2")}, pushes(t, c3))
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		c1, c2 := dial(t, true), dial(t, true)
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON")
+		mustOK(t, c2, "SET", "f", "v")
+		mustDo(t, c1, "GET", "f", proto.String("v"))
+		mustOK(t, c2, "FLUSHALL")
+		equals(t, []string{proto.Push(proto.String("invalidate"), proto.NilResp3)}, pushes(t, c1))
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		c1, c2, sub := dial(t, false), dial(t, false), dial(t, false)
+		id, err := sub.Do("CLIENT", "ID")
+		ok(t, err)
+		id = strings.Trim(id, ":\r\n")
+		mustDo(t, sub, "SUBSCRIBE", "__redis__:invalidate",
+			proto.Array(proto.String("subscribe"), proto.String("__redis__:invalidate"), proto.Int(1)),
+		)
+
+		mustDo(t, c1, "CLIENT", "GETREDIR", proto.Int(-1))
+		mustOK(t, c1, "CLIENT", "TRACKING", "ON", "REDIRECT", id)
+		mustDo(t, c1, "CLIENT", "GETREDIR", ":"+id+"\r\n")
+		mustNil(t, c1, "GET", "r")
+		mustOK(t, c2, "SET", "r", "v")
+		res, err := sub.Read()
+		ok(t, err)
+		equals(t, proto.Array(proto.String("message"), proto.String("__redis__:invalidate"), proto.Strings("r")), res)
+
+		mustDo(t, c1, "CLIENT", "TRACKING", "ON", "REDIRECT", "12345",
+			proto.Error("ERR The client ID you want redirect to does not exist"),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		c := dial(t, true)
+		mustDo(t, c, "CLIENT", "TRACKING",
+			proto.Error("ERR wrong number of arguments for 'client|tracking' command"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "MAYBE",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "FOO",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "PREFIX",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "REDIRECT", "foo",
+			proto.Error(msgInvalidInt),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "PREFIX", "a",
+			proto.Error("ERR PREFIX option requires BCAST mode to be enabled"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "OPTIN",
+			proto.Error("ERR OPTIN and OPTOUT are not compatible with BCAST"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "OPTIN", "OPTOUT",
+			proto.Error("ERR You can't use both OPTIN and OPTOUT"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "foo", "PREFIX", "fo",
+			proto.Error("ERR Prefix 'foo' overlaps with another provided prefix 'fo'. Prefixes for a single client must not overlap."),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "YES",
+			proto.Error("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"),
+		)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "foo")
+		mustDo(t, c, "CLIENT", "TRACKING", "ON",
+			proto.Error("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode."),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "foobar",
+			proto.Error("ERR Prefix 'foobar' overlaps with an existing prefix 'foo'. Prefixes for a single client must not overlap."),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "YES",
+			proto.Error("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."),
+		)
+		mustOK(t, c, "CLIENT", "TRACKING", "OFF")
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "OPTIN")
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "OPTOUT",
+			proto.Error("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode."),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "NO",
+			proto.Error("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "MAYBE",
+			proto.Error(msgSyntaxError),
+		)
+	})
 }
@@ -4,7 +4,6 @@ package miniredis
 
 import (
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -59,14 +58,14 @@ func makeCmdExpire(m *Miniredis, unix bool, d time.Duration) func(*server.Peer,
 
 		var opts struct {
 			key   string
-			value int
+			value int64
 			nx    bool
 			xx    bool
 			gt    bool
 			lt    bool
 		}
 		opts.key = args[0]
-		if ok := optInt(c, args[1], &opts.value); !ok {
+		if ok := optExpire(c, cmd, args[1], d, unix, false, m.effectiveNow(), &opts.value); !ok {
 			return
 		}
 		args = args[2:]
@@ -107,13 +106,13 @@ func makeCmdExpire(m *Miniredis, unix bool, d time.Duration) func(*server.Peer,
 				return
 			}
 
-			oldTTL, ok := db.ttl[opts.key]
+			oldTTL, ok := db.ttl.get(opts.key)
 
 			var newTTL time.Duration
 			if unix {
 				newTTL = m.at(opts.value, d)
 			} else {
-				newTTL = time.Duration(opts.value) * d
+				newTTL = ttlDuration(opts.value, d)
 			}
 
 			// > NX -- Set expiry only when the key has no expiry
@@ -137,8 +136,8 @@ func makeCmdExpire(m *Miniredis, unix bool, d time.Duration) func(*server.Peer,
 				c.WriteInt(0)
 				return
 			}
-			db.ttl[opts.key] = newTTL
-			db.keyVersion[opts.key]++
+			db.ttl.set(opts.key, newTTL)
+			db.bump(opts.key)
 			db.checkTTL(opts.key)
 			c.WriteInt(1)
 		})
@@ -163,6 +162,12 @@ func (m *Miniredis) cmdTouch(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
+		// TOUCH is about access times, so from now on we keep them.
+		if !m.trackAccess {
+			m.trackAccess = true
+			db.touch(args)
+		}
+
 		count := 0
 		for _, key := range args {
 			if db.exists(key) {
@@ -198,7 +203,7 @@ func (m *Miniredis) cmdTTL(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		v, ok := db.ttl[key]
+		v, ok := db.ttl.get(key)
 		if !ok {
 			// no expire value
 			c.WriteInt(-1)
@@ -233,7 +238,7 @@ func (m *Miniredis) cmdPTTL(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		v, ok := db.ttl[key]
+		v, ok := db.ttl.get(key)
 		if !ok {
 			// no expire value
 			c.WriteInt(-1)
@@ -268,13 +273,13 @@ func (m *Miniredis) cmdPersist(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		if _, ok := db.ttl[key]; !ok {
+		if _, ok := db.ttl.get(key); !ok {
 			// no expire value
 			c.WriteInt(0)
 			return
 		}
-		delete(db.ttl, key)
-		db.keyVersion[key]++
+		db.ttl.del(key)
+		db.bump(key)
 		c.WriteInt(1)
 	})
 }
@@ -387,6 +392,10 @@ func (m *Miniredis) cmdMove(c *server.Peer, cmd string, args []string) {
 	opts.targetDB, _ = strconv.Atoi(args[1])
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if !m.validDB(opts.targetDB) {
+			c.WriteError(msgDBIndexOutOfRange)
+			return
+		}
 		if ctx.selectedDB == opts.targetDB {
 			c.WriteError("ERR source and destination objects are the same")
 			return
@@ -421,7 +430,7 @@ func (m *Miniredis) cmdKeys(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		keys, _ := matchKeys(db.allKeys(), key)
+		keys, _ := matchKeys(db.visibleKeys(ctx.tenant), key)
 		c.WriteLen(len(keys))
 		for _, s := range keys {
 			c.WriteBulk(s)
@@ -446,6 +455,16 @@ func (m *Miniredis) cmdRandomkey(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
+		if ctx.tenant != "" {
+			keys := db.tenantKeys(ctx.tenant)
+			if len(keys) == 0 {
+				c.WriteNull()
+				return
+			}
+			c.WriteBulk(keys[m.randIntn(len(keys))])
+			return
+		}
+
 		if len(db.keys) == 0 {
 			c.WriteNull()
 			return
@@ -551,14 +570,15 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 	}
 
 	var opts struct {
-		cursor    int
+		cursor    int64
+		count     int
 		withMatch bool
 		match     string
 		withType  bool
 		_type     string
 	}
 
-	if ok := optIntErr(c, args[0], &opts.cursor, msgInvalidCursor); !ok {
+	if ok := optCursor(c, args[0], &opts.cursor); !ok {
 		return
 	}
 	args = args[1:]
@@ -566,18 +586,24 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 	// MATCH, COUNT and TYPE options
 	for len(args) > 0 {
 		if strings.ToLower(args[0]) == "count" {
-			// we do nothing with count
+			// only used with DeterministicScan()
 			if len(args) < 2 {
 				setDirty(c)
 				c.WriteError(msgSyntaxError)
 				return
 			}
-			if _, err := strconv.Atoi(args[1]); err != nil {
+			count, err := strconv.Atoi(args[1])
+			if err != nil {
 				setDirty(c)
 				c.WriteError(msgInvalidInt)
 				return
 			}
-			args = args[2:]
+			if count < 1 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			opts.count, args = count, args[2:]
 			continue
 		}
 		if strings.ToLower(args[0]) == "match" {
@@ -607,9 +633,9 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		// We return _all_ (matched) keys every time.
+		// Unless DeterministicScan() we return _all_ (matched) keys every time.
 
-		if opts.cursor != 0 {
+		if opts.cursor != 0 && !m.stableScan {
 			// Invalid cursor.
 			c.WriteLen(2)
 			c.WriteBulk("0") // no next cursor
@@ -617,19 +643,26 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		var keys []string
+		keys := db.visibleKeys(ctx.tenant)
+		var next int64
+		if m.stableScan {
+			var err error
+			keys, next, err = m.scanPage(keys, opts.cursor, opts.count)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+		}
 
 		if opts.withType {
+			all := keys
 			keys = make([]string, 0)
-			for k, t := range db.keys {
+			for _, k := range all {
 				// type must be given exactly; no pattern matching is performed
-				if t == opts._type {
+				if db.t(ctx.tenant+k) == opts._type {
 					keys = append(keys, k)
 				}
 			}
-			sort.Strings(keys) // To make things deterministic.
-		} else {
-			keys = db.allKeys()
 		}
 
 		if opts.withMatch {
@@ -637,7 +670,7 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 		}
 
 		c.WriteLen(2)
-		c.WriteBulk("0") // no next cursor
+		c.WriteBulk(strconv.FormatInt(next, 10))
 		c.WriteLen(len(keys))
 		for _, k := range keys {
 			c.WriteBulk(k)
@@ -705,6 +738,10 @@ func (m *Miniredis) cmdCopy(c *server.Peer, cmd string, args []string) {
 		if toDB == -1 {
 			toDB = fromDB
 		}
+		if !m.validDB(toDB) {
+			c.WriteError(msgDBIndexOutOfRange)
+			return
+		}
 
 		if fromDB == toDB && opts.from == opts.to {
 			c.WriteError("ERR source and destination objects are the same")
@@ -93,6 +93,49 @@ func TestTTL(t *testing.T) {
 		must1(t, c, "EXPIRE", "wim", "-1200")
 		equals(t, false, s.Exists("wim"))
 	}
+
+	// Overflows
+	{
+		mustOK(t, c, "SET", "big", "bar")
+		mustDo(t, c,
+			"EXPIRE", "big", "9223372036854775807",
+			proto.Error(errInvalidExpireTime("expire")),
+		)
+		mustDo(t, c,
+			"EXPIRE", "big", "-9223372036854775807",
+			proto.Error(errInvalidExpireTime("expire")),
+		)
+		mustDo(t, c,
+			"PEXPIRE", "big", "9223372036854775807",
+			proto.Error(errInvalidExpireTime("pexpire")),
+		)
+		mustDo(t, c,
+			"EXPIREAT", "big", "9223372036854775807",
+			proto.Error(errInvalidExpireTime("expireat")),
+		)
+		mustDo(t, c,
+			"EXPIRE", "big", "9223372036854775808",
+			proto.Error(msgInvalidInt),
+		)
+		equals(t, time.Duration(0), s.TTL("big"))
+
+		// longer than a time.Duration, but fine for redis
+		must1(t, c, "EXPIRE", "big", "922337203685477")
+		assert(t, s.TTL("big") > 290*365*24*time.Hour, "huge TTL")
+		must1(t, c, "PEXPIREAT", "big", "9223372036854775807")
+		assert(t, s.TTL("big") > 290*365*24*time.Hour, "huge TTL")
+		s.FastForward(time.Hour)
+		equals(t, true, s.Exists("big"))
+
+		// the TTL plus the SetTime() time has to fit
+		s.SetTime(time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC))
+		mustDo(t, c,
+			"PEXPIRE", "big", "9223365000000000000",
+			proto.Error(errInvalidExpireTime("pexpire")),
+		)
+		s.SetTime(time.Time{})
+		must1(t, c, "PEXPIRE", "big", "9223365000000000000")
+	}
 }
 
 func TestExpireat(t *testing.T) {
@@ -131,6 +174,46 @@ func TestExpireat(t *testing.T) {
 	}
 }
 
+func TestSetExpireAt(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	now := time.Unix(1234567890, 0)
+	s.SetTime(now)
+
+	ok(t, s.SetWithTTL("foo", "bar", time.Minute))
+	mustDo(t, c, "TTL", "foo", proto.Int(60))
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	s.HSet("hash", "f", "v")
+	equals(t, ErrWrongType, s.SetWithTTL("hash", "bar", time.Minute))
+
+	s.SetExpireAt("foo", now.Add(90*time.Second))
+	mustDo(t, c, "TTL", "foo", proto.Int(90))
+	ttl, ok2 := s.TTLRemaining("foo")
+	equals(t, true, ok2)
+	equals(t, 90*time.Second, ttl)
+
+	s.FastForward(30 * time.Second)
+	ttl, _ = s.TTLRemaining("foo")
+	equals(t, time.Minute, ttl)
+
+	// no TTL, or no key
+	_, ok2 = s.TTLRemaining("hash")
+	equals(t, false, ok2)
+	_, ok2 = s.TTLRemaining("nosuch")
+	equals(t, false, ok2)
+	s.SetExpireAt("nosuch", now.Add(time.Hour))
+	equals(t, false, s.Exists("nosuch"))
+
+	// the past deletes the key
+	s.SetExpireAt("foo", now.Add(-time.Second))
+	equals(t, false, s.Exists("foo"))
+	ok(t, s.SetWithTTL("foo", "bar", 0))
+	equals(t, false, s.Exists("foo"))
+}
+
 func TestTouch(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -162,6 +245,31 @@ func TestTouch(t *testing.T) {
 		)
 	})
 
+	t.Run("duplicates", func(t *testing.T) {
+		mustDo(t, c,
+			"TOUCH", "foo", "foo", "nay", "nay",
+			proto.Int(2),
+		)
+	})
+
+	t.Run("access time", func(t *testing.T) {
+		s.SetTime(time.Unix(1234567890, 0))
+		mustOK(t, c, "SET", "t1", "v")
+		mustOK(t, c, "SET", "t2", "v")
+
+		later := time.Unix(1234567990, 0)
+		s.SetTime(later)
+		mustDo(t, c,
+			"TOUCH", "t1", "t2",
+			proto.Int(2),
+		)
+		for _, k := range []string{"t1", "t2"} {
+			ki, err := s.KeyInfo(k)
+			ok(t, err)
+			equals(t, later, ki.LastAccess)
+		}
+	})
+
 	t.Run("TTL unchanged", func(t *testing.T) {
 		mustOK(t, c, "SET", "foo", "bar", "EX", "100")
 
@@ -268,6 +376,15 @@ func TestDel(t *testing.T) {
 		equals(t, time.Duration(0), s.TTL("one"))
 	})
 
+	t.Run("duplicates", func(t *testing.T) {
+		s.Set("foo", "bar")
+		s.Set("bar", "baz")
+		mustDo(t, c,
+			"DEL", "foo", "foo", "bar", "nosuch", "nosuch",
+			proto.Int(2),
+		)
+	})
+
 	t.Run("failure cases", func(t *testing.T) {
 		mustDo(t, c,
 			"DEL",
@@ -305,6 +422,21 @@ func TestUnlink(t *testing.T) {
 		equals(t, time.Duration(0), s.TTL("one"))
 	})
 
+	t.Run("duplicates", func(t *testing.T) {
+		s.Set("foo", "bar")
+		mustDo(t, c,
+			"UNLINK", "foo", "foo", "nosuch",
+			proto.Int(1),
+		)
+	})
+
+	t.Run("failure cases", func(t *testing.T) {
+		mustDo(t, c,
+			"UNLINK",
+			proto.Error("ERR wrong number of arguments for 'unlink' command"),
+		)
+	})
+
 	t.Run("direct", func(t *testing.T) {
 		s.Set("foo", "bar")
 		s.Unlink("foo")
@@ -390,6 +522,12 @@ func TestExists(t *testing.T) {
 			"EXISTS", "foo", "noot", "aap",
 			proto.Int(2),
 		)
+
+		// duplicates are counted
+		mustDo(t, c,
+			"EXISTS", "foo", "foo", "noot", "noot",
+			proto.Int(2),
+		)
 	})
 
 	t.Run("nosuch keys", func(t *testing.T) {
@@ -562,13 +700,22 @@ func TestRename(t *testing.T) {
 		proto.Error("ERR no such key"),
 	)
 
+	t.Run("same key", func(t *testing.T) {
+		s.HSet("same", "field", "value")
+		s.SetTTL("same", time.Minute)
+		mustOK(t, c, "RENAME", "same", "same")
+		equals(t, "value", s.HGet("same", "field"))
+		equals(t, time.Minute, s.TTL("same"))
+		must1(t, c, "DEL", "same")
+	})
+
 	t.Run("string key", func(t *testing.T) {
 		s.Set("from", "value")
 		mustOK(t, c, "RENAME", "from", "to")
 		equals(t, false, s.Exists("from"))
 		equals(t, true, s.Exists("to"))
 		s.CheckGet(t, "to", "value")
-		_, ok := s.dbs[0].ttl["to"]
+		_, ok := s.dbs[0].ttl.get("to")
 		equals(t, ok, false)
 	})
 
@@ -578,7 +725,7 @@ func TestRename(t *testing.T) {
 		equals(t, false, s.Exists("from"))
 		equals(t, true, s.Exists("to"))
 		equals(t, "value", s.HGet("to", "key"))
-		_, ok := s.dbs[0].ttl["to"]
+		_, ok := s.dbs[0].ttl.get("to")
 		equals(t, ok, false)
 	})
 
@@ -588,7 +735,7 @@ func TestRename(t *testing.T) {
 		s.SetTTL("TTLto", time.Second*99999)
 		equals(t, time.Second*99999, s.TTL("TTLto"))
 		mustOK(t, c, "RENAME", "TTLfrom", "TTLto")
-		_, ok := s.dbs[0].ttl["TTLto"]
+		_, ok := s.dbs[0].ttl.get("TTLto")
 		equals(t, ok, false)
 	})
 
@@ -726,6 +873,14 @@ func TestScan(t *testing.T) {
 			"SCAN", "1", "COUNT", "noint",
 			proto.Error("ERR value is not an integer or out of range"),
 		)
+		mustDo(t, c,
+			"SCAN", "1", "COUNT", "0",
+			proto.Error("ERR syntax error"),
+		)
+		mustDo(t, c,
+			"SCAN", "1", "COUNT", "-3",
+			proto.Error("ERR syntax error"),
+		)
 		mustDo(t, c,
 			"SCAN", "1", "TYPE",
 			proto.Error("ERR syntax error"),
@@ -737,6 +892,70 @@ func TestScan(t *testing.T) {
 	})
 }
 
+func TestDeterministicScan(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.DeterministicScan(true)
+	for _, k := range []string{"k4", "k2", "k5", "k1", "k3", "other"} {
+		s.Set(k, "v")
+	}
+
+	mustDo(t, c, "SCAN", "0", "COUNT", "2",
+		proto.Array(proto.String("2"), proto.Strings("k1", "k2")))
+	mustDo(t, c, "SCAN", "2", "COUNT", "2",
+		proto.Array(proto.String("4"), proto.Strings("k3", "k4")))
+	mustDo(t, c, "SCAN", "4", "COUNT", "2",
+		proto.Array(proto.String("0"), proto.Strings("k5", "other")))
+	mustDo(t, c, "SCAN", "4", "COUNT", "1", "MATCH", "o*",
+		proto.Array(proto.String("5"), proto.Strings()))
+	mustDo(t, c, "SCAN", "99",
+		proto.Array(proto.String("0"), proto.Strings()))
+	// default COUNT is 10
+	mustDo(t, c, "SCAN", "0", "MATCH", "k*",
+		proto.Array(proto.String("0"), proto.Strings("k1", "k2", "k3", "k4", "k5")))
+
+	s.HSet("h", "f3", "c", "f1", "a", "f2", "b")
+	mustDo(t, c, "HSCAN", "h", "0", "COUNT", "2",
+		proto.Array(proto.String("2"), proto.Strings("f1", "a", "f2", "b")))
+	mustDo(t, c, "HSCAN", "h", "2", "COUNT", "2",
+		proto.Array(proto.String("0"), proto.Strings("f3", "c")))
+
+	s.SAdd("s", "c", "a", "b")
+	mustDo(t, c, "SSCAN", "s", "0", "COUNT", "2",
+		proto.Array(proto.String("2"), proto.Strings("a", "b")))
+	mustDo(t, c, "SSCAN", "s", "0", "COUNT", "2", "MATCH", "b",
+		proto.Array(proto.String("2"), proto.Strings("b")))
+
+	s.ZAdd("z", 3, "a")
+	s.ZAdd("z", 1, "b")
+	mustDo(t, c, "ZSCAN", "z", "0", "COUNT", "1",
+		proto.Array(proto.String("1"), proto.Strings("b", "1")))
+	mustDo(t, c, "ZSCAN", "z", "1", "COUNT", "1",
+		proto.Array(proto.String("0"), proto.Strings("a", "3")))
+
+	// a huge COUNT is the rest
+	huge := "9223372036854775807"
+	mustDo(t, c, "SCAN", "4", "COUNT", huge,
+		proto.Array(proto.String("0"), proto.Strings("k4", "k5", "other", "s", "z")))
+	mustDo(t, c, "HSCAN", "h", "1", "COUNT", huge,
+		proto.Array(proto.String("0"), proto.Strings("f2", "b", "f3", "c")))
+	mustDo(t, c, "SSCAN", "s", "1", "COUNT", huge,
+		proto.Array(proto.String("0"), proto.Strings("b", "c")))
+	mustDo(t, c, "ZSCAN", "z", "1", "COUNT", huge,
+		proto.Array(proto.String("0"), proto.Strings("a", "3")))
+
+	s.DeterministicScan(false)
+	mustDo(t, c, "SCAN", "0", "COUNT", "2", "MATCH", "k*",
+		proto.Array(proto.String("0"), proto.Strings("k1", "k2", "k3", "k4", "k5")))
+	mustDo(t, c, "SSCAN", "s", "1", "COUNT", huge,
+		proto.Array(proto.String("0"), proto.Strings("b", "c")))
+}
+
 func TestRenamenx(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -841,6 +1060,26 @@ func TestCopy(t *testing.T) {
 		equals(t, "string", s.Type("rkey2"))
 	})
 
+	t.Run("list", func(t *testing.T) {
+		mustDo(t, c, "RPUSH", "l1", "a", "b", "c", proto.Int(3))
+		must1(t, c, "COPY", "l1", "l2")
+		mustOK(t, c, "LSET", "l1", "0", "changed")
+		mustDo(t, c, "LRANGE", "l2", "0", "-1", proto.Strings("a", "b", "c"))
+		mustDo(t, c, "LRANGE", "l1", "0", "-1", proto.Strings("changed", "b", "c"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		for _, id := range []string{"1-1", "2-1", "3-1"} {
+			mustDo(t, c, "XADD", "st1", id, "k", "v", proto.String(id))
+		}
+		must1(t, c, "COPY", "st1", "st2")
+		mustDo(t, c, "XADD", "st1", "4-1", "k", "one", proto.String("4-1"))
+		mustDo(t, c, "XADD", "st2", "4-1", "k", "two", proto.String("4-1"))
+		mustDo(t, c, "XRANGE", "st1", "4-1", "+",
+			proto.Array(proto.Array(proto.String("4-1"), proto.Strings("k", "one"))),
+		)
+	})
+
 	t.Run("direct", func(t *testing.T) {
 		s.Set("d1", "value")
 		ok(t, s.Copy(0, "d1", 0, "d2"))
@@ -860,3 +1099,91 @@ func TestCopy(t *testing.T) {
 		)
 	})
 }
+
+func TestActiveExpire(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustOK(t, c, "DEBUG", "SET-ACTIVE-EXPIRE", "0")
+	mustOK(t, c, "SET", "foo", "bar", "EX", "10")
+	mustOK(t, c, "SET", "baz", "bar", "EX", "10")
+	mustOK(t, c, "SET", "keep", "bar")
+	equals(t, []ExpiredKey(nil), s.AdvanceClock(20*time.Second))
+
+	// expired, but still there
+	mustDo(t, c, "DBSIZE", proto.Int(3))
+	equals(t, []string{"baz", "foo", "keep"}, s.Keys())
+	mustDo(t, c, "KEYS", "*", proto.Strings("keep"))
+	mustDo(t, c, "SCAN", "0", proto.Array(proto.String("0"), proto.Strings("keep")))
+
+	// using a key removes it
+	mustDo(t, c, "EXISTS", "foo", proto.Int(0))
+	mustDo(t, c, "DBSIZE", proto.Int(2))
+	mustDo(t, c, "TTL", "foo", proto.Int(-2))
+	mustNil(t, c, "GET", "foo")
+
+	// switching back on sweeps the rest
+	s.SetActiveExpire(true)
+	mustDo(t, c, "DBSIZE", proto.Int(1))
+	equals(t, []string{"keep"}, s.Keys())
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c, "DEBUG", proto.Error(errWrongNumber("debug")))
+		mustDo(t, c, "DEBUG", "SET-ACTIVE-EXPIRE", proto.Error("ERR unknown subcommand or wrong number of arguments for 'SET-ACTIVE-EXPIRE'. Try DEBUG HELP."))
+		mustDo(t, c, "DEBUG", "SET-ACTIVE-EXPIRE", "foo", proto.Error(msgInvalidInt))
+		mustDo(t, c, "DEBUG", "SLEEP", "0", proto.Error("ERR unknown subcommand 'SLEEP'. Try DEBUG HELP."))
+	})
+}
+
+// replies for keys which don't exist: nil, nil array, or empty
+func TestMissingKeyReplies(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.XAdd("planets", "0-1", []string{"name", "Mercury"})
+	mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "$")
+
+	cases := []struct {
+		cmd          []string
+		resp2, resp3 string
+	}{
+		{[]string{"GET", "nosuch"}, proto.Nil, proto.NilResp3},
+		{[]string{"LPOP", "nosuch"}, proto.Nil, proto.NilResp3},
+		{[]string{"LPOP", "nosuch", "2"}, proto.NilList, proto.NilResp3},
+		{[]string{"LPOS", "nosuch", "a"}, proto.Nil, proto.NilResp3},
+		{[]string{"LPOS", "nosuch", "a", "COUNT", "0"}, proto.Strings(), proto.Strings()},
+		{[]string{"LRANGE", "nosuch", "0", "-1"}, proto.Strings(), proto.Strings()},
+		{[]string{"SPOP", "nosuch"}, proto.Nil, proto.NilResp3},
+		{[]string{"SPOP", "nosuch", "2"}, proto.Strings(), proto.Set()},
+		{[]string{"SINTER", "nosuch"}, proto.Strings(), proto.Set()},
+		{[]string{"SUNION", "nosuch"}, proto.Strings(), proto.Set()},
+		{[]string{"SRANDMEMBER", "nosuch", "2"}, proto.Strings(), proto.Strings()},
+		{[]string{"ZRANGE", "nosuch", "0", "-1"}, proto.Strings(), proto.Strings()},
+		{[]string{"ZSCORE", "nosuch", "a"}, proto.Nil, proto.NilResp3},
+		{[]string{"GEOPOS", "nosuch", "a"}, proto.Array(proto.NilList), proto.Array(proto.NilResp3)},
+		{[]string{"XRANGE", "nosuch", "-", "+"}, proto.Strings(), proto.Strings()},
+		{[]string{"XREAD", "STREAMS", "nosuch", "0"}, proto.NilList, proto.NilResp3},
+		{[]string{"XPENDING", "planets", "processing", "-", "+", "10"}, proto.Strings(), proto.Strings()},
+		{
+			[]string{"XPENDING", "planets", "processing"},
+			proto.Array(proto.Int(0), proto.Nil, proto.Nil, proto.NilList),
+			proto.Array(proto.Int(0), proto.NilResp3, proto.NilResp3, proto.NilResp3),
+		},
+	}
+	for _, resp := range []string{"2", "3"} {
+		_, err := c.Do("HELLO", resp)
+		ok(t, err)
+		for _, tc := range cases {
+			want := tc.resp2
+			if resp == "3" {
+				want = tc.resp3
+			}
+			args := append(tc.cmd, want)
+			mustDo(t, c, args...)
+		}
+	}
+}
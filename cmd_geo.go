@@ -40,7 +40,7 @@ func (m *Miniredis) cmdGeoadd(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(key) && db.t(key) != "zset" {
+		if db.wrongType(key, "zset") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
@@ -157,7 +157,7 @@ func (m *Miniredis) cmdGeopos(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(key) && db.t(key) != "zset" {
+		if db.wrongType(key, "zset") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
@@ -305,6 +305,10 @@ func (m *Miniredis) cmdGeoradius(c *server.Peer, cmd string, args []string) {
 		}
 
 		db := m.db(ctx.selectedDB)
+		if db.wrongType(key, "zset") {
+			c.WriteError(msgWrongType)
+			return
+		}
 		members := db.ssetElements(key)
 
 		matches := withinRadius(members, longitude, latitude, radius*toMeter)
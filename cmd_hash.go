@@ -53,7 +53,7 @@ func (m *Miniredis) cmdHset(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		if t, ok := db.keys[key]; ok && t != "hash" {
+		if db.wrongType(key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -90,7 +90,7 @@ func (m *Miniredis) cmdHsetnx(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "hash" {
+		if db.wrongType(opts.key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -104,8 +104,9 @@ func (m *Miniredis) cmdHsetnx(c *server.Peer, cmd string, args []string) {
 			c.WriteInt(0)
 			return
 		}
+		db.before(opts.key, opts.field)
 		db.hashKeys[opts.key][opts.field] = opts.value
-		db.keyVersion[opts.key]++
+		db.bump(opts.key)
 		c.WriteInt(1)
 	})
 }
@@ -134,7 +135,7 @@ func (m *Miniredis) cmdHmset(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "hash" {
+		if db.wrongType(key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -227,7 +228,9 @@ func (m *Miniredis) cmdHdel(c *server.Peer, cmd string, args []string) {
 			if !ok {
 				continue
 			}
+			db.before(opts.key, f)
 			delete(db.hashKeys[opts.key], f)
+			db.bump(opts.key)
 			deleted++
 		}
 		c.WriteInt(deleted)
@@ -478,7 +481,7 @@ func (m *Miniredis) cmdHmget(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "hash" {
+		if db.wrongType(key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -529,7 +532,7 @@ func (m *Miniredis) cmdHincrby(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "hash" {
+		if db.wrongType(opts.key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -565,7 +568,7 @@ func (m *Miniredis) cmdHincrbyfloat(c *server.Peer, cmd string, args []string) {
 		key:   args[0],
 		field: args[1],
 	}
-	delta, _, err := big.ParseFloat(args[2], 10, 128, 0)
+	delta, _, err := big.ParseFloat(args[2], 10, floatPrec, 0)
 	if err != nil {
 		setDirty(c)
 		c.WriteError(msgInvalidFloat)
@@ -576,7 +579,7 @@ func (m *Miniredis) cmdHincrbyfloat(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "hash" {
+		if db.wrongType(opts.key, "hash") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -606,13 +609,14 @@ func (m *Miniredis) cmdHscan(c *server.Peer, cmd string, args []string) {
 
 	opts := struct {
 		key       string
-		cursor    int
+		cursor    int64
+		count     int
 		withMatch bool
 		match     string
 	}{
 		key: args[0],
 	}
-	if ok := optIntErr(c, args[1], &opts.cursor, msgInvalidCursor); !ok {
+	if ok := optCursor(c, args[1], &opts.cursor); !ok {
 		return
 	}
 	args = args[2:]
@@ -620,19 +624,24 @@ func (m *Miniredis) cmdHscan(c *server.Peer, cmd string, args []string) {
 	// MATCH and COUNT options
 	for len(args) > 0 {
 		if strings.ToLower(args[0]) == "count" {
-			// we do nothing with count
+			// only used with DeterministicScan()
 			if len(args) < 2 {
 				setDirty(c)
 				c.WriteError(msgSyntaxError)
 				return
 			}
-			_, err := strconv.Atoi(args[1])
+			count, err := strconv.Atoi(args[1])
 			if err != nil {
 				setDirty(c)
 				c.WriteError(msgInvalidInt)
 				return
 			}
-			args = args[2:]
+			if count < 1 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			opts.count, args = count, args[2:]
 			continue
 		}
 		if strings.ToLower(args[0]) == "match" {
@@ -652,27 +661,36 @@ func (m *Miniredis) cmdHscan(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		// return _all_ (matched) keys every time
+		// Unless DeterministicScan() we return _all_ (matched) keys every time.
 
-		if opts.cursor != 0 {
+		if opts.cursor != 0 && !m.stableScan {
 			// Invalid cursor.
 			c.WriteLen(2)
 			c.WriteBulk("0") // no next cursor
 			c.WriteLen(0)    // no elements
 			return
 		}
-		if db.exists(opts.key) && db.t(opts.key) != "hash" {
+		if db.wrongType(opts.key, "hash") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
 
 		members := db.hashFields(opts.key)
+		var next int64
+		if m.stableScan {
+			var err error
+			members, next, err = m.scanPage(members, opts.cursor, opts.count)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+		}
 		if opts.withMatch {
 			members, _ = matchKeys(members, opts.match)
 		}
 
 		c.WriteLen(2)
-		c.WriteBulk("0") // no next cursor
+		c.WriteBulk(strconv.FormatInt(next, 10))
 		// HSCAN gives key, values.
 		c.WriteLen(len(members) * 2)
 		for _, k := range members {
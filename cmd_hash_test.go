@@ -433,10 +433,28 @@ func TestHashIncrbyfloat(t *testing.T) {
 		s.HSet("hash", "field", "noint")
 		mustDo(t, c,
 			"HINCRBYFLOAT", "hash", "field", "400",
+			proto.Error("ERR hash value is not a float"),
+		)
+		mustDo(t, c,
+			"HINCRBYFLOAT", "hash", "field", "noint",
 			proto.Error("ERR value is not a valid float"),
 		)
 	}
 
+	// Infinity
+	{
+		s.HSet("hash", "inf", "inf")
+		mustDo(t, c,
+			"HINCRBYFLOAT", "hash", "inf", "1",
+			proto.Error("ERR increment would produce NaN or Infinity"),
+		)
+		mustDo(t, c,
+			"HINCRBYFLOAT", "hash", "field2", "-inf",
+			proto.Error("ERR increment would produce NaN or Infinity"),
+		)
+		equals(t, "", s.HGet("hash", "field2"))
+	}
+
 	// New key
 	{
 		mustDo(t, c,
@@ -571,6 +589,10 @@ func TestHscan(t *testing.T) {
 			"HSCAN", "set", "1", "COUNT", "noint",
 			proto.Error("ERR value is not an integer or out of range"),
 		)
+		mustDo(t, c,
+			"HSCAN", "set", "1", "COUNT", "0",
+			proto.Error("ERR syntax error"),
+		)
 	})
 }
 
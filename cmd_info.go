@@ -2,6 +2,9 @@ package miniredis
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
@@ -20,21 +23,66 @@ func (m *Miniredis) cmdInfo(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		const (
-			clientsSectionName    = "clients"
-			clientsSectionContent = "# Clients\nconnected_clients:%d\r\n"
+			serverSectionName      = "server"
+			clientsSectionName     = "clients"
+			clientsSectionContent  = "# Clients\nconnected_clients:%d\r\n"
+			keyspaceSectionName    = "keyspace"
+			replicationSectionName = "replication"
 		)
 
-		var result string
+		mode := "standalone"
+		if m.cluster != nil {
+			mode = "cluster"
+		}
+		serverFields := m.profileFields([]string{
+			"redis_version:" + m.redisVersion(),
+			"redis_mode:" + mode,
+		})
+		serverSection := "# Server\r\n" + strings.Join(serverFields, "\r\n") + "\r\n"
+		clientsSection := fmt.Sprintf(clientsSectionContent, m.Server().ClientsLen())
+		keyspaceSection := m.infoKeyspace()
+		replicationSection := m.infoReplication()
 
+		var result string
+		if len(args) == 0 {
+			result = serverSection + "\r\n" + clientsSection + "\r\n" + replicationSection + "\r\n" + keyspaceSection
+		}
 		for _, key := range args {
-			if key != clientsSectionName {
+			switch key {
+			case serverSectionName:
+				result = serverSection
+			case clientsSectionName:
+				result = clientsSection
+			case keyspaceSectionName:
+				result = keyspaceSection
+			case replicationSectionName:
+				result = replicationSection
+			default:
 				setDirty(c)
 				c.WriteError(fmt.Sprintf("section (%s) is not supported", key))
 				return
 			}
 		}
-		result = fmt.Sprintf(clientsSectionContent, m.Server().ClientsLen())
 
 		c.WriteBulk(result)
 	})
 }
+
+// infoKeyspace is the "keyspace" section, with a line for every non-empty DB.
+// No locks!
+func (m *Miniredis) infoKeyspace() string {
+	var ids []int
+	for id, db := range m.dbs {
+		if len(db.keys) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	res := "# Keyspace\r\n"
+	for _, id := range ids {
+		st := m.dbs[id].stats()
+		res += fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=%d\r\n", id, st.Keys, st.Expires, st.AvgTTL/time.Millisecond)
+	}
+	return res
+}
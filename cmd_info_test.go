@@ -26,7 +26,9 @@ func TestMiniredis_cmdInfo(t *testing.T) {
 	t.Run("No section name in args", func(t *testing.T) {
 		mustDo(t, c,
 			"INFO",
-			proto.String("# Clients\nconnected_clients:1\r\n"),
+			proto.String("# Server\r\nredis_version:6.0.5\r\nredis_mode:standalone\r\n\r\n# Clients\nconnected_clients:1\r\n\r\n"+
+				"# Replication\r\nrole:master\r\nmaster_replid:"+s.ReplID()+"\r\nmaster_replid2:0000000000000000000000000000000000000000\r\nmaster_repl_offset:0\r\nsecond_repl_offset:-1\r\n\r\n"+
+				"# Keyspace\r\n"),
 		)
 	})
 
@@ -54,4 +56,44 @@ func TestMiniredis_cmdInfo(t *testing.T) {
 			proto.String("# Clients\nconnected_clients:2\r\n"),
 		)
 	})
+
+	t.Run("keyspace", func(t *testing.T) {
+		mustDo(t, c,
+			"INFO", "keyspace",
+			proto.String("# Keyspace\r\n"),
+		)
+
+		s.Set("foo", "bar")
+		s.Set("ttl1", "bar")
+		s.SetTTL("ttl1", 10*time.Second)
+		s.Set("ttl2", "bar")
+		s.SetTTL("ttl2", 20*time.Second)
+		s.DB(3).Set("foo", "bar")
+		s.SetTTL("nosuch", time.Second)
+		equals(t, DBStats{Keys: 3, Expires: 2, AvgTTL: 15 * time.Second}, s.DBStats(0))
+		equals(t, DBStats{Keys: 1}, s.DBStats(3))
+		equals(t, DBStats{}, s.DBStats(4))
+		mustDo(t, c,
+			"INFO", "keyspace",
+			proto.String("# Keyspace\r\ndb0:keys=3,expires=2,avg_ttl=15000\r\ndb3:keys=1,expires=0,avg_ttl=0\r\n"),
+		)
+		s.FlushAll()
+	})
+
+	t.Run("server", func(t *testing.T) {
+		mustDo(t, c,
+			"INFO", "server",
+			proto.String("# Server\r\nredis_version:6.0.5\r\nredis_mode:standalone\r\n"),
+		)
+
+		s.SetVersion("7.2.4")
+		mustDo(t, c,
+			"INFO", "server",
+			proto.String("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n"),
+		)
+		mustContain(t, c,
+			"HELLO", "2",
+			"7.2.4",
+		)
+	})
 }
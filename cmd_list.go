@@ -92,7 +92,7 @@ func (m *Miniredis) cmdBXpop(c *server.Peer, cmd string, args []string, lr leftr
 					continue
 				}
 				c.WriteLen(2)
-				c.WriteBulk(key)
+				c.WriteBulk(ctx.tenantKey(key))
 				var v string
 				switch lr {
 				case left:
@@ -170,7 +170,7 @@ func (m *Miniredis) cmdLpos(c *server.Peer, cmd string, args []string) {
 		return
 	}
 
-	if len(args) == 1 {
+	if len(args) < 2 {
 		setDirty(c)
 		c.WriteError(errWrongNumber(cmd))
 		return
@@ -235,6 +235,10 @@ func (m *Miniredis) cmdLpos(c *server.Peer, cmd string, args []string) {
 		t, ok := db.keys[key]
 		if !ok {
 			// No such key
+			if countSpecified {
+				c.WriteLen(0)
+				return
+			}
 			c.WriteNull()
 			return
 		}
@@ -367,7 +371,7 @@ func (m *Miniredis) cmdLinsert(c *server.Peer, cmd string, args []string) {
 				}
 			}
 			db.listKeys[key] = l
-			db.keyVersion[key]++
+			db.bump(key)
 			c.WriteInt(len(l))
 			return
 		}
@@ -462,8 +466,7 @@ func (m *Miniredis) cmdXpop(c *server.Peer, cmd string, args []string, lr leftri
 
 		if !db.exists(opts.key) {
 			// non-existing key is fine
-			if opts.withCount && !c.Resp3 {
-				// zero-length list in this specific case. Looks like a redis bug to me.
+			if opts.withCount {
 				c.WriteLen(-1)
 				return
 			}
@@ -529,7 +532,7 @@ func (m *Miniredis) cmdXpush(c *server.Peer, cmd string, args []string, lr leftr
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(key) && db.t(key) != "list" {
+		if db.wrongType(key, "list") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -628,7 +631,7 @@ func (m *Miniredis) cmdLrange(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "list" {
+		if db.wrongType(opts.key, "list") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -714,7 +717,7 @@ func (m *Miniredis) cmdLrem(c *server.Peer, cmd string, args []string) {
 			db.del(opts.key, true)
 		} else {
 			db.listKeys[opts.key] = newL
-			db.keyVersion[opts.key]++
+			db.bump(opts.key)
 		}
 
 		c.WriteInt(deleted)
@@ -768,7 +771,7 @@ func (m *Miniredis) cmdLset(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		l[index] = opts.value
-		db.keyVersion[opts.key]++
+		db.bump(opts.key)
 
 		c.WriteOK()
 	})
@@ -822,7 +825,7 @@ func (m *Miniredis) cmdLtrim(c *server.Peer, cmd string, args []string) {
 			db.del(opts.key, true)
 		} else {
 			db.listKeys[opts.key] = l
-			db.keyVersion[opts.key]++
+			db.bump(opts.key)
 		}
 		c.WriteOK()
 	})
@@ -851,7 +854,7 @@ func (m *Miniredis) cmdRpoplpush(c *server.Peer, cmd string, args []string) {
 			c.WriteNull()
 			return
 		}
-		if db.t(src) != "list" || (db.exists(dst) && db.t(dst) != "list") {
+		if db.t(src) != "list" || (db.wrongType(dst, "list")) {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -896,7 +899,7 @@ func (m *Miniredis) cmdBrpoplpush(c *server.Peer, cmd string, args []string) {
 			if !db.exists(opts.src) {
 				return false
 			}
-			if db.t(opts.src) != "list" || (db.exists(opts.dst) && db.t(opts.dst) != "list") {
+			if db.t(opts.src) != "list" || (db.wrongType(opts.dst, "list")) {
 				c.WriteError(msgWrongType)
 				return true
 			}
@@ -948,7 +951,7 @@ func (m *Miniredis) cmdLmove(c *server.Peer, cmd string, args []string) {
 			c.WriteNull()
 			return
 		}
-		if db.t(opts.src) != "list" || (db.exists(opts.dst) && db.t(opts.dst) != "list") {
+		if db.t(opts.src) != "list" || (db.wrongType(opts.dst, "list")) {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -636,6 +636,10 @@ func TestLpos(t *testing.T) {
 			"LPOS", "l",
 			proto.Error("ERR wrong number of arguments for 'lpos' command"),
 		)
+		mustDo(t, c,
+			"LPOS",
+			proto.Error("ERR wrong number of arguments for 'lpos' command"),
+		)
 
 		// Wrong number of options.
 		mustDo(t, c,
@@ -1329,6 +1333,50 @@ func TestBrpopTimeout(t *testing.T) {
 	}
 }
 
+func TestMaxBlockTime(t *testing.T) {
+	s := RunT(t)
+
+	t.Run("forever", func(t *testing.T) {
+		s.SetMaxBlockTime(50 * time.Millisecond)
+		defer s.SetMaxBlockTime(0)
+
+		got := goStrings(t, s, "BRPOP", "l1", "0")
+		select {
+		case have := <-got:
+			equals(t, proto.NilList, have)
+		case <-time.After(500 * time.Millisecond):
+			t.Error("BRPOP took too long")
+		}
+
+		got = goStrings(t, s, "XREAD", "BLOCK", "0", "STREAMS", "planets", "$")
+		select {
+		case have := <-got:
+			equals(t, proto.NilList, have)
+		case <-time.After(500 * time.Millisecond):
+			t.Error("XREAD took too long")
+		}
+	})
+
+	t.Run("fastforward", func(t *testing.T) {
+		got := goStrings(t, s, "BLPOP", "l1", "10")
+		time.Sleep(10 * time.Millisecond)
+		s.FastForward(5 * time.Second)
+		select {
+		case <-got:
+			t.Fatal("BLPOP was too quick")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		s.FastForward(5 * time.Second)
+		select {
+		case have := <-got:
+			equals(t, proto.NilList, have)
+		case <-time.After(500 * time.Millisecond):
+			t.Error("BLPOP took too long")
+		}
+	})
+}
+
 func TestBrpopTx(t *testing.T) {
 	// BRPOP in a transaction behaves as if the timeout triggers right away
 	s, err := Run()
@@ -1421,6 +1469,51 @@ func TestBlpop(t *testing.T) {
 	})
 }
 
+func TestBlpopDB(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+
+	mustOK(t, c, "SELECT", "1")
+	got := make(chan string, 1)
+	go func() {
+		res, err := c.Do("BLPOP", "ll", "2")
+		ok(t, err)
+		got <- res
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	// same key, other DB
+	must1(t, c2, "RPUSH", "ll", "aap")
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case res := <-got:
+		t.Fatalf("unblocked by another DB: %q", res)
+	default:
+	}
+
+	// DB 0 is now DB 1
+	mustOK(t, c2, "SWAPDB", "0", "1")
+	equals(t, proto.Strings("ll", "aap"), <-got)
+
+	t.Run("direct", func(t *testing.T) {
+		go func() {
+			res, err := c.Do("BLPOP", "ll", "2")
+			ok(t, err)
+			got <- res
+		}()
+		time.Sleep(30 * time.Millisecond)
+		s.DB(0).Push("ll", "noot")
+		time.Sleep(30 * time.Millisecond)
+		s.SwapDB(0, 1)
+		equals(t, proto.Strings("ll", "noot"), <-got)
+	})
+}
+
 func TestBlpopResourceCleanup(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -249,7 +249,7 @@ func (m *Miniredis) cmdPubSub(c *server.Peer, cmd string, args []string) {
 
 		case "NUMSUB":
 			subs := m.allSubscribers()
-			c.WriteLen(len(subargs) * 2)
+			c.WriteMapLen(len(subargs))
 			for _, channel := range subargs {
 				c.WriteBulk(channel)
 				c.WriteInt(countSubs(subs, channel))
@@ -1,6 +1,8 @@
 package miniredis
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2/proto"
@@ -401,6 +403,37 @@ func TestPublish(t *testing.T) {
 		"PUBLISH", "foo", "bar",
 		proto.Error("ERR Can't execute 'publish': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"),
 	)
+
+	t.Run("log", func(t *testing.T) {
+		mustDo(t, c1,
+			"PUBLISH", "nobody", "hello",
+			proto.Int(0),
+		)
+		mustDo(t, c1,
+			"EVAL", "return redis.call('PUBLISH', 'event1', 'lua')", "0",
+			proto.Int(1),
+		)
+		mustRead(t, c2,
+			proto.Strings("message", "event1", "lua"),
+		)
+		equals(t, []PublishedMessage{
+			{Channel: "event1", Message: "message2", Receivers: 1},
+			{Channel: "event1", Message: "message3", Receivers: 1},
+			{Channel: "nobody", Message: "hello", Receivers: 0},
+			{Channel: "event1", Message: "lua", Receivers: 1},
+		}, s.PublishedMessages())
+
+		s.ResetPublishedMessages()
+		equals(t, []PublishedMessage{}, s.PublishedMessages())
+
+		for i := 0; i < maxPublished+10; i++ {
+			s.Publish("many", strconv.Itoa(i))
+		}
+		msgs := s.PublishedMessages()
+		equals(t, maxPublished, len(msgs))
+		equals(t, "10", msgs[0].Message)
+		equals(t, strconv.Itoa(maxPublished+9), msgs[len(msgs)-1].Message)
+	})
 }
 
 func TestPublishMix(t *testing.T) {
@@ -458,6 +491,79 @@ func TestPublishMix(t *testing.T) {
 	)
 }
 
+func TestPublishOrder(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("message and pmessage", func(t *testing.T) {
+		sub, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer sub.Close()
+		mustDo(t, sub,
+			"SUBSCRIBE", "news",
+			proto.Array(proto.String("subscribe"), proto.String("news"), proto.Int(1)),
+		)
+		mustDo(t, sub,
+			"PSUBSCRIBE", "n*",
+			proto.Array(proto.String("psubscribe"), proto.String("n*"), proto.Int(2)),
+		)
+		for i := 0; i < 10; i++ {
+			msg := strconv.Itoa(i)
+			mustDo(t, c, "PUBLISH", "news", msg, proto.Int(2))
+			mustRead(t, sub, proto.Strings("message", "news", msg))
+			mustRead(t, sub, proto.Strings("pmessage", "n*", "news", msg))
+		}
+	})
+
+	t.Run("stuck subscriber", func(t *testing.T) {
+		// never reads, but PUBLISH doesn't wait for it
+		sub, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer sub.Close()
+		mustDo(t, sub,
+			"SUBSCRIBE", "big",
+			proto.Array(proto.String("subscribe"), proto.String("big"), proto.Int(1)),
+		)
+		msg := strings.Repeat("x", 100_000)
+		for i := 0; i < 200; i++ {
+			mustDo(t, c, "PUBLISH", "big", msg, proto.Int(1))
+		}
+		mustRead(t, sub, proto.Strings("message", "big", msg))
+	})
+
+	t.Run("subscription order", func(t *testing.T) {
+		var subs []*Subscriber
+		for i := 0; i < 3; i++ {
+			sub := s.NewSubscriber()
+			defer sub.Close()
+			sub.Subscribe("events")
+			subs = append(subs, sub)
+		}
+		got := make(chan []int)
+		go func() {
+			var order []int
+			for len(order) < 3 {
+				select {
+				case <-subs[0].Messages():
+					order = append(order, 0)
+				case <-subs[1].Messages():
+					order = append(order, 1)
+				case <-subs[2].Messages():
+					order = append(order, 2)
+				}
+			}
+			got <- order
+		}()
+		// the reply comes after all subscribers have the message
+		mustDo(t, c, "PUBLISH", "events", "hello", proto.Int(3))
+		equals(t, []int{0, 1, 2}, <-got)
+	})
+}
+
 func TestPubsubChannels(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -547,6 +653,18 @@ func TestPubsubNumsub(t *testing.T) {
 		),
 	)
 
+	useRESP3(t, c1)
+	t.Run("RESP3", func(t *testing.T) {
+		mustDo(t, c1,
+			"PUBSUB", "NUMSUB", "event12", "event3",
+			proto.Map(
+				proto.String("event12"),
+				proto.Int(0),
+				proto.String("event3"),
+				proto.Int(1),
+			),
+		)
+	})
 }
 
 func TestPubsubNumpat(t *testing.T) {
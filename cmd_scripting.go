@@ -7,6 +7,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	luajson "github.com/alicebob/gopher-json"
 	lua "github.com/yuin/gopher-lua"
@@ -27,6 +28,9 @@ func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, args []stri
 	l := lua.NewState(lua.Options{SkipOpenLibs: true})
 	defer l.Close()
 
+	m.scriptNow = m.effectiveNow()
+	defer func() { m.scriptNow = time.Time{} }()
+
 	// Taken from the go-lua manual
 	for _, pair := range []struct {
 		n string
@@ -80,7 +84,7 @@ func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, args []stri
 	}
 	l.SetGlobal("ARGV", argvTable)
 
-	redisFuncs, redisConstants := mkLua(m.srv, c, sha)
+	redisFuncs, redisConstants := mkLua(m.srv, c, sha, keys)
 	// Register command handlers
 	l.Push(l.NewFunction(func(l *lua.LState) int {
 		mod := l.RegisterModule("redis", redisFuncs).(*lua.LTable)
@@ -95,6 +99,9 @@ func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, args []stri
 
 	l.Push(lua.LString("redis"))
 	l.Call(1, 0)
+	if m.luaAlias != "" {
+		l.G.Global.RawSetString(m.luaAlias, l.GetGlobal("redis"))
+	}
 
 	if err := l.DoString(script); err != nil {
 		c.WriteError(errLuaParseError(err))
@@ -130,6 +137,7 @@ func (m *Miniredis) cmdEval(c *server.Peer, cmd string, args []string) {
 		ok := m.runLuaScript(c, sha, script, args)
 		if ok {
 			m.scripts[sha] = script
+			m.writes++
 		}
 	})
 }
@@ -234,6 +242,7 @@ func (m *Miniredis) cmdScript(c *server.Peer, cmd string, args []string) {
 			}
 			sha := sha1Hex(opts.script)
 			m.scripts[sha] = opts.script
+			m.writes++
 			c.WriteBulk(sha)
 
 		case "exists":
@@ -248,6 +257,7 @@ func (m *Miniredis) cmdScript(c *server.Peer, cmd string, args []string) {
 
 		case "flush":
 			m.scripts = map[string]string{}
+			m.writes++
 			c.WriteOK()
 
 		}
@@ -2,6 +2,7 @@ package miniredis
 
 import (
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -650,3 +651,204 @@ func TestLuaTX(t *testing.T) {
 		)
 	})
 }
+
+func TestCmdEvalKeys(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("declared", func(t *testing.T) {
+		s.RequireDeclaredKeys(true)
+		defer s.RequireDeclaredKeys(false)
+
+		mustOK(t, c,
+			"EVAL", "return redis.call('SET', KEYS[1], 'bar')", "1", "foo",
+		)
+		mustContain(t, c,
+			"EVAL", "return redis.call('SET', 'other', 'bar')", "1", "foo",
+			"Script attempted to access key 'other' which was not declared in KEYS",
+		)
+		mustContain(t, c,
+			"EVAL", "return redis.call('MGET', KEYS[1], 'other')", "1", "foo",
+			"Script attempted to access key 'other' which was not declared in KEYS",
+		)
+		mustDo(t, c,
+			"EVAL", "return redis.call('PING')", "0",
+			proto.Inline("PONG"),
+		)
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		cl := s.Cluster()
+
+		mustDo(t, c,
+			"EVAL", "return 1", "2", "foo", "bar",
+			proto.Error(msgCrossSlot),
+		)
+		mustDo(t, c,
+			"MGET", "foo", "bar",
+			proto.Error(msgCrossSlot),
+		)
+		mustOK(t, c,
+			"EVAL", "return redis.call('SET', KEYS[2], 'bar')", "2", "{user}a", "{user}b",
+		)
+		mustContain(t, c,
+			"EVAL", "return redis.call('SET', 'other', 'bar')", "1", "{user}a",
+			msgScriptCrossSlot,
+		)
+		// no declared keys
+		mustOK(t, c,
+			"EVAL", "return redis.call('SET', 'other', 'bar')", "0",
+		)
+		mustContain(t, c,
+			"EVAL", "return redis.call('MSET', 'foo', '1', 'bar', '2')", "0",
+			msgScriptCrossSlot,
+		)
+
+		ok(t, cl.AddNode("othernode", "10.0.0.2:7001"))
+		ok(t, cl.MigrateSlot(KeySlot("other"), cl.MyID(), "othernode"))
+		mustContain(t, c,
+			"EVAL", "return redis.call('GET', 'other')", "0",
+			msgScriptNonLocal,
+		)
+	})
+}
+
+func TestLuaTime(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("stable", func(t *testing.T) {
+		// the clock doesn't move during a script
+		mustDo(t, c,
+			"EVAL", `
+local a = redis.call('TIME')
+for i = 1, 100000 do end
+local b = redis.call('TIME')
+return a[1] == b[1] and a[2] == b[2]`, "0",
+			proto.Int(1),
+		)
+	})
+
+	t.Run("mock clock", func(t *testing.T) {
+		s.SetTime(time.Unix(1700000000, 123000000))
+		defer s.SetTime(time.Time{})
+		mustDo(t, c,
+			"EVAL", "return redis.call('TIME')", "0",
+			proto.Strings("1700000000", "123000"),
+		)
+
+		// a TTL computed from TIME is exact
+		s.Set("foo", "bar")
+		mustDo(t, c,
+			"EVAL", `
+local t = redis.call('TIME')
+local ms = t[1] * 1000 + math.floor(t[2] / 1000) + 2500
+redis.call('PEXPIREAT', KEYS[1], ms)
+return redis.call('PTTL', KEYS[1])`, "1", "foo",
+			proto.Int(2500),
+		)
+
+		s.FastForward(time.Second)
+		equals(t, 1500*time.Millisecond, s.TTL("foo"))
+	})
+}
+
+func TestLuaSetresp(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.HSet("h", "f", "v")
+	s.ZAdd("z", 1.5, "one")
+
+	t.Run("resp2", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "return redis.call('HGETALL', KEYS[1])", "1", "h",
+			proto.Strings("f", "v"),
+		)
+		mustDo(t, c,
+			"EVAL", "return redis.call('GET', 'nosuch') == false", "0",
+			proto.Int(1),
+		)
+	})
+
+	t.Run("resp3", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", `
+redis.setresp(3)
+local r = redis.call('HGETALL', KEYS[1])
+return r['map']['f']`, "1", "h",
+			proto.String("v"),
+		)
+		mustDo(t, c,
+			"EVAL", `
+redis.setresp(3)
+return redis.call('ZSCORE', KEYS[1], 'one')['double'] * 2`, "1", "z",
+			proto.Int(3),
+		)
+		mustDo(t, c,
+			"EVAL", `
+redis.setresp(3)
+return redis.call('GET', 'nosuch') == nil`, "0",
+			proto.Int(1),
+		)
+		mustDo(t, c,
+			"EVAL", `
+redis.setresp(3)
+local r = redis.call('SMEMBERS', 'nosuch')
+return r['set'] ~= nil`, "0",
+			proto.Int(1),
+		)
+
+		// the reply is converted back for the client
+		mustDo(t, c,
+			"EVAL", "redis.setresp(3); return redis.call('HGETALL', KEYS[1])", "1", "h",
+			proto.Strings("f", "v"),
+		)
+		mustDo(t, c,
+			"EVAL", "redis.setresp(3); return redis.call('ZSCORE', KEYS[1], 'one')", "1", "z",
+			proto.String("1.5"),
+		)
+	})
+
+	t.Run("resp3 client", func(t *testing.T) {
+		c3, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c3.Close()
+		_, err = c3.Do("HELLO", "3")
+		ok(t, err)
+
+		mustDo(t, c3,
+			"EVAL", "redis.setresp(3); return redis.call('HGETALL', KEYS[1])", "1", "h",
+			proto.StringMap("f", "v"),
+		)
+		mustDo(t, c3,
+			"EVAL", "return {map={a='b'}}", "0",
+			proto.StringMap("a", "b"),
+		)
+		mustDo(t, c3,
+			"EVAL", "return {double=1.5}", "0",
+			proto.Float(1.5),
+		)
+		mustDo(t, c3,
+			"EVAL", "return {big_number='123456789012345678901234567890'}", "0",
+			"(123456789012345678901234567890\r\n",
+		)
+		mustDo(t, c3,
+			"EVAL", "return {set={a=true}}", "0",
+			proto.StringSet("a"),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustContain(t, c,
+			"EVAL", "redis.setresp(4)", "0",
+			"RESP version must be 2 or 3.",
+		)
+	})
+}
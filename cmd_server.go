@@ -3,21 +3,233 @@
 package miniredis
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
 
 func commandsServer(m *Miniredis) {
+	m.srv.Register("ACL", m.cmdACL)
 	m.srv.Register("COMMAND", m.cmdCommand)
+	m.srv.Register("CONFIG", m.cmdConfig)
 	m.srv.Register("DBSIZE", m.cmdDbsize)
+	m.srv.Register("DEBUG", m.cmdDebug)
 	m.srv.Register("FLUSHALL", m.cmdFlushall)
 	m.srv.Register("FLUSHDB", m.cmdFlushdb)
 	m.srv.Register("INFO", m.cmdInfo)
 	m.srv.Register("TIME", m.cmdTime)
 }
 
+// ACL
+func (m *Miniredis) cmdACL(c *server.Peer, cmd string, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+
+	subCmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subCmd {
+	case "LOG":
+		m.cmdACLLog(c, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try ACL HELP.", subCmd))
+	}
+}
+
+// ACL LOG
+func (m *Miniredis) cmdACLLog(c *server.Peer, args []string) {
+	if len(args) > 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("acl|log"))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, "ACL") {
+		return
+	}
+
+	reset := false
+	count := -1
+	if len(args) == 1 {
+		if strings.ToUpper(args[0]) == "RESET" {
+			reset = true
+		} else {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				setDirty(c)
+				c.WriteError("ERR Invalid count")
+				return
+			}
+			count = n
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if reset {
+			m.aclLog = nil
+			c.WriteOK()
+			return
+		}
+
+		entries := m.aclLog
+		if count >= 0 && len(entries) > count {
+			entries = entries[:count]
+		}
+		now := m.effectiveNow()
+		c.WriteLen(len(entries))
+		for _, e := range entries {
+			c.WriteMapLen(10)
+			c.WriteBulk("count")
+			c.WriteInt(e.Count)
+			c.WriteBulk("reason")
+			c.WriteBulk(e.Reason)
+			c.WriteBulk("context")
+			c.WriteBulk(e.Context)
+			c.WriteBulk("object")
+			c.WriteBulk(e.Object)
+			c.WriteBulk("username")
+			c.WriteBulk(e.Username)
+			c.WriteBulk("age-seconds")
+			c.WriteFloat(now.Sub(e.Updated).Seconds())
+			c.WriteBulk("client-info")
+			c.WriteBulk(e.ClientInfo)
+			c.WriteBulk("entry-id")
+			c.WriteInt(e.ID)
+			c.WriteBulk("timestamp-created")
+			c.WriteInt(int(e.Created.UnixNano() / int64(time.Millisecond)))
+			c.WriteBulk("timestamp-last-updated")
+			c.WriteInt(int(e.Updated.UnixNano() / int64(time.Millisecond)))
+		}
+	})
+}
+
+// configParams are the parameters CONFIG GET and CONFIG SET know about.
+var configParams = []string{"maxclients", "timeout"}
+
+// CONFIG
+func (m *Miniredis) cmdConfig(c *server.Peer, cmd string, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	subCmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subCmd {
+	case "GET":
+		m.cmdConfigGet(c, args)
+	case "SET":
+		m.cmdConfigSet(c, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CONFIG HELP.", subCmd))
+	}
+}
+
+// CONFIG GET
+func (m *Miniredis) cmdConfigGet(c *server.Peer, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("config|get"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		var params []string
+		for _, p := range configParams {
+			for _, pattern := range args {
+				if patternRE(strings.ToLower(pattern)).MatchString(p) {
+					params = append(params, p)
+					break
+				}
+			}
+		}
+		c.WriteMapLen(len(params))
+		for _, p := range params {
+			c.WriteBulk(p)
+			c.WriteBulk(m.configGet(p))
+		}
+	})
+}
+
+// configGet gives the value of a configParams parameter. No locks!
+func (m *Miniredis) configGet(param string) string {
+	switch param {
+	case "maxclients":
+		return strconv.Itoa(m.maxClients)
+	case "timeout":
+		return strconv.Itoa(int(m.connTimeouts.Idle / time.Second))
+	}
+	return ""
+}
+
+// CONFIG SET
+func (m *Miniredis) cmdConfigSet(c *server.Peer, args []string) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("config|set"))
+		return
+	}
+
+	// all or nothing
+	values := map[string]int{}
+	for ; len(args) > 0; args = args[2:] {
+		param, value := strings.ToLower(args[0]), args[1]
+		var min, max int64
+		switch param {
+		case "maxclients":
+			min, max = 1, math.MaxUint32
+		case "timeout":
+			min, max = 0, math.MaxInt32
+		default:
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[0]))
+			return
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - argument couldn't be parsed into an integer", param))
+			return
+		}
+		if n < min || n > max {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - argument must be between %d and %d inclusive", param, min, max))
+			return
+		}
+		values[param] = int(n)
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		for param, n := range values {
+			switch param {
+			case "maxclients":
+				m.setMaxClients(n)
+			case "timeout":
+				m.connTimeouts.Idle = time.Duration(n) * time.Second
+				if m.srv != nil {
+					m.srv.SetConnTimeouts(m.connTimeouts)
+				}
+			}
+		}
+		c.WriteOK()
+	})
+}
+
 // DBSIZE
 func (m *Miniredis) cmdDbsize(c *server.Peer, cmd string, args []string) {
 	if len(args) > 0 {
@@ -35,10 +247,60 @@ func (m *Miniredis) cmdDbsize(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
+		if ctx.tenant != "" {
+			c.WriteInt(len(db.tenantKeys(ctx.tenant)))
+			return
+		}
 		c.WriteInt(len(db.keys))
 	})
 }
 
+// DEBUG
+func (m *Miniredis) cmdDebug(c *server.Peer, cmd string, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	subCmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subCmd {
+	case "SET-ACTIVE-EXPIRE":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try DEBUG HELP.", subCmd))
+			return
+		}
+		var on int
+		if ok := optInt(c, args[0], &on); !ok {
+			return
+		}
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			m.setActiveExpire(on != 0)
+			c.WriteOK()
+		})
+	case "CHANGE-REPL-ID":
+		if len(args) != 0 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try DEBUG HELP.", subCmd))
+			return
+		}
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			m.changeReplID()
+			c.WriteOK()
+		})
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try DEBUG HELP.", subCmd))
+	}
+}
+
 // FLUSHALL
 func (m *Miniredis) cmdFlushall(c *server.Peer, cmd string, args []string) {
 	if len(args) > 0 && strings.ToLower(args[0]) == "async" {
@@ -57,7 +319,7 @@ func (m *Miniredis) cmdFlushall(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		m.flushAll()
+		m.flushTenant(ctx.tenant)
 		c.WriteOK()
 	})
 }
@@ -80,7 +342,7 @@ func (m *Miniredis) cmdFlushdb(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		m.db(ctx.selectedDB).flush()
+		m.db(ctx.selectedDB).flushTenant(ctx.tenant)
 		c.WriteOK()
 	})
 }
@@ -1,6 +1,9 @@
 package miniredis
 
 import (
+	"bufio"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -105,6 +108,65 @@ func TestCmdServer(t *testing.T) {
 }
 
 // Test TIME
+func TestCmdServerOnFlush(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	type flush struct {
+		db   int
+		keys map[string]string
+	}
+	var flushes []flush
+	s.OnFlush(func(db int, keys map[string]string) {
+		flushes = append(flushes, flush{db, keys})
+	})
+
+	s.Set("str", "v")
+	s.HSet("h", "f", "v")
+	s.Set("old", "v")
+	s.SetTTL("old", time.Second)
+	s.SetActiveExpire(false)
+	s.FastForward(2 * time.Second)
+	s.SetActiveExpire(true)
+	s.DB(3).Push("l", "a")
+
+	mustOK(t, c, "FLUSHDB")
+	equals(t, []flush{{0, map[string]string{"str": "string", "h": "hash"}}}, flushes)
+
+	flushes = nil
+	mustOK(t, c, "FLUSHDB")
+	equals(t, []flush{{0, map[string]string{}}}, flushes)
+
+	flushes = nil
+	s.Set("str", "v")
+	mustOK(t, c, "FLUSHALL")
+	equals(t,
+		[]flush{
+			{0, map[string]string{"str": "string"}},
+			{3, map[string]string{"l": "list"}},
+		},
+		flushes,
+	)
+
+	t.Run("tenant", func(t *testing.T) {
+		flushes = nil
+		tn := s.Tenant("t1:")
+		tn.Set("k", "v")
+		s.Set("other", "v")
+		tc, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer tc.Close()
+		mustOK(t, tc, "AUTH", tn.Username(), tn.Password())
+		mustOK(t, tc, "FLUSHDB")
+		equals(t, []flush{{0, map[string]string{"k": "string"}}}, flushes)
+	})
+
+	s.OnFlush(nil)
+	mustOK(t, c, "FLUSHALL")
+}
+
 func TestCmdServerTime(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -127,3 +189,192 @@ func TestCmdServerTime(t *testing.T) {
 		proto.Error(errWrongNumber("time")),
 	)
 }
+
+func TestCmdServerACLLog(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	s.RequireUserAuth("alice", "secret")
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	now := time.Unix(1_000_000, 0)
+	s.SetTime(now)
+
+	mustDo(t, c,
+		"AUTH", "alice", "wrong",
+		proto.Error(msgWrongPass),
+	)
+	mustDo(t, c,
+		"AUTH", "alice", "wrong again",
+		proto.Error(msgWrongPass),
+	)
+	mustDo(t, c,
+		"HELLO", "2", "AUTH", "bob", "secret",
+		proto.Error(msgWrongPass),
+	)
+	mustOK(t, c, "AUTH", "alice", "secret")
+
+	log := s.ACLLog()
+	equals(t, 2, len(log))
+	equals(t, "bob", log[0].Username)
+	equals(t, 1, log[0].ID)
+	equals(t, 2, log[1].Count)
+	equals(t, "alice", log[1].Username)
+	equals(t, "auth", log[1].Reason)
+	equals(t, "toplevel", log[1].Context)
+	equals(t, "AUTH", log[1].Object)
+	equals(t, now, log[1].Created)
+
+	mustDo(t, c,
+		"ACL", "LOG", "1",
+		proto.Array(
+			proto.Array(
+				proto.String("count"), proto.Int(1),
+				proto.String("reason"), proto.String("auth"),
+				proto.String("context"), proto.String("toplevel"),
+				proto.String("object"), proto.String("AUTH"),
+				proto.String("username"), proto.String("bob"),
+				proto.String("age-seconds"), proto.String("0"),
+				proto.String("client-info"), proto.String(log[0].ClientInfo),
+				proto.String("entry-id"), proto.Int(1),
+				proto.String("timestamp-created"), proto.Int(1_000_000_000),
+				proto.String("timestamp-last-updated"), proto.Int(1_000_000_000),
+			),
+		),
+	)
+	assert(t, strings.HasPrefix(log[0].ClientInfo, "id=1 addr=127.0.0.1:"), "client info")
+
+	mustDo(t, c,
+		"MULTI",
+		proto.Inline("OK"),
+	)
+	mustDo(t, c,
+		"AUTH", "alice", "wrong",
+		proto.Inline("QUEUED"),
+	)
+	mustDo(t, c,
+		"EXEC",
+		proto.Array(proto.Error(msgWrongPass)),
+	)
+	equals(t, "multi", s.ACLLog()[0].Context)
+
+	mustOK(t, c, "ACL", "LOG", "RESET")
+	mustDo(t, c, "ACL", "LOG", proto.Array())
+
+	mustDo(t, c,
+		"ACL", "LOG", "-1",
+		proto.Error("ERR Invalid count"),
+	)
+	mustDo(t, c,
+		"ACL", "LOG", "1", "2",
+		proto.Error(errWrongNumber("acl|log")),
+	)
+	mustDo(t, c,
+		"ACL", "FOO",
+		proto.Error("ERR unknown subcommand 'FOO'. Try ACL HELP."),
+	)
+}
+
+func TestCmdServerCommandDocs(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c,
+		"COMMAND", "DOCS", "substr", "GET", "nosuch",
+		proto.Array(
+			proto.String("substr"),
+			proto.Array(
+				proto.String("doc_flags"),
+				proto.Array(proto.Inline("deprecated")),
+				proto.String("replaced_by"),
+				proto.String("GETRANGE"),
+			),
+			proto.String("get"),
+			proto.Array(),
+		),
+	)
+
+	useRESP3(t, c)
+	mustDo(t, c,
+		"COMMAND", "DOCS", "getset",
+		proto.Map(
+			proto.String("getset"),
+			proto.Map(
+				proto.String("doc_flags"),
+				proto.Set(proto.Inline("deprecated")),
+				proto.String("replaced_by"),
+				proto.String("SET with the GET argument"),
+			),
+		),
+	)
+}
+
+func TestCmdServerConfig(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c, "CONFIG", "GET", "maxclients", proto.Strings("maxclients", "10000"))
+	mustDo(t, c, "CONFIG", "GET", "*", proto.Strings("maxclients", "10000", "timeout", "0"))
+	mustDo(t, c, "CONFIG", "GET", "nosuch", proto.Strings())
+	mustOK(t, c, "CONFIG", "SET", "timeout", "300", "MAXCLIENTS", "2")
+	mustDo(t, c, "CONFIG", "GET", "time*", "maxclients", proto.Strings("maxclients", "2", "timeout", "300"))
+	equals(t, 300*time.Second, s.connTimeouts.Idle)
+
+	t.Run("maxclients", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		res, err := proto.Read(bufio.NewReader(raw))
+		ok(t, err)
+		equals(t, proto.Error("ERR max number of clients reached"), res)
+		equals(t, 1, s.srv.RejectedConnections())
+
+		c2.Close()
+		s.SetMaxClients(0)
+		for i := 0; i < 3; i++ {
+			c, err := proto.Dial(s.Addr())
+			ok(t, err)
+			defer c.Close()
+			mustDo(t, c, "PING", proto.Inline("PONG"))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c, "CONFIG",
+			proto.Error("ERR wrong number of arguments for 'config' command"),
+		)
+		mustDo(t, c, "CONFIG", "GET",
+			proto.Error("ERR wrong number of arguments for 'config|get' command"),
+		)
+		mustDo(t, c, "CONFIG", "SET", "maxclients",
+			proto.Error("ERR wrong number of arguments for 'config|set' command"),
+		)
+		mustDo(t, c, "CONFIG", "SET", "nosuch", "1",
+			proto.Error("ERR Unknown option or number of arguments for CONFIG SET - 'nosuch'"),
+		)
+		mustDo(t, c, "CONFIG", "SET", "timeout", "1", "maxclients", "many",
+			proto.Error("ERR CONFIG SET failed (possibly related to argument 'maxclients') - argument couldn't be parsed into an integer"),
+		)
+		mustDo(t, c, "CONFIG", "SET", "maxclients", "0",
+			proto.Error("ERR CONFIG SET failed (possibly related to argument 'maxclients') - argument must be between 1 and 4294967295 inclusive"),
+		)
+		mustDo(t, c, "CONFIG", "SET", "timeout", "-1",
+			proto.Error("ERR CONFIG SET failed (possibly related to argument 'timeout') - argument must be between 0 and 2147483647 inclusive"),
+		)
+		mustDo(t, c, "CONFIG", "GET", "timeout", proto.Strings("timeout", "300"))
+		mustDo(t, c, "CONFIG", "REWRITE",
+			proto.Error("ERR unknown subcommand 'REWRITE'. Try CONFIG HELP."),
+		)
+	})
+}
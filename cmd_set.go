@@ -4,6 +4,7 @@ package miniredis
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -48,7 +49,7 @@ func (m *Miniredis) cmdSadd(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(key) && db.t(key) != "set" {
+		if db.wrongType(key, "set") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
@@ -149,8 +150,7 @@ func (m *Miniredis) cmdSdiffstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		db.del(dest, true)
-		db.setSet(dest, set)
+		db.setStore(dest, set)
 		c.WriteInt(len(set))
 	})
 }
@@ -180,7 +180,7 @@ func (m *Miniredis) cmdSinter(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -212,8 +212,7 @@ func (m *Miniredis) cmdSinterstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		db.del(dest, true)
-		db.setSet(dest, set)
+		db.setStore(dest, set)
 		c.WriteInt(len(set))
 	})
 }
@@ -322,7 +321,7 @@ func (m *Miniredis) cmdSmove(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		if db.exists(dst) && db.t(dst) != "set" {
+		if db.wrongType(dst, "set") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
@@ -360,26 +359,20 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 	}
 	opts.key, args = args[0], args[1:]
 
+	if len(args) > 1 {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
 	if len(args) > 0 {
 		v, err := strconv.Atoi(args[0])
-		if err != nil {
+		if err != nil || v < 0 {
 			setDirty(c)
-			c.WriteError(msgInvalidInt)
-			return
-		}
-		if v < 0 {
-			setDirty(c)
-			c.WriteError(msgOutOfRange)
+			c.WriteError(msgInvalidRange)
 			return
 		}
 		opts.count = v
 		opts.withCount = true
-		args = args[1:]
-	}
-	if len(args) > 0 {
-		setDirty(c)
-		c.WriteError(msgInvalidInt)
-		return
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
@@ -390,7 +383,7 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 				c.WriteNull()
 				return
 			}
-			c.WriteLen(0)
+			c.WriteSetLen(0)
 			return
 		}
 
@@ -418,8 +411,8 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 			c.WriteBulk(deleted[0])
 			return
 		}
-		// with `count` return a list
-		c.WriteLen(len(deleted))
+		// with `count` return a set
+		c.WriteSetLen(len(deleted))
 		for _, v := range deleted {
 			c.WriteBulk(v)
 		}
@@ -456,6 +449,11 @@ func (m *Miniredis) cmdSrandmember(c *server.Peer, cmd string, args []string) {
 			c.WriteError(msgInvalidInt)
 			return
 		}
+		if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+			setDirty(c)
+			c.WriteError(msgValueOutOfRange)
+			return
+		}
 		withCount = true
 	}
 
@@ -463,6 +461,11 @@ func (m *Miniredis) cmdSrandmember(c *server.Peer, cmd string, args []string) {
 		db := m.db(ctx.selectedDB)
 
 		if !db.exists(key) {
+			// without a count it's a single value, otherwise an array
+			if withCount {
+				c.WriteLen(0)
+				return
+			}
 			c.WriteNull()
 			return
 		}
@@ -558,7 +561,7 @@ func (m *Miniredis) cmdSunion(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -590,8 +593,7 @@ func (m *Miniredis) cmdSunionstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		db.del(dest, true)
-		db.setSet(dest, set)
+		db.setStore(dest, set)
 		c.WriteInt(len(set))
 	})
 }
@@ -613,14 +615,14 @@ func (m *Miniredis) cmdSscan(c *server.Peer, cmd string, args []string) {
 	var opts struct {
 		key       string
 		value     int
-		cursor    int
+		cursor    int64
 		count     int
 		withMatch bool
 		match     string
 	}
 
 	opts.key = args[0]
-	if ok := optIntErr(c, args[1], &opts.cursor, msgInvalidCursor); !ok {
+	if ok := optCursor(c, args[1], &opts.cursor); !ok {
 		return
 	}
 	args = args[2:]
@@ -667,29 +669,45 @@ func (m *Miniredis) cmdSscan(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 		// return _all_ (matched) keys every time
-		if db.exists(opts.key) && db.t(opts.key) != "set" {
+		if db.wrongType(opts.key, "set") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
 		members := db.setMembers(opts.key)
+		if m.stableScan {
+			members, next, err := m.scanPage(members, opts.cursor, opts.count)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+			if opts.withMatch {
+				members, _ = matchKeys(members, opts.match)
+			}
+			c.WriteLen(2)
+			c.WriteBulk(strconv.FormatInt(next, 10))
+			c.WriteLen(len(members))
+			for _, k := range members {
+				c.WriteBulk(k)
+			}
+			return
+		}
 		if opts.withMatch {
 			members, _ = matchKeys(members, opts.match)
 		}
-		low := opts.cursor
-		high := low + opts.count
-		// validate high is correct
-		if high > len(members) || high == 0 {
-			high = len(members)
-		}
-		if opts.cursor > high {
+		if opts.cursor < 0 || opts.cursor > int64(len(members)) {
 			// invalid cursor
 			c.WriteLen(2)
 			c.WriteBulk("0") // no next cursor
 			c.WriteLen(0)    // no elements
 			return
 		}
+		low := int(opts.cursor)
+		high := len(members)
+		if opts.count > 0 && opts.count < high-low {
+			high = low + opts.count
+		}
 		cursorValue := low + opts.count
-		if cursorValue > len(members) {
+		if opts.count > len(members)-low {
 			cursorValue = 0 // no next cursor
 		}
 		members = members[low:high]
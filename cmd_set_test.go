@@ -3,6 +3,7 @@ package miniredis
 import (
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -340,7 +341,34 @@ func TestSpop(t *testing.T) {
 
 		mustDo(t, c,
 			"SPOP", "str", "-12",
-			proto.Error(msgOutOfRange),
+			proto.Error(msgInvalidRange),
+		)
+		mustDo(t, c,
+			"SPOP", "s", "noint",
+			proto.Error(msgInvalidRange),
+		)
+		mustDo(t, c,
+			"SPOP", "s", "1", "2",
+			proto.Error(msgSyntaxError),
+		)
+	})
+
+	t.Run("reply shapes", func(t *testing.T) {
+		s.SetAdd("one", "aap")
+		mustDo(t, c,
+			"SPOP", "one", "0",
+			proto.Strings(),
+		)
+		mustDo(t, c,
+			"SPOP", "one", "1",
+			proto.Strings("aap"),
+		)
+		mustDo(t, c,
+			"SPOP", "nosuch", "1",
+			proto.Strings(),
+		)
+		mustNil(t, c,
+			"SPOP", "one",
 		)
 	})
 }
@@ -380,10 +408,33 @@ func TestSrandmember(t *testing.T) {
 		proto.Strings("aap", "mies"),
 	)
 
+	// Negative count can repeat elements
+	mustDo(t, c,
+		"SRANDMEMBER", "s", "-5",
+		proto.Strings("noot", "aap", "noot", "noot", "noot"),
+	)
+
+	mustDo(t, c,
+		"SRANDMEMBER", "s", "0",
+		proto.Strings(),
+	)
+	mustDo(t, c,
+		"SRANDMEMBER", "s", "1",
+		proto.Strings("noot"),
+	)
+
 	// a nonexisting key
 	mustNil(t, c,
 		"SRANDMEMBER", "nosuch",
 	)
+	mustDo(t, c,
+		"SRANDMEMBER", "nosuch", "2",
+		proto.Strings(),
+	)
+	mustDo(t, c,
+		"SRANDMEMBER", "nosuch", "-2",
+		proto.Strings(),
+	)
 
 	t.Run("errors", func(t *testing.T) {
 		s.SetAdd("chk", "aap", "noot")
@@ -401,6 +452,10 @@ func TestSrandmember(t *testing.T) {
 			"SRANDMEMBER", "chk", "1", "toomanu",
 			proto.Error("ERR syntax error"),
 		)
+		mustDo(t, c,
+			"SRANDMEMBER", "chk", "-9223372036854775807",
+			proto.Error(msgValueOutOfRange),
+		)
 
 		mustDo(t, c,
 			"SRANDMEMBER", "str",
@@ -608,12 +663,13 @@ func TestSinterstore(t *testing.T) {
 		s.CheckSet(t, "res", "aap", "mies")
 	}
 
-	// With one of the keys being an empty set, the resulting set is also empty
+	// With one of the keys being an empty set, the resulting set is also
+	// empty, and the destination is deleted
 	{
 		must0(t, c,
 			"SINTERSTORE", "res", "s1", "s9",
 		)
-		s.CheckSet(t, "res", []string{}...)
+		equals(t, false, s.Exists("res"))
 	}
 
 	t.Run("errors", func(t *testing.T) {
@@ -771,6 +827,13 @@ func TestSscan(t *testing.T) {
 			proto.Strings(),
 		),
 	)
+	mustDo(t, c,
+		"SSCAN", "set", "-1",
+		proto.Array(
+			proto.String("0"),
+			proto.Strings(),
+		),
+	)
 
 	// COUNT (ignored)
 	mustDo(t, c,
@@ -870,3 +933,44 @@ func TestSscan(t *testing.T) {
 		),
 	)
 }
+
+// Test the destination key of SDIFFSTORE, SINTERSTORE, and SUNIONSTORE.
+func TestSetStoreDestination(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.SetAdd("s1", "aap", "noot")
+	s.SetAdd("s2", "noot", "mies")
+
+	for _, cmd := range []string{"SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE"} {
+		t.Run(cmd, func(t *testing.T) {
+			// TTL is cleared
+			s.SetAdd("dest", "old")
+			s.SetTTL("dest", time.Minute)
+			mustDo(t, c, cmd, "dest", "s1", "s2", proto.Int(map[string]int{
+				"SDIFFSTORE":  1,
+				"SINTERSTORE": 1,
+				"SUNIONSTORE": 3,
+			}[cmd]))
+			equals(t, time.Duration(0), s.TTL("dest"))
+
+			// empty result deletes the destination
+			s.SetTTL("dest", time.Minute)
+			must0(t, c, cmd, "dest", "nosuch", "nosuch2")
+			equals(t, false, s.Exists("dest"))
+			equals(t, time.Duration(0), s.TTL("dest"))
+
+			// the destination can also be a source
+			s.SetAdd("self", "aap", "wim")
+			s.SetTTL("self", time.Minute)
+			_, err := c.Do(cmd, "self", "self", "s1")
+			ok(t, err)
+			equals(t, time.Duration(0), s.TTL("self"))
+			s.Del("self")
+		})
+	}
+}
@@ -5,7 +5,6 @@ package miniredis
 import (
 	"errors"
 	"math"
-	"sort"
 	"strconv"
 	"strings"
 
@@ -18,9 +17,11 @@ func commandsSortedSet(m *Miniredis) {
 	m.srv.Register("ZCARD", m.cmdZcard)
 	m.srv.Register("ZCOUNT", m.cmdZcount)
 	m.srv.Register("ZINCRBY", m.cmdZincrby)
+	m.srv.Register("ZINTERCARD", m.cmdZintercard)
 	m.srv.Register("ZINTERSTORE", m.cmdZinterstore)
 	m.srv.Register("ZLEXCOUNT", m.cmdZlexcount)
 	m.srv.Register("ZRANGE", m.cmdZrange)
+	m.srv.Register("ZRANGESTORE", m.cmdZrangestore)
 	m.srv.Register("ZRANGEBYLEX", m.makeCmdZrangebylex(false))
 	m.srv.Register("ZRANGEBYSCORE", m.makeCmdZrangebyscore(false))
 	m.srv.Register("ZRANK", m.makeCmdZrank(false))
@@ -33,6 +34,7 @@ func commandsSortedSet(m *Miniredis) {
 	m.srv.Register("ZREVRANGEBYSCORE", m.makeCmdZrangebyscore(true))
 	m.srv.Register("ZREVRANK", m.makeCmdZrank(true))
 	m.srv.Register("ZSCORE", m.cmdZscore)
+	m.srv.Register("ZMSCORE", m.cmdZmscore)
 	m.srv.Register("ZUNION", m.cmdZunion)
 	m.srv.Register("ZUNIONSTORE", m.cmdZunionstore)
 	m.srv.Register("ZSCAN", m.cmdZscan)
@@ -56,15 +58,10 @@ func (m *Miniredis) cmdZadd(c *server.Peer, cmd string, args []string) {
 	}
 
 	var opts struct {
-		key  string
-		nx   bool
-		xx   bool
-		gt   bool
-		lt   bool
-		ch   bool
-		incr bool
+		key string
+		ZAddOptions
+		ch bool
 	}
-	elems := map[string]float64{}
 
 	opts.key = args[0]
 	args = args[1:]
@@ -72,19 +69,19 @@ outer:
 	for len(args) > 0 {
 		switch strings.ToUpper(args[0]) {
 		case "NX":
-			opts.nx = true
+			opts.NX = true
 			args = args[1:]
 			continue
 		case "XX":
-			opts.xx = true
+			opts.XX = true
 			args = args[1:]
 			continue
 		case "GT":
-			opts.gt = true
+			opts.GT = true
 			args = args[1:]
 			continue
 		case "LT":
-			opts.lt = true
+			opts.LT = true
 			args = args[1:]
 			continue
 		case "CH":
@@ -92,7 +89,7 @@ outer:
 			args = args[1:]
 			continue
 		case "INCR":
-			opts.incr = true
+			opts.INCR = true
 			args = args[1:]
 			continue
 		default:
@@ -100,88 +97,72 @@ outer:
 		}
 	}
 
+	// same order of checks as redis
 	if len(args) == 0 || len(args)%2 != 0 {
 		setDirty(c)
 		c.WriteError(msgSyntaxError)
 		return
 	}
-	for len(args) > 0 {
-		score, err := strconv.ParseFloat(args[0], 64)
-		if err != nil {
-			setDirty(c)
-			c.WriteError(msgInvalidFloat)
-			return
-		}
-		elems[args[1]] = score
-		args = args[2:]
-	}
 
-	if opts.xx && opts.nx {
+	if opts.INCR && len(args) > 2 {
 		setDirty(c)
-		c.WriteError(msgXXandNX)
+		c.WriteError(msgSingleElementPair)
 		return
 	}
 
-	if opts.gt && opts.lt ||
-		opts.gt && opts.nx ||
-		opts.lt && opts.nx {
+	if err := opts.check(); err != nil {
 		setDirty(c)
-		c.WriteError(msgGTLTandNX)
+		c.WriteError(err.Error())
 		return
 	}
 
-	if opts.incr && len(elems) > 1 {
-		setDirty(c)
-		c.WriteError(msgSingleElementPair)
-		return
+	// in order, since a member can be in there more than once
+	var elems ssElems
+	for len(args) > 0 {
+		score, err := parseScore(args[0])
+		if err != nil {
+			setDirty(c)
+			c.WriteError(msgInvalidFloat)
+			return
+		}
+		elems = append(elems, ssElem{score: score, member: args[1]})
+		args = args[2:]
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(opts.key) && db.t(opts.key) != "zset" {
+		if db.wrongType(opts.key, "zset") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
 
-		if opts.incr {
-			for member, delta := range elems {
-				if opts.nx && db.ssetExists(opts.key, member) {
-					c.WriteNull()
-					return
-				}
-				if opts.xx && !db.ssetExists(opts.key, member) {
-					c.WriteNull()
-					return
-				}
-				newScore := db.ssetIncrby(opts.key, member, delta)
-				c.WriteFloat(newScore)
+		if opts.INCR {
+			el := elems[0]
+			newScore, skipped, err := db.ssetAddOpt(opts.key, opts.ZAddOptions, el.score, el.member)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+			if skipped {
+				c.WriteNull()
+				return
 			}
+			c.WriteFloat(newScore)
 			return
 		}
 
 		res := 0
-		for member, score := range elems {
-			if opts.nx && db.ssetExists(opts.key, member) {
-				continue
-			}
-			if opts.xx && !db.ssetExists(opts.key, member) {
-				continue
-			}
-			old := db.ssetScore(opts.key, member)
-			if opts.gt && score <= old {
-				continue
-			}
-			if opts.lt && score >= old {
+		for _, el := range elems {
+			old, existed := db.ssetScore(opts.key, el.member), db.ssetExists(opts.key, el.member)
+			if _, skipped, _ := db.ssetAddOpt(opts.key, opts.ZAddOptions, el.score, el.member); skipped {
 				continue
 			}
-			if db.ssetAdd(opts.key, score, member) {
+			if !existed {
+				res++
+			} else if opts.ch && old != el.score {
+				// if 'CH' is specified, only count changed keys
 				res++
-			} else {
-				if opts.ch && old != score {
-					// if 'CH' is specified, only count changed keys
-					res++
-				}
 			}
 		}
 		c.WriteInt(res)
@@ -300,7 +281,7 @@ func (m *Miniredis) cmdZincrby(c *server.Peer, cmd string, args []string) {
 	}
 
 	opts.key = args[0]
-	d, err := strconv.ParseFloat(args[1], 64)
+	d, err := parseScore(args[1])
 	if err != nil {
 		setDirty(c)
 		c.WriteError(msgInvalidFloat)
@@ -312,15 +293,82 @@ func (m *Miniredis) cmdZincrby(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if db.exists(opts.key) && db.t(opts.key) != "zset" {
+		if db.wrongType(opts.key, "zset") {
 			c.WriteError(msgWrongType)
 			return
 		}
-		newScore := db.ssetIncrby(opts.key, opts.member, opts.delta)
+		newScore, err := db.ssetIncrby(opts.key, opts.member, opts.delta)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
 		c.WriteFloat(newScore)
 	})
 }
 
+// ZINTERCARD
+func (m *Miniredis) cmdZintercard(c *server.Peer, cmd string, args []string) {
+	if len(args) < 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+	if numKeys <= 0 {
+		setDirty(c)
+		c.WriteError("ERR numkeys should be greater than 0")
+		return
+	}
+	args = args[1:]
+	if len(args) < numKeys {
+		setDirty(c)
+		c.WriteError(msgInvalidKeysNumber)
+		return
+	}
+	keys := args[:numKeys]
+	args = args[numKeys:]
+
+	limit := 0
+	for len(args) > 0 {
+		if strings.ToLower(args[0]) != "limit" || len(args) < 2 {
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+		l, err := strconv.Atoi(args[1])
+		if err != nil || l < 0 {
+			setDirty(c)
+			c.WriteError("ERR LIMIT can't be negative")
+			return
+		}
+		limit = l
+		args = args[2:]
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		n, err := db.ssetInterCard(keys, limit)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		c.WriteInt(n)
+	})
+}
+
 // ZINTERSTORE
 func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 	if len(args) < 3 {
@@ -356,53 +404,20 @@ func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 	keys := args[:numKeys]
 	args = args[numKeys:]
 
-	withWeights := false
-	weights := []float64{}
-	aggregate := "sum"
-	for len(args) > 0 {
-		switch strings.ToLower(args[0]) {
-		case "weights":
-			if len(args) < numKeys+1 {
-				setDirty(c)
-				c.WriteError(msgSyntaxError)
-				return
-			}
-			for i := 0; i < numKeys; i++ {
-				f, err := strconv.ParseFloat(args[i+1], 64)
-				if err != nil {
-					setDirty(c)
-					c.WriteError("ERR weight value is not a float")
-					return
-				}
-				weights = append(weights, f)
-			}
-			withWeights = true
-			args = args[numKeys+1:]
-		case "aggregate":
-			if len(args) < 2 {
-				setDirty(c)
-				c.WriteError(msgSyntaxError)
-				return
-			}
-			aggregate = strings.ToLower(args[1])
-			switch aggregate {
-			case "sum", "min", "max":
-			default:
-				setDirty(c)
-				c.WriteError(msgSyntaxError)
-				return
-			}
-			args = args[2:]
-		default:
-			setDirty(c)
-			c.WriteError(msgSyntaxError)
-			return
-		}
+	opts := zunionOptions{
+		Keys:        keys,
+		WithWeights: false,
+		Weights:     []float64{},
+		Aggregate:   "sum",
+	}
+	if err := opts.parseArgs(args, numKeys); err != nil {
+		setDirty(c)
+		c.WriteError(err.Error())
+		return
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		db.del(destination, true)
 
 		// We collect everything and remove all keys which turned out not to be
 		// present in every set.
@@ -427,8 +442,8 @@ func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 				return
 			}
 			for member, score := range set {
-				if withWeights {
-					score *= weights[i]
+				if opts.WithWeights {
+					score = zsetScore(score * opts.Weights[i])
 				}
 				counts[member]++
 				old, ok := sset[member]
@@ -436,20 +451,7 @@ func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 					sset[member] = score
 					continue
 				}
-				switch aggregate {
-				default:
-					panic("Invalid aggregate")
-				case "sum":
-					sset[member] += score
-				case "min":
-					if score < old {
-						sset[member] = score
-					}
-				case "max":
-					if score > old {
-						sset[member] = score
-					}
-				}
+				sset[member] = zsetAggregate(opts.Aggregate, old, score)
 			}
 		}
 		for key, count := range counts {
@@ -457,7 +459,7 @@ func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 				delete(sset, key)
 			}
 		}
-		db.ssetSet(destination, sset)
+		db.ssetStore(destination, sset)
 		c.WriteInt(len(sset))
 	})
 }
@@ -507,8 +509,6 @@ func (m *Miniredis) cmdZlexcount(c *server.Peer, cmd string, args []string) {
 		}
 
 		members := db.ssetMembers(opts.Key)
-		// Just key sort. If scores are not the same we don't care.
-		sort.Strings(members)
 		members = withLexRange(members, min, minIncl, max, maxIncl)
 
 		c.WriteInt(len(members))
@@ -529,28 +529,97 @@ func (m *Miniredis) cmdZrange(c *server.Peer, cmd string, args []string) {
 		return
 	}
 
-	var opts struct {
-		Key        string
-		Min        string
-		Max        string
-		WithScores bool
-		ByScore    bool
-		ByLex      bool
-		Reverse    bool
-		WithLimit  bool
-		Offset     string
-		Count      string
+	opts, ok := parseZrange(c, args, false)
+	if !ok {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		elems, err := opts.elems(m.db(ctx.selectedDB))
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		writeRange(c, elems, opts.WithScores)
+	})
+}
+
+// ZRANGESTORE
+func (m *Miniredis) cmdZrangestore(c *server.Peer, cmd string, args []string) {
+	if len(args) < 4 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	destination := args[0]
+	opts, ok := parseZrange(c, args[1:], true)
+	if !ok {
+		return
 	}
 
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		elems, err := opts.elems(db)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+
+		sset := sortedSet{}
+		for _, el := range elems {
+			sset[el.member] = el.score
+		}
+		db.ssetStore(destination, sset)
+		c.WriteInt(len(sset))
+	})
+}
+
+// optsZrange are the arguments of ZRANGE and ZRANGESTORE.
+type optsZrange struct {
+	Key        string
+	Min        string
+	Max        string
+	WithScores bool
+	ByScore    bool
+	ByLex      bool
+	Reverse    bool
+	WithLimit  bool
+	Offset     string
+	Count      string
+}
+
+// parseZrange parses "key min max [BYSCORE | BYLEX] [REV] [LIMIT offset
+// count] [WITHSCORES]". ZRANGESTORE (store) has no WITHSCORES. Writes the
+// error, if any.
+func parseZrange(c *server.Peer, args []string, store bool) (optsZrange, bool) {
+	var opts optsZrange
 	opts.Key, opts.Min, opts.Max = args[0], args[1], args[2]
 	args = args[3:]
 
 	for len(args) > 0 {
 		switch strings.ToLower(args[0]) {
 		case "byscore":
+			if opts.ByScore || opts.ByLex {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return opts, false
+			}
 			opts.ByScore = true
 			args = args[1:]
 		case "bylex":
+			if opts.ByScore || opts.ByLex {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return opts, false
+			}
 			opts.ByLex = true
 			args = args[1:]
 		case "rev":
@@ -560,61 +629,72 @@ func (m *Miniredis) cmdZrange(c *server.Peer, cmd string, args []string) {
 			opts.WithLimit = true
 			args = args[1:]
 			if len(args) < 2 {
+				setDirty(c)
 				c.WriteError(msgSyntaxError)
-				return
+				return opts, false
 			}
 			opts.Offset = args[0]
 			opts.Count = args[1]
 			args = args[2:]
 		case "withscores":
+			if store {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return opts, false
+			}
 			opts.WithScores = true
 			args = args[1:]
 		default:
+			setDirty(c)
 			c.WriteError(msgSyntaxError)
-			return
+			return opts, false
 		}
 	}
 
-	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		switch {
-		case opts.ByScore && opts.ByLex:
-			c.WriteError(msgSyntaxError)
-		case opts.ByScore:
-			runRangeByScore(m, c, ctx, optsRangeByScore{
-				Key:        opts.Key,
-				Min:        opts.Min,
-				Max:        opts.Max,
-				Reverse:    opts.Reverse,
-				WithLimit:  opts.WithLimit,
-				Offset:     opts.Offset,
-				Count:      opts.Count,
-				WithScores: opts.WithScores,
-			})
-		case opts.ByLex:
-			runRangeByLex(m, c, ctx, optsRangeByLex{
-				Key:        opts.Key,
-				Min:        opts.Min,
-				Max:        opts.Max,
-				Reverse:    opts.Reverse,
-				WithLimit:  opts.WithLimit,
-				Offset:     opts.Offset,
-				Count:      opts.Count,
-				WithScores: opts.WithScores,
-			})
-		default:
-			if opts.WithLimit {
-				c.WriteError(msgLimitCombination)
-				return
-			}
-			runRange(m, c, ctx, optsRange{
-				Key:        opts.Key,
-				Min:        opts.Min,
-				Max:        opts.Max,
-				Reverse:    opts.Reverse,
-				WithScores: opts.WithScores,
-			})
-		}
-	})
+	if opts.WithLimit && !opts.ByScore && !opts.ByLex {
+		setDirty(c)
+		c.WriteError(msgLimitCombination)
+		return opts, false
+	}
+	if opts.WithScores && opts.ByLex {
+		setDirty(c)
+		c.WriteError(msgWithScoresByLex)
+		return opts, false
+	}
+	return opts, true
+}
+
+// elems gives the elements of the range. No locks!
+func (opts optsZrange) elems(db *RedisDB) (ssElems, error) {
+	switch {
+	case opts.ByScore:
+		return rangeByScore(db, optsRangeByScore{
+			Key:       opts.Key,
+			Min:       opts.Min,
+			Max:       opts.Max,
+			Reverse:   opts.Reverse,
+			WithLimit: opts.WithLimit,
+			Offset:    opts.Offset,
+			Count:     opts.Count,
+		})
+	case opts.ByLex:
+		return rangeByLex(db, optsRangeByLex{
+			Key:       opts.Key,
+			Min:       opts.Min,
+			Max:       opts.Max,
+			Reverse:   opts.Reverse,
+			WithLimit: opts.WithLimit,
+			Offset:    opts.Offset,
+			Count:     opts.Count,
+		})
+	default:
+		return rangeByRank(db, optsRange{
+			Key:     opts.Key,
+			Min:     opts.Min,
+			Max:     opts.Max,
+			Reverse: opts.Reverse,
+		})
+	}
 }
 
 // ZREVRANGE
@@ -645,6 +725,7 @@ func (m *Miniredis) cmdZrevrange(c *server.Peer, cmd string, args []string) {
 			opts.WithScores = true
 			args = args[1:]
 		default:
+			setDirty(c)
 			c.WriteError(msgSyntaxError)
 			return
 		}
@@ -683,6 +764,7 @@ func (m *Miniredis) makeCmdZrangebylex(reverse bool) server.Cmd {
 				opts.WithLimit = true
 				args = args[1:]
 				if len(args) < 2 {
+					setDirty(c)
 					c.WriteError(msgSyntaxError)
 					return
 				}
@@ -732,6 +814,7 @@ func (m *Miniredis) makeCmdZrangebyscore(reverse bool) server.Cmd {
 				opts.WithLimit = true
 				args = args[1:]
 				if len(args) < 2 {
+					setDirty(c)
 					c.WriteError(msgSyntaxError)
 					return
 				}
@@ -884,8 +967,6 @@ func (m *Miniredis) cmdZremrangebylex(c *server.Peer, cmd string, args []string)
 		}
 
 		members := db.ssetMembers(opts.Key)
-		// Just key sort. If scores are not the same we don't care.
-		sort.Strings(members)
 		members = withLexRange(members, min, minIncl, max, maxIncl)
 
 		for _, el := range members {
@@ -1044,26 +1125,80 @@ func (m *Miniredis) cmdZscore(c *server.Peer, cmd string, args []string) {
 	})
 }
 
+// ZMSCORE
+func (m *Miniredis) cmdZmscore(c *server.Peer, cmd string, args []string) {
+	if len(args) < 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	key, members := args[0], args[1:]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "zset" {
+			c.WriteError(ErrWrongType.Error())
+			return
+		}
+
+		c.WriteLen(len(members))
+		for _, member := range members {
+			if !db.ssetExists(key, member) {
+				c.WriteNull()
+				continue
+			}
+			c.WriteFloat(db.ssetScore(key, member))
+		}
+	})
+}
+
 // parseFloatRange handles ZRANGEBYSCORE floats. They are inclusive unless the
-// string starts with '('
+// string starts with '('. That also works for infinity: "(+inf" as min matches
+// nothing, and as max it matches everything but the +inf scores.
+// "inf", "+inf", and "-inf" are fine in any case, and so are numbers too big
+// for a float64, which are infinite, same as strtod() in redis. NaN is not.
 func parseFloatRange(s string) (float64, bool, error) {
-	if len(s) == 0 {
-		return 0, false, nil
-	}
 	inclusive := true
-	if s[0] == '(' {
+	if strings.HasPrefix(s, "(") {
 		s = s[1:]
 		inclusive = false
 	}
 	switch strings.ToLower(s) {
-	case "+inf":
-		return math.Inf(+1), true, nil
+	case "inf", "+inf":
+		return math.Inf(+1), inclusive, nil
 	case "-inf":
-		return math.Inf(-1), true, nil
-	default:
-		f, err := strconv.ParseFloat(s, 64)
-		return f, inclusive, err
+		return math.Inf(-1), inclusive, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		err = nil
+	}
+	if err != nil || math.IsNaN(f) {
+		return 0, false, errors.New(msgInvalidMinMax)
 	}
+	return f, inclusive, nil
+}
+
+// parseScore parses a ZADD or ZINCRBY score. It accepts everything
+// strconv.ParseFloat does, so also "inf", "+inf", and "-inf" in any case, but
+// not NaN.
+func parseScore(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) {
+		return 0, errors.New(msgInvalidFloat)
+	}
+	return f, nil
 }
 
 // withSSRange limits a list of sorted set elements by the ZRANGEBYSCORE range
@@ -1100,56 +1235,90 @@ checkmax:
 	return members
 }
 
-// withLexRange limits a list of sorted set elements.
+// withLexRange limits a list of sorted set elements, in sorted set order, by
+// the ZRANGEBYLEX range logic.
+//
+// BYLEX assumes all scores are equal. When they are not, this does what redis
+// does for small sorted sets: the walk in score order starts at the first
+// member >= min, and stops at the first member > max. For big sorted sets
+// redis uses a skiplist, and the result also depends on its random layout.
 func withLexRange(members []string, min string, minIncl bool, max string, maxIncl bool) []string {
-	if max == "-" || min == "+" {
+	gteMin, lteMax, ok := lexRangeCmp(min, minIncl, max, maxIncl)
+	if !ok || len(members) == 0 {
 		return nil
 	}
-	if min != "-" {
-		found := false
-		if minIncl {
-			for i, m := range members {
-				if m >= min {
-					members = members[i:]
-					found = true
-					break
-				}
-			}
-		} else {
-			// Excluding min
-			for i, m := range members {
-				if m > min {
-					members = members[i:]
-					found = true
-					break
-				}
-			}
-		}
-		if !found {
-			return nil
+	if !gteMin(members[len(members)-1]) || !lteMax(members[0]) {
+		return nil
+	}
+	return lexWalk(members, gteMin, lteMax)
+}
+
+// withLexRangeRev is withLexRange for the reversed commands. It returns the
+// members in reverse order. The walk starts at the last member <= max, and
+// stops at the first member < min.
+func withLexRangeRev(members []string, min string, minIncl bool, max string, maxIncl bool) []string {
+	gteMin, lteMax, ok := lexRangeCmp(min, minIncl, max, maxIncl)
+	if !ok || len(members) == 0 {
+		return nil
+	}
+	if !gteMin(members[len(members)-1]) || !lteMax(members[0]) {
+		return nil
+	}
+	rev := make([]string, len(members))
+	copy(rev, members)
+	reverseSlice(rev)
+	return lexWalk(rev, lteMax, gteMin)
+}
+
+// lexWalk skips members until start() is true, and then takes them as long as
+// while() is true.
+func lexWalk(members []string, start, while func(string) bool) []string {
+	for i, m := range members {
+		if start(m) {
+			members = members[i:]
+			break
 		}
 	}
-	if max != "+" {
-		if maxIncl {
-			for i, m := range members {
-				if m > max {
-					members = members[:i]
-					break
-				}
-			}
-		} else {
-			// Excluding max
-			for i, m := range members {
-				if m >= max {
-					members = members[:i]
-					break
-				}
-			}
+	for i, m := range members {
+		if !while(m) {
+			return members[:i]
 		}
 	}
 	return members
 }
 
+// lexRangeCmp makes the comparisons for a ZRANGEBYLEX range. ok is false if
+// nothing can match, such as when min > max.
+func lexRangeCmp(min string, minIncl bool, max string, maxIncl bool) (func(string) bool, func(string) bool, bool) {
+	if max == "-" || min == "+" {
+		return nil, nil, false
+	}
+	if min != "-" && max != "+" && (min > max || min == max && !(minIncl && maxIncl)) {
+		return nil, nil, false
+	}
+	gteMin := func(m string) bool {
+		switch {
+		case min == "-":
+			return true
+		case minIncl:
+			return m >= min
+		default:
+			return m > min
+		}
+	}
+	lteMax := func(m string) bool {
+		switch {
+		case max == "+":
+			return true
+		case maxIncl:
+			return m <= max
+		default:
+			return m < max
+		}
+	}
+	return gteMin, lteMax, true
+}
+
 // ZUNION
 func (m *Miniredis) cmdZunion(c *server.Peer, cmd string, args []string) {
 	if len(args) < 2 {
@@ -1277,22 +1446,13 @@ func (m *Miniredis) cmdZunionstore(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		deleteDest := true
-		for _, key := range keys {
-			if destination == key {
-				deleteDest = false
-			}
-		}
-		if deleteDest {
-			db.del(destination, true)
-		}
 
 		sset, err := executeZUnion(db, opts)
 		if err != nil {
 			c.WriteError(err.Error())
 			return
 		}
-		db.ssetSet(destination, sset)
+		db.ssetStore(destination, sset)
 		c.WriteInt(sset.card())
 	})
 }
@@ -1313,7 +1473,7 @@ func (opts *zunionOptions) parseArgs(args []string, numKeys int) error {
 			}
 			for i := 0; i < numKeys; i++ {
 				f, err := strconv.ParseFloat(args[i+1], 64)
-				if err != nil {
+				if err != nil || math.IsNaN(f) {
 					return errors.New("ERR weight value is not a float")
 				}
 				opts.Weights = append(opts.Weights, f)
@@ -1360,33 +1520,48 @@ func executeZUnion(db *RedisDB, opts zunionOptions) (sortedSet, error) {
 
 		for member, score := range set {
 			if opts.WithWeights {
-				score *= opts.Weights[i]
+				score = zsetScore(score * opts.Weights[i])
 			}
 			old, ok := sset[member]
 			if !ok {
 				sset[member] = score
 				continue
 			}
-			switch opts.Aggregate {
-			default:
-				panic("Invalid aggregate")
-			case "sum":
-				sset[member] += score
-			case "min":
-				if score < old {
-					sset[member] = score
-				}
-			case "max":
-				if score > old {
-					sset[member] = score
-				}
-			}
+			sset[member] = zsetAggregate(opts.Aggregate, old, score)
 		}
 	}
 
 	return sset, nil
 }
 
+// zsetAggregate combines two scores for the AGGREGATE option of ZUNION and
+// ZINTER*.
+func zsetAggregate(aggregate string, old, score float64) float64 {
+	switch aggregate {
+	default:
+		panic("Invalid aggregate")
+	case "sum":
+		return zsetScore(old + score)
+	case "min":
+		return math.Min(old, score)
+	case "max":
+		return math.Max(old, score)
+	}
+}
+
+// zsetScore is the score redis stores for the result of a weight or a sum:
+// NaN, which is inf * 0, or inf + -inf, is 0.
+func zsetScore(f float64) float64 {
+	if math.IsNaN(f) {
+		return 0
+	}
+	return f
+}
+
+// zscanSmall is the size up to which redis keeps a sorted set in a single
+// listpack, which ZSCAN returns in one go, whatever the COUNT.
+const zscanSmall = 128
+
 // ZSCAN
 func (m *Miniredis) cmdZscan(c *server.Peer, cmd string, args []string) {
 	if len(args) < 2 {
@@ -1403,13 +1578,14 @@ func (m *Miniredis) cmdZscan(c *server.Peer, cmd string, args []string) {
 
 	var opts struct {
 		key       string
-		cursor    int
+		cursor    int64
+		count     int
 		withMatch bool
 		match     string
 	}
 
 	opts.key = args[0]
-	if ok := optIntErr(c, args[1], &opts.cursor, msgInvalidCursor); !ok {
+	if ok := optCursor(c, args[1], &opts.cursor); !ok {
 		return
 	}
 	args = args[2:]
@@ -1421,13 +1597,19 @@ func (m *Miniredis) cmdZscan(c *server.Peer, cmd string, args []string) {
 				c.WriteError(msgSyntaxError)
 				return
 			}
-			if _, err := strconv.Atoi(args[1]); err != nil {
+			count, err := strconv.Atoi(args[1])
+			if err != nil {
 				setDirty(c)
 				c.WriteError(msgInvalidInt)
 				return
 			}
-			// We do nothing with count.
-			args = args[2:]
+			if count < 1 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			// Only used with DeterministicScan(), or for big sorted sets.
+			opts.count, args = count, args[2:]
 			continue
 		}
 		if strings.ToLower(args[0]) == "match" {
@@ -1448,31 +1630,40 @@ func (m *Miniredis) cmdZscan(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		// Paging is not implementend, all results are returned for cursor 0.
-		if opts.cursor != 0 {
-			// Invalid cursor.
-			c.WriteLen(2)
-			c.WriteBulk("0") // no next cursor
-			c.WriteLen(0)    // no elements
-			return
-		}
-		if db.exists(opts.key) && db.t(opts.key) != "zset" {
+		if db.wrongType(opts.key, "zset") {
 			c.WriteError(ErrWrongType.Error())
 			return
 		}
 
 		members := db.ssetMembers(opts.key)
+		var (
+			next int64
+			err  error
+		)
+		switch {
+		case m.stableScan:
+			members, next, err = m.scanPage(members, opts.cursor, opts.count)
+		case len(members) > zscanSmall:
+			members, next = hashScanPage(members, opts.cursor, opts.count)
+		case opts.cursor != 0:
+			// Small sorted sets are returned in one go, for cursor 0.
+			members = nil
+		}
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
 		if opts.withMatch {
 			members, _ = matchKeys(members, opts.match)
 		}
 
 		c.WriteLen(2)
-		c.WriteBulk("0") // no next cursor
-		// HSCAN gives key, values.
+		c.WriteBulk(strconv.FormatInt(next, 10))
+		// HSCAN gives key, values. The scores are strings, also in RESP3.
 		c.WriteLen(len(members) * 2)
 		for _, k := range members {
 			c.WriteBulk(k)
-			c.WriteFloat(db.ssetScore(opts.key, k))
+			c.WriteBulk(server.FormatFloat(db.ssetScore(opts.key, k)))
 		}
 	})
 }
@@ -1503,6 +1694,7 @@ func (m *Miniredis) cmdZpopmax(reverse bool) server.Cmd {
 
 		withScores := true
 		if len(args) > 2 {
+			setDirty(c)
 			c.WriteError(msgSyntaxError)
 			return
 		}
@@ -1581,7 +1773,14 @@ func (m *Miniredis) cmdZrandmember(c *server.Peer, cmd string, args []string) {
 
 	if len(args) > 0 {
 		setDirty(c)
-		c.WriteError(errWrongNumber(cmd))
+		c.WriteError(msgSyntaxError)
+		return
+	}
+
+	if opts.withScores && (opts.count < -math.MaxInt64/2 || opts.count > math.MaxInt64/2) {
+		// same as redis, since the reply would be twice as long
+		setDirty(c)
+		c.WriteError(msgValueOutOfRange)
 		return
 	}
 
@@ -1603,12 +1802,7 @@ func (m *Miniredis) cmdZrandmember(c *server.Peer, cmd string, args []string) {
 		}
 
 		if !opts.withCount {
-			member := db.ssetRandomMember(opts.key)
-			if member == "" {
-				c.WriteNull()
-				return
-			}
-			c.WriteBulk(member)
+			c.WriteBulk(db.ssetRandomMember(opts.key))
 			return
 		}
 
@@ -1650,43 +1844,80 @@ type optsRange struct {
 }
 
 func runRange(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRange) {
+	elems, err := rangeByRank(m.db(cctx.selectedDB), opts)
+	if err != nil {
+		c.WriteError(err.Error())
+		return
+	}
+	writeRange(c, elems, opts.WithScores)
+}
+
+// rangeByRank gives the elements of a ZRANGE by rank. No locks!
+func rangeByRank(db *RedisDB, opts optsRange) (ssElems, error) {
 	min, minErr := strconv.Atoi(opts.Min)
 	max, maxErr := strconv.Atoi(opts.Max)
 	if minErr != nil || maxErr != nil {
-		c.WriteError(msgInvalidInt)
-		return
+		return nil, errors.New(msgInvalidInt)
 	}
 
-	db := m.db(cctx.selectedDB)
-
 	if !db.exists(opts.Key) {
-		c.WriteLen(0)
-		return
+		return nil, nil
 	}
 
 	if db.t(opts.Key) != "zset" {
-		c.WriteError(ErrWrongType.Error())
-		return
+		return nil, ErrWrongType
 	}
 
-	members := db.ssetMembers(opts.Key)
+	members := db.ssetElements(opts.Key)
 	if opts.Reverse {
-		reverseSlice(members)
+		reverseElems(members)
 	}
 	rs, re := redisRange(len(members), min, max, false)
-	if opts.WithScores {
-		c.WriteLen((re - rs) * 2)
+	return members[rs:re], nil
+}
+
+// writeRange writes the elements of a ZRANGE, with or without scores.
+func writeRange(c *server.Peer, elems ssElems, withScores bool) {
+	if withScores {
+		c.WriteLen(len(elems) * 2)
 	} else {
-		c.WriteLen(re - rs)
+		c.WriteLen(len(elems))
 	}
-	for _, el := range members[rs:re] {
-		c.WriteBulk(el)
-		if opts.WithScores {
-			c.WriteFloat(db.ssetScore(opts.Key, el))
+	for _, el := range elems {
+		c.WriteBulk(el.member)
+		if withScores {
+			c.WriteFloat(el.score)
 		}
 	}
 }
 
+// limitRange applies a BYSCORE or BYLEX LIMIT to n elements. That's <offset>
+// <count>, unlike RANGE, and done the way redis does: a negative offset, or one
+// past the end, matches nothing, and a negative count means all remaining
+// elements.
+func limitRange(n, offset, count int) (int, int) {
+	if offset < 0 || offset >= n {
+		return 0, 0
+	}
+	if count < 0 || count > n-offset {
+		return offset, n
+	}
+	return offset, offset + count
+}
+
+// parseLimit parses the <offset> <count> of a LIMIT.
+func parseLimit(offset, count string) (int, int, error) {
+	o, err := strconv.Atoi(offset)
+	if err != nil {
+		return 0, 0, errors.New(msgInvalidInt)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, errors.New(msgInvalidInt)
+	}
+	return o, n, nil
+}
+
 type optsRangeByScore struct {
 	Key        string
 	Min        string
@@ -1699,37 +1930,36 @@ type optsRangeByScore struct {
 }
 
 func runRangeByScore(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRangeByScore) {
+	elems, err := rangeByScore(m.db(cctx.selectedDB), opts)
+	if err != nil {
+		c.WriteError(err.Error())
+		return
+	}
+	writeRange(c, elems, opts.WithScores)
+}
+
+// rangeByScore gives the elements of a ZRANGE BYSCORE. No locks!
+func rangeByScore(db *RedisDB, opts optsRangeByScore) (ssElems, error) {
 	var limitOffset, limitCount int
-	var err error
 	if opts.WithLimit {
-		limitOffset, err = strconv.Atoi(opts.Offset)
-		if err != nil {
-			c.WriteError(msgInvalidInt)
-			return
-		}
-		limitCount, err = strconv.Atoi(opts.Count)
+		var err error
+		limitOffset, limitCount, err = parseLimit(opts.Offset, opts.Count)
 		if err != nil {
-			c.WriteError(msgInvalidInt)
-			return
+			return nil, err
 		}
 	}
 	min, minIncl, minErr := parseFloatRange(opts.Min)
 	max, maxIncl, maxErr := parseFloatRange(opts.Max)
 	if minErr != nil || maxErr != nil {
-		c.WriteError(msgInvalidMinMax)
-		return
+		return nil, errors.New(msgInvalidMinMax)
 	}
 
-	db := m.db(cctx.selectedDB)
-
 	if !db.exists(opts.Key) {
-		c.WriteLen(0)
-		return
+		return nil, nil
 	}
 
 	if db.t(opts.Key) != "zset" {
-		c.WriteError(ErrWrongType.Error())
-		return
+		return nil, ErrWrongType
 	}
 
 	members := db.ssetElements(opts.Key)
@@ -1742,36 +1972,11 @@ func runRangeByScore(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRange
 		reverseElems(members)
 	}
 
-	// Apply LIMIT ranges. That's <start> <elements>. Unlike RANGE.
 	if opts.WithLimit {
-		if limitOffset < 0 {
-			members = ssElems{}
-		} else {
-			if limitOffset < len(members) {
-				members = members[limitOffset:]
-			} else {
-				// out of range
-				members = ssElems{}
-			}
-			if limitCount >= 0 {
-				if len(members) > limitCount {
-					members = members[:limitCount]
-				}
-			}
-		}
-	}
-
-	if opts.WithScores {
-		c.WriteLen(len(members) * 2)
-	} else {
-		c.WriteLen(len(members))
-	}
-	for _, el := range members {
-		c.WriteBulk(el.member)
-		if opts.WithScores {
-			c.WriteFloat(el.score)
-		}
+		start, end := limitRange(len(members), limitOffset, limitCount)
+		members = members[start:end]
 	}
+	return members, nil
 }
 
 type optsRangeByLex struct {
@@ -1786,74 +1991,57 @@ type optsRangeByLex struct {
 }
 
 func runRangeByLex(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRangeByLex) {
+	elems, err := rangeByLex(m.db(cctx.selectedDB), opts)
+	if err != nil {
+		c.WriteError(err.Error())
+		return
+	}
+	writeRange(c, elems, false)
+}
+
+// rangeByLex gives the elements of a ZRANGE BYLEX. No locks!
+func rangeByLex(db *RedisDB, opts optsRangeByLex) (ssElems, error) {
 	var limitOffset, limitCount int
-	var err error
 	if opts.WithLimit {
-		limitOffset, err = strconv.Atoi(opts.Offset)
-		if err != nil {
-			c.WriteError(msgInvalidInt)
-			return
-		}
-		limitCount, err = strconv.Atoi(opts.Count)
+		var err error
+		limitOffset, limitCount, err = parseLimit(opts.Offset, opts.Count)
 		if err != nil {
-			c.WriteError(msgInvalidInt)
-			return
+			return nil, err
 		}
 	}
 	min, minIncl, minErr := parseLexrange(opts.Min)
 	max, maxIncl, maxErr := parseLexrange(opts.Max)
 	if minErr != nil || maxErr != nil {
-		c.WriteError(msgInvalidRangeItem)
-		return
+		return nil, errors.New(msgInvalidRangeItem)
 	}
 
-	db := m.db(cctx.selectedDB)
-
 	if !db.exists(opts.Key) {
-		c.WriteLen(0)
-		return
+		return nil, nil
 	}
 
 	if db.t(opts.Key) != "zset" {
-		c.WriteError(ErrWrongType.Error())
-		return
+		return nil, ErrWrongType
 	}
 
 	members := db.ssetMembers(opts.Key)
-	// Just key sort. If scores are not the same we don't care.
-	sort.Strings(members)
 	if opts.Reverse {
 		min, max = max, min
 		minIncl, maxIncl = maxIncl, minIncl
-	}
-	members = withLexRange(members, min, minIncl, max, maxIncl)
-	if opts.Reverse {
-		reverseSlice(members)
+		members = withLexRangeRev(members, min, minIncl, max, maxIncl)
+	} else {
+		members = withLexRange(members, min, minIncl, max, maxIncl)
 	}
 
-	// Apply LIMIT ranges. That's <start> <elements>. Unlike RANGE.
 	if opts.WithLimit {
-		if limitOffset < 0 {
-			members = nil
-		} else {
-			if limitOffset < len(members) {
-				members = members[limitOffset:]
-			} else {
-				// out of range
-				members = nil
-			}
-			if limitCount >= 0 {
-				if len(members) > limitCount {
-					members = members[:limitCount]
-				}
-			}
-		}
+		start, end := limitRange(len(members), limitOffset, limitCount)
+		members = members[start:end]
 	}
 
-	c.WriteLen(len(members))
-	for _, el := range members {
-		c.WriteBulk(el)
+	elems := make(ssElems, 0, len(members))
+	for _, member := range members {
+		elems = append(elems, ssElem{score: db.ssetScore(opts.Key, member), member: member})
 	}
+	return elems, nil
 }
 
 // optLexrange handles ZRANGE{,BYLEX} ranges. They start with '[', '(', or are
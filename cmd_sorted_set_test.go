@@ -1,8 +1,11 @@
 package miniredis
 
 import (
+	"fmt"
 	"math"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -89,6 +92,17 @@ func TestSortedSet(t *testing.T) {
 			"ZADD", "z", "noint", "two",
 			proto.Error("ERR value is not a valid float"),
 		)
+		mustDo(t, c,
+			"ZADD", "z", "nan", "two",
+			proto.Error("ERR value is not a valid float"),
+		)
+		mustDo(t, c,
+			"ZADD", "z", "INCR", "NaN", "two",
+			proto.Error("ERR value is not a valid float"),
+		)
+
+		_, err := s.ZAdd("z", math.NaN(), "two")
+		equals(t, ErrFloatValueError, err)
 	}
 
 	// ZRANK on non-existing key/member
@@ -283,6 +297,111 @@ func TestSortedSetAdd(t *testing.T) {
 			"ZADD", "set", "GT", "LT", "1.0", "foo",
 			proto.Error(msgGTLTandNX),
 		)
+		// the flags are checked before the scores
+		mustDo(t, c,
+			"ZADD", "set", "NX", "XX", "nofloat", "foo",
+			proto.Error(msgXXandNX),
+		)
+		mustDo(t, c,
+			"ZADD", "set", "INCR", "1", "foo", "1", "foo",
+			proto.Error(msgSingleElementPair),
+		)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		// GT and LT don't stop new members
+		mustDo(t, c, "ZADD", "flags", "GT", "-1", "a", proto.Int(1))
+		mustDo(t, c, "ZADD", "flags", "LT", "5", "b", proto.Int(1))
+		mustDo(t, c, "ZADD", "flags", "GT", "CH", "-2", "a", "6", "b", proto.Int(1))
+		mustDo(t, c, "ZADD", "flags", "LT", "CH", "-2", "a", "6", "b", proto.Int(1))
+		mustDo(t, c, "ZRANGE", "flags", "0", "-1", "WITHSCORES",
+			proto.Strings("a", "-2", "b", "6"),
+		)
+
+		// a member twice is done in order
+		mustDo(t, c, "ZADD", "flags", "GT", "CH", "10", "a", "3", "a", proto.Int(1))
+		mustDo(t, c, "ZSCORE", "flags", "a", proto.String("10"))
+		mustDo(t, c, "ZADD", "flags", "CH", "1", "c", "2", "c", proto.Int(2))
+		mustDo(t, c, "ZADD", "flags", "1", "d", "2", "d", proto.Int(1))
+
+		// XX with GT
+		mustDo(t, c, "ZADD", "flags", "XX", "GT", "CH", "20", "a", "100", "nosuch", proto.Int(1))
+		mustNil(t, c, "ZSCORE", "flags", "nosuch")
+
+		// INCR with GT and LT
+		mustDo(t, c, "ZADD", "flags", "GT", "INCR", "1", "a", proto.String("21"))
+		mustNil(t, c, "ZADD", "flags", "GT", "INCR", "-1", "a")
+		mustDo(t, c, "ZADD", "flags", "LT", "INCR", "-1", "a", proto.String("20"))
+		mustNil(t, c, "ZADD", "flags", "LT", "INCR", "0", "a")
+		mustDo(t, c, "ZADD", "flags", "GT", "INCR", "-7", "new", proto.String("-7"))
+
+		// NaN
+		mustDo(t, c, "ZADD", "flags", "inf", "inf", proto.Int(1))
+		mustDo(t, c, "ZADD", "flags", "INCR", "-inf", "inf", proto.Error(msgScoreNaN))
+		mustNil(t, c, "ZADD", "flags", "NX", "INCR", "-inf", "inf")
+
+		// XX on a new key doesn't make it
+		mustDo(t, c, "ZADD", "newkey", "XX", "1", "a", proto.Int(0))
+		mustNil(t, c, "ZADD", "newkey", "XX", "INCR", "1", "a")
+		equals(t, false, s.Exists("newkey"))
+	})
+
+	t.Run("ZAddOpt", func(t *testing.T) {
+		add := func(opts ZAddOptions, score float64, member string) (float64, bool) {
+			t.Helper()
+			sc, changed, err := s.ZAddOpt("opt", opts, score, member)
+			ok(t, err)
+			return sc, changed
+		}
+
+		sc, changed := add(ZAddOptions{XX: true}, 1, "a")
+		equals(t, 0.0, sc)
+		equals(t, false, changed)
+		equals(t, false, s.Exists("opt"))
+
+		sc, changed = add(ZAddOptions{NX: true}, 1, "a")
+		equals(t, 1.0, sc)
+		equals(t, true, changed)
+		sc, changed = add(ZAddOptions{NX: true}, 2, "a")
+		equals(t, 1.0, sc)
+		equals(t, false, changed)
+
+		sc, changed = add(ZAddOptions{GT: true}, 0, "a")
+		equals(t, 1.0, sc)
+		equals(t, false, changed)
+		sc, changed = add(ZAddOptions{GT: true}, 5, "a")
+		equals(t, 5.0, sc)
+		equals(t, true, changed)
+		sc, changed = add(ZAddOptions{LT: true}, 6, "a")
+		equals(t, 5.0, sc)
+		equals(t, false, changed)
+		sc, changed = add(ZAddOptions{LT: true}, 9, "new")
+		equals(t, 9.0, sc)
+		equals(t, true, changed)
+
+		sc, changed = add(ZAddOptions{INCR: true}, 2, "a")
+		equals(t, 7.0, sc)
+		equals(t, true, changed)
+		sc, changed = add(ZAddOptions{INCR: true, LT: true}, 1, "a")
+		equals(t, 7.0, sc)
+		equals(t, false, changed)
+		mustDo(t, c, "ZRANGE", "opt", "0", "-1", "WITHSCORES",
+			proto.Strings("a", "7", "new", "9"),
+		)
+
+		// errors are the ones of ZADD
+		_, _, err := s.ZAddOpt("opt", ZAddOptions{NX: true, XX: true}, 1, "a")
+		equals(t, msgXXandNX, err.Error())
+		_, _, err = s.ZAddOpt("opt", ZAddOptions{NX: true, GT: true}, 1, "a")
+		equals(t, msgGTLTandNX, err.Error())
+		_, _, err = s.ZAddOpt("opt", ZAddOptions{}, math.NaN(), "a")
+		equals(t, ErrFloatValueError, err)
+		s.ZAdd("infs", math.Inf(+1), "a")
+		_, _, err = s.ZAddOpt("infs", ZAddOptions{INCR: true}, math.Inf(-1), "a")
+		equals(t, msgScoreNaN, err.Error())
+		s.Set("str", "value")
+		_, _, err = s.ZAddOpt("str", ZAddOptions{}, 1, "a")
+		equals(t, ErrWrongType, err)
 	})
 
 	useRESP3(t, c)
@@ -373,6 +492,30 @@ func TestSortedSetRange(t *testing.T) {
 		)
 	})
 
+	t.Run("byscore and bylex", func(t *testing.T) {
+		mustDo(t, c,
+			"ZRANGE", "z", "(3", "2", "byScore", "rev", "WITHSCORES",
+			proto.Strings("zwei", "2", "two", "2"),
+		)
+		mustDo(t, c,
+			"ZRANGE", "z", "+inf", "-inf", "REV", "LIMIT", "1", "2", "BYSCORE",
+			proto.Strings("three", "drei"),
+		)
+
+		s.ZAdd("lex", 0, "alpha")
+		s.ZAdd("lex", 0, "bravo")
+		s.ZAdd("lex", 0, "charlie")
+		s.ZAdd("lex", 0, "delta")
+		mustDo(t, c,
+			"ZRANGE", "lex", "[b", "(d", "BYLEX",
+			proto.Strings("bravo", "charlie"),
+		)
+		mustDo(t, c,
+			"ZRANGE", "lex", "+", "-", "BYLEX", "REV", "LIMIT", "1", "2",
+			proto.Strings("charlie", "bravo"),
+		)
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		mustDo(t, c,
 			"ZRANGE",
@@ -402,6 +545,22 @@ func TestSortedSetRange(t *testing.T) {
 			"ZRANGE", "set", "1", "2", "LIMIT", "1", "2",
 			proto.Error(msgLimitCombination),
 		)
+		mustDo(t, c,
+			"ZRANGE", "set", "1", "2", "BYSCORE", "BYSCORE",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZRANGE", "set", "[a", "[b", "BYLEX", "BYSCORE",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZRANGE", "set", "[a", "[b", "BYLEX", "WITHSCORES",
+			proto.Error(msgWithScoresByLex),
+		)
+		mustDo(t, c,
+			"ZRANGE", "set", "1", "2", "BYSCORE", "LIMIT", "1",
+			proto.Error(msgSyntaxError),
+		)
 		// Wrong type of key
 		s.Set("str", "value")
 		mustDo(t, c,
@@ -581,6 +740,58 @@ func TestSortedSetRangeByScore(t *testing.T) {
 		proto.Strings(),
 	)
 
+	// Exclusive infinity
+	{
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "3", "(+inf",
+			proto.Strings("drei", "three"),
+		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "(+inf", "+inf",
+			proto.Strings(),
+		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "(-inf", "(-4",
+			proto.Strings("zero kelvin"),
+		)
+		mustDo(t, c,
+			"ZREVRANGEBYSCORE", "z", "(inf", "3",
+			proto.Strings("three", "drei"),
+		)
+		mustDo(t, c,
+			"ZCOUNT", "z", "(-inf", "(+inf",
+			proto.Int(7),
+		)
+	}
+
+	// Infinity in any case, and numbers too big for a float64
+	{
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "3", "INF",
+			proto.Strings("drei", "three", "inf"),
+		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "(-Inf", "(-4",
+			proto.Strings("zero kelvin"),
+		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "3", "1e400",
+			proto.Strings("drei", "three", "inf"),
+		)
+		mustDo(t, c,
+			"ZCOUNT", "z", "-1e400", "(-4",
+			proto.Int(1),
+		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "nan", "3",
+			proto.Error(msgInvalidMinMax),
+		)
+		mustDo(t, c,
+			"ZCOUNT", "z", "1", "(NaN",
+			proto.Error(msgInvalidMinMax),
+		)
+	}
+
 	// Wrong ranges
 	{
 		mustDo(t, c,
@@ -683,6 +894,14 @@ func TestSortedSetRangeByScore(t *testing.T) {
 			"ZRANGEBYSCORE", "set", "[1", "2",
 			proto.Error("ERR min or max is not a float"),
 		)
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "set", "", "2",
+			proto.Error("ERR min or max is not a float"),
+		)
+		mustDo(t, c,
+			"ZCOUNT", "set", "1", "",
+			proto.Error("ERR min or max is not a float"),
+		)
 		mustDo(t, c,
 			"ZRANGEBYSCORE", "set", "1", "[2",
 			proto.Error("ERR min or max is not a float"),
@@ -838,6 +1057,24 @@ func TestSortedSetRemRangeByLex(t *testing.T) {
 		"ZREMRANGEBYLEX", "z", "+", "(z",
 	)
 
+	t.Run("watch", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c2, "WATCH", "z")
+		must1(t, c, "ZREMRANGEBYLEX", "z", "[drei", "[drei")
+		mustOK(t, c2, "MULTI")
+		mustDo(t, c2, "ZCARD", "z", proto.Inline("QUEUED"))
+		mustNilList(t, c2, "EXEC")
+
+		mustOK(t, c2, "WATCH", "z")
+		must0(t, c, "ZREMRANGEBYLEX", "z", "[a", "[b")
+		mustOK(t, c2, "MULTI")
+		mustDo(t, c2, "ZCARD", "z", proto.Inline("QUEUED"))
+		mustDo(t, c2, "EXEC", proto.Array(proto.Int(5)))
+	})
+
 	// No such key
 	must0(t, c,
 		"ZREMRANGEBYLEX", "nosuch", "-", "+",
@@ -960,6 +1197,52 @@ func TestSortedSetRemRangeByRank(t *testing.T) {
 			proto.Error(msgWrongType),
 		)
 	})
+
+	t.Run("ranges", func(t *testing.T) {
+		add := func() {
+			s.Del("r")
+			for i, m := range []string{"a", "b", "c", "d", "e"} {
+				s.ZAdd("r", float64(i), m)
+			}
+		}
+
+		add()
+		must0(t, c, "ZREMRANGEBYRANK", "r", "3", "1")
+		must0(t, c, "ZREMRANGEBYRANK", "r", "-1", "-2")
+		must0(t, c, "ZREMRANGEBYRANK", "r", "5", "-1")
+		mustDo(t, c, "ZREMRANGEBYRANK", "r", "-100", "1", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "r", "0", "-1", proto.Strings("c", "d", "e"))
+
+		add()
+		mustDo(t, c, "ZREMRANGEBYRANK", "r", "3", "9223372036854775807", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "r", "0", "-1", proto.Strings("a", "b", "c"))
+
+		add()
+		mustDo(t, c, "ZREMRANGEBYRANK", "r", "-9223372036854775808", "-5", proto.Int(1))
+		mustDo(t, c, "ZRANGE", "r", "0", "-1", proto.Strings("b", "c", "d", "e"))
+	})
+
+	t.Run("sliding window", func(t *testing.T) {
+		// keep the newest 3 hits, as a rate limiter does
+		hit := func(now int, member string, removed, card int) {
+			t.Helper()
+			mustOK(t, c, "MULTI")
+			mustDo(t, c, "ZADD", "hits", strconv.Itoa(now), member, proto.Inline("QUEUED"))
+			mustDo(t, c, "ZREMRANGEBYRANK", "hits", "0", "-4", proto.Inline("QUEUED"))
+			mustDo(t, c, "ZCARD", "hits", proto.Inline("QUEUED"))
+			mustDo(t, c, "EXEC", proto.Array(
+				proto.Int(1),
+				proto.Int(removed),
+				proto.Int(card),
+			))
+		}
+		hit(1, "h1", 0, 1)
+		hit(2, "h2", 0, 2)
+		hit(3, "h3", 0, 3)
+		hit(4, "h4", 1, 3)
+		hit(5, "h5", 1, 3)
+		mustDo(t, c, "ZRANGE", "hits", "0", "-1", proto.Strings("h3", "h4", "h5"))
+	})
 }
 
 // Test ZREMRANGEBYSCORE
@@ -1046,6 +1329,63 @@ func TestSortedSetRangeRemByScore(t *testing.T) {
 			"ZREMRANGEBYSCORE", "str", "1", "2",
 			proto.Error(msgWrongType),
 		)
+		mustDo(t, c,
+			"ZREMRANGEBYSCORE", "z", "(", "1",
+			proto.Error(msgInvalidMinMax),
+		)
+		mustDo(t, c,
+			"ZREMRANGEBYSCORE", "z", "[1", "2",
+			proto.Error(msgInvalidMinMax),
+		)
+	})
+
+	t.Run("infinite", func(t *testing.T) {
+		add := func() {
+			s.Del("inf")
+			s.ZAdd("inf", math.Inf(-1), "minf")
+			s.ZAdd("inf", 1, "one")
+			s.ZAdd("inf", 2, "two")
+			s.ZAdd("inf", math.Inf(+1), "pinf")
+		}
+
+		add()
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "(-inf", "(+inf", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "inf", "0", "-1", proto.Strings("minf", "pinf"))
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "-inf", "-inf", proto.Int(1))
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "inf", "inf", proto.Int(1))
+		equals(t, false, s.Exists("inf"))
+
+		add()
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "(1", "(1", proto.Int(0))
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "1", "1", proto.Int(1))
+		mustDo(t, c, "ZREMRANGEBYSCORE", "inf", "(1", "+inf", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "inf", "0", "-1", proto.Strings("minf"))
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		// drop everything older than 100, as a time series does
+		for i := 0; i < 10; i++ {
+			s.ZAdd("series", float64(i*25), strconv.Itoa(i))
+		}
+		mustOK(t, c, "WATCH", "series")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZREMRANGEBYSCORE", "series", "-inf", "(100", proto.Inline("QUEUED"))
+		mustDo(t, c, "ZCARD", "series", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Int(4), proto.Int(6)))
+		mustDo(t, c, "ZRANGE", "series", "0", "0", proto.Strings("4"))
+
+		// an empty range is no change for WATCH
+		mustOK(t, c, "WATCH", "series")
+		must0(t, c, "ZREMRANGEBYSCORE", "series", "-inf", "(100")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZCARD", "series", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Int(6)))
+
+		mustOK(t, c, "WATCH", "series")
+		must1(t, c, "ZREMRANGEBYSCORE", "series", "-inf", "100")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZCARD", "series", proto.Inline("QUEUED"))
+		mustNilList(t, c, "EXEC")
 	})
 }
 
@@ -1333,6 +1673,68 @@ func TestSortedSetRangeByLex(t *testing.T) {
 			proto.Error(errWrongNumber("zlexcount")),
 		)
 	})
+
+	t.Run("different scores", func(t *testing.T) {
+		s.ZAdd("zs", 1, "b")
+		s.ZAdd("zs", 2, "a")
+		s.ZAdd("zs", 3, "c")
+
+		mustDo(t, c,
+			"ZRANGEBYLEX", "zs", "-", "+",
+			proto.Strings("b", "a", "c"),
+		)
+		mustDo(t, c,
+			"ZRANGEBYLEX", "zs", "[a", "[b",
+			proto.Strings("b", "a"),
+		)
+		mustDo(t, c,
+			"ZRANGEBYLEX", "zs", "-", "[a",
+			proto.Strings(),
+		)
+		mustDo(t, c,
+			"ZRANGEBYLEX", "zs", "[c", "+",
+			proto.Strings("c"),
+		)
+		mustDo(t, c,
+			"ZREVRANGEBYLEX", "zs", "+", "-",
+			proto.Strings("c", "a", "b"),
+		)
+		mustDo(t, c,
+			"ZREVRANGEBYLEX", "zs", "[b", "-",
+			proto.Strings("a", "b"),
+		)
+		mustDo(t, c,
+			"ZLEXCOUNT", "zs", "[a", "[b",
+			proto.Int(2),
+		)
+		mustDo(t, c,
+			"ZRANGEBYLEX", "zs", "[c", "[a",
+			proto.Strings(),
+		)
+	})
+
+	t.Run("ZLEXCOUNT", func(t *testing.T) {
+		s.ZAdd("ze", 0, "")
+		s.ZAdd("ze", 0, "a")
+		s.ZAdd("ze", 0, "b")
+		mustDo(t, c, "ZLEXCOUNT", "ze", "[", "+", proto.Int(3))
+		mustDo(t, c, "ZLEXCOUNT", "ze", "(", "+", proto.Int(2))
+		mustDo(t, c, "ZLEXCOUNT", "ze", "-", "[a", proto.Int(2))
+		mustDo(t, c, "ZLEXCOUNT", "ze", "+", "-", proto.Int(0))
+		mustDo(t, c, "EVAL", "return redis.call('ZLEXCOUNT', KEYS[1], '(a', '+')", "1", "ze", proto.Int(1))
+
+		s.Set("str", "value")
+		mustDo(t, c,
+			"ZLEXCOUNT", "str", "-", "+",
+			proto.Error(msgWrongType),
+		)
+
+		// like redis, the range is only checked when the command runs
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZLEXCOUNT", "ze", "a", "b", proto.Inline("QUEUED"))
+		mustDo(t, c, "ZLEXCOUNT", "ze", "-", "+", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Error(msgInvalidRangeItem), proto.Int(3)))
+	})
 }
 
 // Test ZINCRBY
@@ -1389,6 +1791,96 @@ func TestSortedSetIncrby(t *testing.T) {
 			proto.Error(msgWrongType),
 		)
 	})
+
+	t.Run("inf", func(t *testing.T) {
+		mustDo(t, c,
+			"ZINCRBY", "zi", "+inf", "member",
+			proto.String("inf"),
+		)
+		mustDo(t, c,
+			"ZINCRBY", "zi", "INF", "member",
+			proto.String("inf"),
+		)
+		mustDo(t, c,
+			"ZINCRBY", "zi", "-inf", "member",
+			proto.Error(msgScoreNaN),
+		)
+		mustDo(t, c,
+			"ZADD", "zi", "INCR", "-inf", "member",
+			proto.Error(msgScoreNaN),
+		)
+		mustDo(t, c,
+			"ZINCRBY", "zi", "nan", "member",
+			proto.Error(msgInvalidFloat),
+		)
+		mustDo(t, c,
+			"ZSCORE", "zi", "member",
+			proto.String("inf"),
+		)
+	})
+}
+
+// LIMIT in ZRANGEBYSCORE and ZRANGEBYLEX, and their friends
+func TestSortedSetLimit(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		s.ZAdd("z", float64(i), m)
+	}
+
+	for _, tc := range []struct {
+		offset, count string
+		want          []string
+	}{
+		{"0", "-1", []string{"a", "b", "c", "d", "e"}},
+		{"0", "-100", []string{"a", "b", "c", "d", "e"}},
+		{"2", "-1", []string{"c", "d", "e"}},
+		{"4", "-1", []string{"e"}},
+		{"5", "-1", []string{}},
+		{"9223372036854775807", "1", []string{}},
+		{"0", "0", []string{}},
+		{"0", "2", []string{"a", "b"}},
+		{"3", "2", []string{"d", "e"}},
+		{"3", "9223372036854775807", []string{"d", "e"}},
+		{"-1", "2", []string{}},
+		{"-1", "-1", []string{}},
+	} {
+		mustDo(t, c,
+			"ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", tc.offset, tc.count,
+			proto.Strings(tc.want...),
+		)
+		mustDo(t, c,
+			"ZRANGEBYLEX", "z", "-", "+", "LIMIT", tc.offset, tc.count,
+			proto.Strings(tc.want...),
+		)
+		mustDo(t, c,
+			"ZRANGE", "z", "-inf", "+inf", "BYSCORE", "LIMIT", tc.offset, tc.count,
+			proto.Strings(tc.want...),
+		)
+		mustDo(t, c,
+			"ZRANGE", "z", "-", "+", "BYLEX", "LIMIT", tc.offset, tc.count,
+			proto.Strings(tc.want...),
+		)
+	}
+
+	// reversed, the offset counts from the end
+	mustDo(t, c,
+		"ZREVRANGEBYSCORE", "z", "+inf", "-inf", "LIMIT", "1", "-1",
+		proto.Strings("d", "c", "b", "a"),
+	)
+	mustDo(t, c,
+		"ZREVRANGEBYLEX", "z", "+", "-", "LIMIT", "1", "2",
+		proto.Strings("d", "c"),
+	)
+	mustDo(t, c,
+		"ZRANGE", "z", "+inf", "-inf", "BYSCORE", "REV", "LIMIT", "-1", "2",
+		proto.Strings(),
+	)
 }
 
 func TestZscan(t *testing.T) {
@@ -1399,7 +1891,7 @@ func TestZscan(t *testing.T) {
 	ok(t, err)
 	defer c.Close()
 
-	// We cheat with zscan. It always returns everything.
+	// Small sorted sets are returned in one go, as redis does.
 
 	s.ZAdd("h", 1.0, "field1")
 	s.ZAdd("h", 2.0, "field2")
@@ -1481,6 +1973,10 @@ func TestZscan(t *testing.T) {
 			"ZSCAN", "set", "0", "COUNT", "noint",
 			proto.Error(msgInvalidInt),
 		)
+		mustDo(t, c,
+			"ZSCAN", "set", "0", "COUNT", "0",
+			proto.Error(msgSyntaxError),
+		)
 
 		s.Set("str", "value")
 		mustDo(t, c,
@@ -1488,6 +1984,94 @@ func TestZscan(t *testing.T) {
 			proto.Error(msgWrongType),
 		)
 	})
+
+	// scan gets all members with ZSCAN, calling f after every page.
+	scan := func(t *testing.T, key string, f func(), args ...string) (map[string]string, int) {
+		t.Helper()
+		seen := map[string]string{}
+		cursor, pages := "0", 0
+		for {
+			res, err := c.Do(append([]string{"ZSCAN", key, cursor}, args...)...)
+			ok(t, err)
+			page, err := proto.Parse(res)
+			ok(t, err)
+			cursor = page.([]interface{})[0].(string)
+			elems := page.([]interface{})[1].([]interface{})
+			for i := 0; i < len(elems); i += 2 {
+				seen[elems[i].(string)] = elems[i+1].(string)
+			}
+			pages++
+			if cursor == "0" {
+				return seen, pages
+			}
+			f()
+		}
+	}
+
+	t.Run("big", func(t *testing.T) {
+		for i := 0; i < 500; i++ {
+			s.ZAdd("big", float64(i), "m"+strconv.Itoa(i))
+		}
+
+		seen, pages := scan(t, "big", func() {}, "COUNT", "50")
+		equals(t, 500, len(seen))
+		equals(t, "42", seen["m42"])
+		assert(t, pages >= 10, "pages: %d", pages)
+
+		seen, pages = scan(t, "big", func() {})
+		equals(t, 500, len(seen))
+		assert(t, pages >= 50, "pages: %d", pages)
+
+		seen, _ = scan(t, "big", func() {}, "MATCH", "m4?", "COUNT", "100")
+		equals(t, 10, len(seen))
+	})
+
+	t.Run("big, changing", func(t *testing.T) {
+		for i := 0; i < 500; i++ {
+			s.ZAdd("changing", float64(i), "m"+strconv.Itoa(i))
+		}
+
+		// members which are there all the time show up at least once
+		n := 0
+		seen, _ := scan(t, "changing", func() {
+			s.ZRem("changing", "m"+strconv.Itoa(400+n))
+			s.ZAdd("changing", 1, "new"+strconv.Itoa(n))
+			n++
+		}, "COUNT", "20")
+		for i := 0; i < 400; i++ {
+			_, found := seen["m"+strconv.Itoa(i)]
+			assert(t, found, "m%d not found", i)
+		}
+	})
+
+	t.Run("big, restore", func(t *testing.T) {
+		for i := 0; i < 500; i++ {
+			s.ZAdd("restored", float64(i), "m"+strconv.Itoa(i))
+		}
+		snap := s.Snapshot()
+
+		// the cursors are hashes, so they're fine after a Restore()
+		restored := false
+		seen, _ := scan(t, "restored", func() {
+			if !restored {
+				s.ZRem("restored", "m1")
+				s.Restore(snap)
+				restored = true
+			}
+		}, "COUNT", "20")
+		equals(t, 500, len(seen))
+	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		mustDo(t, c,
+			"ZSCAN", "h", "0", "MATCH", "mi*",
+			proto.Array(
+				proto.String("0"),
+				proto.Strings("mies", "5"),
+			),
+		)
+	})
 }
 
 func TestZunionstore(t *testing.T) {
@@ -1559,6 +2143,53 @@ func TestZunionstore(t *testing.T) {
 			"ZUNIONSTORE", "aggr", "1", "set",
 			proto.Int(3),
 		)
+
+		mustDo(t, c,
+			"ZUNIONSTORE", "amax", "2", "h1", "set", "WEIGHTS", "3", "5", "AGGREGATE", "MAX",
+			proto.Int(5),
+		)
+		ss, err := s.SortedSet("amax")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 3, "field2": 6, "aap": 5, "noot": 5, "mies": 5}, ss)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		s.Set("dest", "a string")
+		s.SetTTL("dest", time.Minute)
+		mustDo(t, c,
+			"ZUNIONSTORE", "dest", "1", "h1",
+			proto.Int(2),
+		)
+		ss, err := s.SortedSet("dest")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 1, "field2": 2}, ss)
+		equals(t, time.Duration(0), s.TTL("dest"))
+
+		mustDo(t, c,
+			"ZUNIONSTORE", "dest", "1", "nosuch",
+			proto.Int(0),
+		)
+		equals(t, false, s.Exists("dest"))
+	})
+
+	t.Run("nan", func(t *testing.T) {
+		s.ZAdd("inf", math.Inf(1), "field1")
+		s.ZAdd("-inf", math.Inf(-1), "field1")
+		mustDo(t, c,
+			"ZUNIONSTORE", "nan", "2", "inf", "-inf",
+			proto.Int(1),
+		)
+		ss, err := s.SortedSet("nan")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 0}, ss)
+
+		mustDo(t, c,
+			"ZUNIONSTORE", "nan", "2", "inf", "h1", "WEIGHTS", "0", "1", "AGGREGATE", "MAX",
+			proto.Int(2),
+		)
+		ss, err = s.SortedSet("nan")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 1, "field2": 2}, ss)
 	})
 
 	t.Run("wrong usage", func(t *testing.T) {
@@ -1603,6 +2234,10 @@ func TestZunionstore(t *testing.T) {
 			"ZUNIONSTORE", "set", "2", "k1", "k2", "WEIGHTS", "1", "nof",
 			proto.Error("ERR weight value is not a float"),
 		)
+		mustDo(t, c,
+			"ZUNIONSTORE", "set", "2", "k1", "k2", "WEIGHTS", "1", "nan",
+			proto.Error("ERR weight value is not a float"),
+		)
 
 		mustDo(t, c,
 			"ZUNIONSTORE", "set", "2", "k1", "k2", "AGGREGATE",
@@ -1786,6 +2421,65 @@ func TestZinterstore(t *testing.T) {
 		equals(t, map[string]float64{"field1": 2}, ss)
 	}
 
+	t.Run("max, with a set", func(t *testing.T) {
+		mustDo(t, c,
+			"ZINTERSTORE", "amax", "2", "h1", "s2", "WEIGHTS", "3", "5", "AGGREGATE", "MAX",
+			proto.Int(1),
+		)
+		ss, err := s.SortedSet("amax")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 5}, ss)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		s.Set("dest", "a string")
+		s.SetTTL("dest", time.Minute)
+		mustDo(t, c,
+			"ZINTERSTORE", "dest", "2", "h1", "h2",
+			proto.Int(2),
+		)
+		ss, err := s.SortedSet("dest")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 2, "field2": 4}, ss)
+		equals(t, time.Duration(0), s.TTL("dest"))
+
+		// source and destination can be the same key
+		mustDo(t, c,
+			"ZINTERSTORE", "dest", "2", "dest", "h1",
+			proto.Int(2),
+		)
+		ss, err = s.SortedSet("dest")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 3, "field2": 6}, ss)
+
+		// an empty result removes the destination
+		mustDo(t, c,
+			"ZINTERSTORE", "dest", "2", "h1", "nosuch",
+			proto.Int(0),
+		)
+		equals(t, false, s.Exists("dest"))
+	})
+
+	t.Run("nan", func(t *testing.T) {
+		s.ZAdd("inf", math.Inf(1), "field1")
+		s.ZAdd("-inf", math.Inf(-1), "field1")
+		mustDo(t, c,
+			"ZINTERSTORE", "nan", "2", "inf", "-inf",
+			proto.Int(1),
+		)
+		ss, err := s.SortedSet("nan")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 0}, ss)
+
+		mustDo(t, c,
+			"ZINTERSTORE", "nan", "1", "inf", "WEIGHTS", "0",
+			proto.Int(1),
+		)
+		ss, err = s.SortedSet("nan")
+		ok(t, err)
+		equals(t, map[string]float64{"field1": 0}, ss)
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		mustDo(t, c,
 			"ZINTERSTORE",
@@ -1854,6 +2548,108 @@ func TestZinterstore(t *testing.T) {
 	})
 }
 
+func TestZintercard(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.ZAdd("h1", 1.0, "field1")
+	s.ZAdd("h1", 2.0, "field2")
+	s.ZAdd("h1", 3.0, "field3")
+	s.ZAdd("h2", 1.0, "field1")
+	s.ZAdd("h2", 2.0, "field2")
+	s.ZAdd("h2", 4.0, "field4")
+	s.SAdd("s2", "field1", "field4")
+
+	mustDo(t, c, "ZINTERCARD", "2", "h1", "h2", proto.Int(2))
+	mustDo(t, c, "ZINTERCARD", "1", "h1", proto.Int(3))
+	mustDo(t, c, "ZINTERCARD", "2", "h2", "s2", proto.Int(2))
+	mustDo(t, c, "ZINTERCARD", "3", "h1", "h2", "s2", proto.Int(1))
+	mustDo(t, c, "ZINTERCARD", "2", "h1", "nosuch", proto.Int(0))
+
+	t.Run("limit", func(t *testing.T) {
+		mustDo(t, c, "ZINTERCARD", "2", "h1", "h2", "LIMIT", "1", proto.Int(1))
+		mustDo(t, c, "ZINTERCARD", "2", "h1", "h2", "limit", "2", proto.Int(2))
+		mustDo(t, c, "ZINTERCARD", "2", "h1", "h2", "LIMIT", "10", proto.Int(2))
+		mustDo(t, c, "ZINTERCARD", "2", "h1", "h2", "LIMIT", "0", proto.Int(2))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"ZINTERCARD",
+			proto.Error(errWrongNumber("zintercard")),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "1",
+			proto.Error(errWrongNumber("zintercard")),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "noint", "h1",
+			proto.Error(msgInvalidInt),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "0", "h1",
+			proto.Error("ERR numkeys should be greater than 0"),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "3", "h1", "h2",
+			proto.Error(msgInvalidKeysNumber),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "1", "h1", "LIMIT", "-1",
+			proto.Error("ERR LIMIT can't be negative"),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "1", "h1", "LIMIT", "foo",
+			proto.Error("ERR LIMIT can't be negative"),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "1", "h1", "LIMIT",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "1", "h1", "foo",
+			proto.Error(msgSyntaxError),
+		)
+		s.Set("str", "value")
+		mustDo(t, c,
+			"ZINTERCARD", "2", "h1", "str",
+			proto.Error(msgWrongType),
+		)
+		mustDo(t, c,
+			"ZINTERCARD", "2", "nosuch", "str",
+			proto.Error(msgWrongType),
+		)
+	})
+}
+
+// Two sorted sets of 1M members. With a LIMIT it's done after a few members.
+func BenchmarkZintercard(b *testing.B) {
+	const size = 1000000
+	db := NewMiniRedis().db(0)
+	for i := 0; i < size; i++ {
+		m := strconv.Itoa(i)
+		db.ssetAdd("z1", float64(i), m)
+		db.ssetAdd("z2", float64(i), m)
+	}
+
+	for _, limit := range []int{10, 0} {
+		b.Run(fmt.Sprintf("limit %d", limit), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				n, err := db.ssetInterCard([]string{"z1", "z2"}, limit)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if limit > 0 && n != limit {
+					b.Fatalf("got %d", n)
+				}
+			}
+		})
+	}
+}
+
 func TestSSRange(t *testing.T) {
 	ss := newSortedSet()
 	ss.set(1.0, "key1")
@@ -2063,6 +2859,178 @@ func TestSortedSetPopMax(t *testing.T) {
 	})
 }
 
+func TestSortedSetMscore(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.ZAdd("z", 1, "one")
+	s.ZAdd("z", 2.5, "two")
+
+	mustDo(t, c,
+		"ZMSCORE", "z", "two", "nosuch", "one",
+		proto.Array(proto.String("2.5"), proto.Nil, proto.String("1")),
+	)
+	mustDo(t, c,
+		"ZMSCORE", "nosuch", "one", "two",
+		proto.Array(proto.Nil, proto.Nil),
+	)
+
+	t.Run("RESP3", func(t *testing.T) {
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		useRESP3(t, c)
+		mustDo(t, c,
+			"ZMSCORE", "z", "two", "nosuch",
+			proto.Array(proto.Float(2.5), proto.NilResp3),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"ZMSCORE",
+			proto.Error(errWrongNumber("zmscore")),
+		)
+		mustDo(t, c,
+			"ZMSCORE", "z",
+			proto.Error(errWrongNumber("zmscore")),
+		)
+
+		s.Set("str", "value")
+		mustDo(t, c,
+			"ZMSCORE", "str", "aap",
+			proto.Error(msgWrongType),
+		)
+	})
+}
+
+func TestSortedSetRangestore(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.ZAdd("z", 1, "one")
+	s.ZAdd("z", 2, "two")
+	s.ZAdd("z", 2, "zwei")
+	s.ZAdd("z", 3, "three")
+
+	t.Run("by rank", func(t *testing.T) {
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "1", "-1", proto.Int(3))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1", "WITHSCORES",
+			proto.Strings("two", "2", "zwei", "2", "three", "3"),
+		)
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "0", "1", "REV", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1",
+			proto.Strings("zwei", "three"),
+		)
+	})
+
+	t.Run("by score", func(t *testing.T) {
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "(1", "+inf", "BYSCORE", "LIMIT", "1", "5", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1", "WITHSCORES",
+			proto.Strings("zwei", "2", "three", "3"),
+		)
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "2", "-inf", "BYSCORE", "REV", "LIMIT", "0", "1", proto.Int(1))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1", "WITHSCORES",
+			proto.Strings("zwei", "2"),
+		)
+	})
+
+	t.Run("by lex", func(t *testing.T) {
+		s.ZAdd("lex", 5, "a")
+		s.ZAdd("lex", 5, "b")
+		s.ZAdd("lex", 5, "c")
+		mustDo(t, c, "ZRANGESTORE", "dst", "lex", "(a", "+", "BYLEX", proto.Int(2))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1", "WITHSCORES",
+			proto.Strings("b", "5", "c", "5"),
+		)
+		mustDo(t, c, "ZRANGESTORE", "dst", "lex", "+", "-", "BYLEX", "REV", "LIMIT", "0", "1", proto.Int(1))
+		mustDo(t, c, "ZRANGE", "dst", "0", "-1",
+			proto.Strings("c"),
+		)
+	})
+
+	t.Run("destination", func(t *testing.T) {
+		// replaced, without TTL
+		s.Set("str", "value")
+		s.SetTTL("str", time.Hour)
+		mustDo(t, c, "ZRANGESTORE", "str", "z", "0", "0", proto.Int(1))
+		equals(t, "zset", s.Type("str"))
+		equals(t, time.Duration(0), s.TTL("str"))
+
+		// nothing deletes it
+		mustDo(t, c, "ZRANGESTORE", "str", "z", "10", "20", proto.Int(0))
+		equals(t, false, s.Exists("str"))
+		s.ZAdd("dst", 1, "one")
+		mustDo(t, c, "ZRANGESTORE", "dst", "nosuch", "0", "-1", proto.Int(0))
+		equals(t, false, s.Exists("dst"))
+
+		// the source itself
+		s.ZAdd("self", 1, "a")
+		s.ZAdd("self", 2, "b")
+		mustDo(t, c, "ZRANGESTORE", "self", "self", "1", "1", proto.Int(1))
+		mustDo(t, c, "ZRANGE", "self", "0", "-1", proto.Strings("b"))
+	})
+
+	t.Run("MULTI", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "0", "0", proto.Inline("QUEUED"))
+		mustDo(t, c, "ZCARD", "dst", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Int(1), proto.Int(1)))
+
+		// parse errors abort the transaction
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "0", "1", "BYSCORE", "BYLEX", proto.Error(msgSyntaxError))
+		mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "ZRANGESTORE", "dst", "z", "0", "1", "LIMIT", "1", "2", proto.Error(msgLimitCombination))
+		mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "0",
+			proto.Error(errWrongNumber("zrangestore")),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "0", "1", "WITHSCORES",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "0", "1", "LIMIT", "1",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "0", "1", "LIMIT", "1", "2",
+			proto.Error(msgLimitCombination),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "0", "1", "BYSCORE", "BYLEX",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "a", "1",
+			proto.Error(msgInvalidInt),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "a", "1", "BYSCORE",
+			proto.Error(msgInvalidMinMax),
+		)
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "z", "a", "1", "BYLEX",
+			proto.Error(msgInvalidRangeItem),
+		)
+		s.Set("str", "value")
+		mustDo(t, c,
+			"ZRANGESTORE", "dst", "str", "0", "1",
+			proto.Error(msgWrongType),
+		)
+	})
+}
+
 // Test ZRANDMEMBER
 func TestSortedSetRandmember(t *testing.T) {
 	s, err := Run()
@@ -2153,6 +3121,33 @@ func TestSortedSetRandmember(t *testing.T) {
 		)
 	})
 
+	t.Run("seed", func(t *testing.T) {
+		// the same seed gives the same members
+		for _, args := range [][]string{
+			{"ZRANDMEMBER", "z"},
+			{"ZRANDMEMBER", "z", "3"},
+			{"ZRANDMEMBER", "z", "-9", "WITHSCORES"},
+		} {
+			s.Seed(42)
+			want, err := c.Do(args...)
+			ok(t, err)
+			s.Seed(42)
+			mustDo(t, c, append(args, want)...)
+		}
+	})
+
+	t.Run("empty member", func(t *testing.T) {
+		s.ZAdd("e", 1, "")
+		mustDo(t, c,
+			"ZRANDMEMBER", "e",
+			proto.String(""),
+		)
+		mustDo(t, c,
+			"ZRANDMEMBER", "e", "-2",
+			proto.Strings("", ""),
+		)
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		mustDo(t, c,
 			"ZRANDMEMBER",
@@ -2169,6 +3164,21 @@ func TestSortedSetRandmember(t *testing.T) {
 			proto.Error(msgInvalidInt),
 		)
 
+		mustDo(t, c,
+			"ZRANDMEMBER", "z", "1", "WITHSCORES", "foo",
+			proto.Error(msgSyntaxError),
+		)
+
+		mustDo(t, c,
+			"ZRANDMEMBER", "z", "1", "foo",
+			proto.Error(msgSyntaxError),
+		)
+
+		mustDo(t, c,
+			"ZRANDMEMBER", "z", "-9223372036854775807", "WITHSCORES",
+			proto.Error(msgValueOutOfRange),
+		)
+
 		s.Set("str", "value")
 		mustDo(t, c,
 			"ZRANDMEMBER", "str", "1",
@@ -2176,3 +3186,55 @@ func TestSortedSetRandmember(t *testing.T) {
 		)
 	})
 }
+
+// Test the destination key of ZINTERSTORE and ZUNIONSTORE.
+func TestSortedSetStoreDestination(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.ZAdd("z1", 1, "aap")
+	s.ZAdd("z1", 2, "noot")
+	s.ZAdd("z2", 3, "noot")
+
+	for _, cmd := range []string{"ZINTERSTORE", "ZUNIONSTORE"} {
+		t.Run(cmd, func(t *testing.T) {
+			// TTL is cleared
+			s.ZAdd("dest", 1, "old")
+			s.SetTTL("dest", time.Minute)
+			_, err := c.Do(cmd, "dest", "2", "z1", "z2")
+			ok(t, err)
+			equals(t, time.Duration(0), s.TTL("dest"))
+
+			// empty result deletes the destination
+			s.SetTTL("dest", time.Minute)
+			must0(t, c, cmd, "dest", "2", "nosuch", "nosuch2")
+			equals(t, false, s.Exists("dest"))
+			equals(t, time.Duration(0), s.TTL("dest"))
+
+			// the destination can also be a source
+			s.ZAdd("self", 5, "noot")
+			s.SetTTL("self", time.Minute)
+			must1(t, c, cmd, "self", "2", "self", "z2")
+			equals(t, time.Duration(0), s.TTL("self"))
+			s.Del("self")
+
+			// errors don't touch the destination
+			s.ZAdd("dest", 1, "old")
+			s.Set("str", "value")
+			mustDo(t, c, cmd, "dest", "2", "z1", "str", proto.Error(msgWrongType))
+			equals(t, true, s.Exists("dest"))
+			s.Del("dest")
+		})
+	}
+
+	s.ZAdd("self", 5, "noot")
+	s.ZAdd("self", 5, "mies")
+	must1(t, c, "ZINTERSTORE", "self", "2", "self", "z2")
+	if have, _ := s.ZScore("self", "noot"); have != 8 {
+		t.Errorf("have %v, want 8", have)
+	}
+}
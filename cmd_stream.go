@@ -25,6 +25,8 @@ func commandsStream(m *Miniredis) {
 	m.srv.Register("XREADGROUP", m.cmdXreadgroup)
 	m.srv.Register("XACK", m.cmdXack)
 	m.srv.Register("XDEL", m.cmdXdel)
+	m.srv.Register("XDELEX", m.cmdXdelex)
+	m.srv.Register("XACKDEL", m.cmdXackdel)
 	m.srv.Register("XPENDING", m.cmdXpending)
 	m.srv.Register("XTRIM", m.cmdXtrim)
 	m.srv.Register("XAUTOCLAIM", m.cmdXautoclaim)
@@ -47,45 +49,46 @@ func (m *Miniredis) cmdXadd(c *server.Peer, cmd string, args []string) {
 
 	key, args := args[0], args[1:]
 
-	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+	noMkStream := false
+	if strings.ToUpper(args[0]) == "NOMKSTREAM" {
+		noMkStream = true
+		args = args[1:]
+	}
 
-		maxlen := -1
-		if strings.ToLower(args[0]) == "maxlen" {
-			args = args[1:]
-			// we don't treat "~" special
-			if args[0] == "~" {
-				args = args[1:]
-			}
-			n, err := strconv.Atoi(args[0])
+	var trim streamTrim
+	if len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "MAXLEN", "MINID":
+			var err error
+			trim, args, err = parseStreamTrim(args)
 			if err != nil {
-				c.WriteError(msgInvalidInt)
-				return
-			}
-			if n < 0 {
-				c.WriteError("ERR The MAXLEN argument must be >= 0.")
+				setDirty(c)
+				c.WriteError(err.Error())
 				return
 			}
-			maxlen = n
-			args = args[1:]
 		}
-		if len(args) < 1 {
-			c.WriteError(errWrongNumber(cmd))
-			return
-		}
-		entryID, args := args[0], args[1:]
+	}
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	entryID, args := args[0], args[1:]
 
-		// args must be composed of field/value pairs.
-		if len(args) == 0 || len(args)%2 != 0 {
-			c.WriteError("ERR wrong number of arguments for XADD") // non-default message
-			return
-		}
+	// args must be composed of field/value pairs.
+	if len(args) == 0 || len(args)%2 != 0 {
+		setDirty(c)
+		c.WriteError("ERR wrong number of arguments for XADD") // non-default message
+		return
+	}
 
-		var values []string
-		for len(args) > 0 {
-			values = append(values, args[0], args[1])
-			args = args[2:]
-		}
+	var values []string
+	for len(args) > 0 {
+		values = append(values, args[0], args[1])
+		args = args[2:]
+	}
 
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 		s, err := db.stream(key)
 		if err != nil {
@@ -93,7 +96,10 @@ func (m *Miniredis) cmdXadd(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		if s == nil {
-			// TODO: NOMKSTREAM
+			if noMkStream {
+				c.WriteNull()
+				return
+			}
 			s, _ = db.newStream(key)
 		}
 
@@ -107,15 +113,101 @@ func (m *Miniredis) cmdXadd(c *server.Peer, cmd string, args []string) {
 			}
 			return
 		}
-		if maxlen >= 0 {
-			s.trim(maxlen)
+		db.bump(key)
+		m.notify(db.id, notifyStream, "xadd", key)
+		if trim.apply(s) > 0 {
+			m.notify(db.id, notifyStream, "xtrim", key)
 		}
-		db.keyVersion[key]++
 
 		c.WriteBulk(newID)
 	})
 }
 
+// trimming options, as used by XADD and XTRIM.
+type streamTrim struct {
+	strategy  string // "MAXLEN", "MINID", or "" for no trimming
+	maxLen    int    // for MAXLEN
+	threshold string // for MINID
+	limit     int    // 0 is no limit
+}
+
+// parseStreamTrim parses "<MAXLEN | MINID> [= | ~] threshold [LIMIT count]".
+// Returns the remaining arguments.
+func parseStreamTrim(args []string) (streamTrim, []string, error) {
+	var (
+		opts   streamTrim
+		nearly bool
+	)
+	opts.strategy, args = strings.ToUpper(args[0]), args[1:]
+	if opts.strategy != "MAXLEN" && opts.strategy != "MINID" {
+		return opts, nil, errors.New(msgXtrimInvalidStrategy)
+	}
+
+	// "~" trims exactly as well, but it allows LIMIT.
+	if len(args) > 0 {
+		switch args[0] {
+		case "=":
+			args = args[1:]
+		case "~":
+			nearly = true
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return opts, nil, errors.New(msgSyntaxError)
+	}
+
+	switch opts.strategy {
+	case "MAXLEN":
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return opts, nil, errors.New(msgXtrimInvalidMaxLen)
+		}
+		if n < 0 {
+			return opts, nil, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		opts.maxLen = n
+	case "MINID":
+		id, err := formatStreamID(args[0])
+		if err != nil {
+			return opts, nil, errors.New(msgInvalidStreamID)
+		}
+		opts.threshold = id
+	}
+	args = args[1:]
+
+	if len(args) > 0 && strings.ToUpper(args[0]) == "LIMIT" {
+		if len(args) < 2 {
+			return opts, nil, errors.New(msgSyntaxError)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return opts, nil, errors.New(msgInvalidInt)
+		}
+		if n < 0 {
+			return opts, nil, errors.New("ERR The LIMIT argument must be >= 0.")
+		}
+		if !nearly {
+			return opts, nil, errors.New(msgXtrimInvalidLimit)
+		}
+		opts.limit = n
+		args = args[2:]
+	}
+	return opts, args, nil
+}
+
+// apply trims the stream. Returns the number of deleted entries.
+func (t streamTrim) apply(s *streamKey) int {
+	switch t.strategy {
+	case "MAXLEN":
+		return s.trim(t.maxLen, t.limit)
+	case "MINID":
+		return s.trimBefore(t.threshold, t.limit)
+	default:
+		return 0
+	}
+}
+
 // XLEN
 func (m *Miniredis) cmdXlen(c *server.Peer, cmd string, args []string) {
 	if len(args) != 1 {
@@ -138,6 +230,7 @@ func (m *Miniredis) cmdXlen(c *server.Peer, cmd string, args []string) {
 		s, err := db.stream(key)
 		if err != nil {
 			c.WriteError(err.Error())
+			return
 		}
 		if s == nil {
 			// No such key. That's zero length.
@@ -363,6 +456,7 @@ func (m *Miniredis) cmdXgroupCreate(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		m.notify(db.id, notifyStream, "xgroup-create", stream)
 
 		c.WriteOK()
 	})
@@ -395,6 +489,7 @@ func (m *Miniredis) cmdXgroupDestroy(c *server.Peer, cmd string, args []string)
 			return
 		}
 		delete(s.groups, groupName)
+		m.notify(db.id, notifyStream, "xgroup-destroy", stream)
 		c.WriteInt(1)
 	})
 }
@@ -433,6 +528,7 @@ func (m *Miniredis) cmdXgroupCreateconsumer(c *server.Peer, cmd string, args []s
 			return
 		}
 		g.consumers[consumerName] = &consumer{}
+		m.notify(db.id, notifyStream, "xgroup-createconsumer", key)
 		c.WriteInt(1)
 	})
 }
@@ -472,6 +568,7 @@ func (m *Miniredis) cmdXgroupDelconsumer(c *server.Peer, cmd string, args []stri
 			return
 		}
 		defer delete(g.consumers, consumerName)
+		m.notify(db.id, notifyStream, "xgroup-delconsumer", key)
 
 		if consumer.numPendingEntries > 0 {
 			newPending := make([]pendingEntry, 0)
@@ -537,12 +634,46 @@ func (m *Miniredis) cmdXinfoStream(c *server.Peer, args []string) {
 			return
 		}
 
-		c.WriteMapLen(1)
+		info := s.info()
+		if m.streamInfo != nil {
+			m.streamInfo(ctx.selectedDB, key, &info)
+		}
+
+		c.WriteMapLen(10)
 		c.WriteBulk("length")
-		c.WriteInt(len(s.entries))
+		c.WriteInt(info.Length)
+		c.WriteBulk("radix-tree-keys")
+		c.WriteInt(info.RadixTreeKeys)
+		c.WriteBulk("radix-tree-nodes")
+		c.WriteInt(info.RadixTreeNodes)
+		c.WriteBulk("last-generated-id")
+		c.WriteBulk(info.LastGeneratedID)
+		c.WriteBulk("max-deleted-entry-id")
+		c.WriteBulk(info.MaxDeletedEntryID)
+		c.WriteBulk("entries-added")
+		c.WriteInt(info.EntriesAdded)
+		c.WriteBulk("recorded-first-entry-id")
+		c.WriteBulk(info.RecordedFirstEntryID)
+		c.WriteBulk("groups")
+		c.WriteInt(info.Groups)
+		c.WriteBulk("first-entry")
+		writeStreamEntry(c, info.FirstEntry)
+		c.WriteBulk("last-entry")
+		writeStreamEntry(c, info.LastEntry)
 	})
 }
 
+// writeStreamEntry writes an entry as [id, [field, value, ...]], or nil.
+func writeStreamEntry(c *server.Peer, e *StreamEntry) {
+	if e == nil {
+		c.WriteNull()
+		return
+	}
+	c.WriteLen(2)
+	c.WriteBulk(e.ID)
+	c.WriteStrings(e.Values)
+}
+
 // XINFO GROUPS
 func (m *Miniredis) cmdXinfoGroups(c *server.Peer, args []string) {
 	if len(args) != 1 {
@@ -804,7 +935,11 @@ func xreadgroup(
 		if _, err := parseStreamID(id); id != `>` && err != nil {
 			return nil, err
 		}
+		_, known := g.consumers[consumer]
 		entries := g.readGroup(now, consumer, id, count, noack)
+		if _, ok := g.consumers[consumer]; ok && !known {
+			db.master.notify(db.id, notifyStream, "xgroup-createconsumer", key)
+		}
 		if id == `>` && len(entries) == 0 {
 			continue
 		}
@@ -872,11 +1007,162 @@ func (m *Miniredis) cmdXdel(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
-		db.keyVersion[stream]++
+		db.bump(stream)
+		if n > 0 {
+			m.notify(db.id, notifyStream, "xdel", stream)
+		}
 		c.WriteInt(n)
 	})
 }
 
+// XDELEX
+func (m *Miniredis) cmdXdelex(c *server.Peer, cmd string, args []string) {
+	if len(args) < 4 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	key, args := args[0], args[1:]
+	policy, ids, err := parseStreamDeletePolicy(args)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(err.Error())
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+		s, err := db.stream(key)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+
+		res := make([]int, len(ids))
+		deleted := 0
+		for i, id := range ids {
+			res[i] = -1
+			if s == nil {
+				continue
+			}
+			if _, e := s.get(id); e == nil {
+				continue
+			}
+			res[i] = s.deleteWithPolicy(id, policy)
+			if res[i] == 1 {
+				deleted++
+			}
+		}
+		if deleted > 0 {
+			db.bump(key)
+			m.notify(db.id, notifyStream, "xdel", key)
+		}
+
+		c.WriteLen(len(res))
+		for _, r := range res {
+			c.WriteInt(r)
+		}
+	})
+}
+
+// XACKDEL
+func (m *Miniredis) cmdXackdel(c *server.Peer, cmd string, args []string) {
+	if len(args) < 5 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c, cmd) {
+		return
+	}
+
+	key, group, args := args[0], args[1], args[2:]
+	policy, ids, err := parseStreamDeletePolicy(args)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(err.Error())
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+		g, err := db.streamGroup(key, group)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		if g == nil {
+			c.WriteError(errReadgroup(key, group).Error())
+			return
+		}
+
+		res := make([]int, len(ids))
+		deleted := 0
+		for i, id := range ids {
+			res[i] = -1
+			if !g.dropPending(id) {
+				continue
+			}
+			if _, e := g.stream.get(id); e == nil {
+				continue
+			}
+			res[i] = g.stream.deleteWithPolicy(id, policy)
+			if res[i] == 1 {
+				deleted++
+			}
+		}
+		if deleted > 0 {
+			db.bump(key)
+			m.notify(db.id, notifyStream, "xdel", key)
+		}
+
+		c.WriteLen(len(res))
+		for _, r := range res {
+			c.WriteInt(r)
+		}
+	})
+}
+
+// parseStreamDeletePolicy parses "[KEEPREF | DELREF | ACKED] IDS numids id
+// [id ...]", as used by XDELEX and XACKDEL.
+func parseStreamDeletePolicy(args []string) (string, []string, error) {
+	policy := "KEEPREF"
+	switch p := strings.ToUpper(args[0]); p {
+	case "KEEPREF", "DELREF", "ACKED":
+		policy = p
+		args = args[1:]
+	}
+	if len(args) < 2 || strings.ToUpper(args[0]) != "IDS" {
+		return "", nil, errors.New(msgSyntaxError)
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return "", nil, errors.New("ERR Number of IDs must be a positive integer")
+	}
+	ids := args[2:]
+	if len(ids) != n {
+		return "", nil, errors.New("ERR The `numids` parameter must match the number of arguments")
+	}
+	for i, id := range ids {
+		id, err := formatStreamID(id)
+		if err != nil {
+			return "", nil, errors.New(msgInvalidStreamID)
+		}
+		ids[i] = id
+	}
+	return policy, ids, nil
+}
+
 // XREAD
 func (m *Miniredis) cmdXread(c *server.Peer, cmd string, args []string) {
 	if len(args) < 3 {
@@ -931,8 +1217,7 @@ parsing:
 					c.WriteError(msgInvalidStreamID)
 					return
 				} else if id == "$" {
-					db := m.DB(getCtx(c).selectedDB)
-					opts.ids[i] = db.streamKeys[opts.streams[i]].lastID()
+					opts.ids[i] = m.lastStreamID(c, opts.streams[i])
 				}
 			}
 			args = nil
@@ -952,7 +1237,11 @@ parsing:
 	if !opts.block {
 		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 			db := m.db(ctx.selectedDB)
-			res := xread(db, opts.streams, opts.ids, opts.count)
+			res, err := xread(db, opts.streams, opts.ids, opts.count)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
 			writeXread(c, opts.streams, res)
 		})
 		return
@@ -963,7 +1252,11 @@ parsing:
 		opts.blockTimeout,
 		func(c *server.Peer, ctx *connCtx) bool {
 			db := m.db(ctx.selectedDB)
-			res := xread(db, opts.streams, opts.ids, opts.count)
+			res, err := xread(db, opts.streams, opts.ids, opts.count)
+			if err != nil {
+				c.WriteError(err.Error())
+				return true
+			}
 			if len(res) == 0 {
 				return false
 			}
@@ -976,12 +1269,29 @@ parsing:
 	)
 }
 
-func xread(db *RedisDB, streams []string, ids []string, count int) map[string][]StreamEntry {
+// lastStreamID is what "$" means in XREAD. "0-0" if there is no such stream.
+func (m *Miniredis) lastStreamID(c *server.Peer, key string) string {
+	ctx := getCtx(c)
+	if !ctx.nested {
+		m.Lock()
+		defer m.Unlock()
+	}
+	if s, ok := m.db(ctx.selectedDB).streamKeys[key]; ok {
+		return s.lastID()
+	}
+	return "0-0"
+}
+
+func xread(db *RedisDB, streams []string, ids []string, count int) (map[string][]StreamEntry, error) {
 	res := map[string][]StreamEntry{}
 	for i := range streams {
 		stream := streams[i]
 		id := ids[i]
 
+		if db.wrongType(stream, "stream") {
+			return nil, ErrWrongType
+		}
+
 		var s, ok = db.streamKeys[stream]
 		if !ok {
 			continue
@@ -1013,7 +1323,7 @@ func xread(db *RedisDB, streams []string, ids []string, count int) map[string][]
 			res[stream] = returnedEntries
 		}
 	}
-	return res
+	return res, nil
 }
 
 func writeXread(c *server.Peer, streams []string, res map[string][]StreamEntry) {
@@ -1021,14 +1331,14 @@ func writeXread(c *server.Peer, streams []string, res map[string][]StreamEntry)
 		c.WriteLen(-1)
 		return
 	}
-	c.WriteLen(len(res))
+	c.WritePairsLen(len(res))
 	for _, stream := range streams {
 		entries, ok := res[stream]
 		if !ok {
 			continue
 		}
-		c.WriteLen(2)
-		c.WriteBulk(stream)
+		c.WritePair()
+		c.WriteBulk(getCtx(c).tenantKey(stream))
 		c.WriteLen(len(entries))
 		for _, entry := range entries {
 			c.WriteLen(2)
@@ -1182,11 +1492,6 @@ func writeXpending(
 	count int,
 	consumer *string,
 ) {
-	if len(g.pending) == 0 || count < 0 {
-		c.WriteLen(-1)
-		return
-	}
-
 	// format, list of:
 	//  - message ID
 	//  - consumer
@@ -1222,10 +1527,7 @@ func writeXpending(
 			})
 		}
 	}
-	if len(res) == 0 {
-		c.WriteLen(-1)
-		return
-	}
+	// nothing pending is an empty list, never a nil
 	c.WriteLen(len(res))
 	for _, e := range res {
 		c.WriteLen(4)
@@ -1243,78 +1545,31 @@ func (m *Miniredis) cmdXtrim(c *server.Peer, cmd string, args []string) {
 		c.WriteError(errWrongNumber(cmd))
 		return
 	}
-
-	var opts struct {
-		stream     string
-		strategy   string
-		maxLen     int    // for MAXLEN
-		threshold  string // for MINID
-		withLimit  bool   // "LIMIT"
-		withExact  bool   // "="
-		withNearly bool   // "~"
-	}
-
-	opts.stream, opts.strategy, args = args[0], strings.ToUpper(args[1]), args[2:]
-
-	if opts.strategy != "MAXLEN" && opts.strategy != "MINID" {
-		setDirty(c)
-		c.WriteError(msgXtrimInvalidStrategy)
+	if !m.handleAuth(c) {
 		return
 	}
-
-	// Ignore nearly exact trimming parameters.
-	switch args[0] {
-	case "=":
-		opts.withExact = true
-		args = args[1:]
-	case "~":
-		opts.withNearly = true
-		args = args[1:]
-	}
-
-	switch opts.strategy {
-	case "MAXLEN":
-		maxLen, err := strconv.Atoi(args[0])
-		if err != nil {
-			setDirty(c)
-			c.WriteError(msgXtrimInvalidMaxLen)
-			return
-		}
-		opts.maxLen = maxLen
-	case "MINID":
-		opts.threshold = args[0]
+	if m.checkPubsub(c, cmd) {
+		return
 	}
-	args = args[1:]
-
-	if len(args) == 2 && strings.ToUpper(args[0]) == "LIMIT" {
-		// Ignore LIMIT.
-		opts.withLimit = true
-		if _, err := strconv.Atoi(args[1]); err != nil {
-			setDirty(c)
-			c.WriteError(msgInvalidInt)
-			return
-		}
 
-		args = args[2:]
-	}
+	key, args := args[0], args[1:]
 
-	if len(args) != 0 {
+	trim, args, err := parseStreamTrim(args)
+	if err != nil {
 		setDirty(c)
-		c.WriteError(fmt.Sprintf("ERR incorrect argument %s", args[0]))
+		c.WriteError(err.Error())
 		return
 	}
-
-	if opts.withLimit && !opts.withNearly {
+	if len(args) != 0 {
 		setDirty(c)
-		c.WriteError(fmt.Sprintf(msgXtrimInvalidLimit))
+		c.WriteError(fmt.Sprintf("ERR incorrect argument %s", args[0]))
 		return
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
-		s, err := db.stream(opts.stream)
+		s, err := db.stream(key)
 		if err != nil {
-			setDirty(c)
 			c.WriteError(err.Error())
 			return
 		}
@@ -1323,23 +1578,12 @@ func (m *Miniredis) cmdXtrim(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		switch opts.strategy {
-		case "MAXLEN":
-			entriesBefore := len(s.entries)
-			s.trim(opts.maxLen)
-			c.WriteInt(entriesBefore - len(s.entries))
-		case "MINID":
-			var delete []string
-			for _, entry := range s.entries {
-				if entry.ID < opts.threshold {
-					delete = append(delete, entry.ID)
-				} else {
-					break
-				}
-			}
-			s.delete(delete)
-			c.WriteInt(len(delete))
+		n := trim.apply(s)
+		if n > 0 {
+			db.bump(key)
+			m.notify(db.id, notifyStream, "xtrim", key)
 		}
+		c.WriteInt(n)
 	})
 }
 
@@ -1373,6 +1617,7 @@ func (m *Miniredis) cmdXautoclaim(c *server.Peer, cmd string, args []string) {
 
 	start_, err := formatStreamRangeBound(args[4], true, false)
 	if err != nil {
+		setDirty(c)
 		c.WriteError(msgInvalidStreamID)
 		return
 	}
@@ -1423,7 +1668,11 @@ parsing:
 			return
 		}
 
+		_, known := g.consumers[opts.consumer]
 		nextCallId, entries := xautoclaim(m.effectiveNow(), *g, opts.minIdleTime, opts.start, opts.count, opts.consumer)
+		if _, ok := g.consumers[opts.consumer]; ok && !known {
+			m.notify(db.id, notifyStream, "xgroup-createconsumer", opts.key)
+		}
 		writeXautoclaim(c, nextCallId, entries, opts.justId)
 	})
 }
@@ -1609,7 +1858,11 @@ func (m *Miniredis) cmdXclaim(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
+		_, known := g.consumers[opts.consumerName]
 		claimedEntryIDs := m.xclaim(g, opts.consumerName, opts.minIdleTime, opts.newLastDelivery, opts.ids, opts.retryCount, opts.force)
+		if _, ok := g.consumers[opts.consumerName]; ok && !known {
+			m.notify(db.id, notifyStream, "xgroup-createconsumer", opts.key)
+		}
 		writeXclaim(c, g.stream, claimedEntryIDs, opts.justId)
 	})
 }
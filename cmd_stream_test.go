@@ -6,6 +6,7 @@ import (
 	"math"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -38,9 +39,25 @@ func TestStream(t *testing.T) {
 		)
 	})
 
+	entry := proto.Array(
+		proto.String("1234567-89"),
+		proto.Strings("one", "1", "two", "2"),
+	)
+	info := []string{
+		proto.String("length"), proto.Int(1),
+		proto.String("radix-tree-keys"), proto.Int(1),
+		proto.String("radix-tree-nodes"), proto.Int(2),
+		proto.String("last-generated-id"), proto.String("1234567-89"),
+		proto.String("max-deleted-entry-id"), proto.String("0-0"),
+		proto.String("entries-added"), proto.Int(1),
+		proto.String("recorded-first-entry-id"), proto.String("1234567-89"),
+		proto.String("groups"), proto.Int(0),
+		proto.String("first-entry"), entry,
+		proto.String("last-entry"), entry,
+	}
 	mustDo(t, c,
 		"XINFO", "STREAM", "s",
-		proto.Array(proto.String("length"), proto.Int(1)),
+		proto.Array(info...),
 	)
 
 	now := time.Date(2001, 1, 1, 4, 4, 5, 4000000, time.UTC)
@@ -78,7 +95,7 @@ func TestStream(t *testing.T) {
 	t.Run("resp3", func(t *testing.T) {
 		mustDo(t, c,
 			"XINFO", "STREAM", "s",
-			proto.Map(proto.String("length"), proto.Int(1)),
+			proto.Map(info...),
 		)
 	})
 }
@@ -495,6 +512,28 @@ func TestStreamRead(t *testing.T) {
 			proto.Error(msgXreadUnbalanced),
 		)
 	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		mustDo(t, c,
+			"XREAD", "STREAMS", "planets", "planets2", "3-0", "3",
+			proto.Map(
+				proto.String("planets"),
+				proto.Array(
+					proto.Array(proto.String("4-1"), proto.Strings("name", "Jupiter", "greek-god", "Dias", "idx", "5")),
+					proto.Array(proto.String("5-1"), proto.Strings("name", "block", "idx", "6")),
+				),
+				proto.String("planets2"),
+				proto.Array(
+					proto.Array(proto.String("4-1"), proto.Strings("name", "Jupiter", "greek-god", "Dias", "idx", "5")),
+				),
+			),
+		)
+		mustDo(t, c,
+			"XREAD", "STREAMS", "planets", "$",
+			proto.NilResp3,
+		)
+	})
 }
 
 // Test XINFO
@@ -516,11 +555,99 @@ func TestStreamInfo(t *testing.T) {
 		proto.String("0-1"),
 	)
 
+	mercury := proto.Array(
+		proto.String("0-1"),
+		proto.Strings("name", "Mercury", "greek-god", "Hermes", "idx", "1"),
+	)
 	mustDo(t, c,
 		"XINFO", "STREAM", "planets",
-		proto.Array(proto.String("length"), proto.Int(1)),
+		proto.Array(
+			proto.String("length"), proto.Int(1),
+			proto.String("radix-tree-keys"), proto.Int(1),
+			proto.String("radix-tree-nodes"), proto.Int(2),
+			proto.String("last-generated-id"), proto.String("0-1"),
+			proto.String("max-deleted-entry-id"), proto.String("0-0"),
+			proto.String("entries-added"), proto.Int(1),
+			proto.String("recorded-first-entry-id"), proto.String("0-1"),
+			proto.String("groups"), proto.Int(0),
+			proto.String("first-entry"), mercury,
+			proto.String("last-entry"), mercury,
+		),
 	)
 
+	t.Run("deleted", func(t *testing.T) {
+		mustDo(t, c, "XADD", "planets", "0-2", "name", "Venus", proto.String("0-2"))
+		mustDo(t, c, "XADD", "planets", "0-3", "name", "Earth", proto.String("0-3"))
+		mustDo(t, c, "XDEL", "planets", "0-3", "0-2", proto.Int(2))
+		mustDo(t, c,
+			"XINFO", "STREAM", "planets",
+			proto.Array(
+				proto.String("length"), proto.Int(1),
+				proto.String("radix-tree-keys"), proto.Int(1),
+				proto.String("radix-tree-nodes"), proto.Int(2),
+				proto.String("last-generated-id"), proto.String("0-3"),
+				proto.String("max-deleted-entry-id"), proto.String("0-3"),
+				proto.String("entries-added"), proto.Int(3),
+				proto.String("recorded-first-entry-id"), proto.String("0-1"),
+				proto.String("groups"), proto.Int(0),
+				proto.String("first-entry"), mercury,
+				proto.String("last-entry"), mercury,
+			),
+		)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		mustDo(t, c, "XADD", "empty", "MAXLEN", "0", "0-1", "a", "b", proto.String("0-1"))
+		mustDo(t, c,
+			"XINFO", "STREAM", "empty",
+			proto.Array(
+				proto.String("length"), proto.Int(0),
+				proto.String("radix-tree-keys"), proto.Int(0),
+				proto.String("radix-tree-nodes"), proto.Int(1),
+				proto.String("last-generated-id"), proto.String("0-1"),
+				proto.String("max-deleted-entry-id"), proto.String("0-0"),
+				proto.String("entries-added"), proto.Int(1),
+				proto.String("recorded-first-entry-id"), proto.String("0-0"),
+				proto.String("groups"), proto.Int(0),
+				proto.String("first-entry"), proto.Nil,
+				proto.String("last-entry"), proto.Nil,
+			),
+		)
+	})
+
+	t.Run("radix tree", func(t *testing.T) {
+		for i := 0; i < 250; i++ {
+			_, err := s.XAdd("big", "*", []string{"i", strconv.Itoa(i)})
+			ok(t, err)
+		}
+		_, err := s.XAdd("huge", "*", []string{"v", strings.Repeat("x", 5000)})
+		ok(t, err)
+		_, err = s.XAdd("huge", "*", []string{"v", "x"})
+		ok(t, err)
+
+		s.SetStreamInfo(func(db int, key string, info *StreamInfo) {
+			if key == "huge" {
+				info.RadixTreeKeys = 1000
+			}
+		})
+		defer s.SetStreamInfo(nil)
+
+		for key, want := range map[string][2]int{
+			"big":  {3, 4},
+			"huge": {1000, 3},
+		} {
+			res, err := c.Do("XINFO", "STREAM", key)
+			ok(t, err)
+			reply, err := proto.Parse(res)
+			ok(t, err)
+			fields := reply.([]interface{})
+			equals(t, "radix-tree-keys", fields[2])
+			equals(t, want[0], fields[3])
+			equals(t, "radix-tree-nodes", fields[4])
+			equals(t, want[1], fields[5])
+		}
+	})
+
 	mustDo(t, c,
 		"XINFO", "GROUPS", "planets", "foo", "bar",
 		proto.Error("ERR wrong number of arguments for 'groups' command"),
@@ -957,7 +1084,7 @@ func TestStreamXpending(t *testing.T) {
 		)
 		mustDo(t, c,
 			"XPENDING", "planets", "processing", "-", "+", "-99",
-			proto.NilList,
+			proto.Strings(),
 		)
 
 		// Increase delivery count
@@ -983,11 +1110,11 @@ func TestStreamXpending(t *testing.T) {
 
 		mustDo(t, c,
 			"XPENDING", "planets", "processing", "IDLE", "5000", "-", "+", "999",
-			proto.NilList,
+			proto.Strings(),
 		)
 		mustDo(t, c,
 			"XPENDING", "planets", "processing", "-", "+", "999", "bob",
-			proto.NilList,
+			proto.Strings(),
 		)
 		mustDo(t, c,
 			"XPENDING", "planets", "processing", "IDLE", "4000", "-", "+", "999", "alice",
@@ -1007,7 +1134,7 @@ func TestStreamXpending(t *testing.T) {
 		)
 		mustDo(t, c,
 			"XPENDING", "planets", "processing", "-", "+", "999",
-			proto.NilList,
+			proto.Strings(),
 		)
 	})
 
@@ -1102,6 +1229,239 @@ func TestStreamTrim(t *testing.T) {
 		proto.Array(
 			proto.Array(proto.String("5-1"), proto.Strings("name", "Saturn")),
 		))
+
+	t.Run("LIMIT", func(t *testing.T) {
+		for _, id := range []string{"1-1", "1-2", "1-3", "1-4", "1-5", "2-0", "10-0"} {
+			_, err := c.Do("XADD", "moons", id, "name", "Io")
+			ok(t, err)
+		}
+
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "~", "2", "LIMIT", "2", proto.Int(2))
+		mustDo(t, c,
+			"XLEN", "moons", proto.Int(5))
+		mustDo(t, c,
+			"XTRIM", "moons", "MAXLEN", "~", "1", "LIMIT", "3", proto.Int(3))
+		mustDo(t, c,
+			"XLEN", "moons", proto.Int(2))
+		// 0 is no limit
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "~", "3", "LIMIT", "0", proto.Int(1))
+		mustDo(t, c,
+			"XRANGE", "moons", "-", "+",
+			proto.Array(
+				proto.Array(proto.String("10-0"), proto.Strings("name", "Io")),
+			))
+
+		// IDs are compared as IDs, not as strings
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "9", proto.Int(0))
+
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "3", "LIMIT", "2",
+			proto.Error(msgXtrimInvalidLimit))
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "~", "3", "LIMIT", "-2",
+			proto.Error("ERR The LIMIT argument must be >= 0."))
+		mustDo(t, c,
+			"XTRIM", "moons", "MAXLEN", "-2",
+			proto.Error("ERR The MAXLEN argument must be >= 0."))
+		mustDo(t, c,
+			"XTRIM", "moons", "MINID", "foo",
+			proto.Error(msgInvalidStreamID))
+		mustDo(t, c,
+			"XTRIM", "moons", "MAXLEN", "=",
+			proto.Error(msgSyntaxError))
+	})
+
+	t.Run("XADD", func(t *testing.T) {
+		for _, id := range []string{"1-1", "1-2", "1-3"} {
+			_, err := c.Do("XADD", "rings", id, "name", "A")
+			ok(t, err)
+		}
+		mustDo(t, c,
+			"XADD", "rings", "MINID", "1-3", "2-0", "name", "B",
+			proto.String("2-0"))
+		mustDo(t, c,
+			"XLEN", "rings", proto.Int(2))
+		mustDo(t, c,
+			"XADD", "rings", "MAXLEN", "~", "1", "LIMIT", "1", "3-0", "name", "C",
+			proto.String("3-0"))
+		mustDo(t, c,
+			"XLEN", "rings", proto.Int(2))
+
+		mustDo(t, c,
+			"XADD", "nosuch", "NOMKSTREAM", "*", "name", "D",
+			proto.Nil)
+		must0(t, c,
+			"EXISTS", "nosuch")
+		mustDo(t, c,
+			"XADD", "rings", "NOMKSTREAM", "4-0", "name", "D",
+			proto.String("4-0"))
+	})
+}
+
+func TestStreamNotify(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+	sub, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer sub.Close()
+
+	mustFail(t, s.NotifyKeyspaceEvents("Kq"), errInvalidNotifyFlags.Error())
+	ok(t, s.NotifyKeyspaceEvents("KEt"))
+
+	mustDo(t, sub,
+		"PSUBSCRIBE", "__keyspace@0__:*",
+		proto.Array(proto.String("psubscribe"), proto.String("__keyspace@0__:*"), proto.Int(1)),
+	)
+	mustDo(t, sub,
+		"PSUBSCRIBE", "__keyevent@0__:xtrim",
+		proto.Array(proto.String("psubscribe"), proto.String("__keyevent@0__:xtrim"), proto.Int(2)),
+	)
+	event := func(t *testing.T, event string) {
+		t.Helper()
+		mustRead(t, sub,
+			proto.Strings("pmessage", "__keyspace@0__:*", "__keyspace@0__:planets", event),
+		)
+	}
+
+	mustDo(t, c, "XADD", "planets", "1-0", "name", "Mercury", proto.String("1-0"))
+	event(t, "xadd")
+	mustDo(t, c, "XADD", "planets", "MAXLEN", "1", "2-0", "name", "Venus", proto.String("2-0"))
+	event(t, "xadd")
+	event(t, "xtrim")
+	mustRead(t, sub,
+		proto.Strings("pmessage", "__keyevent@0__:xtrim", "__keyevent@0__:xtrim", "planets"),
+	)
+
+	mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "$")
+	event(t, "xgroup-create")
+	must1(t, c, "XGROUP", "CREATECONSUMER", "planets", "processing", "alice")
+	event(t, "xgroup-createconsumer")
+	must0(t, c, "XGROUP", "CREATECONSUMER", "planets", "processing", "alice")
+	mustDo(t, c, "XADD", "planets", "3-0", "name", "Earth", proto.String("3-0"))
+	event(t, "xadd")
+	_, err = c.Do("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">")
+	ok(t, err)
+	event(t, "xgroup-createconsumer")
+	_, err = c.Do("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">")
+	ok(t, err)
+	mustDo(t, c, "XDEL", "planets", "999-0", proto.Int(0))
+	must1(t, c, "XDEL", "planets", "3-0")
+	event(t, "xdel")
+	mustDo(t, c, "XGROUP", "DELCONSUMER", "planets", "processing", "bob", proto.Int(1))
+	event(t, "xgroup-delconsumer")
+	must1(t, c, "XGROUP", "DESTROY", "planets", "processing")
+	event(t, "xgroup-destroy")
+	must0(t, c, "XTRIM", "planets", "MAXLEN", "5")
+	must1(t, c, "XTRIM", "planets", "MAXLEN", "0")
+	event(t, "xtrim")
+	mustRead(t, sub,
+		proto.Strings("pmessage", "__keyevent@0__:xtrim", "__keyevent@0__:xtrim", "planets"),
+	)
+}
+
+func TestStreamKeyEvents(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	// no NotifyKeyspaceEvents() needed
+	sub := s.KeyEvents("planet*", 0)
+	buffered := s.KeyEvents("*", 10)
+
+	mustDo(t, c, "XADD", "planets", "1-0", "name", "Mercury", proto.String("1-0"))
+	mustDo(t, c, "XADD", "moons", "1-0", "name", "Luna", proto.String("1-0"))
+	mustDo(t, c, "XADD", "planets", "MAXLEN", "1", "2-0", "name", "Venus", proto.String("2-0"))
+
+	equals(t, KeyEvent{DB: 0, Key: "planets", Event: "xadd"}, <-sub.Events())
+	equals(t, KeyEvent{DB: 0, Key: "planets", Event: "xadd"}, <-sub.Events())
+	sub.Close()
+	// after Close() we still get the queued event
+	equals(t, KeyEvent{DB: 0, Key: "planets", Event: "xtrim"}, <-sub.Events())
+	_, open := <-sub.Events()
+	assert(t, !open, "closed")
+
+	mustDo(t, c, "XADD", "planets", "3-0", "name", "Earth", proto.String("3-0"))
+	buffered.Close()
+	var events []string
+	for e := range buffered.Events() {
+		events = append(events, e.Key+" "+e.Event)
+	}
+	equals(t, []string{
+		"planets xadd",
+		"moons xadd",
+		"planets xadd",
+		"planets xtrim",
+		"planets xadd",
+	}, events)
+}
+
+func TestStreamKeyEventsOrder(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+	sub, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer sub.Close()
+
+	ok(t, s.NotifyKeyspaceEvents("Kt"))
+	mustDo(t, sub,
+		"PSUBSCRIBE", "*",
+		proto.Array(proto.String("psubscribe"), proto.String("*"), proto.Int(1)),
+	)
+	events := s.KeyEvents("*", 10)
+	defer events.Close()
+	read := func(t *testing.T, channel, msg string) {
+		t.Helper()
+		mustRead(t, sub, proto.Strings("pmessage", "*", channel, msg))
+	}
+
+	t.Run("script", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", `
+				redis.call("XADD", "planets", "1-0", "name", "Mercury")
+				redis.call("PUBLISH", "news", "added")
+				redis.call("XADD", "moons", "1-0", "name", "Luna")
+				return redis.call("PUBLISH", "news", "done")`, "0",
+			proto.Int(1),
+		)
+		read(t, "__keyspace@0__:planets", "xadd")
+		read(t, "news", "added")
+		read(t, "__keyspace@0__:moons", "xadd")
+		read(t, "news", "done")
+		equals(t, KeyEvent{DB: 0, Key: "planets", Event: "xadd"}, <-events.Events())
+		equals(t, KeyEvent{DB: 0, Key: "moons", Event: "xadd"}, <-events.Events())
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "XADD", "planets", "2-0", "name", "Venus", proto.Inline("QUEUED"))
+		mustDo(t, c, "PUBLISH", "news", "added", proto.Inline("QUEUED"))
+		mustDo(t, c, "XADD", "moons", "2-0", "name", "Phobos", proto.Inline("QUEUED"))
+		equals(t, 0, len(events.Events()))
+		mustDo(t, c, "EXEC", proto.Array(
+			proto.String("2-0"),
+			proto.Int(1),
+			proto.String("2-0"),
+		))
+		read(t, "__keyspace@0__:planets", "xadd")
+		read(t, "news", "added")
+		read(t, "__keyspace@0__:moons", "xadd")
+		equals(t, KeyEvent{DB: 0, Key: "planets", Event: "xadd"}, <-events.Events())
+		equals(t, KeyEvent{DB: 0, Key: "moons", Event: "xadd"}, <-events.Events())
+	})
 }
 
 func TestStreamAutoClaim(t *testing.T) {
@@ -1395,7 +1755,7 @@ func TestStreamClaim(t *testing.T) {
 	)
 	mustDo(t, c,
 		"XPENDING", "planets", "processing", "-", "+", "999",
-		proto.NilList,
+		proto.Strings(),
 	)
 
 	mustDo(t, c,
@@ -1641,6 +2001,151 @@ func TestStreamClaim(t *testing.T) {
 	)
 	mustDo(t, c,
 		"XPENDING", "planets", "processing", "-", "+", "999",
-		proto.NilList,
+		proto.Strings(),
+	)
+}
+
+func TestStreamConsumerIdle(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+	s.SetTime(time.Now())
+
+	mustFail(t, s.SetConsumerIdle("planets", "processing", "alice", time.Minute), msgKeyNotFound)
+	mustOK(t, c,
+		"XGROUP", "CREATE", "planets", "processing", "$", "MKSTREAM",
+	)
+	mustFail(t, s.SetConsumerIdle("planets", "nosuch", "alice", time.Minute), ErrGroupNotFound.Error())
+	mustFail(t, s.SetConsumerIdle("planets", "processing", "alice", time.Minute), ErrConsumerNotFound.Error())
+
+	_, err = s.XAdd("planets", "0-1", []string{"name", "Mercury"})
+	ok(t, err)
+	_, err = s.XAdd("planets", "0-2", []string{"name", "Venus"})
+	ok(t, err)
+	_, err = c.Do("XREADGROUP", "GROUP", "processing", "alice", "COUNT", "1", "STREAMS", "planets", ">")
+	ok(t, err)
+	_, err = c.Do("XREADGROUP", "GROUP", "processing", "bob", "COUNT", "1", "STREAMS", "planets", ">")
+	ok(t, err)
+
+	mustDo(t, c,
+		"XPENDING", "planets", "processing", "IDLE", "60000", "-", "+", "10",
+		proto.Strings(),
+	)
+	mustDo(t, c,
+		"XAUTOCLAIM", "planets", "processing", "chris", "60000", "0", "JUSTID",
+		proto.Array(proto.String("0-0"), proto.Array(), proto.Array()),
+	)
+
+	ok(t, s.SetConsumerIdle("planets", "processing", "alice", 2*time.Minute))
+	mustDo(t, c,
+		"XPENDING", "planets", "processing", "IDLE", "60000", "-", "+", "10",
+		proto.Array(
+			proto.Array(proto.String("0-1"), proto.String("alice"), proto.Int(120000), proto.Int(1)),
+		),
+	)
+	mustDo(t, c,
+		"XAUTOCLAIM", "planets", "processing", "chris", "60000", "0", "JUSTID",
+		proto.Array(proto.String("0-0"), proto.Array(proto.String("0-1")), proto.Array()),
+	)
+}
+
+func TestStreamDelex(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c,
+		"XDELEX", "planets", "IDS", "1", "0-1",
+		proto.Array(proto.Int(-1)),
 	)
+
+	for _, id := range []string{"0-1", "0-2", "0-3", "0-4", "0-5"} {
+		_, err := s.XAdd("planets", id, []string{"name", "Mercury"})
+		ok(t, err)
+	}
+	mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "0")
+	mustOK(t, c, "XGROUP", "CREATE", "planets", "other", "0")
+	_, err = c.Do("XREADGROUP", "GROUP", "processing", "alice", "COUNT", "3", "STREAMS", "planets", ">")
+	ok(t, err)
+
+	t.Run("XDELEX", func(t *testing.T) {
+		// KEEPREF is the default
+		mustDo(t, c,
+			"XDELEX", "planets", "IDS", "2", "0-1", "0-99",
+			proto.Array(proto.Int(1), proto.Int(-1)),
+		)
+		// deleted entries are not counted
+		must0(t, c, "XACK", "planets", "processing", "0-1")
+
+		// still pending for "processing", and not read by "other"
+		mustDo(t, c,
+			"XDELEX", "planets", "ACKED", "IDS", "1", "0-2",
+			proto.Array(proto.Int(2)),
+		)
+
+		mustDo(t, c,
+			"XDELEX", "planets", "DELREF", "IDS", "1", "0-2",
+			proto.Array(proto.Int(1)),
+		)
+		must0(t, c, "XACK", "planets", "processing", "0-2")
+		mustDo(t, c, "XLEN", "planets", proto.Int(3))
+	})
+
+	t.Run("XACKDEL", func(t *testing.T) {
+		mustDo(t, c,
+			"XACKDEL", "planets", "processing", "ACKED", "IDS", "2", "0-3", "0-4",
+			proto.Array(proto.Int(2), proto.Int(-1)),
+		)
+		mustDo(t, c, "XLEN", "planets", proto.Int(3))
+
+		_, err = c.Do("XREADGROUP", "GROUP", "other", "bob", "STREAMS", "planets", ">")
+		ok(t, err)
+		mustDo(t, c,
+			"XACKDEL", "planets", "other", "ACKED", "IDS", "1", "0-3",
+			proto.Array(proto.Int(1)),
+		)
+		mustDo(t, c,
+			"XACKDEL", "planets", "other", "KEEPREF", "IDS", "1", "0-4",
+			proto.Array(proto.Int(1)),
+		)
+		mustDo(t, c, "XLEN", "planets", proto.Int(1))
+
+		mustDo(t, c,
+			"XACKDEL", "planets", "nosuch", "IDS", "1", "0-4",
+			proto.Error("NOGROUP No such key 'planets' or consumer group 'nosuch'"),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"XDELEX", "planets", "IDS", "1",
+			proto.Error(errWrongNumber("xdelex")),
+		)
+		mustDo(t, c,
+			"XDELEX", "planets", "FOO", "IDS", "1", "0-1",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c,
+			"XDELEX", "planets", "IDS", "0", "0-1",
+			proto.Error("ERR Number of IDs must be a positive integer"),
+		)
+		mustDo(t, c,
+			"XDELEX", "planets", "IDS", "2", "0-1",
+			proto.Error("ERR The `numids` parameter must match the number of arguments"),
+		)
+		mustDo(t, c,
+			"XDELEX", "planets", "IDS", "1", "foo",
+			proto.Error(msgInvalidStreamID),
+		)
+		mustDo(t, c,
+			"XACKDEL", "planets", "processing", "IDS", "1",
+			proto.Error(errWrongNumber("xackdel")),
+		)
+	})
 }
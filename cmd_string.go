@@ -4,7 +4,6 @@ package miniredis
 
 import (
 	"math/big"
-	"strconv"
 	"strings"
 	"time"
 
@@ -96,22 +95,16 @@ func (m *Miniredis) cmdSet(c *server.Peer, cmd string, args []string) {
 				c.WriteError(msgSyntaxError)
 				return
 			}
-			expire, err := strconv.Atoi(args[1])
-			if err != nil {
-				setDirty(c)
-				c.WriteError(msgInvalidInt)
-				return
-			}
-			if expire <= 0 {
-				setDirty(c)
-				c.WriteError(msgInvalidSETime)
+			unix := arg == "PXAT" || arg == "EXAT"
+			var expire int64
+			if ok := optExpire(c, cmd, args[1], timeUnit, unix, true, m.effectiveNow(), &expire); !ok {
 				return
 			}
 
-			if arg == "PXAT" || arg == "EXAT" {
+			if unix {
 				opts.ttl = m.at(expire, timeUnit)
 			} else {
-				opts.ttl = time.Duration(expire) * timeUnit
+				opts.ttl = ttlDuration(expire, timeUnit)
 			}
 			opts.ttlSet = true
 
@@ -155,12 +148,12 @@ func (m *Miniredis) cmdSet(c *server.Peer, cmd string, args []string) {
 			}
 		}
 		if opts.keepttl {
-			if val, ok := db.ttl[opts.key]; ok {
+			if val, ok := db.ttl.get(opts.key); ok {
 				opts.ttl = val
 			}
 		}
 		if opts.get {
-			if t, ok := db.keys[opts.key]; ok && t != "string" {
+			if db.wrongType(opts.key, "string") {
 				c.WriteError(msgWrongType)
 				return
 			}
@@ -174,14 +167,14 @@ func (m *Miniredis) cmdSet(c *server.Peer, cmd string, args []string) {
 				db.stringSet(opts.key, opts.value)
 			}
 			if opts.ttl != 0 {
-				db.ttl[opts.key] = opts.ttl
+				db.ttl.set(opts.key, opts.ttl)
 			}
 		}
 		if opts.get {
 			if !existed {
 				c.WriteNull()
 			} else {
-				c.WriteBulk(old)
+				c.WriteBulk(old.String())
 			}
 			return
 		}
@@ -204,15 +197,8 @@ func (m *Miniredis) cmdSetex(c *server.Peer, cmd string, args []string) {
 	}
 
 	key := args[0]
-	ttl, err := strconv.Atoi(args[1])
-	if err != nil {
-		setDirty(c)
-		c.WriteError(msgInvalidInt)
-		return
-	}
-	if ttl <= 0 {
-		setDirty(c)
-		c.WriteError(msgInvalidSETEXTime)
+	var ttl int64
+	if ok := optExpire(c, cmd, args[1], time.Second, false, true, m.effectiveNow(), &ttl); !ok {
 		return
 	}
 	value := args[2]
@@ -222,7 +208,7 @@ func (m *Miniredis) cmdSetex(c *server.Peer, cmd string, args []string) {
 
 		db.del(key, true) // Clear any existing keys.
 		db.stringSet(key, value)
-		db.ttl[key] = time.Duration(ttl) * time.Second
+		db.ttl.set(key, ttlDuration(ttl, time.Second))
 		c.WriteOK()
 	})
 }
@@ -243,17 +229,12 @@ func (m *Miniredis) cmdPsetex(c *server.Peer, cmd string, args []string) {
 
 	var opts struct {
 		key   string
-		ttl   int
+		ttl   int64
 		value string
 	}
 
 	opts.key = args[0]
-	if ok := optInt(c, args[1], &opts.ttl); !ok {
-		return
-	}
-	if opts.ttl <= 0 {
-		setDirty(c)
-		c.WriteError(msgInvalidPSETEXTime)
+	if ok := optExpire(c, cmd, args[1], time.Millisecond, false, true, m.effectiveNow(), &opts.ttl); !ok {
 		return
 	}
 	opts.value = args[2]
@@ -263,7 +244,7 @@ func (m *Miniredis) cmdPsetex(c *server.Peer, cmd string, args []string) {
 
 		db.del(opts.key, true) // Clear any existing keys.
 		db.stringSet(opts.key, opts.value)
-		db.ttl[opts.key] = time.Duration(opts.ttl) * time.Millisecond
+		db.ttl.set(opts.key, ttlDuration(opts.ttl, time.Millisecond))
 		c.WriteOK()
 	})
 }
@@ -452,22 +433,16 @@ func (m *Miniredis) cmdGetex(c *server.Peer, cmd string, args []string) {
 				c.WriteError(msgSyntaxError)
 				return
 			}
-			expire, err := strconv.Atoi(args[1])
-			if err != nil {
-				setDirty(c)
-				c.WriteError(msgInvalidInt)
-				return
-			}
-			if expire <= 0 {
-				setDirty(c)
-				c.WriteError(msgInvalidSETime)
+			unix := arg == "PXAT" || arg == "EXAT"
+			var expire int64
+			if ok := optExpire(c, cmd, args[1], timeUnit, unix, true, m.effectiveNow(), &expire); !ok {
 				return
 			}
 
-			if arg == "PXAT" || arg == "EXAT" {
+			if unix {
 				opts.ttl = m.at(expire, timeUnit)
 			} else {
-				opts.ttl = time.Duration(expire) * timeUnit
+				opts.ttl = ttlDuration(expire, timeUnit)
 			}
 		default:
 			setDirty(c)
@@ -483,18 +458,22 @@ func (m *Miniredis) cmdGetex(c *server.Peer, cmd string, args []string) {
 			c.WriteNull()
 			return
 		}
-		switch {
-		case opts.persist:
-			delete(db.ttl, opts.key)
-		case opts.ttl != 0:
-			db.ttl[opts.key] = opts.ttl
-		}
-
 		if db.t(opts.key) != "string" {
 			c.WriteError(msgWrongType)
 			return
 		}
 
+		switch {
+		case opts.persist:
+			if _, ok := db.ttl.get(opts.key); ok {
+				db.ttl.del(opts.key)
+				db.bump(opts.key)
+			}
+		case opts.ttl != 0:
+			db.ttl.set(opts.key, opts.ttl)
+			db.bump(opts.key)
+		}
+
 		c.WriteBulk(db.stringGet(opts.key))
 	})
 }
@@ -518,7 +497,7 @@ func (m *Miniredis) cmdGetset(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -526,13 +505,13 @@ func (m *Miniredis) cmdGetset(c *server.Peer, cmd string, args []string) {
 		old, ok := db.stringKeys[key]
 		db.stringSet(key, value)
 		// a GETSET clears the ttl
-		delete(db.ttl, key)
+		db.ttl.del(key)
 
 		if !ok {
 			c.WriteNull()
 			return
 		}
-		c.WriteBulk(old)
+		c.WriteBulk(old.String())
 	})
 }
 
@@ -594,13 +573,7 @@ func (m *Miniredis) cmdMget(c *server.Peer, cmd string, args []string) {
 				c.WriteNull()
 				continue
 			}
-			v, ok := db.stringKeys[k]
-			if !ok {
-				// Should not happen, we just checked keys[]
-				c.WriteNull()
-				continue
-			}
-			c.WriteBulk(v)
+			c.WriteBulk(db.stringGet(k))
 		}
 	})
 }
@@ -623,7 +596,7 @@ func (m *Miniredis) cmdIncr(c *server.Peer, cmd string, args []string) {
 		db := m.db(ctx.selectedDB)
 
 		key := args[0]
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -663,7 +636,7 @@ func (m *Miniredis) cmdIncrby(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -693,7 +666,7 @@ func (m *Miniredis) cmdIncrbyfloat(c *server.Peer, cmd string, args []string) {
 	}
 
 	key := args[0]
-	delta, _, err := big.ParseFloat(args[1], 10, 128, 0)
+	delta, _, err := big.ParseFloat(args[1], 10, floatPrec, 0)
 	if err != nil {
 		setDirty(c)
 		c.WriteError(msgInvalidFloat)
@@ -703,7 +676,7 @@ func (m *Miniredis) cmdIncrbyfloat(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -736,7 +709,7 @@ func (m *Miniredis) cmdDecr(c *server.Peer, cmd string, args []string) {
 		db := m.db(ctx.selectedDB)
 
 		key := args[0]
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -776,7 +749,7 @@ func (m *Miniredis) cmdDecrby(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
@@ -810,12 +783,12 @@ func (m *Miniredis) cmdStrlen(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
 
-		c.WriteInt(len(db.stringKeys[key]))
+		c.WriteInt(db.stringLen(key))
 	})
 }
 
@@ -838,15 +811,12 @@ func (m *Miniredis) cmdAppend(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[key]; ok && t != "string" {
+		if db.wrongType(key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
 
-		newValue := db.stringKeys[key] + value
-		db.stringSet(key, newValue)
-
-		c.WriteInt(len(newValue))
+		c.WriteInt(db.stringAppend(key, value))
 	})
 }
 
@@ -880,13 +850,18 @@ func (m *Miniredis) cmdGetrange(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
 
+		if !db.exists(opts.key) {
+			c.WriteBulk("")
+			return
+		}
 		v := db.stringKeys[opts.key]
-		c.WriteBulk(withRange(v, opts.start, opts.end))
+		s, e := redisRange(v.Len(), opts.start, opts.end, true /* string getrange symantics */)
+		c.WriteBulk(v.Slice(s, e))
 	})
 }
 
@@ -923,21 +898,20 @@ func (m *Miniredis) cmdSetrange(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
 
-		v := []byte(db.stringKeys[opts.key])
-		end := opts.pos + len(opts.subst)
-		if len(v) < end {
-			newV := make([]byte, end)
-			copy(newV, v)
-			v = newV
+		if opts.subst == "" {
+			c.WriteInt(db.stringLen(opts.key))
+			return
+		}
+		if opts.pos > maxStringLen-len(opts.subst) {
+			c.WriteError(msgStringTooLong)
+			return
 		}
-		copy(v[opts.pos:end], opts.subst)
-		db.stringSet(opts.key, string(v))
-		c.WriteInt(len(v))
+		c.WriteInt(db.stringSetRange(opts.key, opts.pos, opts.subst))
 	})
 }
 
@@ -991,7 +965,7 @@ func (m *Miniredis) cmdBitcount(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		v := db.stringKeys[opts.key]
+		v := db.stringGet(opts.key)
 		if opts.useRange {
 			v = withRange(v, opts.start, opts.end)
 		}
@@ -1030,17 +1004,17 @@ func (m *Miniredis) cmdBitop(c *server.Peer, cmd string, args []string) {
 		switch opts.op {
 		case "AND", "OR", "XOR":
 			first := opts.input[0]
-			if t, ok := db.keys[first]; ok && t != "string" {
+			if db.wrongType(first, "string") {
 				c.WriteError(msgWrongType)
 				return
 			}
-			res := []byte(db.stringKeys[first])
+			res := []byte(db.stringGet(first))
 			for _, vk := range opts.input[1:] {
-				if t, ok := db.keys[vk]; ok && t != "string" {
+				if db.wrongType(vk, "string") {
 					c.WriteError(msgWrongType)
 					return
 				}
-				v := db.stringKeys[vk]
+				v := db.stringGet(vk)
 				cb := map[string]func(byte, byte) byte{
 					"AND": func(a, b byte) byte { return a & b },
 					"OR":  func(a, b byte) byte { return a | b },
@@ -1062,11 +1036,11 @@ func (m *Miniredis) cmdBitop(c *server.Peer, cmd string, args []string) {
 				return
 			}
 			key := opts.input[0]
-			if t, ok := db.keys[key]; ok && t != "string" {
+			if db.wrongType(key, "string") {
 				c.WriteError(msgWrongType)
 				return
 			}
-			value := []byte(db.stringKeys[key])
+			value := []byte(db.stringGet(key))
 			for i := range value {
 				value[i] = ^value[i]
 			}
@@ -1124,10 +1098,10 @@ func (m *Miniredis) cmdBitpos(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.Key]; ok && t != "string" {
+		if db.wrongType(opts.Key, "string") {
 			c.WriteError(msgWrongType)
 			return
-		} else if !ok {
+		} else if !db.exists(opts.Key) {
 			// non-existing key behaves differently
 			if opts.Bit == 0 {
 				c.WriteInt(0)
@@ -1136,7 +1110,7 @@ func (m *Miniredis) cmdBitpos(c *server.Peer, cmd string, args []string) {
 			}
 			return
 		}
-		value := db.stringKeys[opts.Key]
+		value := db.stringGet(opts.Key)
 		start := opts.Start
 		end := opts.End
 		if start < 0 {
@@ -1206,7 +1180,7 @@ func (m *Miniredis) cmdGetbit(c *server.Peer, cmd string, args []string) {
 	if ok := optIntErr(c, args[1], &opts.bit, "ERR bit offset is not an integer or out of range"); !ok {
 		return
 	}
-	if opts.bit < 0 {
+	if opts.bit < 0 || opts.bit >= maxStringLen*8 {
 		setDirty(c)
 		c.WriteError("ERR bit offset is not an integer or out of range")
 		return
@@ -1215,18 +1189,14 @@ func (m *Miniredis) cmdGetbit(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
-		value := db.stringKeys[opts.key]
-
 		ourByteNr := opts.bit / 8
 		var ourByte byte
-		if ourByteNr > len(value)-1 {
-			ourByte = '\x00'
-		} else {
-			ourByte = value[ourByteNr]
+		if ourByteNr < db.stringLen(opts.key) {
+			ourByte = db.stringKeys[opts.key].Slice(ourByteNr, ourByteNr+1)[0]
 		}
 		res := 0
 		if toBits(ourByte)[opts.bit%8] {
@@ -1259,7 +1229,7 @@ func (m *Miniredis) cmdSetbit(c *server.Peer, cmd string, args []string) {
 	if ok := optIntErr(c, args[1], &opts.bit, "ERR bit offset is not an integer or out of range"); !ok {
 		return
 	}
-	if opts.bit < 0 {
+	if opts.bit < 0 || opts.bit >= maxStringLen*8 {
 		setDirty(c)
 		c.WriteError("ERR bit offset is not an integer or out of range")
 		return
@@ -1276,30 +1246,26 @@ func (m *Miniredis) cmdSetbit(c *server.Peer, cmd string, args []string) {
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		db := m.db(ctx.selectedDB)
 
-		if t, ok := db.keys[opts.key]; ok && t != "string" {
+		if db.wrongType(opts.key, "string") {
 			c.WriteError(msgWrongType)
 			return
 		}
-		value := []byte(db.stringKeys[opts.key])
-
 		ourByteNr := opts.bit / 8
 		ourBitNr := opts.bit % 8
-		if ourByteNr > len(value)-1 {
-			// Too short. Expand.
-			newValue := make([]byte, ourByteNr+1)
-			copy(newValue, value)
-			value = newValue
+		var value byte
+		if ourByteNr < db.stringLen(opts.key) {
+			value = db.stringKeys[opts.key].Slice(ourByteNr, ourByteNr+1)[0]
 		}
 		old := 0
-		if toBits(value[ourByteNr])[ourBitNr] {
+		if toBits(value)[ourBitNr] {
 			old = 1
 		}
 		if opts.newBit == 0 {
-			value[ourByteNr] &^= 1 << uint8(7-ourBitNr)
+			value &^= 1 << uint8(7-ourBitNr)
 		} else {
-			value[ourByteNr] |= 1 << uint8(7-ourBitNr)
+			value |= 1 << uint8(7-ourBitNr)
 		}
-		db.stringSet(opts.key, string(value))
+		db.stringSetRange(opts.key, ourByteNr, string([]byte{value}))
 
 		c.WriteInt(old)
 	})
@@ -149,12 +149,22 @@ func TestSet(t *testing.T) {
 
 		mustDo(t, c,
 			"SET", "aap", "noot", "EX", "0",
-			proto.Error("ERR invalid expire time in set"),
+			proto.Error(errInvalidExpireTime("set")),
 		)
 		mustDo(t, c,
 			"SET", "aap", "noot", "EX", "-100",
-			proto.Error("ERR invalid expire time in set"),
+			proto.Error(errInvalidExpireTime("set")),
 		)
+		mustDo(t, c,
+			"SET", "aap", "noot", "EX", "9223372036854775",
+			proto.Error(errInvalidExpireTime("set")),
+		)
+		mustDo(t, c,
+			"SET", "aap", "noot", "PX", "9223372036854775807",
+			proto.Error(errInvalidExpireTime("set")),
+		)
+		mustOK(t, c, "SET", "aap", "noot", "PXAT", "9223372036854775807")
+		assert(t, s.TTL("aap") > 290*365*24*time.Hour, "huge TTL")
 	})
 
 	t.Run("KEEPTTL", func(t *testing.T) {
@@ -185,7 +195,7 @@ func TestSet(t *testing.T) {
 		equals(t, time.Second*1111111011, s.TTL("exat"))
 		mustDo(t, c,
 			"SET", "exat", "bal", "EXAT", "-1",
-			proto.Error(msgInvalidSETime),
+			proto.Error(errInvalidExpireTime("set")),
 		)
 	})
 
@@ -197,7 +207,7 @@ func TestSet(t *testing.T) {
 		equals(t, time.Second*2111111011, s.TTL("pxat"))
 		mustDo(t, c,
 			"SET", "pxat", "bal", "PXAT", "-1",
-			proto.Error(msgInvalidSETime),
+			proto.Error(errInvalidExpireTime("set")),
 		)
 	})
 
@@ -281,6 +291,17 @@ func TestMset(t *testing.T) {
 		equals(t, time.Duration(0), s.TTL("aap"))
 		equals(t, time.Duration(0), s.TTL("foo"))
 	}
+
+	t.Run("big", func(t *testing.T) {
+		args := []string{"MSET"}
+		for i := 0; i < 100000; i++ {
+			args = append(args, "key:"+strconv.Itoa(i), "value:"+strconv.Itoa(i))
+		}
+		mustOK(t, c, args...)
+		s.CheckGet(t, "key:0", "value:0")
+		s.CheckGet(t, "key:99999", "value:99999")
+		equals(t, 100005, len(s.Keys()))
+	})
 }
 
 func TestSetex(t *testing.T) {
@@ -325,11 +346,15 @@ func TestSetex(t *testing.T) {
 		)
 		mustDo(t, c,
 			"SETEX", "aap", "0", "noot",
-			proto.Error("ERR invalid expire time in setex"),
+			proto.Error(errInvalidExpireTime("setex")),
 		)
 		mustDo(t, c,
 			"SETEX", "aap", "-10", "noot",
-			proto.Error("ERR invalid expire time in setex"),
+			proto.Error(errInvalidExpireTime("setex")),
+		)
+		mustDo(t, c,
+			"SETEX", "aap", "9223372036854775807", "noot",
+			proto.Error(errInvalidExpireTime("setex")),
 		)
 	}
 }
@@ -376,11 +401,15 @@ func TestPsetex(t *testing.T) {
 		)
 		mustDo(t, c,
 			"PSETEX", "aap", "0", "noot",
-			proto.Error("ERR invalid expire time in psetex"),
+			proto.Error(errInvalidExpireTime("psetex")),
 		)
 		mustDo(t, c,
 			"PSETEX", "aap", "-10", "noot",
-			proto.Error("ERR invalid expire time in psetex"),
+			proto.Error(errInvalidExpireTime("psetex")),
+		)
+		mustDo(t, c,
+			"PSETEX", "aap", "9223372036854775807", "noot",
+			proto.Error(errInvalidExpireTime("psetex")),
 		)
 	}
 }
@@ -583,6 +612,46 @@ func TestIncrbyfloat(t *testing.T) {
 		)
 	}
 
+	t.Run("formatting", func(t *testing.T) {
+		for _, c2 := range []struct {
+			start, delta, want string
+		}{
+			{"10.50", "0.1", "10.6"},
+			{"10.6", "5.0e3", "5010.6"},
+			{"0.1", "0.2", "0.3"},
+			{"1", "-1.00000000000000000001", "0"},
+			{"0", "3.0", "3"},
+			{"1e20", "0.5", "100000000000000000000"},
+			{"123456789012345678", "0.5", "123456789012345678"},
+			{"0", "0.000123456789012345678", "0.00012345678901235"},
+			{"1", "0.33333333333333333333333", "1.3333333333333333"},
+		} {
+			s.Set("f", c2.start)
+			mustDo(t, c,
+				"INCRBYFLOAT", "f", c2.delta,
+				proto.String(c2.want),
+			)
+		}
+	})
+
+	t.Run("infinity", func(t *testing.T) {
+		s.Set("f", "inf")
+		mustDo(t, c,
+			"INCRBYFLOAT", "f", "1",
+			proto.Error(msgIncrNaNInf),
+		)
+		s.Set("f", "1")
+		mustDo(t, c,
+			"INCRBYFLOAT", "f", "+inf",
+			proto.Error(msgIncrNaNInf),
+		)
+		mustDo(t, c,
+			"INCRBYFLOAT", "f", "nan",
+			proto.Error(msgInvalidFloat),
+		)
+		s.CheckGet(t, "f", "1")
+	})
+
 	// New key
 	{
 		mustDo(t, c,
@@ -835,10 +904,24 @@ func TestGetex(t *testing.T) {
 	})
 
 	t.Run("errors", func(t *testing.T) {
+		// the overflow checks add the SetTime() time
+		s.SetTime(time.Time{})
 		mustDo(t, c,
 			"GETEX", "one", "two",
 			proto.Error(msgSyntaxError),
 		)
+		mustDo(t, c,
+			"GETEX", "one", "EX", "0",
+			proto.Error(errInvalidExpireTime("getex")),
+		)
+		mustDo(t, c,
+			"GETEX", "one", "EX", "9223372036854775",
+			proto.Error(errInvalidExpireTime("getex")),
+		)
+		mustDo(t, c,
+			"GETEX", "one", "PX", "9223372036854775807",
+			proto.Error(errInvalidExpireTime("getex")),
+		)
 	})
 }
 
@@ -1112,6 +1195,50 @@ func TestGetrange(t *testing.T) {
 	}
 }
 
+// Test SUBSTR, the old name of GETRANGE
+func TestSubstr(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("foo", "abcdefg")
+	mustDo(t, c,
+		"SUBSTR", "foo", "1", "3",
+		proto.String("bcd"),
+	)
+	mustDo(t, c,
+		"substr", "foo", "-3", "-1",
+		proto.String("efg"),
+	)
+	mustDo(t, c,
+		"SUBSTR", "foo",
+		proto.Error(errWrongNumber("substr")),
+	)
+
+	t.Run("deprecated", func(t *testing.T) {
+		var seen []string
+		s.OnDeprecated(func(cmd, replacement string) {
+			seen = append(seen, cmd+":"+replacement)
+		})
+		defer s.OnDeprecated(nil)
+		mustDo(t, c,
+			"SUBSTR", "foo", "0", "0",
+			proto.String("a"),
+		)
+		equals(t, []string{"SUBSTR:GETRANGE"}, seen)
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		ok(t, s.srv.Rename("SUBSTR", ""))
+		mustContain(t, c, "SUBSTR", "foo", "0", "0", "unknown command")
+		mustDo(t, c,
+			"GETRANGE", "foo", "0", "0",
+			proto.String("a"),
+		)
+	})
+}
+
 func TestSetrange(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -1138,6 +1265,34 @@ func TestSetrange(t *testing.T) {
 		s.CheckGet(t, "nosuch", "\x00\x00\x00bar")
 	}
 
+	// Big values
+	{
+		mustDo(t, c,
+			"SETRANGE", "big", "1000000", "bar",
+			proto.Int(1000003),
+		)
+		mustDo(t, c,
+			"APPEND", "big", "baz",
+			proto.Int(1000006),
+		)
+		mustDo(t, c,
+			"SETBIT", "big", "8", "1",
+			proto.Int(0),
+		)
+		mustDo(t, c,
+			"GETRANGE", "big", "0", "2",
+			proto.String("\x00\x80\x00"),
+		)
+		mustDo(t, c,
+			"GETRANGE", "big", "999999", "-1",
+			proto.String("\x00barbaz"),
+		)
+		mustDo(t, c,
+			"STRLEN", "big",
+			proto.Int(1000006),
+		)
+	}
+
 	// Wrong type of existing key
 	{
 		s.HSet("wrong", "aap", "noot")
@@ -1169,6 +1324,14 @@ func TestSetrange(t *testing.T) {
 			"SETRANGE", "key", "-1", "",
 			proto.Error("ERR offset is out of range"),
 		)
+		mustDo(t, c,
+			"SETRANGE", "key", "9223372036854775807", "x",
+			proto.Error(msgStringTooLong),
+		)
+		mustDo(t, c,
+			"SETRANGE", "nokey", "2147483647", "",
+			proto.Int(0),
+		)
 		mustDo(t, c,
 			"SETRANGE", "many", "12", "keys", "here",
 			proto.Error(errWrongNumber("setrange")),
@@ -1596,6 +1759,14 @@ func TestGetbit(t *testing.T) {
 			"GETBIT", "many", "noint",
 			proto.Error("ERR bit offset is not an integer or out of range"),
 		)
+		mustDo(t, c,
+			"GETBIT", "many", "4294967296",
+			proto.Error("ERR bit offset is not an integer or out of range"),
+		)
+		mustDo(t, c,
+			"GETBIT", "many", "9223372036854775807",
+			proto.Error("ERR bit offset is not an integer or out of range"),
+		)
 	}
 }
 
@@ -1672,6 +1843,14 @@ func TestSetbit(t *testing.T) {
 			"SETBIT", "many", "-3", "0",
 			proto.Error("ERR bit offset is not an integer or out of range"),
 		)
+		mustDo(t, c,
+			"SETBIT", "many", "4294967296", "1",
+			proto.Error("ERR bit offset is not an integer or out of range"),
+		)
+		mustDo(t, c,
+			"SETBIT", "many", "9223372036854775807", "1",
+			proto.Error("ERR bit offset is not an integer or out of range"),
+		)
 		mustDo(t, c,
 			"SETBIT", "many", "3", "2",
 			proto.Error("ERR bit is not an integer or out of range"),
@@ -88,9 +88,12 @@ func (m *Miniredis) cmdExec(c *server.Peer, cmd string, args []string) {
 	}
 
 	c.WriteLen(len(ctx.transaction))
+	m.writer = c
 	for _, cb := range ctx.transaction {
+		m.op++
 		cb(c, ctx)
 	}
+	m.writer = nil
 	// wake up anyone who waits on anything.
 	m.signal.Broadcast()
 
@@ -177,3 +180,17 @@ func (m *Miniredis) cmdUnwatch(c *server.Peer, cmd string, args []string) {
 		c.WriteOK()
 	})
 }
+
+// txErrorHook fails the transaction when a command in a MULTI replied with an
+// error, instead of being queued. Handlers mark that themselves with
+// setDirty(), this catches the errors they miss, such as unknown commands.
+func (m *Miniredis) txErrorHook(c *server.Peer, cmd string, _ string) {
+	switch cmd {
+	case "MULTI", "EXEC", "DISCARD", "WATCH":
+		// misuse of these doesn't fail the transaction
+		return
+	}
+	if ctx, ok := c.Ctx.(*connCtx); ok && inTx(ctx) {
+		ctx.dirtyTransaction = true
+	}
+}
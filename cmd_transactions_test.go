@@ -1,6 +1,7 @@
 package miniredis
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2/proto"
@@ -173,6 +174,40 @@ func TestTxQueueErr(t *testing.T) {
 
 	// Didn't get EXECed
 	equals(t, false, s.Exists("aap"))
+
+	t.Run("every error", func(t *testing.T) {
+		for _, cmd := range [][]string{
+			{"ZRANGE", "z", "0", "1", "LIMIT"},
+			{"ZRANGEBYLEX", "z", "-", "+", "LIMIT", "1"},
+			{"ZRANGEBYSCORE", "z", "0", "1", "LIMIT", "1"},
+			{"ZREVRANGE", "z", "0", "1", "foo"},
+			{"ZPOPMAX", "z", "1", "foo"},
+			{"XAUTOCLAIM", "s", "g", "c", "0", "foo"},
+			{"NOSUCHCOMMAND"},
+		} {
+			mustOK(t, c, "MULTI")
+			res, err := c.Do(cmd...)
+			ok(t, err)
+			assert(t, strings.HasPrefix(res, "-"), "%v: not an error: %q", cmd, res)
+			mustDo(t, c,
+				"EXEC",
+				proto.Error("EXECABORT Transaction discarded because of previous errors."),
+			)
+		}
+	})
+
+	t.Run("not an error", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c,
+			"MULTI",
+			proto.Error("ERR MULTI calls can not be nested"),
+		)
+		mustDo(t, c,
+			"WATCH", "aap",
+			proto.Error("ERR WATCH in MULTI"),
+		)
+		mustDo(t, c, "EXEC", proto.Array())
+	})
 }
 
 func TestTxWatch(t *testing.T) {
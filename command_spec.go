@@ -0,0 +1,235 @@
+package miniredis
+
+// Static information about commands: arity, flags, and where the keys are.
+// Mostly taken from the COMMAND reply.
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+type commandSpec struct {
+	name     string // lowercase
+	arity    int    // negative means "at least"
+	flags    []string
+	firstKey int // 1-based position of the first key. 0 if no keys.
+	lastKey  int // negative counts from the end
+	keyStep  int
+}
+
+// commands which are newer than the COMMAND dump in cmd_command.go.
+var extraCommandSpecs = []commandSpec{
+	{"acl", -2, []string{"admin", "noscript", "loading", "stale"}, 0, 0, 0},
+	{"copy", -3, []string{"write", "denyoom"}, 1, 2, 1},
+	{"getdel", 2, []string{"write", "fast"}, 1, 1, 1},
+	{"getex", -2, []string{"write", "fast"}, 1, 1, 1},
+	{"hello", -1, []string{"noscript", "loading", "stale", "fast"}, 0, 0, 0},
+	{"lmove", 5, []string{"write", "denyoom"}, 1, 2, 1},
+	{"lpos", -3, []string{"readonly"}, 1, 1, 1},
+	{"quit", -1, []string{"loading", "stale", "fast"}, 0, 0, 0},
+	{"xackdel", -6, []string{"write", "fast"}, 1, 1, 1},
+	{"xautoclaim", -6, []string{"write", "fast"}, 1, 1, 1},
+	{"xdelex", -5, []string{"write", "fast"}, 1, 1, 1},
+	{"zintercard", -3, []string{"readonly", "movablekeys"}, 0, 0, 0},
+	{"zmscore", -3, []string{"readonly", "fast"}, 1, 1, 1},
+	{"zrandmember", -2, []string{"readonly"}, 1, 1, 1},
+	{"zrangestore", -5, []string{"write", "denyoom"}, 1, 2, 1},
+	{"zunion", -3, []string{"readonly", "movablekeys"}, 0, 0, 0},
+}
+
+// commandAliases are historic command names, which are handled by the command
+// they are an alias of. They are all in deprecatedCommands as well.
+var commandAliases = map[string]string{
+	"SUBSTR": "GETRANGE",
+}
+
+// deprecatedCommands are the commands redis considers deprecated, with what
+// to use instead.
+var deprecatedCommands = map[string]string{
+	"BRPOPLPUSH":           "BLMOVE",
+	"GEORADIUS":            "GEOSEARCH and GEOSEARCHSTORE",
+	"GEORADIUS_RO":         "GEOSEARCH",
+	"GEORADIUSBYMEMBER":    "GEOSEARCH and GEOSEARCHSTORE",
+	"GEORADIUSBYMEMBER_RO": "GEOSEARCH",
+	"GETSET":               "SET with the GET argument",
+	"HMSET":                "HSET with multiple field-value pairs",
+	"PSETEX":               "SET with the PX argument",
+	"RPOPLPUSH":            "LMOVE",
+	"SETEX":                "SET with the EX argument",
+	"SETNX":                "SET with the NX argument",
+	"SLAVEOF":              "REPLICAOF",
+	"SUBSTR":               "GETRANGE",
+	"ZRANGEBYLEX":          "ZRANGE with the BYLEX argument",
+	"ZRANGEBYSCORE":        "ZRANGE with the BYSCORE argument",
+	"ZREVRANGE":            "ZRANGE with the REV argument",
+	"ZREVRANGEBYLEX":       "ZRANGE with the REV and BYLEX arguments",
+	"ZREVRANGEBYSCORE":     "ZRANGE with the REV and BYSCORE arguments",
+}
+
+var (
+	commandSpecsOnce sync.Once
+	commandSpecsMap  map[string]commandSpec
+)
+
+// commandSpecs gives all known commands, by lowercase name.
+func commandSpecs() map[string]commandSpec {
+	commandSpecsOnce.Do(func() {
+		commandSpecsMap = parseCommandSpecs(commandsReply)
+		for _, s := range extraCommandSpecs {
+			commandSpecsMap[s.name] = s
+		}
+	})
+	return commandSpecsMap
+}
+
+// parseCommandSpecs reads a COMMAND reply. Panics on invalid input.
+func parseCommandSpecs(raw string) map[string]commandSpec {
+	raw = strings.ReplaceAll(strings.TrimSpace(raw), "\n", "\r\n") + "\r\n"
+	res, err := server.ParseReply(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		panic(err)
+	}
+	specs := map[string]commandSpec{}
+	for _, r := range res.([]interface{}) {
+		fields := r.([]interface{})
+		if len(fields) != 6 {
+			panic("invalid COMMAND entry")
+		}
+		spec := commandSpec{
+			name:     fields[0].(string),
+			arity:    fields[1].(int),
+			firstKey: fields[3].(int),
+			lastKey:  fields[4].(int),
+			keyStep:  fields[5].(int),
+		}
+		for _, f := range fields[2].([]interface{}) {
+			spec.flags = append(spec.flags, string(f.(server.Simple)))
+		}
+		specs[spec.name] = spec
+	}
+	return specs
+}
+
+// hasFlag checks for flags such as "write" or "readonly".
+func (s commandSpec) hasFlag(flag string) bool {
+	for _, f := range s.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// commandKeys returns the keys used by a command. args doesn't include the
+// command itself. Unknown commands have no keys.
+func commandKeys(cmd string, args []string) []string {
+	var keys []string
+	for _, i := range commandKeyPositions(cmd, args) {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// destinationKeys are the commands which write to only one of their keys,
+// with the index of that key in what commandKeys() returns.
+var destinationKeys = map[string]int{
+	"bitop":          0,
+	"blmove":         1,
+	"brpoplpush":     1,
+	"copy":           1,
+	"geosearchstore": 0,
+	"lmove":          1,
+	"pfmerge":        0,
+	"rpoplpush":      1,
+	"sdiffstore":     0,
+	"sinterstore":    0,
+	"smove":          1,
+	"sunionstore":    0,
+	"zdiffstore":     0,
+	"zinterstore":    0,
+	"zrangestore":    0,
+	"zunionstore":    0,
+}
+
+// writtenKeys returns the keys from commandKeys() the command can create.
+func writtenKeys(cmd string, keys []string) []string {
+	i, ok := destinationKeys[strings.ToLower(cmd)]
+	if !ok {
+		return keys
+	}
+	if i >= len(keys) {
+		return nil
+	}
+	return keys[i : i+1]
+}
+
+// commandKeyPositions returns the indexes in args of the keys of a command.
+func commandKeyPositions(cmd string, args []string) []int {
+	cmd = strings.ToLower(cmd)
+	switch cmd {
+	case "eval", "evalsha":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		return numkeysPositions(args, 1)
+	case "zunionstore", "zinterstore":
+		// ZUNIONSTORE destination numkeys key [key ...] ...
+		if len(args) == 0 {
+			return nil
+		}
+		return append([]int{0}, numkeysPositions(args, 1)...)
+	case "zunion", "zintercard":
+		// ZUNION numkeys key [key ...] ...
+		return numkeysPositions(args, 0)
+	case "xread", "xreadgroup":
+		// XREAD [...] STREAMS key [key ...] id [id ...]
+		for i, a := range args {
+			if strings.ToLower(a) == "streams" {
+				return positions(i+1, i+1+(len(args)-i-1)/2)
+			}
+		}
+		return nil
+	}
+
+	spec, ok := commandSpecs()[cmd]
+	if !ok || spec.firstKey <= 0 || spec.keyStep <= 0 {
+		return nil
+	}
+	last := spec.lastKey
+	if last < 0 {
+		last = len(args) + 1 + last
+	}
+	var pos []int
+	for i := spec.firstKey; i <= last && i <= len(args); i += spec.keyStep {
+		pos = append(pos, i-1)
+	}
+	return pos
+}
+
+// key positions for commands where args[pos] is the number of keys, directly
+// followed by the keys.
+func numkeysPositions(args []string, pos int) []int {
+	if len(args) <= pos {
+		return nil
+	}
+	n, err := strconv.Atoi(args[pos])
+	if err != nil || n < 0 {
+		return nil
+	}
+	end := pos + 1 + n
+	if end > len(args) {
+		end = len(args)
+	}
+	return positions(pos+1, end)
+}
+
+// positions gives [from, to).
+func positions(from, to int) []int {
+	var res []int
+	for i := from; i < to; i++ {
+		res = append(res, i)
+	}
+	return res
+}
@@ -0,0 +1,289 @@
+package miniredis
+
+// Loading a redis.conf. See Miniredis.LoadConfigFile().
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadConfigFile applies the settings from a redis.conf file. Only a subset
+// is supported:
+//
+//	requirepass <password>         -- same as RequireAuth()
+//	notify-keyspace-events <flags> -- same as NotifyKeyspaceEvents()
+//	databases <n>                  -- SELECT, SWAPDB, MOVE, and COPY error for DBs >= n
+//	rename-command <cmd> <new>     -- an empty new name ("") disables the command
+//	maxmemory <bytes>              -- validated, but there is no eviction
+//	maxmemory-policy <policy>      -- validated. LRU and LFU policies keep access times, see KeyInfo().
+//	appendonly <yes|no>            -- validated, but nothing is written
+//	timeout <seconds>              -- same as the Idle of SetConnTimeouts()
+//	tcp-keepalive <seconds>        -- same as the KeepAlive of SetConnTimeouts(). 0 is no keepalive.
+//	maxclients <n>                 -- same as SetMaxClients()
+//
+// All other directives are ignored, so a production config can be used as-is.
+// Invalid values give an error with the line number, and then nothing from the
+// file is applied. That includes renames of commands which don't exist, or to
+// names which do, which are checked when the server runs, and otherwise by
+// Start().
+func (m *Miniredis) LoadConfigFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+
+	// renames are the only thing which can fail, so they go first.
+	m.Lock()
+	srv := m.srv
+	m.Unlock()
+	if srv != nil {
+		if err := srv.RenameAll(cfg.renames); err != nil {
+			return fmt.Errorf("%s: rename-command: %w", path, err)
+		}
+	}
+
+	if cfg.requirepass != nil {
+		m.RequireAuth(*cfg.requirepass)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if cfg.notifyFlags != nil {
+		m.notifyFlags = *cfg.notifyFlags
+	}
+	if cfg.databases != 0 {
+		m.databases = cfg.databases
+	}
+	if p := cfg.maxmemoryPolicy; strings.HasSuffix(p, "-lru") || strings.HasSuffix(p, "-lfu") {
+		m.trackAccess = true
+	}
+	if cfg.timeout != nil {
+		m.connTimeouts.Idle = time.Duration(*cfg.timeout) * time.Second
+	}
+	if cfg.keepAlive != nil {
+		m.connTimeouts.KeepAlive = time.Duration(*cfg.keepAlive) * time.Second
+		if *cfg.keepAlive == 0 {
+			m.connTimeouts.KeepAlive = -1
+		}
+	}
+	if m.srv != nil {
+		m.srv.SetConnTimeouts(m.connTimeouts)
+	}
+	if cfg.maxClients != 0 {
+		m.setMaxClients(cfg.maxClients)
+	}
+	m.renames = append(m.renames, cfg.renames...)
+	return nil
+}
+
+type config struct {
+	requirepass     *string
+	notifyFlags     *int
+	databases       int
+	renames         [][2]string // from, to
+	maxmemoryPolicy string      // lower case
+	timeout         *int        // seconds
+	keepAlive       *int        // seconds
+	maxClients      int
+}
+
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		args, err := splitConfigArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", n, err)
+		}
+		if err := cfg.apply(strings.ToLower(args[0]), args[1:]); err != nil {
+			return nil, fmt.Errorf("%d: %s: %w", n, args[0], err)
+		}
+	}
+	return cfg, sc.Err()
+}
+
+var errConfigArgs = errors.New("wrong number of arguments")
+
+func (cfg *config) apply(directive string, args []string) error {
+	switch directive {
+	case "requirepass":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		cfg.requirepass = &args[0]
+	case "notify-keyspace-events":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		f, err := parseNotifyFlags(args[0])
+		if err != nil {
+			return err
+		}
+		cfg.notifyFlags = &f
+	case "databases":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return errors.New("invalid number of databases")
+		}
+		cfg.databases = n
+	case "rename-command":
+		if len(args) != 2 {
+			return errConfigArgs
+		}
+		cfg.renames = append(cfg.renames, [2]string{args[0], args[1]})
+	case "maxmemory":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		if _, err := parseMemory(args[0]); err != nil {
+			return err
+		}
+	case "maxmemory-policy":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		switch p := strings.ToLower(args[0]); p {
+		case "noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+			"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl":
+			cfg.maxmemoryPolicy = p
+		default:
+			return errors.New("argument(s) must be one of the following: " +
+				"volatile-lru, volatile-lfu, volatile-random, volatile-ttl, " +
+				"allkeys-lru, allkeys-lfu, allkeys-random, noeviction")
+		}
+	case "timeout", "tcp-keepalive":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return errors.New("argument must be between 0 and 2147483647 inclusive")
+		}
+		if directive == "timeout" {
+			cfg.timeout = &n
+		} else {
+			cfg.keepAlive = &n
+		}
+	case "maxclients":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return errors.New("argument must be between 1 and 4294967295 inclusive")
+		}
+		cfg.maxClients = n
+	case "appendonly":
+		if len(args) != 1 {
+			return errConfigArgs
+		}
+		if v := strings.ToLower(args[0]); v != "yes" && v != "no" {
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+	}
+	return nil
+}
+
+// parseMemory reads "100", "1k", "1kb", "2mb", &c. as bytes.
+func parseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	v := strings.ToLower(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v, mul = strings.TrimSuffix(v, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory value %q", s)
+	}
+	return n * mul, nil
+}
+
+// splitConfigArgs splits a config line into words. Words can be quoted with
+// "double" (with \ escapes) or 'single' quotes.
+func splitConfigArgs(line string) ([]string, error) {
+	var (
+		args []string
+		cur  strings.Builder
+		in   bool // in a word
+	)
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			if in {
+				args = append(args, cur.String())
+				cur.Reset()
+				in = false
+			}
+		case (ch == '"' || ch == '\'') && !in:
+			quote := ch
+			closed := false
+			for i++; i < len(line); i++ {
+				ch := line[i]
+				if ch == '\\' && quote == '"' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						cur.WriteByte('\n')
+					case 't':
+						cur.WriteByte('\t')
+					default:
+						cur.WriteByte(line[i])
+					}
+					continue
+				}
+				if ch == quote {
+					closed = true
+					break
+				}
+				cur.WriteByte(ch)
+			}
+			if !closed {
+				return nil, errors.New("unbalanced quotes in configuration line")
+			}
+			args = append(args, cur.String())
+			cur.Reset()
+		default:
+			in = true
+			cur.WriteByte(ch)
+		}
+	}
+	if in {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
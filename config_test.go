@@ -0,0 +1,135 @@
+package miniredis
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	s := RunT(t)
+	ok(t, s.LoadConfigFile("testdata/redis.conf"))
+
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c, "PING", proto.Error(msgNoAuth))
+	mustOK(t, c, "AUTH", "s3cr3t pass")
+
+	mustOK(t, c, "SELECT", "3")
+	mustDo(t, c, "SELECT", "4", proto.Error(msgDBIndexOutOfRange))
+	mustDo(t, c, "SWAPDB", "0", "4", proto.Error(msgDBIndexOutOfRange))
+	mustDo(t, c, "MOVE", "foo", "4", proto.Error(msgDBIndexOutOfRange))
+	mustDo(t, c, "COPY", "foo", "bar", "DB", "4", proto.Error(msgDBIndexOutOfRange))
+
+	mustContain(t, c, "FLUSHALL", "unknown command `FLUSHALL`")
+	mustContain(t, c, "KEYS", "*", "unknown command `KEYS`")
+	mustDo(t, c, "SECRETKEYS", "*", proto.Strings())
+
+	equals(t, notifyKeyspace|notifyStream, s.notifyFlags)
+	equals(t, true, s.trackAccess)
+
+	t.Run("restart", func(t *testing.T) {
+		s.Close()
+		ok(t, s.Restart())
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustOK(t, c, "AUTH", "s3cr3t pass")
+		mustContain(t, c, "FLUSHALL", "unknown command `FLUSHALL`")
+		mustDo(t, c, "SECRETKEYS", "*", proto.Strings())
+	})
+
+	t.Run("before start", func(t *testing.T) {
+		m := NewMiniRedis()
+		ok(t, m.LoadConfigFile("testdata/redis.conf"))
+		ok(t, m.Start())
+		defer m.Close()
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustOK(t, c, "AUTH", "s3cr3t pass")
+		mustDo(t, c, "SECRETKEYS", "*", proto.Strings())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := os.Open("testdata/nosuch.conf")
+		mustFail(t, s.LoadConfigFile("testdata/nosuch.conf"), err.Error())
+
+		f, err := ioutil.TempFile("", "redis.conf")
+		ok(t, err)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("requirepass foo\n\ndatabases many\n")
+		ok(t, err)
+		ok(t, f.Close())
+
+		m := NewMiniRedis()
+		mustFail(t, m.LoadConfigFile(f.Name()), f.Name()+":3: databases: invalid number of databases")
+		equals(t, 0, len(m.passwords))
+	})
+
+	t.Run("rename errors", func(t *testing.T) {
+		m := RunT(t)
+		f, err := ioutil.TempFile("", "redis.conf")
+		ok(t, err)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("requirepass foo\nrename-command GET FOO\nrename-command NOSUCH BAR\n")
+		ok(t, err)
+		ok(t, f.Close())
+
+		mustFail(t, m.LoadConfigFile(f.Name()), f.Name()+": rename-command: no such command: NOSUCH")
+		equals(t, 0, len(m.passwords))
+		equals(t, 0, len(m.renames))
+
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustNil(t, c, "GET", "k")
+		mustContain(t, c, "FOO", "unknown command `FOO`")
+
+		ok(t, ioutil.WriteFile(f.Name(), []byte("rename-command GET SET\n"), 0600))
+		mustFail(t, m.LoadConfigFile(f.Name()), f.Name()+": rename-command: command already registered: SET")
+		mustNil(t, c, "GET", "k")
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	for conf, want := range map[string]string{
+		"databases 0":                   "1: databases: invalid number of databases",
+		"databases":                     "1: databases: wrong number of arguments",
+		"requirepass \"foo":             "1: unbalanced quotes in configuration line",
+		"notify-keyspace-events Kq":     "1: notify-keyspace-events: " + errInvalidNotifyFlags.Error(),
+		"maxmemory lots":                "1: maxmemory: invalid memory value \"lots\"",
+		"appendonly maybe":              "1: appendonly: argument must be 'yes' or 'no'",
+		"timeout -1":                    "1: timeout: argument must be between 0 and 2147483647 inclusive",
+		"tcp-keepalive often":           "1: tcp-keepalive: argument must be between 0 and 2147483647 inclusive",
+		"maxmemory-policy newest":       "1: maxmemory-policy: argument(s) must be one of the following: volatile-lru, volatile-lfu, volatile-random, volatile-ttl, allkeys-lru, allkeys-lfu, allkeys-random, noeviction",
+		"maxmemory-policy":              "1: maxmemory-policy: wrong number of arguments",
+		"maxmemory-policy VOLATILE-TTL": "",
+		"rename-command SET":            "1: rename-command: wrong number of arguments",
+		"# comment\nmaxmemory 1gb":      "",
+		"requirepass 'single quoted'":   "",
+		"requirepass \"esc\\\"aped\"":   "",
+		"SomethingElse we don't know 1": "",
+	} {
+		_, err := parseConfig(strings.NewReader(conf))
+		if want == "" {
+			ok(t, err)
+			continue
+		}
+		mustFail(t, err, want)
+	}
+
+	cfg, err := parseConfig(strings.NewReader("requirepass \"esc\\\"aped\"\nrename-command  GET   ''"))
+	ok(t, err)
+	equals(t, `esc"aped`, *cfg.requirepass)
+	equals(t, [][2]string{{"GET", ""}}, cfg.renames)
+
+	n, err := parseMemory("2kb")
+	ok(t, err)
+	equals(t, int64(2048), n)
+}
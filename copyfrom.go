@@ -0,0 +1,214 @@
+package miniredis
+
+// Seeding from another Redis. See Miniredis.CopyFrom().
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+// copiedKey is a key read from the other server.
+type copiedKey struct {
+	key    string
+	t      string
+	ttl    time.Duration // 0 for none
+	values []string      // for hashes and zsets: key/value pairs
+	stream []StreamEntry
+}
+
+// CopyFrom connects to the Redis at addr, which can also be another
+// miniredis, and copies all keys from its DB 0 to the selected DB, with their
+// TTLs. Existing keys are overwritten. Strings, hashes, lists, sets, sorted
+// sets, and stream entries are supported. Stream consumer groups are not
+// copied, and HyperLogLogs become normal strings.
+// The keys are read with SCAN, so on a busy server the result is not a
+// consistent snapshot.
+func (m *Miniredis) CopyFrom(addr string) error {
+	return m.selected().CopyFrom(addr)
+}
+
+// CopyFrom copies all keys from Redis DB 0 at addr. See Miniredis.CopyFrom().
+func (db *RedisDB) CopyFrom(addr string) error {
+	c, err := proto.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var keys []copiedKey
+	cursor := "0"
+	for {
+		res, err := copyDo(c, "SCAN", cursor, "COUNT", "100")
+		if err != nil {
+			return err
+		}
+		page, err := proto.ReadArray(res)
+		if err != nil || len(page) != 2 {
+			return fmt.Errorf("SCAN: unexpected reply %q", res)
+		}
+		if cursor, err = proto.ReadString(page[0]); err != nil {
+			return err
+		}
+		names, err := proto.ReadStrings(page[1])
+		if err != nil {
+			return err
+		}
+		for _, k := range names {
+			ck, err := copyKey(c, k)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+			if ck != nil {
+				keys = append(keys, *ck)
+			}
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	now := db.master.effectiveNow()
+	for _, ck := range keys {
+		db.del(ck.key, true)
+		switch ck.t {
+		case "string":
+			db.stringSet(ck.key, ck.values[0])
+		case "hash":
+			db.hashSet(ck.key, ck.values...)
+		case "list":
+			db.listPush(ck.key, ck.values...)
+		case "set":
+			db.setAdd(ck.key, ck.values...)
+		case "zset":
+			for i := 0; i+1 < len(ck.values); i += 2 {
+				score, err := strconv.ParseFloat(ck.values[i+1], 64)
+				if err != nil {
+					return fmt.Errorf("key %q: %w", ck.key, err)
+				}
+				db.ssetAdd(ck.key, score, ck.values[i])
+			}
+		case "stream":
+			s, _ := db.newStream(ck.key)
+			for _, e := range ck.stream {
+				if _, err := s.add(e.ID, e.Values, now); err != nil {
+					return fmt.Errorf("key %q: %w", ck.key, err)
+				}
+			}
+		}
+		if ck.ttl > 0 {
+			db.ttl.set(ck.key, ck.ttl)
+		}
+	}
+	return nil
+}
+
+// copyKey reads a single key. Returns nil if the key is gone.
+func copyKey(c *proto.Client, k string) (*copiedKey, error) {
+	res, err := copyDo(c, "TYPE", k)
+	if err != nil {
+		return nil, err
+	}
+	t, err := proto.Parse(res)
+	if err != nil {
+		return nil, err
+	}
+	ck := &copiedKey{key: k, t: fmt.Sprint(t)}
+
+	var cmd []string
+	switch ck.t {
+	case "none":
+		return nil, nil
+	case "string":
+		cmd = []string{"GET", k}
+	case "hash":
+		cmd = []string{"HGETALL", k}
+	case "list":
+		cmd = []string{"LRANGE", k, "0", "-1"}
+	case "set":
+		cmd = []string{"SMEMBERS", k}
+	case "zset":
+		cmd = []string{"ZRANGE", k, "0", "-1", "WITHSCORES"}
+	case "stream":
+		cmd = []string{"XRANGE", k, "-", "+"}
+	default:
+		return nil, fmt.Errorf("unsupported type %q", ck.t)
+	}
+	res, err = copyDo(c, cmd...)
+	if err != nil {
+		return nil, err
+	}
+	switch ck.t {
+	case "string":
+		v, err := proto.ReadString(res)
+		if err != nil {
+			return nil, err
+		}
+		ck.values = []string{v}
+	case "stream":
+		if ck.stream, err = readStreamEntries(res); err != nil {
+			return nil, err
+		}
+	default:
+		if ck.values, err = proto.ReadStrings(res); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err = copyDo(c, "PTTL", k)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := proto.Parse(res)
+	if err != nil {
+		return nil, err
+	}
+	if ms, ok := ttl.(int); ok && ms > 0 {
+		ck.ttl = time.Duration(ms) * time.Millisecond
+	}
+	return ck, nil
+}
+
+// copyDo is Do(), with error replies as errors.
+func copyDo(c *proto.Client, cmd ...string) (string, error) {
+	res, err := c.Do(cmd...)
+	if err != nil {
+		return "", err
+	}
+	if msg, err := proto.ReadError(res); err == nil {
+		return "", errors.New(msg)
+	}
+	return res, nil
+}
+
+// readStreamEntries parses an XRANGE reply.
+func readStreamEntries(res string) ([]StreamEntry, error) {
+	elems, err := proto.ReadArray(res)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StreamEntry
+	for _, e := range elems {
+		parts, err := proto.ReadArray(e)
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("XRANGE: unexpected reply %q", e)
+		}
+		id, err := proto.ReadString(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		values, err := proto.ReadStrings(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, StreamEntry{ID: id, Values: values})
+	}
+	return entries, nil
+}
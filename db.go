@@ -3,6 +3,7 @@ package miniredis
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sort"
 	"strconv"
@@ -18,6 +19,26 @@ func (db *RedisDB) exists(k string) bool {
 	return ok
 }
 
+// wrongType is true if the key exists, and is not of type t. Commands should
+// give a WRONGTYPE error for those. No locks!
+func (db *RedisDB) wrongType(k, t string) bool {
+	kt, ok := db.keys[k]
+	return ok && kt != t
+}
+
+// bump marks a key as changed, for WATCH and KeyVersion(). All changes to a
+// key in a single command count as one. No locks!
+func (db *RedisDB) bump(k string) {
+	db.master.writes++
+	db.wrote(k)
+	db.master.invalidate(k)
+	if op, ok := db.versionOp[k]; ok && op == db.master.op {
+		return
+	}
+	db.versionOp[k] = db.master.op
+	db.keyVersion[k]++
+}
+
 // t gives the type of a key, or ""
 func (db *RedisDB) t(k string) string {
 	return db.keys[k]
@@ -33,17 +54,40 @@ func (db *RedisDB) allKeys() []string {
 	return res
 }
 
+// stats for INFO keyspace.
+func (db *RedisDB) stats() DBStats {
+	st := DBStats{Keys: len(db.keys)}
+	var total time.Duration
+	db.ttl.each(func(k string, ttl time.Duration) {
+		if !db.exists(k) {
+			return
+		}
+		st.Expires++
+		total += ttl
+	})
+	if st.Expires > 0 {
+		st.AvgTTL = total / time.Duration(st.Expires)
+	}
+	return st
+}
+
 // flush removes all keys and values.
 func (db *RedisDB) flush() {
+	for k := range db.keys {
+		db.beforeAll(k)
+		db.bump(k)
+	}
+	db.master.invalidateFlush()
 	db.keys = map[string]string{}
-	db.stringKeys = map[string]string{}
+	db.stringKeys = map[string]*rope{}
 	db.hashKeys = map[string]hashKey{}
 	db.listKeys = map[string]listKey{}
 	db.setKeys = map[string]setKey{}
 	db.hllKeys = map[string]*hll{}
 	db.sortedsetKeys = map[string]sortedSet{}
-	db.ttl = map[string]time.Duration{}
+	db.ttl = newExpireSet()
 	db.streamKeys = map[string]*streamKey{}
+	db.lastAccess = map[string]time.Time{}
 }
 
 // move something to another db. Will return ok. Or not.
@@ -56,6 +100,7 @@ func (db *RedisDB) move(key string, to *RedisDB) bool {
 	if !ok {
 		return false
 	}
+	to.beforeAll(key)
 	to.keys[key] = db.keys[key]
 	switch t {
 	case "string":
@@ -75,16 +120,23 @@ func (db *RedisDB) move(key string, to *RedisDB) bool {
 	default:
 		panic("unhandled key type")
 	}
-	to.keyVersion[key]++
-	if v, ok := db.ttl[key]; ok {
-		to.ttl[key] = v
+	to.bump(key)
+	if v, ok := db.ttl.get(key); ok {
+		to.ttl.set(key, v)
+	}
+	if v, ok := db.lastAccess[key]; ok {
+		to.lastAccess[key] = v
 	}
 	db.del(key, true)
 	return true
 }
 
 func (db *RedisDB) rename(from, to string) {
+	if from == to {
+		return
+	}
 	db.del(to, true)
+	db.beforeAll(to)
 	switch db.t(from) {
 	case "string":
 		db.stringKeys[to] = db.stringKeys[from]
@@ -104,9 +156,12 @@ func (db *RedisDB) rename(from, to string) {
 		panic("missing case")
 	}
 	db.keys[to] = db.keys[from]
-	db.keyVersion[to]++
-	if v, ok := db.ttl[from]; ok {
-		db.ttl[to] = v
+	db.bump(to)
+	if v, ok := db.ttl.get(from); ok {
+		db.ttl.set(to, v)
+	}
+	if v, ok := db.lastAccess[from]; ok {
+		db.lastAccess[to] = v
 	}
 
 	db.del(from, true)
@@ -116,11 +171,13 @@ func (db *RedisDB) del(k string, delTTL bool) {
 	if !db.exists(k) {
 		return
 	}
+	db.beforeAll(k)
 	t := db.t(k)
 	delete(db.keys, k)
-	db.keyVersion[k]++
+	db.bump(k)
 	if delTTL {
-		delete(db.ttl, k)
+		db.ttl.del(k)
+		delete(db.lastAccess, k)
 	}
 	switch t {
 	case "string":
@@ -142,20 +199,60 @@ func (db *RedisDB) del(k string, delTTL bool) {
 	}
 }
 
+// replace deletes the key, and makes it again with set, with the same TTL. If
+// set doesn't make the key the TTL is gone as well. No locks!
+func (db *RedisDB) replace(k string, set func()) {
+	db.del(k, false)
+	set()
+	if !db.exists(k) {
+		db.ttl.del(k)
+		delete(db.lastAccess, k)
+	}
+}
+
 // stringGet returns the string key or "" on error/nonexists.
 func (db *RedisDB) stringGet(k string) string {
 	if t, ok := db.keys[k]; !ok || t != "string" {
 		return ""
 	}
-	return db.stringKeys[k]
+	return db.stringKeys[k].String()
 }
 
 // stringSet force set()s a key. Does not touch expire.
 func (db *RedisDB) stringSet(k, v string) {
 	db.del(k, false)
 	db.keys[k] = "string"
-	db.stringKeys[k] = v
-	db.keyVersion[k]++
+	db.stringKeys[k] = newRope(v)
+	db.bump(k)
+}
+
+// stringAppend appends to a string key, which is created if needed, and
+// returns the new length. Does not touch expire.
+func (db *RedisDB) stringAppend(k, v string) int {
+	return db.stringSetRange(k, db.stringLen(k), v)
+}
+
+// stringSetRange overwrites a string key at pos, padded with zero bytes if
+// needed, and returns the new length. The key is created if needed. Does not
+// touch expire.
+func (db *RedisDB) stringSetRange(k string, pos int, v string) int {
+	r, ok := db.stringKeys[k]
+	if !ok {
+		r = &rope{}
+		db.keys[k] = "string"
+		db.stringKeys[k] = r
+	}
+	r.SetRange(pos, v)
+	db.bump(k)
+	return r.Len()
+}
+
+// stringLen returns the length of a string key or 0 on error/nonexists.
+func (db *RedisDB) stringLen(k string) int {
+	if t, ok := db.keys[k]; !ok || t != "string" {
+		return 0
+	}
+	return db.stringKeys[k].Len()
 }
 
 // change int key value
@@ -163,7 +260,7 @@ func (db *RedisDB) stringIncr(k string, delta int) (int, error) {
 	v := 0
 	if sv, ok := db.stringKeys[k]; ok {
 		var err error
-		v, err = strconv.Atoi(sv)
+		v, err = strconv.Atoi(sv.String())
 		if err != nil {
 			return 0, ErrIntValueError
 		}
@@ -176,14 +273,17 @@ func (db *RedisDB) stringIncr(k string, delta int) (int, error) {
 // change float key value
 func (db *RedisDB) stringIncrfloat(k string, delta *big.Float) (*big.Float, error) {
 	v := big.NewFloat(0.0)
-	v.SetPrec(128)
+	v.SetPrec(floatPrec)
 	if sv, ok := db.stringKeys[k]; ok {
 		var err error
-		v, _, err = big.ParseFloat(sv, 10, 128, 0)
+		v, _, err = big.ParseFloat(sv.String(), 10, floatPrec, 0)
 		if err != nil {
 			return nil, ErrFloatValueError
 		}
 	}
+	if v.IsInf() || delta.IsInf() {
+		return nil, errors.New(msgIncrNaNInf)
+	}
 	v.Add(v, delta)
 	db.stringSet(k, formatBig(v))
 	return v, nil
@@ -197,7 +297,7 @@ func (db *RedisDB) listLpush(k, v string) int {
 	}
 	l = append([]string{v}, l...)
 	db.listKeys[k] = l
-	db.keyVersion[k]++
+	db.bump(k)
 	return len(l)
 }
 
@@ -211,7 +311,7 @@ func (db *RedisDB) listLpop(k string) string {
 	} else {
 		db.listKeys[k] = l
 	}
-	db.keyVersion[k]++
+	db.bump(k)
 	return el
 }
 
@@ -222,7 +322,7 @@ func (db *RedisDB) listPush(k string, v ...string) int {
 	}
 	l = append(l, v...)
 	db.listKeys[k] = l
-	db.keyVersion[k]++
+	db.bump(k)
 	return len(l)
 }
 
@@ -234,23 +334,34 @@ func (db *RedisDB) listPop(k string) string {
 		db.del(k, true)
 	} else {
 		db.listKeys[k] = l
-		db.keyVersion[k]++
+		db.bump(k)
 	}
 	return el
 }
 
 // setset replaces a whole set.
 func (db *RedisDB) setSet(k string, set setKey) {
+	db.beforeAll(k)
 	db.keys[k] = "set"
 	db.setKeys[k] = set
-	db.keyVersion[k]++
+	db.bump(k)
+}
+
+// setStore saves the result of a *STORE command. The key is replaced, without
+// TTL, or deleted if the set is empty.
+func (db *RedisDB) setStore(k string, set setKey) {
+	db.del(k, true)
+	if len(set) > 0 {
+		db.setSet(k, set)
+	}
 }
 
 // setadd adds members to a set. Returns nr of new keys.
 func (db *RedisDB) setAdd(k string, elems ...string) int {
+	db.before(k, elems...)
 	s, ok := db.setKeys[k]
 	if !ok {
-		s = setKey{}
+		s = make(setKey, len(elems))
 		db.keys[k] = "set"
 	}
 	added := 0
@@ -261,7 +372,7 @@ func (db *RedisDB) setAdd(k string, elems ...string) int {
 		s[e] = struct{}{}
 	}
 	db.setKeys[k] = s
-	db.keyVersion[k]++
+	db.bump(k)
 	return added
 }
 
@@ -271,6 +382,7 @@ func (db *RedisDB) setRem(k string, fields ...string) int {
 	if !ok {
 		return 0
 	}
+	db.before(k, fields...)
 	removed := 0
 	for _, f := range fields {
 		if _, ok := s[f]; ok {
@@ -283,7 +395,7 @@ func (db *RedisDB) setRem(k string, fields ...string) int {
 	} else {
 		db.setKeys[k] = s
 	}
-	db.keyVersion[k]++
+	db.bump(k)
 	return removed
 }
 
@@ -337,7 +449,7 @@ func (db *RedisDB) hashGet(key, field string) string {
 
 // hashSet returns the number of new keys
 func (db *RedisDB) hashSet(k string, fv ...string) int {
-	if t, ok := db.keys[k]; ok && t != "hash" {
+	if db.wrongType(k, "hash") {
 		db.del(k, true)
 	}
 	db.keys[k] = "hash"
@@ -347,9 +459,10 @@ func (db *RedisDB) hashSet(k string, fv ...string) int {
 	new := 0
 	for idx := 0; idx < len(fv)-1; idx = idx + 2 {
 		f, v := fv[idx], fv[idx+1]
+		db.before(k, f)
 		_, ok := db.hashKeys[k][f]
 		db.hashKeys[k][f] = v
-		db.keyVersion[k]++
+		db.bump(k)
 		if !ok {
 			new++
 		}
@@ -377,16 +490,19 @@ func (db *RedisDB) hashIncr(key, field string, delta int) (int, error) {
 // hashIncrfloat changes float key value
 func (db *RedisDB) hashIncrfloat(key, field string, delta *big.Float) (*big.Float, error) {
 	v := big.NewFloat(0.0)
-	v.SetPrec(128)
+	v.SetPrec(floatPrec)
 	if h, ok := db.hashKeys[key]; ok {
 		if f, ok := h[field]; ok {
 			var err error
-			v, _, err = big.ParseFloat(f, 10, 128, 0)
+			v, _, err = big.ParseFloat(f, 10, floatPrec, 0)
 			if err != nil {
-				return nil, ErrFloatValueError
+				return nil, errors.New(msgHashNotFloat)
 			}
 		}
 	}
+	if v.IsInf() || delta.IsInf() {
+		return nil, errors.New(msgIncrNaNInf)
+	}
 	v.Add(v, delta)
 	db.hashSet(key, field, formatBig(v))
 	return v, nil
@@ -400,13 +516,24 @@ func (db *RedisDB) sortedSet(key string) map[string]float64 {
 
 // ssetSet sets a complete sorted set.
 func (db *RedisDB) ssetSet(key string, sset sortedSet) {
+	db.beforeAll(key)
 	db.keys[key] = "zset"
-	db.keyVersion[key]++
+	db.bump(key)
 	db.sortedsetKeys[key] = sset
 }
 
+// ssetStore saves the result of a *STORE command. The key is replaced,
+// without TTL, or deleted if the sorted set is empty.
+func (db *RedisDB) ssetStore(key string, sset sortedSet) {
+	db.del(key, true)
+	if len(sset) > 0 {
+		db.ssetSet(key, sset)
+	}
+}
+
 // ssetAdd adds member to a sorted set. Returns whether this was a new member.
 func (db *RedisDB) ssetAdd(key string, score float64, member string) bool {
+	db.before(key, member)
 	ss, ok := db.sortedsetKeys[key]
 	if !ok {
 		ss = newSortedSet()
@@ -415,10 +542,34 @@ func (db *RedisDB) ssetAdd(key string, score float64, member string) bool {
 	_, ok = ss[member]
 	ss[member] = score
 	db.sortedsetKeys[key] = ss
-	db.keyVersion[key]++
+	db.bump(key)
 	return !ok
 }
 
+// ssetAddOpt is ssetAdd with the flags of ZADD. Returns the score of the
+// member afterwards, and whether the flags skipped it. Only INCR can error.
+func (db *RedisDB) ssetAddOpt(key string, opts ZAddOptions, score float64, member string) (float64, bool, error) {
+	exists := db.ssetExists(key, member)
+	old := db.ssetScore(key, member)
+	if opts.INCR && exists {
+		// NaN is an error, but only if NX doesn't skip it
+		if opts.NX {
+			return old, true, nil
+		}
+		score += old
+		if math.IsNaN(score) {
+			return 0, false, errors.New(msgScoreNaN)
+		}
+	}
+	// GT and LT only apply to existing members.
+	if opts.NX && exists || opts.XX && !exists ||
+		exists && (opts.GT && score <= old || opts.LT && score >= old) {
+		return old, true, nil
+	}
+	db.ssetAdd(key, score, member)
+	return score, false, nil
+}
+
 // All members from a sorted set, ordered by score.
 func (db *RedisDB) ssetMembers(key string) []string {
 	ss, ok := db.sortedsetKeys[key]
@@ -472,12 +623,17 @@ func (db *RedisDB) ssetScore(key, member string) float64 {
 func (db *RedisDB) ssetRem(key, member string) bool {
 	ss := db.sortedsetKeys[key]
 	_, ok := ss[member]
+	if !ok {
+		return false
+	}
+	db.before(key, member)
 	delete(ss, member)
 	if len(ss) == 0 {
 		// Delete key on removal of last member
 		db.del(key, true)
 	}
-	return ok
+	db.bump(key)
+	return true
 }
 
 // ssetExists tells if a member exists in a sorted set.
@@ -487,8 +643,9 @@ func (db *RedisDB) ssetExists(key, member string) bool {
 	return ok
 }
 
-// ssetIncrby changes float sorted set score.
-func (db *RedisDB) ssetIncrby(k, m string, delta float64) float64 {
+// ssetIncrby changes float sorted set score. It errors if the new score would
+// be NaN, as with "inf" + "-inf".
+func (db *RedisDB) ssetIncrby(k, m string, delta float64) (float64, error) {
 	ss, ok := db.sortedsetKeys[k]
 	if !ok {
 		ss = newSortedSet()
@@ -498,16 +655,82 @@ func (db *RedisDB) ssetIncrby(k, m string, delta float64) float64 {
 
 	v, _ := ss.get(m)
 	v += delta
+	if math.IsNaN(v) {
+		return 0, errors.New(msgScoreNaN)
+	}
+	db.before(k, m)
 	ss.set(v, m)
-	db.keyVersion[k]++
-	return v
+	db.bump(k)
+	return v, nil
+}
+
+// ssetInterCard implements the logic behind ZINTERCARD. Keys can be sets or
+// sorted sets. It walks the smallest one, and stops once it found limit
+// members. A limit of 0 means no limit.
+func (db *RedisDB) ssetInterCard(keys []string, limit int) (int, error) {
+	// all keys must either not exist, or be of type "set" or "zset".
+	for _, key := range keys {
+		if db.exists(key) && db.t(key) != "set" && db.t(key) != "zset" {
+			return 0, ErrWrongType
+		}
+	}
+
+	card := func(k string) int {
+		if db.t(k) == "set" {
+			return len(db.setKeys[k])
+		}
+		return len(db.sortedsetKeys[k])
+	}
+	has := func(k, member string) bool {
+		if db.t(k) == "set" {
+			_, ok := db.setKeys[k][member]
+			return ok
+		}
+		_, ok := db.sortedsetKeys[k][member]
+		return ok
+	}
+
+	smallest := keys[0]
+	for _, key := range keys {
+		if !db.exists(key) {
+			return 0, nil
+		}
+		if card(key) < card(smallest) {
+			smallest = key
+		}
+	}
+	// count counts member if it's in every key, and says whether we're done.
+	n := 0
+	count := func(member string) bool {
+		for _, key := range keys {
+			if key != smallest && !has(key, member) {
+				return false
+			}
+		}
+		n++
+		return n == limit
+	}
+	if db.t(smallest) == "set" {
+		for m := range db.setKeys[smallest] {
+			if count(m) {
+				break
+			}
+		}
+	} else {
+		for m := range db.sortedsetKeys[smallest] {
+			if count(m) {
+				break
+			}
+		}
+	}
+	return n, nil
 }
 
 // setDiff implements the logic behind SDIFF*
 func (db *RedisDB) setDiff(keys []string) (setKey, error) {
 	key := keys[0]
 	keys = keys[1:]
-	if db.exists(key) && db.t(key) != "set" {
+	if db.wrongType(key, "set") {
 		return nil, ErrWrongType
 	}
 	s := setKey{}
@@ -533,7 +756,7 @@ func (db *RedisDB) setDiff(keys []string) (setKey, error) {
 func (db *RedisDB) setInter(keys []string) (setKey, error) {
 	// all keys must either not exist, or be of type "set".
 	for _, key := range keys {
-		if db.exists(key) && db.t(key) != "set" {
+		if db.wrongType(key, "set") {
 			return nil, ErrWrongType
 		}
 	}
@@ -572,7 +795,7 @@ func (db *RedisDB) setInter(keys []string) (setKey, error) {
 func (db *RedisDB) setUnion(keys []string) (setKey, error) {
 	key := keys[0]
 	keys = keys[1:]
-	if db.exists(key) && db.t(key) != "set" {
+	if db.wrongType(key, "set") {
 		return nil, ErrWrongType
 	}
 	s := setKey{}
@@ -603,13 +826,13 @@ func (db *RedisDB) newStream(key string) (*streamKey, error) {
 	db.keys[key] = "stream"
 	s := newStreamKey()
 	db.streamKeys[key] = s
-	db.keyVersion[key]++
+	db.bump(key)
 	return s, nil
 }
 
 // return existing stream, or nil.
 func (db *RedisDB) stream(key string) (*streamKey, error) {
-	if db.exists(key) && db.t(key) != "stream" {
+	if db.wrongType(key, "stream") {
 		return nil, ErrWrongType
 	}
 
@@ -625,18 +848,71 @@ func (db *RedisDB) streamGroup(key, group string) (*streamGroup, error) {
 	return s.groups[group], nil
 }
 
-// fastForward proceeds the current timestamp with duration, works as a time machine
-func (db *RedisDB) fastForward(duration time.Duration) {
-	for _, key := range db.allKeys() {
-		if value, ok := db.ttl[key]; ok {
-			db.ttl[key] = value - duration
-			db.checkTTL(key)
+// fastForward proceeds the current timestamp with duration, works as a time
+// machine. Returns the expired keys, sorted, which also get an "expired"
+// keyspace event.
+func (db *RedisDB) fastForward(duration time.Duration) []string {
+	db.ttl.advance(duration)
+	if db.master.lazyExpire {
+		// see SetActiveExpire()
+		return nil
+	}
+	var expired []string
+	for {
+		key, ttl, ok := db.ttl.next()
+		if !ok || ttl > 0 {
+			break
+		}
+		db.ttl.del(key)
+		if db.exists(key) {
+			expired = append(expired, key)
+		}
+	}
+	sort.Strings(expired)
+	for _, key := range expired {
+		db.del(key, true)
+		db.master.notify(db.id, notifyExpired, "expired", key)
+	}
+	return expired
+}
+
+// expired is true if the key has a TTL <= 0, which can happen with
+// SetActiveExpire(false). No locks!
+func (db *RedisDB) expired(k string) bool {
+	ttl, ok := db.ttl.get(k)
+	return ok && ttl <= 0
+}
+
+// lazyExpire removes keys which expired while active expiry was off, see
+// SetActiveExpire(). Same as redis, that happens when a command uses such a
+// key. No locks!
+func (db *RedisDB) lazyExpire(keys []string) {
+	for _, k := range keys {
+		if db.expired(k) {
+			db.del(k, true)
+			db.master.notify(db.id, notifyExpired, "expired", k)
 		}
 	}
 }
 
+// visibleKeys is tenantKeys() without the keys which are expired, but not
+// removed yet. No locks!
+func (db *RedisDB) visibleKeys(prefix string) []string {
+	keys := db.tenantKeys(prefix)
+	if !db.master.lazyExpire {
+		return keys
+	}
+	res := keys[:0]
+	for _, k := range keys {
+		if !db.expired(prefix + k) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
 func (db *RedisDB) checkTTL(key string) {
-	if v, ok := db.ttl[key]; ok && v <= 0 {
+	if v, ok := db.ttl.get(key); ok && v <= 0 {
 		db.del(key, true)
 	}
 }
@@ -655,7 +931,7 @@ func (db *RedisDB) hllAdd(k string, elems ...string) int {
 		}
 	}
 	db.hllKeys[k] = s
-	db.keyVersion[k]++
+	db.bump(k)
 	return hllAltered
 }
 
@@ -663,7 +939,7 @@ func (db *RedisDB) hllAdd(k string, elems ...string) int {
 func (db *RedisDB) hllCount(keys []string) (int, error) {
 	countOverall := 0
 	for _, key := range keys {
-		if db.exists(key) && db.t(key) != "hll" {
+		if db.wrongType(key, "hll") {
 			return 0, ErrNotValidHllValue
 		}
 		if !db.exists(key) {
@@ -678,7 +954,7 @@ func (db *RedisDB) hllCount(keys []string) (int, error) {
 // hllMerge merges all the hlls provided as keys to the first key. Creates a new hll in the first key if it contains nothing
 func (db *RedisDB) hllMerge(keys []string) error {
 	for _, key := range keys {
-		if db.exists(key) && db.t(key) != "hll" {
+		if db.wrongType(key, "hll") {
 			return ErrNotValidHllValue
 		}
 	}
@@ -702,7 +978,7 @@ func (db *RedisDB) hllMerge(keys []string) error {
 
 	db.hllKeys[destKey] = destHll
 	db.keys[destKey] = "hll"
-	db.keyVersion[destKey]++
+	db.bump(destKey)
 
 	return nil
 }
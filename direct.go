@@ -4,6 +4,7 @@ package miniredis
 
 import (
 	"errors"
+	"math"
 	"math/big"
 	"time"
 )
@@ -23,6 +24,12 @@ var (
 
 	// ErrFloatValueError can returned by INCRBYFLOAT
 	ErrFloatValueError = errors.New(msgInvalidFloat)
+
+	// ErrGroupNotFound is returned when a stream consumer group doesn't exist.
+	ErrGroupNotFound = errors.New("NOGROUP No such consumer group")
+
+	// ErrConsumerNotFound is returned when a stream consumer doesn't exist.
+	ErrConsumerNotFound = errors.New("ERR no such consumer")
 )
 
 // Select sets the DB id for all direct commands.
@@ -34,7 +41,7 @@ func (m *Miniredis) Select(i int) {
 
 // Keys returns all keys from the selected database, sorted.
 func (m *Miniredis) Keys() []string {
-	return m.DB(m.selectedDB).Keys()
+	return m.selected().Keys()
 }
 
 // Keys returns all keys, sorted.
@@ -45,6 +52,26 @@ func (db *RedisDB) Keys() []string {
 	return db.allKeys()
 }
 
+// DBStats are the per DB numbers from INFO keyspace.
+type DBStats struct {
+	Keys    int
+	Expires int           // keys with a TTL
+	AvgTTL  time.Duration // of the keys with a TTL
+}
+
+// DBStats gives the key statistics of a DB, as INFO keyspace reports them.
+func (m *Miniredis) DBStats(i int) DBStats {
+	return m.DB(i).Stats()
+}
+
+// Stats gives the key statistics, as INFO keyspace reports them.
+func (db *RedisDB) Stats() DBStats {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	return db.stats()
+}
+
 // FlushAll removes all keys from all databases.
 func (m *Miniredis) FlushAll() {
 	m.Lock()
@@ -62,7 +89,7 @@ func (m *Miniredis) flushAll() {
 
 // FlushDB removes all keys from the selected database.
 func (m *Miniredis) FlushDB() {
-	m.DB(m.selectedDB).FlushDB()
+	m.selected().FlushDB()
 }
 
 // FlushDB removes all keys.
@@ -76,7 +103,7 @@ func (db *RedisDB) FlushDB() {
 
 // Get returns string keys added with SET.
 func (m *Miniredis) Get(k string) (string, error) {
-	return m.DB(m.selectedDB).Get(k)
+	return m.selected().Get(k)
 }
 
 // Get returns a string key.
@@ -95,7 +122,7 @@ func (db *RedisDB) Get(k string) (string, error) {
 
 // Set sets a string key. Removes expire.
 func (m *Miniredis) Set(k, v string) error {
-	return m.DB(m.selectedDB).Set(k, v)
+	return m.selected().Set(k, v)
 }
 
 // Set sets a string key. Removes expire.
@@ -105,7 +132,7 @@ func (db *RedisDB) Set(k, v string) error {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "string" {
+	if db.wrongType(k, "string") {
 		return ErrWrongType
 	}
 	db.del(k, true) // Remove expire
@@ -115,7 +142,7 @@ func (db *RedisDB) Set(k, v string) error {
 
 // Incr changes a int string value by delta.
 func (m *Miniredis) Incr(k string, delta int) (int, error) {
-	return m.DB(m.selectedDB).Incr(k, delta)
+	return m.selected().Incr(k, delta)
 }
 
 // Incr changes a int string value by delta.
@@ -124,7 +151,7 @@ func (db *RedisDB) Incr(k string, delta int) (int, error) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "string" {
+	if db.wrongType(k, "string") {
 		return 0, ErrWrongType
 	}
 
@@ -139,7 +166,7 @@ func (m *Miniredis) IncrByFloat(k string, delta float64) (float64, error) {
 
 // Incrfloat changes a float string value by delta.
 func (m *Miniredis) Incrfloat(k string, delta float64) (float64, error) {
-	return m.DB(m.selectedDB).Incrfloat(k, delta)
+	return m.selected().Incrfloat(k, delta)
 }
 
 // Incrfloat changes a float string value by delta.
@@ -148,7 +175,7 @@ func (db *RedisDB) Incrfloat(k string, delta float64) (float64, error) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "string" {
+	if db.wrongType(k, "string") {
 		return 0, ErrWrongType
 	}
 
@@ -164,7 +191,7 @@ func (db *RedisDB) Incrfloat(k string, delta float64) (float64, error) {
 // This is the same as the Redis command `LRANGE 0 -1`, but you can do your own
 // range-ing.
 func (m *Miniredis) List(k string) ([]string, error) {
-	return m.DB(m.selectedDB).List(k)
+	return m.selected().List(k)
 }
 
 // List returns the list k, or an error if it's not there or something else.
@@ -185,7 +212,7 @@ func (db *RedisDB) List(k string) ([]string, error) {
 
 // Lpush prepends one value to a list. Returns the new length.
 func (m *Miniredis) Lpush(k, v string) (int, error) {
-	return m.DB(m.selectedDB).Lpush(k, v)
+	return m.selected().Lpush(k, v)
 }
 
 // Lpush prepends one value to a list. Returns the new length.
@@ -194,7 +221,7 @@ func (db *RedisDB) Lpush(k, v string) (int, error) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "list" {
+	if db.wrongType(k, "list") {
 		return 0, ErrWrongType
 	}
 	return db.listLpush(k, v), nil
@@ -202,7 +229,7 @@ func (db *RedisDB) Lpush(k, v string) (int, error) {
 
 // Lpop removes and returns the last element in a list.
 func (m *Miniredis) Lpop(k string) (string, error) {
-	return m.DB(m.selectedDB).Lpop(k)
+	return m.selected().Lpop(k)
 }
 
 // Lpop removes and returns the last element in a list.
@@ -228,7 +255,7 @@ func (m *Miniredis) RPush(k string, v ...string) (int, error) {
 
 // Push add element at the end. Returns the new length.
 func (m *Miniredis) Push(k string, v ...string) (int, error) {
-	return m.DB(m.selectedDB).Push(k, v...)
+	return m.selected().Push(k, v...)
 }
 
 // Push add element at the end. Is called RPUSH in redis. Returns the new length.
@@ -237,7 +264,7 @@ func (db *RedisDB) Push(k string, v ...string) (int, error) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "list" {
+	if db.wrongType(k, "list") {
 		return 0, ErrWrongType
 	}
 	return db.listPush(k, v...), nil
@@ -250,7 +277,7 @@ func (m *Miniredis) RPop(k string) (string, error) {
 
 // Pop removes and returns the last element. Is called RPOP in Redis.
 func (m *Miniredis) Pop(k string) (string, error) {
-	return m.DB(m.selectedDB).Pop(k)
+	return m.selected().Pop(k)
 }
 
 // Pop removes and returns the last element. Is called RPOP in Redis.
@@ -277,7 +304,7 @@ func (m *Miniredis) SAdd(k string, elems ...string) (int, error) {
 
 // SetAdd adds keys to a set. Returns the number of new keys.
 func (m *Miniredis) SetAdd(k string, elems ...string) (int, error) {
-	return m.DB(m.selectedDB).SetAdd(k, elems...)
+	return m.selected().SetAdd(k, elems...)
 }
 
 // SetAdd adds keys to a set. Returns the number of new keys.
@@ -286,7 +313,7 @@ func (db *RedisDB) SetAdd(k string, elems ...string) (int, error) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "set" {
+	if db.wrongType(k, "set") {
 		return 0, ErrWrongType
 	}
 	return db.setAdd(k, elems...), nil
@@ -300,7 +327,7 @@ func (m *Miniredis) SMembers(k string) ([]string, error) {
 
 // Members returns all keys in a set, sorted.
 func (m *Miniredis) Members(k string) ([]string, error) {
-	return m.DB(m.selectedDB).Members(k)
+	return m.selected().Members(k)
 }
 
 // Members gives all set keys. Sorted.
@@ -325,7 +352,7 @@ func (m *Miniredis) SIsMember(k, v string) (bool, error) {
 
 // IsMember tells if value is in the set.
 func (m *Miniredis) IsMember(k, v string) (bool, error) {
-	return m.DB(m.selectedDB).IsMember(k, v)
+	return m.selected().IsMember(k, v)
 }
 
 // IsMember tells if value is in the set.
@@ -344,7 +371,7 @@ func (db *RedisDB) IsMember(k, v string) (bool, error) {
 
 // HKeys returns all (sorted) keys ('fields') for a hash key.
 func (m *Miniredis) HKeys(k string) ([]string, error) {
-	return m.DB(m.selectedDB).HKeys(k)
+	return m.selected().HKeys(k)
 }
 
 // HKeys returns all (sorted) keys ('fields') for a hash key.
@@ -363,7 +390,7 @@ func (db *RedisDB) HKeys(key string) ([]string, error) {
 
 // Del deletes a key and any expiration value. Returns whether there was a key.
 func (m *Miniredis) Del(k string) bool {
-	return m.DB(m.selectedDB).Del(k)
+	return m.selected().Del(k)
 }
 
 // Del deletes a key and any expiration value. Returns whether there was a key.
@@ -396,7 +423,7 @@ func (db *RedisDB) Unlink(k string) bool {
 // Note: this direct function returns 0 if there is no TTL set, unlike redis,
 // which returns -1.
 func (m *Miniredis) TTL(k string) time.Duration {
-	return m.DB(m.selectedDB).TTL(k)
+	return m.selected().TTL(k)
 }
 
 // TTL is the left over time to live. As set via EXPIRE, PEXPIRE, EXPIREAT,
@@ -406,12 +433,13 @@ func (db *RedisDB) TTL(k string) time.Duration {
 	db.master.Lock()
 	defer db.master.Unlock()
 
-	return db.ttl[k]
+	ttl, _ := db.ttl.get(k)
+	return ttl
 }
 
 // SetTTL sets the TTL of a key.
 func (m *Miniredis) SetTTL(k string, ttl time.Duration) {
-	m.DB(m.selectedDB).SetTTL(k, ttl)
+	m.selected().SetTTL(k, ttl)
 }
 
 // SetTTL sets the time to live of a key.
@@ -420,13 +448,75 @@ func (db *RedisDB) SetTTL(k string, ttl time.Duration) {
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	db.ttl[k] = ttl
-	db.keyVersion[k]++
+	db.ttl.set(k, ttl)
+	db.bump(k)
+}
+
+// SetWithTTL sets a string key with a TTL, same as SET with EX or PX.
+// Unlike redis the key can't be an existing non-string key.
+func (m *Miniredis) SetWithTTL(k, v string, ttl time.Duration) error {
+	return m.selected().SetWithTTL(k, v, ttl)
+}
+
+// SetWithTTL sets a string key with a TTL.
+func (db *RedisDB) SetWithTTL(k, v string, ttl time.Duration) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	if db.wrongType(k, "string") {
+		return ErrWrongType
+	}
+	db.stringSet(k, v)
+	db.ttl.set(k, ttl)
+	db.checkTTL(k)
+	return nil
+}
+
+// SetExpireAt makes an existing key expire at t, same as PEXPIREAT. t is
+// compared with the time set with SetTime(), or with the current time, so
+// tests don't have to do the arithmetic themselves. A t which is not after
+// that deletes the key, same as redis.
+func (m *Miniredis) SetExpireAt(k string, t time.Time) {
+	m.selected().SetExpireAt(k, t)
+}
+
+// SetExpireAt makes an existing key expire at t.
+func (db *RedisDB) SetExpireAt(k string, t time.Time) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	if !db.exists(k) {
+		return
+	}
+	db.ttl.set(k, t.Sub(db.master.effectiveNow()))
+	db.bump(k)
+	db.checkTTL(k)
+}
+
+// TTLRemaining is the time until the key expires, with FastForward() and the
+// like counted, and false if the key has no TTL or doesn't exist. That's the
+// same as comparing with SetExpireAt(): after SetTime(now) and
+// SetExpireAt(k, now.Add(time.Minute)) it gives a minute.
+func (m *Miniredis) TTLRemaining(k string) (time.Duration, bool) {
+	return m.selected().TTLRemaining(k)
+}
+
+// TTLRemaining is the time until the key expires.
+func (db *RedisDB) TTLRemaining(k string) (time.Duration, bool) {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	if !db.exists(k) {
+		return 0, false
+	}
+	return db.ttl.get(k)
 }
 
 // Type gives the type of a key, or ""
 func (m *Miniredis) Type(k string) string {
-	return m.DB(m.selectedDB).Type(k)
+	return m.selected().Type(k)
 }
 
 // Type gives the type of a key, or ""
@@ -439,7 +529,7 @@ func (db *RedisDB) Type(k string) string {
 
 // Exists tells whether a key exists.
 func (m *Miniredis) Exists(k string) bool {
-	return m.DB(m.selectedDB).Exists(k)
+	return m.selected().Exists(k)
 }
 
 // Exists tells whether a key exists.
@@ -450,12 +540,106 @@ func (db *RedisDB) Exists(k string) bool {
 	return db.exists(k)
 }
 
+// ReplaceWithString replaces the key, of any type, with a string, and keeps
+// its TTL. This is for tests of schema migrations, where a key changes type
+// between versions of an application.
+func (m *Miniredis) ReplaceWithString(k, v string) {
+	m.selected().ReplaceWithString(k, v)
+}
+
+// ReplaceWithString replaces the key with a string, and keeps its TTL.
+func (db *RedisDB) ReplaceWithString(k, v string) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	db.replace(k, func() {
+		db.stringSet(k, v)
+	})
+}
+
+// ReplaceWithHash replaces the key, of any type, with a hash, and keeps its
+// TTL. An empty hash deletes the key.
+func (m *Miniredis) ReplaceWithHash(k string, fields map[string]string) {
+	m.selected().ReplaceWithHash(k, fields)
+}
+
+// ReplaceWithHash replaces the key with a hash, and keeps its TTL.
+func (db *RedisDB) ReplaceWithHash(k string, fields map[string]string) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	db.replace(k, func() {
+		for f, v := range fields {
+			db.hashSet(k, f, v)
+		}
+	})
+}
+
+// ReplaceWithList replaces the key, of any type, with a list, and keeps its
+// TTL. An empty list deletes the key.
+func (m *Miniredis) ReplaceWithList(k string, elems ...string) {
+	m.selected().ReplaceWithList(k, elems...)
+}
+
+// ReplaceWithList replaces the key with a list, and keeps its TTL.
+func (db *RedisDB) ReplaceWithList(k string, elems ...string) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	db.replace(k, func() {
+		if len(elems) > 0 {
+			db.listPush(k, elems...)
+		}
+	})
+}
+
+// ReplaceWithSet replaces the key, of any type, with a set, and keeps its TTL.
+// An empty set deletes the key.
+func (m *Miniredis) ReplaceWithSet(k string, elems ...string) {
+	m.selected().ReplaceWithSet(k, elems...)
+}
+
+// ReplaceWithSet replaces the key with a set, and keeps its TTL.
+func (db *RedisDB) ReplaceWithSet(k string, elems ...string) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	db.replace(k, func() {
+		if len(elems) > 0 {
+			db.setAdd(k, elems...)
+		}
+	})
+}
+
+// ReplaceWithSortedSet replaces the key, of any type, with a sorted set, and
+// keeps its TTL. An empty sorted set deletes the key.
+func (m *Miniredis) ReplaceWithSortedSet(k string, members map[string]float64) {
+	m.selected().ReplaceWithSortedSet(k, members)
+}
+
+// ReplaceWithSortedSet replaces the key with a sorted set, and keeps its TTL.
+func (db *RedisDB) ReplaceWithSortedSet(k string, members map[string]float64) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	db.replace(k, func() {
+		for member, score := range members {
+			db.ssetAdd(k, score, member)
+		}
+	})
+}
+
 // HGet returns hash keys added with HSET.
 // This will return an empty string if the key is not set. Redis would return
 // a nil.
 // Returns empty string when the key is of a different type.
 func (m *Miniredis) HGet(k, f string) string {
-	return m.DB(m.selectedDB).HGet(k, f)
+	return m.selected().HGet(k, f)
 }
 
 // HGet returns hash keys added with HSET.
@@ -474,7 +658,7 @@ func (db *RedisDB) HGet(k, f string) string {
 // HSet sets hash keys.
 // If there is another key by the same name it will be gone.
 func (m *Miniredis) HSet(k string, fv ...string) {
-	m.DB(m.selectedDB).HSet(k, fv...)
+	m.selected().HSet(k, fv...)
 }
 
 // HSet sets hash keys.
@@ -489,7 +673,7 @@ func (db *RedisDB) HSet(k string, fv ...string) {
 
 // HDel deletes a hash key.
 func (m *Miniredis) HDel(k, f string) {
-	m.DB(m.selectedDB).HDel(k, f)
+	m.selected().HDel(k, f)
 }
 
 // HDel deletes a hash key.
@@ -505,8 +689,9 @@ func (db *RedisDB) hdel(k, f string) {
 	if _, ok := db.hashKeys[k]; !ok {
 		return
 	}
+	db.before(k, f)
 	delete(db.hashKeys[k], f)
-	db.keyVersion[k]++
+	db.bump(k)
 }
 
 // HIncrBy increases the integer value of a hash field by delta (int).
@@ -516,7 +701,7 @@ func (m *Miniredis) HIncrBy(k, f string, delta int) (int, error) {
 
 // HIncr increases a key/field by delta (int).
 func (m *Miniredis) HIncr(k, f string, delta int) (int, error) {
-	return m.DB(m.selectedDB).HIncr(k, f, delta)
+	return m.selected().HIncr(k, f, delta)
 }
 
 // HIncr increases a key/field by delta (int).
@@ -535,7 +720,7 @@ func (m *Miniredis) HIncrByFloat(k, f string, delta float64) (float64, error) {
 
 // HIncrfloat increases a key/field by delta (float).
 func (m *Miniredis) HIncrfloat(k, f string, delta float64) (float64, error) {
-	return m.DB(m.selectedDB).HIncrfloat(k, f, delta)
+	return m.selected().HIncrfloat(k, f, delta)
 }
 
 // HIncrfloat increases a key/field by delta (float).
@@ -554,7 +739,7 @@ func (db *RedisDB) HIncrfloat(k, f string, delta float64) (float64, error) {
 
 // SRem removes fields from a set. Returns number of deleted fields.
 func (m *Miniredis) SRem(k string, fields ...string) (int, error) {
-	return m.DB(m.selectedDB).SRem(k, fields...)
+	return m.selected().SRem(k, fields...)
 }
 
 // SRem removes fields from a set. Returns number of deleted fields.
@@ -574,24 +759,75 @@ func (db *RedisDB) SRem(k string, fields ...string) (int, error) {
 
 // ZAdd adds a score,member to a sorted set.
 func (m *Miniredis) ZAdd(k string, score float64, member string) (bool, error) {
-	return m.DB(m.selectedDB).ZAdd(k, score, member)
+	return m.selected().ZAdd(k, score, member)
 }
 
-// ZAdd adds a score,member to a sorted set.
+// ZAdd adds a score,member to a sorted set. A NaN score is an
+// ErrFloatValueError, same as with ZADD.
 func (db *RedisDB) ZAdd(k string, score float64, member string) (bool, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
 	defer db.master.signal.Broadcast()
 
-	if db.exists(k) && db.t(k) != "zset" {
+	if math.IsNaN(score) {
+		return false, ErrFloatValueError
+	}
+	if db.wrongType(k, "zset") {
 		return false, ErrWrongType
 	}
 	return db.ssetAdd(k, score, member), nil
 }
 
+// ZAddOptions are the flags of ZADD, for ZAddOpt().
+type ZAddOptions struct {
+	NX   bool // only add new members
+	XX   bool // only update existing members
+	GT   bool // only update existing members to a greater score
+	LT   bool // only update existing members to a smaller score
+	INCR bool // add the score to the existing score, as ZINCRBY
+}
+
+// check gives the ZADD error of incompatible flags, if any.
+func (o ZAddOptions) check() error {
+	if o.XX && o.NX {
+		return errors.New(msgXXandNX)
+	}
+	if o.GT && o.LT || o.GT && o.NX || o.LT && o.NX {
+		return errors.New(msgGTLTandNX)
+	}
+	return nil
+}
+
+// ZAddOpt adds a score,member to a sorted set, with the flags of ZADD.
+func (m *Miniredis) ZAddOpt(k string, opts ZAddOptions, score float64, member string) (float64, bool, error) {
+	return m.selected().ZAddOpt(k, opts, score, member)
+}
+
+// ZAddOpt adds a score,member to a sorted set, with the flags of ZADD. Returns
+// the score of the member afterwards, and whether it was added or updated,
+// which is false if the flags skipped it. Incompatible flags give the error
+// ZADD gives.
+func (db *RedisDB) ZAddOpt(k string, opts ZAddOptions, score float64, member string) (float64, bool, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	defer db.master.signal.Broadcast()
+
+	if err := opts.check(); err != nil {
+		return 0, false, err
+	}
+	if math.IsNaN(score) {
+		return 0, false, ErrFloatValueError
+	}
+	if db.wrongType(k, "zset") {
+		return 0, false, ErrWrongType
+	}
+	newScore, skipped, err := db.ssetAddOpt(k, opts, score, member)
+	return newScore, !skipped && err == nil, err
+}
+
 // ZMembers returns all members of a sorted set by score
 func (m *Miniredis) ZMembers(k string) ([]string, error) {
-	return m.DB(m.selectedDB).ZMembers(k)
+	return m.selected().ZMembers(k)
 }
 
 // ZMembers returns all members of a sorted set by score
@@ -610,7 +846,7 @@ func (db *RedisDB) ZMembers(k string) ([]string, error) {
 
 // SortedSet returns a raw string->float64 map.
 func (m *Miniredis) SortedSet(k string) (map[string]float64, error) {
-	return m.DB(m.selectedDB).SortedSet(k)
+	return m.selected().SortedSet(k)
 }
 
 // SortedSet returns a raw string->float64 map.
@@ -629,7 +865,7 @@ func (db *RedisDB) SortedSet(k string) (map[string]float64, error) {
 
 // ZRem deletes a member. Returns whether the was a key.
 func (m *Miniredis) ZRem(k, member string) (bool, error) {
-	return m.DB(m.selectedDB).ZRem(k, member)
+	return m.selected().ZRem(k, member)
 }
 
 // ZRem deletes a member. Returns whether the was a key.
@@ -649,7 +885,7 @@ func (db *RedisDB) ZRem(k, member string) (bool, error) {
 
 // ZScore gives the score of a sorted set member.
 func (m *Miniredis) ZScore(k, member string) (float64, error) {
-	return m.DB(m.selectedDB).ZScore(k, member)
+	return m.selected().ZScore(k, member)
 }
 
 // ZScore gives the score of a sorted set member.
@@ -670,7 +906,7 @@ func (db *RedisDB) ZScore(k, member string) (float64, error) {
 // If a value is given normal XADD rules apply. Values should be an even
 // length.
 func (m *Miniredis) XAdd(k string, id string, values []string) (string, error) {
-	return m.DB(m.selectedDB).XAdd(k, id, values)
+	return m.selected().XAdd(k, id, values)
 }
 
 // XAdd adds an entry to a stream. `id` can be left empty or be '*'.
@@ -694,7 +930,7 @@ func (db *RedisDB) XAdd(k string, id string, values []string) (string, error) {
 
 // Stream returns a slice of stream entries. Oldest first.
 func (m *Miniredis) Stream(k string) ([]StreamEntry, error) {
-	return m.DB(m.selectedDB).Stream(k)
+	return m.selected().Stream(k)
 }
 
 // Stream returns a slice of stream entries. Oldest first.
@@ -712,7 +948,48 @@ func (db *RedisDB) Stream(key string) ([]StreamEntry, error) {
 	return s.entries, nil
 }
 
-// Publish a message to subscribers. Returns the number of receivers.
+// SetConsumerIdle makes all pending entries of a stream consumer look like
+// they were last delivered `d` ago. That's what XPENDING IDLE, XCLAIM, and
+// XAUTOCLAIM use for their min-idle-time. Idle times are relative to the time
+// set with SetTime(), if any.
+func (m *Miniredis) SetConsumerIdle(key, group, consumer string, d time.Duration) error {
+	return m.selected().SetConsumerIdle(key, group, consumer, d)
+}
+
+// SetConsumerIdle makes all pending entries of a stream consumer look like
+// they were last delivered `d` ago. That's what XPENDING IDLE, XCLAIM, and
+// XAUTOCLAIM use for their min-idle-time. Idle times are relative to the time
+// set with SetTime(), if any.
+func (db *RedisDB) SetConsumerIdle(key, group, consumer string, d time.Duration) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	s, err := db.stream(key)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return ErrKeyNotFound
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return ErrGroupNotFound
+	}
+	if _, ok := g.consumers[consumer]; !ok {
+		return ErrConsumerNotFound
+	}
+
+	last := db.master.effectiveNow().Add(-d)
+	for i := range g.pending {
+		if g.pending[i].consumer == consumer {
+			g.pending[i].lastDelivery = last
+		}
+	}
+	return nil
+}
+
+// Publish a message to subscribers. Returns the number of receivers, after all
+// of them got the message, in the order they subscribed.
 func (m *Miniredis) Publish(channel, message string) int {
 	m.Lock()
 	defer m.Unlock()
@@ -720,6 +997,36 @@ func (m *Miniredis) Publish(channel, message string) int {
 	return m.publish(channel, message)
 }
 
+// PublishedMessage is a message as sent via PUBLISH, Publish(), or a keyspace
+// event.
+type PublishedMessage struct {
+	Channel   string
+	Message   string
+	Receivers int // as returned by PUBLISH
+}
+
+// maxPublished is the number of messages PublishedMessages() keeps.
+const maxPublished = 1000
+
+// PublishedMessages gives the last 1000 published messages, oldest first.
+// Messages are recorded even if nobody was subscribed.
+func (m *Miniredis) PublishedMessages() []PublishedMessage {
+	m.Lock()
+	defer m.Unlock()
+
+	res := make([]PublishedMessage, len(m.published))
+	copy(res, m.published)
+	return res
+}
+
+// ResetPublishedMessages clears the log of PublishedMessages().
+func (m *Miniredis) ResetPublishedMessages() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.published = nil
+}
+
 // PubSubChannels is "PUBSUB CHANNELS <pattern>". An empty pattern is fine
 // (meaning all channels).
 // Returned channels will be ordered alphabetically.
@@ -754,7 +1061,7 @@ func (m *Miniredis) PubSubNumPat() int {
 
 // PfAdd adds keys to a hll. Returns the flag which equals to 1 if the inner hll value has been changed.
 func (m *Miniredis) PfAdd(k string, elems ...string) (int, error) {
-	return m.DB(m.selectedDB).HllAdd(k, elems...)
+	return m.selected().HllAdd(k, elems...)
 }
 
 // HllAdd adds keys to a hll. Returns the flag which equals to true if the inner hll value has been changed.
@@ -762,7 +1069,7 @@ func (db *RedisDB) HllAdd(k string, elems ...string) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
 
-	if db.exists(k) && db.t(k) != "hll" {
+	if db.wrongType(k, "hll") {
 		return 0, ErrWrongType
 	}
 	return db.hllAdd(k, elems...), nil
@@ -770,7 +1077,7 @@ func (db *RedisDB) HllAdd(k string, elems ...string) (int, error) {
 
 // PfCount returns an estimation of the amount of elements previously added to a hll.
 func (m *Miniredis) PfCount(keys ...string) (int, error) {
-	return m.DB(m.selectedDB).HllCount(keys...)
+	return m.selected().HllCount(keys...)
 }
 
 // HllCount returns an estimation of the amount of elements previously added to a hll.
@@ -783,7 +1090,7 @@ func (db *RedisDB) HllCount(keys ...string) (int, error) {
 
 // PfMerge merges all the input hlls into a hll under destKey key.
 func (m *Miniredis) PfMerge(destKey string, sourceKeys ...string) error {
-	return m.DB(m.selectedDB).HllMerge(destKey, sourceKeys...)
+	return m.selected().HllMerge(destKey, sourceKeys...)
 }
 
 // HllMerge merges all the input hlls into a hll under destKey key.
@@ -799,5 +1106,8 @@ func (db *RedisDB) HllMerge(destKey string, sourceKeys ...string) error {
 // Returns ErrKeyNotFound if src does not exist.
 // Overwrites dest if it already exists (unlike the redis command, which needs a flag to allow that).
 func (m *Miniredis) Copy(srcDB int, src string, destDB int, dest string) error {
-	return m.copy(m.DB(srcDB), src, m.DB(destDB), dest)
+	m.Lock()
+	defer m.Unlock()
+	defer m.signal.Broadcast()
+	return m.copy(m.db(srcDB), src, m.db(destDB), dest)
 }
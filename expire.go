@@ -0,0 +1,120 @@
+package miniredis
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+// expireSet holds the TTLs of a DB. The TTLs are stored as deadlines on the
+// clock of the set, in a min-heap, so moving the clock forward, and finding
+// the key which expires next, doesn't have to look at every key.
+// No locks!
+type expireSet struct {
+	now   time.Duration // how far the clock of this set was moved forward
+	items map[string]*expireItem
+	heap  expireHeap
+}
+
+type expireItem struct {
+	key      string
+	deadline time.Duration
+	index    int // in the heap
+}
+
+func newExpireSet() *expireSet {
+	return &expireSet{
+		items: map[string]*expireItem{},
+	}
+}
+
+// len is the number of keys with a TTL.
+func (s *expireSet) len() int {
+	return len(s.items)
+}
+
+// get returns the remaining TTL of a key. This can be <= 0 for keys which are
+// expired but not yet removed.
+func (s *expireSet) get(k string) (time.Duration, bool) {
+	it, ok := s.items[k]
+	if !ok {
+		return 0, false
+	}
+	return it.deadline - s.now, true
+}
+
+// set sets, or updates, the TTL of a key. TTLs past the end of the clock
+// stop there.
+func (s *expireSet) set(k string, ttl time.Duration) {
+	deadline := s.now + ttl
+	if ttl > 0 && deadline < s.now {
+		deadline = math.MaxInt64
+	}
+	if it, ok := s.items[k]; ok {
+		it.deadline = deadline
+		heap.Fix(&s.heap, it.index)
+		return
+	}
+	it := &expireItem{key: k, deadline: deadline}
+	s.items[k] = it
+	heap.Push(&s.heap, it)
+}
+
+// del removes the TTL of a key, if any.
+func (s *expireSet) del(k string) {
+	it, ok := s.items[k]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.heap, it.index)
+	delete(s.items, k)
+}
+
+// next returns the key which expires first, with its remaining TTL.
+func (s *expireSet) next() (string, time.Duration, bool) {
+	if len(s.heap) == 0 {
+		return "", 0, false
+	}
+	it := s.heap[0]
+	return it.key, it.deadline - s.now, true
+}
+
+// advance moves the clock forward. This lowers the TTL of every key, but
+// doesn't remove anything: keys with a TTL <= 0 are found with next().
+func (s *expireSet) advance(d time.Duration) {
+	s.now += d
+}
+
+// each calls cb for every key with a TTL, in no particular order.
+func (s *expireSet) each(cb func(k string, ttl time.Duration)) {
+	for k, it := range s.items {
+		cb(k, it.deadline-s.now)
+	}
+}
+
+// expireHeap implements heap.Interface.
+type expireHeap []*expireItem
+
+func (h expireHeap) Len() int           { return len(h) }
+func (h expireHeap) Less(i, j int) bool { return h[i].deadline < h[j].deadline }
+
+func (h expireHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expireHeap) Push(x interface{}) {
+	it := x.(*expireItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expireHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
@@ -0,0 +1,116 @@
+package miniredis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpireSet(t *testing.T) {
+	s := newExpireSet()
+	_, _, ok := s.next()
+	equals(t, false, ok)
+
+	s.set("c", 3*time.Second)
+	s.set("a", 1*time.Second)
+	s.set("b", 2*time.Second)
+	equals(t, 3, s.len())
+
+	k, ttl, ok := s.next()
+	equals(t, true, ok)
+	equals(t, "a", k)
+	equals(t, time.Second, ttl)
+
+	s.advance(1500 * time.Millisecond)
+	v, ok := s.get("c")
+	equals(t, true, ok)
+	equals(t, 1500*time.Millisecond, v)
+	k, ttl, _ = s.next()
+	equals(t, "a", k)
+	equals(t, -500*time.Millisecond, ttl)
+
+	// updates move keys around
+	s.set("a", 10*time.Second)
+	k, _, _ = s.next()
+	equals(t, "b", k)
+
+	s.del("b")
+	s.del("nosuch")
+	equals(t, 2, s.len())
+	k, ttl, _ = s.next()
+	equals(t, "c", k)
+	equals(t, 1500*time.Millisecond, ttl)
+	_, ok = s.get("b")
+	equals(t, false, ok)
+
+	seen := map[string]time.Duration{}
+	s.each(func(k string, ttl time.Duration) { seen[k] = ttl })
+	equals(t, map[string]time.Duration{"a": 10 * time.Second, "c": 1500 * time.Millisecond}, seen)
+}
+
+func TestFastForwardOrder(t *testing.T) {
+	m := NewMiniRedis()
+	for i, k := range []string{"d", "a", "c", "b"} {
+		m.Set(k, "v")
+		m.SetTTL(k, time.Duration(10-i)*time.Second)
+	}
+	m.Set("keep", "v")
+	m.SetTTL("keep", time.Hour)
+	m.SetTTL("nosuchkey", time.Second)
+
+	equals(t, []ExpiredKey{{0, "a"}, {0, "b"}, {0, "c"}, {0, "d"}}, m.AdvanceClock(time.Minute))
+	equals(t, []string{"keep"}, m.Keys())
+	equals(t, 59*time.Minute, m.TTL("keep"))
+	equals(t, 1, m.dbs[0].ttl.len())
+}
+
+func benchmarkDB(n int) *RedisDB {
+	m := NewMiniRedis()
+	db := m.db(0)
+	for i := 0; i < n; i++ {
+		k := strconv.Itoa(i)
+		db.stringSet(k, "v")
+		db.ttl.set(k, time.Duration(n+i)*time.Second)
+	}
+	return db
+}
+
+func BenchmarkExpireSet(b *testing.B) {
+	const n = 1000000
+	db := benchmarkDB(n)
+
+	b.Run("set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			db.ttl.set(strconv.Itoa(i%n), time.Duration(n+i)*time.Second)
+		}
+	})
+
+	b.Run("next", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			db.ttl.next()
+		}
+	})
+
+	b.Run("fastforward", func(b *testing.B) {
+		// nothing expires
+		for i := 0; i < b.N; i++ {
+			db.fastForward(time.Nanosecond)
+		}
+	})
+
+	b.Run("expire", func(b *testing.B) {
+		// every step expires a single key
+		db := benchmarkDB(n)
+		db.fastForward(n * time.Second)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if i%(n-1) == 0 && i > 0 {
+				b.StopTimer()
+				db = benchmarkDB(n)
+				db.fastForward(n * time.Second)
+				b.StartTimer()
+			}
+			db.fastForward(time.Second)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package miniredis
+
+// The dump RunT() logs when a test fails. See Miniredis.SetFailureDump().
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FailureDump configures the dump of the keys RunT() logs when the test
+// fails. See SetFailureDump().
+type FailureDump struct {
+	Off     bool   // no dump
+	Pattern string // only keys which match, as with KEYS. Default is the keys commands used most recently.
+	Keys    int    // at most this many keys per DB. 0 is 20.
+	Elems   int    // at most this many elements per key. 0 is 10.
+}
+
+// failTester is what RunT() needs for the failure dump. testing.T and
+// friends have it.
+type failTester interface {
+	Failed() bool
+	Logf(string, ...interface{})
+}
+
+// SetFailureDump changes the dump of the keys a miniredis made with RunT()
+// logs when the test fails, instead of calls to Dump() all over the test.
+// By default it has the 20 keys commands used most recently, in every DB,
+// with at most 10 elements per key, the same way Dump() shows them. With a
+// Pattern it has the matching keys instead. Values are truncated to
+// DumpMaxLineLen.
+// Keys set with Go methods, such as m.Set(), only count as used when a
+// command used them, or with a Pattern.
+func (m *Miniredis) SetFailureDump(d FailureDump) {
+	m.Lock()
+	defer m.Unlock()
+	m.failureDump = &d
+}
+
+// failureDumpKeys is the default for FailureDump.Keys.
+const failureDumpKeys = 20
+
+// used remembers the keys a command used, for the failure dump. No locks!
+func (m *Miniredis) used(db int, keys []string) {
+	if m.failureDump == nil || m.failureDump.Off {
+		return
+	}
+	if m.recentKeys == nil {
+		m.recentKeys = map[dbKey]uint64{}
+	}
+	for _, k := range keys {
+		m.recentKeys[dbKey{db: db, key: k}] = m.op
+	}
+	if len(m.recentKeys) > 10000 {
+		// only the most recent ones are needed
+		for _, k := range m.recentlyUsed(-1, 1000) {
+			delete(m.recentKeys, k)
+		}
+	}
+}
+
+// recentlyUsed gives the keys in DB db (all DBs if it's negative) which
+// commands used, most recent first. With skip it gives all but the skip most
+// recent ones. No locks!
+func (m *Miniredis) recentlyUsed(db, skip int) []dbKey {
+	var keys []dbKey
+	for k := range m.recentKeys {
+		if db < 0 || k.db == db {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m.recentKeys[keys[i]], m.recentKeys[keys[j]]
+		if a != b {
+			return a > b
+		}
+		return keys[i].key < keys[j].key
+	})
+	if skip > len(keys) {
+		skip = len(keys)
+	}
+	return keys[skip:]
+}
+
+// logFailureDump logs the dump, if the test failed.
+func (m *Miniredis) logFailureDump(t Tester) {
+	ft, ok := t.(failTester)
+	if !ok || !ft.Failed() {
+		return
+	}
+	if d := m.failureDumpText(); d != "" {
+		ft.Logf("miniredis keys at the failure:\n%s", d)
+	}
+}
+
+func (m *Miniredis) failureDumpText() string {
+	m.Lock()
+	defer m.Unlock()
+
+	opts := m.failureDump
+	if opts == nil || opts.Off {
+		return ""
+	}
+	maxKeys, maxElems := opts.Keys, opts.Elems
+	if maxKeys <= 0 {
+		maxKeys = failureDumpKeys
+	}
+	if maxElems <= 0 {
+		maxElems = 10
+	}
+
+	r := ""
+	for _, id := range m.dbIDs() {
+		db := m.dbs[id]
+		var keys []string
+		if opts.Pattern != "" {
+			keys, _ = matchKeys(db.allKeys(), opts.Pattern)
+		} else {
+			for _, k := range m.recentlyUsed(id, 0) {
+				if db.exists(k.key) {
+					keys = append(keys, k.key)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		r += fmt.Sprintf("db %d (%d keys):\n", id, len(db.keys))
+		for i, k := range keys {
+			if i == maxKeys {
+				r += fmt.Sprintf("(and %d more)\n", len(keys)-maxKeys)
+				break
+			}
+			r += db.dumpKey(k, maxElems)
+		}
+	}
+	return r
+}
@@ -0,0 +1,76 @@
+package miniredis
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestFailureDump(t *testing.T) {
+	// runs RunT() with a failing test, and gives what it logged
+	run := func(t *testing.T, fail bool, cb func(*Miniredis, *proto.Client)) []string {
+		t.Helper()
+		f := &fakeTester{}
+		m := RunT(f)
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		cb(m, c)
+		c.Close()
+		if fail {
+			f.Fatalf("failed")
+		}
+		for _, cb := range f.cleanup {
+			cb()
+		}
+		return f.logs
+	}
+
+	t.Run("passed", func(t *testing.T) {
+		logs := run(t, false, func(m *Miniredis, c *proto.Client) {
+			mustOK(t, c, "SET", "foo", "bar")
+		})
+		equals(t, 0, len(logs))
+	})
+
+	t.Run("recent keys", func(t *testing.T) {
+		logs := run(t, true, func(m *Miniredis, c *proto.Client) {
+			m.Set("untouched", "v")
+			for i := 0; i < 30; i++ {
+				mustOK(t, c, "SET", "k"+strconv.Itoa(i), "v")
+			}
+			must1(t, c, "RPUSH", "list", "a")
+			mustOK(t, c, "SELECT", "2")
+			mustDo(t, c, "HSET", "h", "f", "v", proto.Int(1))
+		})
+		equals(t, 1, len(logs))
+		log := logs[0]
+		assert(t, strings.HasPrefix(log, "miniredis keys at the failure:\ndb 0 (32 keys):\n- list\n   \"a\"\n- k29\n"), "dump: %s", log)
+		assert(t, strings.Contains(log, "(and 11 more)\ndb 2 (1 keys):\n- h\n   f: \"v\"\n"), "dump: %s", log)
+		assert(t, !strings.Contains(log, "untouched"), "dump: %s", log)
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		logs := run(t, true, func(m *Miniredis, c *proto.Client) {
+			m.SetFailureDump(FailureDump{Pattern: "user:*", Elems: 2})
+			m.Set("other", "v")
+			m.Push("user:1", "a", "b", "c")
+			m.Set("user:2", strings.Repeat("x", 100))
+		})
+		equals(t, []string{
+			"miniredis keys at the failure:\n" +
+				"db 0 (3 keys):\n" +
+				"- user:1\n   \"a\"\n   \"b\"\n   ...\n" +
+				"- user:2\n   \"" + strings.Repeat("x", 52) + "\"...(100)\n",
+		}, logs)
+	})
+
+	t.Run("off", func(t *testing.T) {
+		logs := run(t, true, func(m *Miniredis, c *proto.Client) {
+			m.SetFailureDump(FailureDump{Off: true})
+			mustOK(t, c, "SET", "foo", "bar")
+		})
+		equals(t, 0, len(logs))
+	})
+}
@@ -0,0 +1,168 @@
+package miniredis
+
+// Random commands, to find panics. See Miniredis.Fuzz().
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/proto"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// commands Fuzz() never sends, since they wait.
+var fuzzSkip = map[string]bool{
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BRPOPLPUSH": true,
+	"BLMOVE":     true,
+	"BLMPOP":     true,
+	"BZPOPMIN":   true,
+	"BZPOPMAX":   true,
+	"BZMPOP":     true,
+	"WAIT":       true,
+}
+
+var fuzzKeys = []string{
+	"str", "hash", "list", "set", "zset", "stream", "hll", "nosuch",
+	"", "ключ", "🔑", "{tag}str", "a\x00b", strings.Repeat("k", 1000),
+}
+
+var fuzzArgs = []string{
+	"0", "1", "-1", "2", "-2", "10", "3.14", "-0", "+1", "007",
+	"2147483647", "2147483648",
+	"9223372036854775807", "-9223372036854775808", "9223372036854775808",
+	"1e308", "-1e308", "1e400", "nan", "NaN", "inf", "+inf", "-inf",
+	"(1", "(-inf", "(+inf", "[a", "(a", "-", "+", "[", "(",
+	"*", "$", ">", "0-0", "0-1", "1-*", "18446744073709551615-18446744073709551615",
+	"LIMIT", "COUNT", "MATCH", "TYPE", "WITHSCORES", "WITHVALUES", "BYSCORE",
+	"BYLEX", "REV", "NX", "XX", "GT", "LT", "CH", "INCR", "EX", "PX", "EXAT",
+	"PXAT", "KEEPTTL", "GET", "STORE", "LEFT", "RIGHT", "BEFORE", "AFTER",
+	"AGGREGATE", "SUM", "MIN", "MAX", "WEIGHTS", "STREAMS", "GROUP", "MKSTREAM",
+	"MAXLEN", "MINID", "~", "=", "ID", "RANK", "ASYNC", "FIELDS",
+	"", " ", "\x00", "é", "日本語", "\r\n", strings.Repeat("v", 10000),
+}
+
+// Fuzz sends n random commands to the miniredis, and fails the test if one of
+// them panics, or doesn't get a valid reply. The commands are syntactically
+// valid, but weird: huge counts, NaN and infinite scores, unicode keys,
+// negative limits, &c. Commands which block are skipped.
+//
+// Without commands all known commands are used, including the ones added with
+// RegisterCommand(). The same seed gives the same commands. The commands
+// change the data, so use a miniredis which is only for fuzzing.
+func (m *Miniredis) Fuzz(t Tester, seed int64, n int, commands ...string) {
+	m.Lock()
+	srv := m.srv
+	if len(commands) == 0 {
+		for name := range commandSpecs() {
+			commands = append(commands, strings.ToUpper(name))
+		}
+		for name := range m.customCommands {
+			commands = append(commands, name)
+		}
+	}
+	m.Unlock()
+	if srv == nil {
+		t.Fatalf("miniredis is not running")
+		return
+	}
+
+	var cmds []string
+	for _, c := range commands {
+		if c = strings.ToUpper(c); !fuzzSkip[c] {
+			cmds = append(cmds, c)
+		}
+	}
+	sort.Strings(cmds)
+	if len(cmds) == 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		if i%100 == 0 {
+			m.fuzzSeed()
+		}
+		args := fuzzCommand(rnd, cmds[rnd.Intn(len(cmds))])
+		if err := fuzzRun(srv, args); err != nil {
+			t.Fatalf("fuzz command %d (seed %d) %q: %s", i, seed, args, err)
+			return
+		}
+	}
+}
+
+// fuzzSeed makes sure there is a key of every type.
+func (m *Miniredis) fuzzSeed() {
+	m.Lock()
+	defer m.Unlock()
+	defer m.signal.Broadcast()
+
+	db := m.db(m.selectedDB)
+	for _, k := range fuzzKeys[:7] {
+		db.del(k, true)
+	}
+	db.stringSet("str", "value")
+	db.hashSet("hash", "f1", "v1", "f2", "2")
+	db.listPush("list", "a", "b", "c")
+	db.setAdd("set", "a", "b", "c")
+	db.ssetAdd("zset", 1, "a")
+	db.ssetAdd("zset", 2, "b")
+	if st, err := db.newStream("stream"); err == nil {
+		st.add("1-1", []string{"f", "v"}, m.effectiveNow())
+	}
+	db.hllAdd("hll", "a", "b")
+}
+
+// fuzzCommand makes a command with random arguments.
+func fuzzCommand(rnd *rand.Rand, cmd string) []string {
+	n := rnd.Intn(8)
+	if spec, ok := commandSpecs()[strings.ToLower(cmd)]; ok && spec.arity > 0 && rnd.Intn(2) == 0 {
+		n = spec.arity - 1
+	}
+	args := []string{cmd}
+	for i := 0; i < n; i++ {
+		if i == 0 || rnd.Intn(4) == 0 {
+			args = append(args, fuzzKeys[rnd.Intn(len(fuzzKeys))])
+			continue
+		}
+		args = append(args, fuzzArgs[rnd.Intn(len(fuzzArgs))])
+	}
+	return args
+}
+
+// fuzzRun runs a single command on a new connection.
+func fuzzRun(srv *server.Server, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	buf := &bytes.Buffer{}
+	wr := bufio.NewWriter(buf)
+	peer := server.NewPeer(wr)
+	srv.Dispatch(peer, args)
+	wr.Flush()
+
+	raw := buf.String()
+	rd := bufio.NewReader(buf)
+	for replies := 0; ; replies++ {
+		if _, err := rd.Peek(1); err == io.EOF {
+			if replies == 0 {
+				return fmt.Errorf("no reply")
+			}
+			return nil
+		}
+		// error replies are fine, anything which isn't a complete reply
+		// is not.
+		if _, err := proto.Read(rd); err != nil {
+			return fmt.Errorf("invalid reply: %q", raw)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package miniredis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestFuzz(t *testing.T) {
+	s := RunT(t)
+	s.Fuzz(t, 42, 20000)
+
+	t.Run("deterministic scan", func(t *testing.T) {
+		s := RunT(t)
+		s.DeterministicScan(true)
+		s.Fuzz(t, 43, 20000)
+	})
+
+	t.Run("invalid replies", func(t *testing.T) {
+		s := RunT(t)
+		var reply string
+		s.Server().Register("BROKEN", func(c *server.Peer, cmd string, args []string) {
+			c.WriteRaw(reply)
+		})
+		for r, want := range map[string]string{
+			"-ERR fine\r\n":             "",
+			"*2\r\n-ERR fine\r\n:1\r\n": "",
+			"":                          "no reply",
+			"$5\r\nhel":                 "invalid reply",
+			"*2\r\n:1\r\n":              "invalid reply",
+			"+OK\r\n+O":                 "invalid reply",
+			"$x\r\n":                    "invalid reply",
+			"?\r\n":                     "invalid reply",
+		} {
+			reply = r
+			err := fuzzRun(s.Server(), []string{"BROKEN"})
+			switch {
+			case want == "" && err != nil:
+				t.Errorf("%q: %s", reply, err)
+			case want != "" && (err == nil || !strings.HasPrefix(err.Error(), want)):
+				t.Errorf("%q: have %v, want %s", reply, err, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package miniredis
+
+// HTTP health endpoint. See Miniredis.StartHTTPHealth().
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HealthStats is what the /stats URL of StartHTTPHealth() gives, as JSON.
+// The fields are the same as the ones in INFO.
+type HealthStats struct {
+	RedisVersion     string              `json:"redis_version"`
+	RedisMode        string              `json:"redis_mode"`
+	Ready            bool                `json:"ready"`
+	ConnectedClients int                 `json:"connected_clients"`
+	TotalConnections int                 `json:"total_connections_received"`
+	TotalCommands    int                 `json:"total_commands_processed"`
+	Keyspace         map[string]HealthDB `json:"keyspace"` // "db0" &c., only non-empty DBs
+}
+
+// HealthDB is a line of the keyspace section of INFO.
+type HealthDB struct {
+	Keys    int `json:"keys"`
+	Expires int `json:"expires"`
+	AvgTTL  int `json:"avg_ttl"` // in milliseconds
+}
+
+// StartHTTPHealth starts a small HTTP server on addr, such as "127.0.0.1:0",
+// for test environments where the orchestration probes the health of redis
+// via an HTTP sidecar. It returns the address it listens on. The URLs are:
+//
+//	/ready  200 while the miniredis runs, 503 when it's closed
+//	/stats  HealthStats, as JSON
+//
+// The HTTP server keeps running after Close(), so a probe can see that
+// miniredis is down, and it's still there after a Restart(). Stop it with
+// StopHTTPHealth().
+func (m *Miniredis) StartHTTPHealth(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", m.healthReady)
+	mux.HandleFunc("/stats", m.healthStats)
+	hs := &http.Server{Handler: mux}
+
+	m.Lock()
+	old := m.health
+	m.health = hs
+	m.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	go hs.Serve(l)
+	return l.Addr().String(), nil
+}
+
+// StopHTTPHealth stops the StartHTTPHealth() server, if any.
+func (m *Miniredis) StopHTTPHealth() {
+	m.Lock()
+	hs := m.health
+	m.health = nil
+	m.Unlock()
+	if hs != nil {
+		hs.Close()
+	}
+}
+
+func (m *Miniredis) healthReady(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	ready := m.srv != nil
+	m.Unlock()
+	if !ready {
+		http.Error(w, "miniredis is not running", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
+
+func (m *Miniredis) healthStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.HealthStats())
+}
+
+// HealthStats gives the same stats as the /stats URL of StartHTTPHealth().
+func (m *Miniredis) HealthStats() HealthStats {
+	m.Lock()
+	defer m.Unlock()
+
+	st := HealthStats{
+		RedisVersion: m.redisVersion(),
+		RedisMode:    "standalone",
+		Keyspace:     map[string]HealthDB{},
+	}
+	if m.cluster != nil {
+		st.RedisMode = "cluster"
+	}
+	if m.srv != nil {
+		st.Ready = true
+		st.ConnectedClients = m.srv.ClientsLen()
+		st.TotalConnections = m.srv.TotalConnections()
+		st.TotalCommands = m.srv.TotalCommands()
+	}
+	for id, db := range m.dbs {
+		if len(db.keys) == 0 {
+			continue
+		}
+		dbst := db.stats()
+		st.Keyspace[fmt.Sprintf("db%d", id)] = HealthDB{
+			Keys:    dbst.Keys,
+			Expires: dbst.Expires,
+			AvgTTL:  int(dbst.AvgTTL / time.Millisecond),
+		}
+	}
+	return st
+}
@@ -0,0 +1,59 @@
+package miniredis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTPHealth(t *testing.T) {
+	m := RunT(t)
+	addr, err := m.StartHTTPHealth("127.0.0.1:0")
+	ok(t, err)
+	defer m.StopHTTPHealth()
+
+	get := func(t *testing.T, path string) (int, string) {
+		t.Helper()
+		res, err := http.Get("http://" + addr + path)
+		ok(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		ok(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	code, body := get(t, "/ready")
+	equals(t, http.StatusOK, code)
+	equals(t, "OK\n", body)
+
+	m.Set("foo", "bar")
+	m.Set("baz", "bar")
+	m.SetTTL("baz", 10*time.Second)
+	m.DB(2).Set("foo", "bar")
+	code, body = get(t, "/stats")
+	equals(t, http.StatusOK, code)
+	var st HealthStats
+	ok(t, json.Unmarshal([]byte(body), &st))
+	equals(t, defaultVersion, st.RedisVersion)
+	equals(t, "standalone", st.RedisMode)
+	equals(t, true, st.Ready)
+	equals(t, map[string]HealthDB{
+		"db0": {Keys: 2, Expires: 1, AvgTTL: 10000},
+		"db2": {Keys: 1},
+	}, st.Keyspace)
+
+	m.Close()
+	code, _ = get(t, "/ready")
+	equals(t, http.StatusServiceUnavailable, code)
+	equals(t, false, m.HealthStats().Ready)
+
+	ok(t, m.Restart())
+	code, _ = get(t, "/ready")
+	equals(t, http.StatusOK, code)
+
+	m.StopHTTPHealth()
+	_, err = http.Get("http://" + addr + "/ready")
+	assert(t, err != nil, "stopped")
+}
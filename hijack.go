@@ -0,0 +1,72 @@
+package miniredis
+
+// Sending raw bytes as replies. See Miniredis.Hijack().
+
+import (
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// RawWriter sends bytes to a client as-is. See Miniredis.Hijack().
+type RawWriter interface {
+	// Write sends p to the client. It doesn't need to be valid RESP.
+	Write(p []byte) (int, error)
+	// Close closes the connection, once the handler returns.
+	Close()
+}
+
+// HijackFunc is a raw handler for a command, see Miniredis.Hijack(). args
+// doesn't include the command itself.
+type HijackFunc func(w RawWriter, args []string)
+
+// Hijack replaces the reply of a command with whatever the handler writes,
+// which can be truncated arrays, replies of the wrong type, or any other
+// garbage. This is for testing the error handling, and the connection
+// recovery, of client libraries. For example:
+//
+//	m.Hijack("GET", func(w miniredis.RawWriter, args []string) {
+//		w.Write([]byte("*2\r\n$3\r\nfoo\r\n")) // one element short
+//		w.Close()
+//	})
+//
+// The handler runs before anything else, such as AUTH checks, or MULTI
+// queueing, without any locks held, and the command itself doesn't run at
+// all. It works for commands which miniredis doesn't support, but not for
+// commands called from Lua scripts. A nil handler restores the normal
+// command.
+func (m *Miniredis) Hijack(cmd string, h HijackFunc) {
+	m.Lock()
+	defer m.Unlock()
+	cmd = strings.ToUpper(cmd)
+	if h == nil {
+		delete(m.hijacks, cmd)
+		return
+	}
+	m.hijacks[cmd] = h
+}
+
+// hijacked runs the Hijack() handler of the command, if there is one.
+func (m *Miniredis) hijacked(c *server.Peer, cmd string, args []string) bool {
+	m.Lock()
+	h, ok := m.hijacks[cmd]
+	m.Unlock()
+	if !ok {
+		return false
+	}
+	h(rawWriter{c}, args)
+	return true
+}
+
+type rawWriter struct {
+	c *server.Peer
+}
+
+func (w rawWriter) Write(p []byte) (int, error) {
+	w.c.WriteRaw(string(p))
+	return len(p), nil
+}
+
+func (w rawWriter) Close() {
+	w.c.Close()
+}
@@ -0,0 +1,86 @@
+package miniredis
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestHijack(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("foo", "bar")
+	var seen []string
+	s.Hijack("get", func(w RawWriter, args []string) {
+		seen = args
+		w.Write([]byte(":12\r\n"))
+	})
+	mustDo(t, c, "GET", "foo", proto.Int(12))
+	equals(t, []string{"foo"}, seen)
+	// other commands are fine
+	mustDo(t, c, "STRLEN", "foo", proto.Int(3))
+
+	t.Run("garbage", func(t *testing.T) {
+		s.Hijack("GET", func(w RawWriter, args []string) {
+			w.Write([]byte("*2\r\n$3\r\nfoo\r\n"))
+			w.Close()
+		})
+
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		_, err = raw.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"))
+		ok(t, err)
+		raw.SetReadDeadline(time.Now().Add(time.Second))
+		res, err := ioutil.ReadAll(raw)
+		ok(t, err)
+		equals(t, "*2\r\n$3\r\nfoo\r\n", string(res))
+
+		// the proto client sees a broken connection
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		_, err = c.Do("GET", "foo")
+		assert(t, err != nil, "error")
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		s.Hijack("NOSUCH", func(w RawWriter, args []string) {
+			w.Write([]byte("+fine\r\n"))
+		})
+		defer s.Hijack("NOSUCH", nil)
+		mustDo(t, c, "NOSUCH", "a", proto.Inline("fine"))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		s.Hijack("GET", nil)
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		s.Hijack("ECHO", func(w RawWriter, args []string) {
+			w.Write([]byte("$5\r\nraw!!\r\n"))
+		})
+		defer s.Hijack("ECHO", nil)
+
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		r := bufio.NewReader(raw)
+		_, err = raw.Write([]byte("*1\r\n$5\r\nMULTI\r\n*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n*1\r\n$4\r\nEXEC\r\n"))
+		ok(t, err)
+		raw.SetReadDeadline(time.Now().Add(time.Second))
+		res := make([]byte, len("+OK\r\n$5\r\nraw!!\r\n*0\r\n"))
+		_, err = io.ReadFull(r, res)
+		ok(t, err)
+		equals(t, "+OK\r\n$5\r\nraw!!\r\n*0\r\n", string(res))
+	})
+}
@@ -7,7 +7,11 @@ func TestCluster(t *testing.T) {
 	testCluster(t,
 		func(c *client) {
 			// c.DoLoosly("CLUSTER", "SLOTS")
-			c.DoLoosely("CLUSTER", "KEYSLOT", "{test}")
+			c.Do("CLUSTER", "KEYSLOT", "{test}")
+			c.Do("CLUSTER", "KEYSLOT", "foo{}{bar}")
+			c.Do("CLUSTER", "KEYSLOT", "foo{{bar}}zap")
+			c.Do("CLUSTER", "KEYSLOT", "foo{bar}{zap}")
+			c.Error("wrong number", "CLUSTER", "KEYSLOT")
 			c.DoLoosely("CLUSTER", "NODES")
 			c.Error("wrong number", "CLUSTER")
 		},
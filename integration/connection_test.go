@@ -210,3 +210,55 @@ func TestHello(t *testing.T) {
 		},
 	)
 }
+
+func TestClientTracking(t *testing.T) {
+	skip(t)
+	testRESP3Pair(t, func(c1, c2 *client) {
+		c1.Do("CLIENT", "TRACKING", "ON")
+		c1.Do("GET", "k")
+		c2.Do("SET", "k", "v")
+		c1.Do("PING") // the invalidation
+		c1.Receive()
+		c1.Do("GET", "k")
+		c1.Do("SET", "k", "v2")
+		c1.Receive() // its own invalidation
+		c1.Do("GET", "k")
+		c2.Do("GETEX", "k")
+		c2.Do("GETEX", "k", "EX", "10")
+		c1.Do("PING")
+		c1.Receive()
+		c1.Do("GET", "k")
+		c2.Do("FLUSHALL")
+		c1.Do("PING")
+		c1.Receive()
+		c1.Do("CLIENT", "TRACKING", "OFF")
+
+		c1.Do("CLIENT", "TRACKING", "ON", "NOLOOP")
+		c1.Do("GET", "k")
+		c1.Do("SET", "k", "v")
+		c2.Do("SET", "k", "v2")
+		c1.Do("PING")
+		c1.Do("CLIENT", "TRACKING", "OFF")
+
+		c1.Do("CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "a", "PREFIX", "b")
+		c2.Do("MSET", "a1", "v", "b1", "v", "c1", "v")
+		c1.Do("PING")
+		c1.Receive()
+		c1.Receive()
+		c1.Do("CLIENT", "GETREDIR")
+
+		c1.Error("overlaps", "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "ab")
+		c1.Error("overlaps", "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "c", "PREFIX", "cd")
+		c1.Error("BCAST mode", "CLIENT", "TRACKING", "ON")
+		c1.Error("CLIENT CACHING", "CLIENT", "CACHING", "YES")
+		c1.Do("CLIENT", "TRACKING", "OFF")
+		c1.Error("wrong number", "CLIENT", "TRACKING")
+		c1.Error("syntax", "CLIENT", "TRACKING", "ON", "FOO")
+		c1.Error("requires BCAST", "CLIENT", "TRACKING", "ON", "PREFIX", "a")
+		c1.Error("not compatible", "CLIENT", "TRACKING", "ON", "BCAST", "OPTIN")
+		c1.Error("both OPTIN and OPTOUT", "CLIENT", "TRACKING", "ON", "OPTIN", "OPTOUT")
+		c1.Error("does not exist", "CLIENT", "TRACKING", "ON", "REDIRECT", "12345")
+		c1.Error("tracking mode", "CLIENT", "CACHING", "YES")
+		c1.Do("CLIENT", "GETREDIR")
+	})
+}
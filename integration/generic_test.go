@@ -174,6 +174,8 @@ func TestScan(t *testing.T) {
 		c.Error("invalid cursor", "SCAN", "noint")
 		c.Error("not an integer", "SCAN", "0", "COUNT", "noint")
 		c.Error("syntax error", "SCAN", "0", "COUNT")
+		c.Error("syntax error", "SCAN", "0", "COUNT", "0")
+		c.Error("syntax error", "SCAN", "0", "COUNT", "-1")
 		c.Error("syntax error", "SCAN", "0", "MATCH")
 		c.Error("syntax error", "SCAN", "0", "garbage")
 		c.Error("syntax error", "SCAN", "0", "COUNT", "12", "MATCH", "foo", "garbage")
@@ -196,6 +198,13 @@ func TestFastForward(t *testing.T) {
 		c.Error("invalid expire", "SET", "key1", "value", "PX", "-100")
 		c.Error("invalid expire", "SET", "key2", "value", "EX", "-100")
 		c.Error("invalid expire", "SET", "key3", "value", "EX", "0")
+		c.Do("SET", "key4", "value")
+		c.Error("invalid expire", "EXPIRE", "key4", "9223372036854775807")
+		c.Error("invalid expire", "EXPIRE", "key4", "-9223372036854775807")
+		c.Error("invalid expire", "PEXPIRE", "key4", "9223372036854775807")
+		c.Error("invalid expire", "EXPIREAT", "key4", "9223372036854775807")
+		c.Do("EXPIRE", "key4", "922337203685477")
+		c.Do("PERSIST", "key4")
 		c.DoSorted("KEYS", "*")
 
 		c.Do("SET", "key4", "value")
@@ -446,3 +455,27 @@ func TestCopy(t *testing.T) {
 		})
 	})
 }
+
+func TestMissingKeyReplies(t *testing.T) {
+	skip(t)
+	missing := func(c *client) {
+		c.Do("XADD", "planets", "0-1", "name", "Mercury")
+		c.Do("XGROUP", "CREATE", "planets", "processing", "$")
+
+		c.Do("GET", "nosuch")
+		c.Do("LPOP", "nosuch")
+		c.Do("LPOP", "nosuch", "2")
+		c.Do("LPOS", "nosuch", "a")
+		c.Do("LPOS", "nosuch", "a", "COUNT", "0")
+		c.Do("SPOP", "nosuch", "2")
+		c.Do("SINTER", "nosuch")
+		c.Do("SUNION", "nosuch")
+		c.Do("SRANDMEMBER", "nosuch", "2")
+		c.Do("GEOPOS", "nosuch", "a")
+		c.Do("XREAD", "STREAMS", "nosuch", "0")
+		c.Do("XPENDING", "planets", "processing")
+		c.Do("XPENDING", "planets", "processing", "-", "+", "10")
+	}
+	testRaw(t, missing)
+	testRESP3(t, missing)
+}
@@ -176,6 +176,9 @@ func TestHashIncr(t *testing.T) {
 		c.Do("SET", "str", "value")
 		c.Error("wrong kind", "HINCRBYFLOAT", "str", "value", "12")
 		c.Do("HINCRBYFLOAT", "aap", "noot", "12")
+		c.Do("HSET", "aap", "noint", "foo")
+		c.Error("hash value is not a float", "HINCRBYFLOAT", "aap", "noint", "12")
+		c.Error("NaN or Infinity", "HINCRBYFLOAT", "aap", "noot", "inf")
 	})
 }
 
@@ -203,6 +206,7 @@ func TestHscan(t *testing.T) {
 		c.Error("wrong number", "HSCAN")
 		c.Error("wrong number", "HSCAN", "noint")
 		c.Error("not an integer", "HSCAN", "h", "0", "COUNT", "noint")
+		c.Error("syntax error", "HSCAN", "h", "0", "COUNT", "0")
 		c.Error("syntax error", "HSCAN", "h", "0", "COUNT")
 		c.Error("syntax error", "HSCAN", "h", "0", "MATCH")
 		c.Error("syntax error", "HSCAN", "h", "0", "garbage")
@@ -401,6 +401,20 @@ func TestScriptReplicate(t *testing.T) {
 	})
 }
 
+func TestScriptSetresp(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("HSET", "h", "f", "v")
+		c.Do("ZADD", "z", "1.5", "one")
+		c.Do("EVAL", `redis.setresp(3); return redis.call('HGETALL', KEYS[1])['map']['f']`, "1", "h")
+		c.Do("EVAL", `redis.setresp(3); return redis.call('HGETALL', KEYS[1])`, "1", "h")
+		c.Do("EVAL", `redis.setresp(3); return redis.call('ZSCORE', KEYS[1], 'one')`, "1", "z")
+		c.Do("EVAL", `redis.setresp(3); return redis.call('GET', 'nosuch') == nil`, "0")
+		c.Do("EVAL", `return {double=1.5}`, "0")
+		c.Error("RESP version must be 2 or 3", "EVAL", `redis.setresp(4)`, "0")
+	})
+}
+
 func TestScriptTx(t *testing.T) {
 	skip(t)
 	sha2 := "bfbf458525d6a0b19200bfd6db3af481156b367b" // keys[1], argv[1]
@@ -46,3 +46,21 @@ func TestServerTLS(t *testing.T) {
 		c.Do("GET", "foo")
 	})
 }
+
+func TestServerConfig(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("CONFIG", "SET", "timeout", "300")
+		c.Do("CONFIG", "GET", "timeout")
+		c.Do("CONFIG", "SET", "maxclients", "100", "timeout", "0")
+		c.Do("CONFIG", "GET", "maxclients")
+
+		c.Error("wrong number", "CONFIG")
+		c.Error("wrong number", "CONFIG", "GET")
+		c.Error("wrong number", "CONFIG", "SET", "timeout")
+		c.Error("Unknown option", "CONFIG", "SET", "nosuch", "1")
+		c.Error("couldn't be parsed into an integer", "CONFIG", "SET", "maxclients", "many")
+		c.Error("must be between 1 and 4294967295", "CONFIG", "SET", "maxclients", "0")
+		c.Error("must be between 0 and 2147483647", "CONFIG", "SET", "timeout", "-1")
+	})
+}
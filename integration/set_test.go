@@ -169,6 +169,7 @@ func TestSetSpop(t *testing.T) {
 			// failure cases
 			c.Error("out of range", "SPOP", "foo", "one")
 			c.Error("out of range", "SPOP", "foo", "-4")
+			c.Error("syntax error", "SPOP", "foo", "1", "2")
 		})
 	})
 }
@@ -186,6 +187,9 @@ func TestSetSrandmember(t *testing.T) {
 
 		c.Do("SRANDMEMBER", "s", "0")
 		c.Do("SPOP", "nosuch")
+		c.Do("SRANDMEMBER", "nosuch")
+		c.Do("SRANDMEMBER", "nosuch", "1")
+		c.Do("SRANDMEMBER", "nosuch", "-1")
 
 		// failure cases
 		c.Error("wrong number", "SRANDMEMBER")
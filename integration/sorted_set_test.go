@@ -28,6 +28,11 @@ func TestSortedSet(t *testing.T) {
 
 		c.Do("ZADD", "zi", "inf", "aap", "-inf", "noot", "+inf", "mies")
 		c.Do("ZRANK", "zi", "noot")
+		c.Error("not a valid float", "ZADD", "zi", "nan", "aap")
+		c.Do("ZINCRBY", "zi", "INF", "aap")
+		c.Error("NaN", "ZINCRBY", "zi", "-inf", "aap")
+		c.Error("NaN", "ZADD", "zi", "INCR", "-inf", "aap")
+		c.Do("ZSCORE", "zi", "aap")
 
 		// Double key
 		c.Do("ZADD", "zz", "1", "aap", "2", "aap")
@@ -160,6 +165,40 @@ func TestSortedSetAdd(t *testing.T) {
 		c.Error("ERR GT, LT, and/or NX options at the same time are not compatible", "ZADD", "z", "GT", "LT", "1", "score")
 	})
 
+	testRaw(t, func(c *client) {
+		// GT and LT only apply to existing members
+		c.Do("ZADD", "z", "GT", "-1", "a")
+		c.Do("ZADD", "z", "LT", "5", "b")
+		c.Do("ZADD", "z", "GT", "CH", "-2", "a", "6", "b")
+		c.Do("ZADD", "z", "LT", "CH", "-2", "a", "6", "b")
+		c.Do("ZADD", "z", "XX", "GT", "CH", "20", "a", "100", "nosuch")
+		c.Do("ZRANGE", "z", "0", "-1", "WITHSCORES")
+
+		// duplicate members
+		c.Do("ZADD", "z", "GT", "CH", "30", "a", "3", "a")
+		c.Do("ZADD", "z", "CH", "1", "c", "2", "c")
+		c.Do("ZADD", "z", "1", "d", "2", "d")
+		c.Do("ZRANGE", "z", "0", "-1", "WITHSCORES")
+
+		c.Do("ZADD", "z", "GT", "INCR", "1", "a")
+		c.Do("ZADD", "z", "GT", "INCR", "-1", "a")
+		c.Do("ZADD", "z", "LT", "INCR", "-1", "a")
+		c.Do("ZADD", "z", "LT", "INCR", "0", "a")
+		c.Do("ZADD", "z", "GT", "INCR", "-7", "new")
+		c.Do("ZADD", "z", "XX", "INCR", "-7", "nosuch")
+
+		c.Do("ZADD", "z", "inf", "inf")
+		c.Error("NaN", "ZADD", "z", "INCR", "-inf", "inf")
+		c.Do("ZADD", "z", "NX", "INCR", "-inf", "inf")
+		c.Do("ZADD", "newkey", "XX", "1", "a")
+		c.Do("EXISTS", "newkey")
+
+		c.Error("not compatible", "ZADD", "z", "NX", "XX", "nofloat", "a")
+		c.Error("INCR option", "ZADD", "z", "INCR", "1", "a", "1", "a")
+		c.Error("GT, LT", "ZADD", "z", "GT", "NX", "1", "a")
+		c.Error("not a valid float", "ZADD", "z", "GT", "nofloat", "a")
+	})
+
 	testRESP3(t, func(c *client) {
 		c.Do("ZADD", "z", "INCR", "1", "aap")
 	})
@@ -230,6 +269,10 @@ func TestSortedSetRange(t *testing.T) {
 			c.Do("ZRANGE", "zs", "-", "+", "BYLEX", "LIMIT", "1", "-1")
 			c.Do("ZRANGE", "zs", "-", "+", "BYLEX", "LIMIT", "1", "-1", "REV")
 			c.Error("syntax error", "ZRANGE", "z", "[be", "[ma", "BYSCORE", "BYLEX")
+			c.Error("syntax error", "ZRANGE", "z", "[be", "[ma", "BYLEX", "BYLEX")
+			c.Error("WITHSCORES not supported", "ZRANGE", "zs", "-", "+", "BYLEX", "WITHSCORES")
+			c.Do("ZRANGE", "zs", "+", "-", "bylex", "rev", "limit", "0", "2")
+			c.Do("ZRANGE", "z", "+inf", "(1", "REV", "BYSCORE", "WITHSCORES")
 			c.Error("range item", "ZRANGE", "z", "be", "(ma", "BYLEX")
 			c.Error("range item", "ZRANGE", "z", "(be", "ma", "BYLEX")
 		})
@@ -256,6 +299,49 @@ func TestSortedSetRange(t *testing.T) {
 	})
 }
 
+func TestSortedSetRangestore(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("ZADD", "z",
+			"1", "aap",
+			"2", "noot",
+			"3", "mies",
+			"2", "nootagain",
+			"3", "miesagain",
+			"+Inf", "the stars",
+		)
+		c.Do("ZRANGESTORE", "dst", "z", "0", "-1")
+		c.Do("ZRANGE", "dst", "0", "-1", "WITHSCORES")
+		c.Do("ZRANGESTORE", "dst", "z", "1", "2", "REV")
+		c.Do("ZRANGE", "dst", "0", "-1", "WITHSCORES")
+		c.Do("ZRANGESTORE", "dst", "z", "(1", "+inf", "BYSCORE", "LIMIT", "1", "2")
+		c.Do("ZRANGE", "dst", "0", "-1", "WITHSCORES")
+		c.Do("ZRANGESTORE", "dst", "z", "+inf", "2", "BYSCORE", "REV")
+		c.Do("ZRANGE", "dst", "0", "-1", "WITHSCORES")
+		c.Do("ZRANGESTORE", "dst", "z", "[b", "(n", "BYLEX")
+		c.Do("ZRANGESTORE", "dst", "z", "10", "20")
+		c.Do("EXISTS", "dst")
+		c.Do("ZRANGESTORE", "dst", "nosuch", "0", "-1")
+		c.Do("ZRANGESTORE", "z", "z", "0", "0")
+		c.Do("ZRANGE", "z", "0", "-1", "WITHSCORES")
+
+		// failure cases
+		c.Error("wrong number", "ZRANGESTORE")
+		c.Error("wrong number", "ZRANGESTORE", "dst", "z", "0")
+		c.Error("syntax error", "ZRANGESTORE", "dst", "z", "0", "1", "WITHSCORES")
+		c.Error("syntax error", "ZRANGESTORE", "dst", "z", "0", "1", "LIMIT", "1")
+		c.Error("syntax error", "ZRANGESTORE", "dst", "z", "0", "1", "BYSCORE", "BYLEX")
+		c.Error("LIMIT", "ZRANGESTORE", "dst", "z", "0", "1", "LIMIT", "1", "2")
+		c.Error("not an integer", "ZRANGESTORE", "dst", "z", "a", "1")
+		c.Error("not a float", "ZRANGESTORE", "dst", "z", "a", "1", "BYSCORE")
+		c.Error("not valid", "ZRANGESTORE", "dst", "z", "a", "1", "BYLEX")
+		c.Do("SET", "str", "I am a string")
+		c.Error("wrong kind", "ZRANGESTORE", "dst", "str", "0", "1")
+		c.Do("ZRANGESTORE", "str", "z", "0", "0")
+		c.Do("TYPE", "str")
+	})
+}
+
 func TestSortedSetRevRange(t *testing.T) {
 	skip(t)
 	testRaw(t, func(c *client) {
@@ -365,6 +451,12 @@ func TestSortedSetRemRangeByRank(t *testing.T) {
 		c.Do("EXISTS", "z")
 
 		c.Do("ZREMRANGEBYRANK", "nosuch", "-2", "-1")
+		c.Do("ZADD", "r", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+		c.Do("ZREMRANGEBYRANK", "r", "3", "1")
+		c.Do("ZREMRANGEBYRANK", "r", "-1", "-2")
+		c.Do("ZREMRANGEBYRANK", "r", "-100", "1")
+		c.Do("ZREMRANGEBYRANK", "r", "1", "9223372036854775807")
+		c.Do("ZRANGE", "r", "0", "-1")
 
 		// failure cases
 		c.Error("wrong number", "ZREMRANGEBYRANK")
@@ -399,6 +491,12 @@ func TestSortedSetRemRangeByScore(t *testing.T) {
 		c.Do("EXISTS", "z")
 
 		c.Do("ZREMRANGEBYSCORE", "nosuch", "-inf", "inf")
+		c.Do("ZADD", "inf", "-inf", "minf", "1", "one", "2", "two", "+inf", "pinf")
+		c.Do("ZREMRANGEBYSCORE", "inf", "(-inf", "(+inf")
+		c.Do("ZREMRANGEBYSCORE", "inf", "-inf", "-inf")
+		c.Do("ZRANGE", "inf", "0", "-1", "WITHSCORES")
+		c.Do("ZREMRANGEBYSCORE", "inf", "inf", "inf")
+		c.Do("EXISTS", "inf")
 
 		// failure cases
 		c.Error("wrong number", "ZREMRANGEBYSCORE")
@@ -437,6 +535,26 @@ func TestSortedSetScore(t *testing.T) {
 	})
 }
 
+func TestSortedSetMscore(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("ZADD", "z",
+			"1", "aap",
+			"2", "noot",
+			"+Inf", "the stars",
+		)
+		c.Do("ZMSCORE", "z", "aap", "nosuch", "the stars")
+		c.Do("ZMSCORE", "z", "aap", "aap")
+		c.Do("ZMSCORE", "nosuch", "aap", "noot")
+
+		// failure cases
+		c.Error("wrong number", "ZMSCORE")
+		c.Error("wrong number", "ZMSCORE", "z")
+		c.Do("SET", "str", "I am a string")
+		c.Error("wrong kind", "ZMSCORE", "str", "member")
+	})
+}
+
 func TestSortedSetRangeByScore(t *testing.T) {
 	skip(t)
 	testRaw(t, func(c *client) {
@@ -467,6 +585,18 @@ func TestSortedSetRangeByScore(t *testing.T) {
 		c.Do("ZRANGEBYSCORE", "z", "(1", "(3")
 		c.Do("ZRANGEBYSCORE", "z", "1", "(3")
 		c.Do("ZRANGEBYSCORE", "z", "1", "(3", "LIMIT", "0", "2")
+		c.Do("ZRANGEBYSCORE", "z", "2", "(+inf")
+		c.Do("ZRANGEBYSCORE", "z", "(+inf", "+inf")
+		c.Do("ZRANGEBYSCORE", "z", "(-inf", "(2")
+		c.Do("ZREVRANGEBYSCORE", "z", "(+inf", "(-inf")
+		c.Do("ZCOUNT", "z", "(-inf", "(+inf")
+		c.Do("ZRANGEBYSCORE", "z", "2", "INF")
+		c.Do("ZRANGEBYSCORE", "z", "(-Inf", "1e400")
+		c.Do("ZCOUNT", "z", "-1e400", "(+iNf")
+		c.Error("not a float", "ZRANGEBYSCORE", "z", "nan", "2")
+		c.Error("not a float", "ZCOUNT", "z", "1", "(NaN")
+		c.Error("not a float", "ZRANGEBYSCORE", "z", "", "2")
+		c.Error("not a float", "ZCOUNT", "z", "1", "")
 		c.Do("ZRANGEBYSCORE", "foo", "2", "3", "LIMIT", "1", "2", "WITHSCORES")
 		c.Do("ZCOUNT", "z", "-inf", "inf")
 		c.Do("ZCOUNT", "z", "0", "3")
@@ -522,6 +652,25 @@ func TestSortedSetRangeByScore(t *testing.T) {
 	})
 }
 
+func TestSortedSetLimit(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("ZADD", "z", "0", "a", "1", "b", "2", "c", "3", "d", "4", "e")
+		for _, limit := range [][2]string{
+			{"0", "-1"}, {"0", "-100"}, {"2", "-1"}, {"4", "-1"}, {"5", "-1"},
+			{"9223372036854775807", "1"}, {"0", "0"}, {"0", "2"}, {"3", "2"},
+			{"3", "9223372036854775807"}, {"-1", "2"}, {"-1", "-1"},
+		} {
+			c.Do("ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", limit[0], limit[1])
+			c.Do("ZREVRANGEBYSCORE", "z", "+inf", "-inf", "LIMIT", limit[0], limit[1])
+			c.Do("ZRANGEBYLEX", "z", "-", "+", "LIMIT", limit[0], limit[1])
+			c.Do("ZREVRANGEBYLEX", "z", "+", "-", "LIMIT", limit[0], limit[1])
+			c.Do("ZRANGE", "z", "-inf", "+inf", "BYSCORE", "LIMIT", limit[0], limit[1])
+			c.Do("ZRANGE", "z", "+", "-", "BYLEX", "REV", "LIMIT", limit[0], limit[1])
+		}
+	})
+}
+
 func TestSortedSetRangeByLex(t *testing.T) {
 	skip(t)
 	testRaw(t, func(c *client) {
@@ -571,6 +720,17 @@ func TestSortedSetRangeByLex(t *testing.T) {
 		c.Do("ZREVRANGEBYLEX", "z", "+", "(z")
 		c.Do("ZLEXCOUNT", "z", "(z", "+")
 
+		// different scores
+		c.Do("ZADD", "zs", "1", "b", "2", "a", "3", "c")
+		c.Do("ZRANGEBYLEX", "zs", "-", "+")
+		c.Do("ZRANGEBYLEX", "zs", "[a", "[b")
+		c.Do("ZRANGEBYLEX", "zs", "-", "[a")
+		c.Do("ZRANGEBYLEX", "zs", "[c", "+")
+		c.Do("ZREVRANGEBYLEX", "zs", "+", "-")
+		c.Do("ZREVRANGEBYLEX", "zs", "[b", "-")
+		c.Do("ZLEXCOUNT", "zs", "[a", "[b")
+		c.Do("ZRANGEBYLEX", "zs", "[c", "[a")
+
 		// failure cases
 		c.Error("wrong number", "ZRANGEBYLEX")
 		c.Error("wrong number", "ZREVRANGEBYLEX")
@@ -652,6 +812,7 @@ func TestZscan(t *testing.T) {
 		c.Error("wrong number", "ZSCAN", "noint")
 		c.Error("not an integer", "ZSCAN", "h", "0", "COUNT", "noint")
 		c.Error("syntax error", "ZSCAN", "h", "0", "COUNT")
+		c.Error("syntax error", "ZSCAN", "h", "0", "COUNT", "0")
 		c.Error("syntax error", "ZSCAN", "h", "0", "MATCH")
 		c.Error("syntax error", "ZSCAN", "h", "0", "garbage")
 		c.Error("syntax error", "ZSCAN", "h", "0", "COUNT", "12", "MATCH", "foo", "garbage")
@@ -698,6 +859,7 @@ func TestZunion(t *testing.T) {
 		c.Error("syntax error", "ZUNION", "2", "f1", "f2", "WEIGHTS", "1")
 		c.Error("syntax error", "ZUNION", "2", "f1", "f2", "WEIGHTS", "1", "2", "3")
 		c.Error("not a float", "ZUNION", "2", "f1", "f2", "WEIGHTS", "f", "2")
+		c.Error("not a float", "ZUNION", "2", "f1", "f2", "WEIGHTS", "nan", "2")
 		c.Error("syntax error", "ZUNION", "2", "f1", "f2", "AGGREGATE", "foo")
 		c.Do("SET", "str", "1")
 		c.Error("wrong kind", "ZUNION", "1", "str")
@@ -799,6 +961,14 @@ func TestZinterstore(t *testing.T) {
 		c.Do("ZADD", "q1", "2", "f1")
 		c.Do("SADD", "q2", "f1")
 		c.Do("ZINTERSTORE", "dest", "2", "q1", "q2")
+
+		// inf + -inf, and inf * 0, are 0
+		c.Do("ZADD", "inf", "inf", "a")
+		c.Do("ZADD", "-inf", "-inf", "a")
+		c.Do("ZINTERSTORE", "nan", "2", "inf", "-inf")
+		c.Do("ZRANGE", "nan", "0", "-1", "WITHSCORES")
+		c.Do("ZINTERSTORE", "nan", "1", "inf", "WEIGHTS", "0")
+		c.Do("ZRANGE", "nan", "0", "-1", "WITHSCORES")
 		c.Do("ZRANGE", "dest", "0", "-1", "withscores")
 
 		// Error cases
@@ -819,6 +989,38 @@ func TestZinterstore(t *testing.T) {
 	})
 }
 
+func TestZintercard(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("ZADD", "h1", "1.0", "key1")
+		c.Do("ZADD", "h1", "2.0", "key2")
+		c.Do("ZADD", "h1", "3.0", "key3")
+		c.Do("ZADD", "h2", "1.0", "key1")
+		c.Do("ZADD", "h2", "4.0", "key2")
+		c.Do("SADD", "s1", "key1", "key3")
+
+		c.Do("ZINTERCARD", "2", "h1", "h2")
+		c.Do("ZINTERCARD", "2", "h1", "s1")
+		c.Do("ZINTERCARD", "3", "h1", "h2", "s1")
+		c.Do("ZINTERCARD", "2", "h1", "nosuch")
+		c.Do("ZINTERCARD", "2", "h1", "h2", "LIMIT", "1")
+		c.Do("ZINTERCARD", "2", "h1", "h2", "LIMIT", "0")
+		c.Do("ZINTERCARD", "2", "h1", "h2", "LIMIT", "100")
+
+		// Error cases
+		c.Error("wrong number", "ZINTERCARD")
+		c.Error("wrong number", "ZINTERCARD", "1")
+		c.Error("not an integer", "ZINTERCARD", "foo", "h1")
+		c.Error("greater than 0", "ZINTERCARD", "0", "h1")
+		c.Error("greater than number", "ZINTERCARD", "3", "h1", "h2")
+		c.Error("negative", "ZINTERCARD", "1", "h1", "LIMIT", "-1")
+		c.Error("syntax error", "ZINTERCARD", "1", "h1", "LIMIT")
+		c.Error("syntax error", "ZINTERCARD", "1", "h1", "foo")
+		c.Do("SET", "str", "1")
+		c.Error("wrong kind", "ZINTERCARD", "2", "h1", "str")
+	})
+}
+
 func TestZpopminmax(t *testing.T) {
 	skip(t)
 	testRaw(t, func(c *client) {
@@ -889,5 +1091,8 @@ func TestZrandmember(t *testing.T) {
 		c.Do("SET", "str", "1")
 		c.Error("wrong kind", "ZRANDMEMBER", "str")
 		c.Error("not an integer", "ZRANDMEMBER", "q", "two")
+		c.Error("syntax error", "ZRANDMEMBER", "q", "2", "foo")
+		c.Error("syntax error", "ZRANDMEMBER", "q", "2", "WITHSCORES", "foo")
+		c.Error("out of range", "ZRANDMEMBER", "q", "-9223372036854775807", "WITHSCORES")
 	})
 }
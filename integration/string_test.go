@@ -50,6 +50,10 @@ func TestString(t *testing.T) {
 		c.Error("syntax error", "SET", "both", "bar", "PXAT", "3345678901000", "EXAT", "2345678901")
 		c.Error("invalid expire", "SET", "foo", "bar", "EXAT", "-100")
 		c.Error("invalid expire", "SET", "foo", "bar", "PXAT", "-100")
+		c.Error("invalid expire", "SET", "foo", "bar", "EX", "9223372036854775")
+		c.Error("invalid expire", "SET", "foo", "bar", "PX", "9223372036854775807")
+		c.Error("invalid expire", "SETEX", "foo", "9223372036854775807", "bar")
+		c.Error("invalid expire", "PSETEX", "foo", "9223372036854775807", "bar")
 		c.Error("syntax error", "SET", "both", "bar", "PX", "6", "EX", "6")
 		c.Error("syntax error", "SET", "both", "bar", "PX", "6", "EX", "0")
 		c.Error("syntax error", "SET", "both", "bar", "PX", "6", "PXAT", "2345678901")
@@ -98,6 +102,9 @@ func TestStringGetex(t *testing.T) {
 		c.Error("syntax error", "GETEX", "foo", "EX", "10", "PERSIST")
 		c.Error("syntax error", "GETEX", "foo", "EX", "10", "PX", "10")
 		c.Error("not an integer", "GETEX", "foo", "EX", "ten")
+		c.Error("invalid expire", "GETEX", "foo", "EX", "0")
+		c.Error("invalid expire", "GETEX", "foo", "EX", "9223372036854775")
+		c.Error("invalid expire", "GETEX", "foo", "PX", "9223372036854775807")
 
 		// Wrong type
 		c.Do("HSET", "hash", "key", "value")
@@ -366,6 +373,10 @@ func TestIncrAndFriends(t *testing.T) {
 		c.Do("INCRBYFLOAT", "whole", "300")
 		c.Do("GET", "whole")
 		c.Do("INCRBYFLOAT", "big", "12345e10")
+		c.Do("INCRBYFLOAT", "tenth", "0.1")
+		c.Do("INCRBYFLOAT", "tenth", "0.2")
+		c.Do("INCRBYFLOAT", "tenth", "-0.3")
+		c.Error("NaN or Infinity", "INCRBYFLOAT", "tenth", "inf")
 		c.Do("GET", "big")
 
 		// Floats are not ints.
@@ -40,6 +40,17 @@ func TestTx(t *testing.T) {
 		c.Error("EXECABORT", "EXEC")
 	})
 
+	// Unknown commands and syntax errors in the MULTI sequence
+	testRaw(t, func(c *client) {
+		c.Do("MULTI")
+		c.Error("unknown command", "NOSUCHCOMMAND")
+		c.Error("EXECABORT", "EXEC")
+
+		c.Do("MULTI")
+		c.Error("syntax error", "ZRANGE", "z", "0", "1", "LIMIT")
+		c.Error("EXECABORT", "EXEC")
+	})
+
 	// Simple WATCH
 	testRaw(t, func(c *client) {
 		c.Do("SET", "foo", "bar")
@@ -0,0 +1,337 @@
+// Command gencommands makes the command tables and the arity tests of
+// miniredis from the commands.json of redis, for all commands the README
+// lists as implemented.
+//
+// Get commands.json from https://github.com/redis/docs (or make it with
+// utils/generate-commands-json.py in the redis repo), and run:
+//
+//	go run ./internal/gencommands -json commands.json
+//
+// from the root of the repo. That writes command_spec_gen_test.go, which checks
+// that the command table of miniredis has the arity, the write flag, and the
+// key positions redis has, and integration/arity_gen_test.go, which checks
+// that miniredis and redis agree on the arity of every command.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// command is an entry of commands.json. Only the fields we need.
+type command struct {
+	Arity        int       `json:"arity"`
+	Container    string    `json:"container"`
+	CommandFlags []string  `json:"command_flags"`
+	KeySpecs     []keySpec `json:"key_specs"`
+}
+
+type keySpec struct {
+	BeginSearch struct {
+		Index *struct {
+			Pos int `json:"pos"`
+		} `json:"index"`
+		Keyword *struct {
+			Keyword   string `json:"keyword"`
+			StartFrom int    `json:"startfrom"`
+		} `json:"keyword"`
+	} `json:"begin_search"`
+	FindKeys struct {
+		Range *struct {
+			LastKey int `json:"lastkey"`
+			Step    int `json:"step"`
+			Limit   int `json:"limit"`
+		} `json:"range"`
+		Keynum *struct {
+			KeynumIdx int `json:"keynumidx"`
+			FirstKey  int `json:"firstkey"`
+			Step      int `json:"step"`
+		} `json:"keynum"`
+	} `json:"find_keys"`
+}
+
+// spec is what ends up in the commandSpec table of the tests.
+type spec struct {
+	name     string // lowercase
+	arity    int
+	flags    []string
+	firstKey int
+	lastKey  int
+	keyStep  int
+}
+
+func main() {
+	var (
+		jsonFile   = flag.String("json", "commands.json", "commands.json of redis")
+		readmeFile = flag.String("readme", "README.md", "README with the implemented commands")
+		specsFile  = flag.String("specs", "command_spec_gen_test.go", "generated command table tests")
+		testsFile  = flag.String("tests", "integration/arity_gen_test.go", "generated arity tests")
+	)
+	flag.Parse()
+
+	if err := run(*jsonFile, *readmeFile, *specsFile, *testsFile); err != nil {
+		fmt.Fprintf(os.Stderr, "gencommands: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(jsonFile, readmeFile, specsFile, testsFile string) error {
+	raw, err := ioutil.ReadFile(jsonFile)
+	if err != nil {
+		return err
+	}
+	commands, err := parseCommands(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %s", jsonFile, err)
+	}
+
+	readme, err := os.Open(readmeFile)
+	if err != nil {
+		return err
+	}
+	defer readme.Close()
+	implemented, err := implementedCommands(readme)
+	if err != nil {
+		return fmt.Errorf("%s: %s", readmeFile, err)
+	}
+
+	var specs []spec
+	for _, name := range implemented {
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "gencommands: %s is not in %s, skipped\n", name, jsonFile)
+			continue
+		}
+		specs = append(specs, makeSpec(name, cmd))
+	}
+
+	src, err := specsSource(specs)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(specsFile, src, 0644); err != nil {
+		return err
+	}
+	src, err = testsSource(specs, containers(commands))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(testsFile, src, 0644)
+}
+
+// parseCommands reads commands.json, with the names in upper case.
+func parseCommands(raw []byte) (map[string]command, error) {
+	var cmds map[string]command
+	if err := json.Unmarshal(raw, &cmds); err != nil {
+		return nil, err
+	}
+	res := map[string]command{}
+	for name, c := range cmds {
+		if c.Arity == 0 {
+			return nil, fmt.Errorf("no arity for %s", name)
+		}
+		res[strings.ToUpper(name)] = c
+	}
+	return res, nil
+}
+
+// containers are the commands which have subcommands, such as CLIENT.
+func containers(cmds map[string]command) map[string]bool {
+	res := map[string]bool{}
+	for name, c := range cmds {
+		if c.Container != "" {
+			res[strings.ToUpper(c.Container)] = true
+		}
+		if i := strings.IndexByte(name, ' '); i > 0 {
+			res[name[:i]] = true
+		}
+	}
+	return res
+}
+
+var (
+	readmeCommand = regexp.MustCompile(`^   - ([A-Z][A-Z0-9_]*)`)
+	readmeSection = regexp.MustCompile(`^## `)
+)
+
+// implementedCommands reads the "## Commands" section of the README, and
+// gives all listed commands, sorted. For subcommands, such as "CLIENT KILL",
+// that's the command.
+func implementedCommands(r io.Reader) ([]string, error) {
+	var (
+		seen = map[string]bool{}
+		in   bool
+		res  []string
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if readmeSection.MatchString(line) {
+			in = line == "## Commands"
+			continue
+		}
+		if !in {
+			continue
+		}
+		if m := readmeCommand.FindStringSubmatch(line); m != nil && !seen[m[1]] {
+			seen[m[1]] = true
+			res = append(res, m[1])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no commands found")
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// makeSpec gets the arity, flags, and key positions, the way the old style
+// COMMAND reply has them. Commands whose keys can't be given as a single
+// range get the "movablekeys" flag, and no positions.
+func makeSpec(name string, c command) spec {
+	s := spec{
+		name:  strings.ToLower(name),
+		arity: c.Arity,
+	}
+	for _, f := range c.CommandFlags {
+		s.flags = append(s.flags, strings.ToLower(f))
+	}
+
+	movable := false
+	for i, ks := range c.KeySpecs {
+		if ks.BeginSearch.Index == nil || ks.FindKeys.Range == nil {
+			movable = true
+			break
+		}
+		pos, rng := ks.BeginSearch.Index.Pos, ks.FindKeys.Range
+		last := pos + rng.LastKey
+		if rng.LastKey < 0 {
+			last = rng.LastKey
+		}
+		if i == 0 {
+			s.firstKey, s.lastKey, s.keyStep = pos, last, rng.Step
+			continue
+		}
+		// a spec right after the previous one (SMOVE, LMOVE, &c.) extends it
+		if s.lastKey < 0 || rng.Step != s.keyStep || pos != s.lastKey+s.keyStep {
+			movable = true
+			break
+		}
+		s.lastKey = last
+	}
+	if movable {
+		s.firstKey, s.lastKey, s.keyStep = 0, 0, 0
+		s.flags = append(s.flags, "movablekeys")
+	}
+	return s
+}
+
+func specsSource(specs []spec) ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by gencommands from commands.json; DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "package miniredis\n\n")
+	fmt.Fprintf(b, "import \"testing\"\n\n")
+	fmt.Fprintf(b, "func TestGeneratedCommandSpecs(t *testing.T) {\n")
+	fmt.Fprintf(b, "specs := commandSpecs()\n")
+	fmt.Fprintf(b, "for _, want := range []commandSpec{\n")
+	for _, s := range specs {
+		flags := "nil"
+		if len(s.flags) > 0 {
+			flags = fmt.Sprintf("[]string{%s}", quoted(s.flags))
+		}
+		fmt.Fprintf(b, "{%q, %d, %s, %d, %d, %d},\n", s.name, s.arity, flags, s.firstKey, s.lastKey, s.keyStep)
+	}
+	fmt.Fprintf(b, "} {\n")
+	b.WriteString(`have, ok := specs[want.name]
+	if !ok {
+		t.Errorf("%s: not in the command table", want.name)
+		continue
+	}
+	if have.arity != want.arity {
+		t.Errorf("%s: arity %d, redis has %d", want.name, have.arity, want.arity)
+	}
+	if have.hasFlag("write") != want.hasFlag("write") {
+		t.Errorf("%s: write flag %t, redis has %t", want.name, have.hasFlag("write"), want.hasFlag("write"))
+	}
+	if !want.hasFlag("movablekeys") && (have.firstKey != want.firstKey || have.lastKey != want.lastKey || have.keyStep != want.keyStep) {
+		t.Errorf("%s: keys %d %d %d, redis has %d %d %d", want.name, have.firstKey, have.lastKey, have.keyStep, want.firstKey, want.lastKey, want.keyStep)
+	}
+}
+}
+`)
+	return format.Source(b.Bytes())
+}
+
+func testsSource(specs []spec, containers map[string]bool) ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by gencommands from commands.json; DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "package main\n\n")
+	fmt.Fprintf(b, "import \"testing\"\n\n")
+	fmt.Fprintf(b, "func TestGeneratedArity(t *testing.T) {\n")
+	fmt.Fprintf(b, "skip(t)\n")
+	fmt.Fprintf(b, "testRaw(t, func(c *client) {\n")
+	for _, s := range specs {
+		name := strings.ToUpper(s.name)
+		if containers[name] {
+			// the arity is checked per subcommand
+			continue
+		}
+		for _, args := range arityChecks(s.arity) {
+			fmt.Fprintf(b, "c.Error(\"wrong number\", %q", name)
+			for _, a := range args {
+				fmt.Fprintf(b, ", %q", a)
+			}
+			fmt.Fprintf(b, ")\n")
+		}
+	}
+	fmt.Fprintf(b, "})\n}\n")
+	return format.Source(b.Bytes())
+}
+
+// arityChecks gives argument lists which have the wrong number of arguments:
+// one too few, and, for a fixed arity, one too many. The arity counts the
+// command itself.
+func arityChecks(arity int) [][]string {
+	var res [][]string
+	n := arity
+	if n < 0 {
+		n = -n
+	}
+	if n >= 2 {
+		res = append(res, args(n-2))
+	}
+	if arity > 0 {
+		res = append(res, args(arity))
+	}
+	return res
+}
+
+func args(n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = "k"
+	}
+	return res
+}
+
+func quoted(ss []string) string {
+	var qs []string
+	for _, s := range ss {
+		qs = append(qs, fmt.Sprintf("%q", s))
+	}
+	return strings.Join(qs, ", ")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gencommands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	specs, tests := filepath.Join(dir, "specs_test.go"), filepath.Join(dir, "tests.go")
+	if err := run("testdata/commands.json", "testdata/README.md", specs, tests); err != nil {
+		t.Fatal(err)
+	}
+	for file, golden := range map[string]string{
+		specs: "testdata/command_spec_gen_test.go.golden",
+		tests: "testdata/arity_gen_test.go.golden",
+	} {
+		have, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(have) != string(want) {
+			t.Errorf("%s: have:\n%s\nwant:\n%s", golden, have, want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if err := run("testdata/nosuch.json", "testdata/README.md", "", ""); err == nil {
+		t.Error("expected an error")
+	}
+	if err := run("testdata/commands.json", "testdata/commands.json", "", ""); err == nil {
+		t.Error("expected an error for a README without commands")
+	}
+}
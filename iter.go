@@ -0,0 +1,107 @@
+package miniredis
+
+// Iterators over big keys, which don't copy the key. See Miniredis.ZIter().
+//
+// The iterators keep miniredis locked while they run, so the callback must not
+// call any methods on the Miniredis. Iteration stops when the callback returns
+// false.
+
+// ZIter calls f for every member of a sorted set. The order is not defined.
+func (m *Miniredis) ZIter(k string, f func(member string, score float64) bool) error {
+	return m.selected().ZIter(k, f)
+}
+
+// ZIter calls f for every member of a sorted set. The order is not defined.
+func (db *RedisDB) ZIter(k string, f func(member string, score float64) bool) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	if err := db.iterCheck(k, "zset"); err != nil {
+		return err
+	}
+	for member, score := range db.sortedsetKeys[k] {
+		if !f(member, score) {
+			break
+		}
+	}
+	return nil
+}
+
+// HIter calls f for every field of a hash. The order is not defined.
+func (m *Miniredis) HIter(k string, f func(field, value string) bool) error {
+	return m.selected().HIter(k, f)
+}
+
+// HIter calls f for every field of a hash. The order is not defined.
+func (db *RedisDB) HIter(k string, f func(field, value string) bool) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	if err := db.iterCheck(k, "hash"); err != nil {
+		return err
+	}
+	for field, value := range db.hashKeys[k] {
+		if !f(field, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// SIter calls f for every member of a set. The order is not defined.
+func (m *Miniredis) SIter(k string, f func(member string) bool) error {
+	return m.selected().SIter(k, f)
+}
+
+// SIter calls f for every member of a set. The order is not defined.
+func (db *RedisDB) SIter(k string, f func(member string) bool) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	if err := db.iterCheck(k, "set"); err != nil {
+		return err
+	}
+	for member := range db.setKeys[k] {
+		if !f(member) {
+			break
+		}
+	}
+	return nil
+}
+
+// XIter calls f for every entry of a stream, oldest first. The entry must not
+// be changed.
+func (m *Miniredis) XIter(k string, f func(e StreamEntry) bool) error {
+	return m.selected().XIter(k, f)
+}
+
+// XIter calls f for every entry of a stream, oldest first. The entry must not
+// be changed.
+func (db *RedisDB) XIter(k string, f func(e StreamEntry) bool) error {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	if err := db.iterCheck(k, "stream"); err != nil {
+		return err
+	}
+	s := db.streamKeys[k]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if !f(e) {
+			break
+		}
+	}
+	return nil
+}
+
+// iterCheck gives ErrKeyNotFound or ErrWrongType, if needed. No locks!
+func (db *RedisDB) iterCheck(k, t string) error {
+	if !db.exists(k) {
+		return ErrKeyNotFound
+	}
+	if db.t(k) != t {
+		return ErrWrongType
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package miniredis
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	s := RunT(t)
+
+	t.Run("zset", func(t *testing.T) {
+		s.ZAdd("zset", 1, "one")
+		s.ZAdd("zset", 2, "two")
+		sum := 0.0
+		var members []string
+		ok(t, s.ZIter("zset", func(member string, score float64) bool {
+			members = append(members, member)
+			sum += score
+			return true
+		}))
+		sort.Strings(members)
+		equals(t, []string{"one", "two"}, members)
+		equals(t, 3.0, sum)
+
+		n := 0
+		ok(t, s.ZIter("zset", func(string, float64) bool {
+			n++
+			return false
+		}))
+		equals(t, 1, n)
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		s.HSet("hash", "f1", "v1", "f2", "v2")
+		got := map[string]string{}
+		ok(t, s.HIter("hash", func(f, v string) bool {
+			got[f] = v
+			return true
+		}))
+		equals(t, map[string]string{"f1": "v1", "f2": "v2"}, got)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		s.SetAdd("set", "a", "b", "c")
+		var members []string
+		ok(t, s.SIter("set", func(m string) bool {
+			members = append(members, m)
+			return true
+		}))
+		sort.Strings(members)
+		equals(t, []string{"a", "b", "c"}, members)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		_, err := s.XAdd("stream", "1-1", []string{"k", "1"})
+		ok(t, err)
+		_, err = s.XAdd("stream", "2-1", []string{"k", "2"})
+		ok(t, err)
+		var ids []string
+		ok(t, s.XIter("stream", func(e StreamEntry) bool {
+			ids = append(ids, e.ID)
+			return true
+		}))
+		equals(t, []string{"1-1", "2-1"}, ids)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		equals(t, ErrKeyNotFound, s.ZIter("nosuch", nil))
+		equals(t, ErrWrongType, s.ZIter("hash", nil))
+		equals(t, ErrWrongType, s.HIter("set", nil))
+		equals(t, ErrWrongType, s.SIter("zset", nil))
+		equals(t, ErrWrongType, s.XIter("zset", nil))
+	})
+}
@@ -0,0 +1,189 @@
+package miniredis
+
+// Key metadata, similar to what OBJECT and DEBUG OBJECT report.
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// the Redis 7 defaults for the "compact" encodings.
+const (
+	listpackMaxEntries = 128 // *-max-listpack-entries
+	listpackMaxValue   = 64  // *-max-listpack-value
+	intsetMaxEntries   = 512 // set-max-intset-entries
+	embstrMaxLen       = 44
+)
+
+// KeyInfo is the metadata of a key. See Miniredis.KeyInfo().
+type KeyInfo struct {
+	Type       string        // as TYPE
+	Encoding   string        // as OBJECT ENCODING would report, for the default configs
+	TTL        time.Duration // 0 if there is no TTL
+	LastAccess time.Time     // last command which used this key, see KeyInfo(). Zero if none did.
+	Version    uint          // see KeyVersion()
+	Size       int           // approximate payload size in bytes, key and value
+}
+
+// String is meant for debug output in failing tests.
+func (ki KeyInfo) String() string {
+	s := fmt.Sprintf("type=%s encoding=%s ttl=%s version=%d size=%d", ki.Type, ki.Encoding, ki.TTL, ki.Version, ki.Size)
+	if !ki.LastAccess.IsZero() {
+		s += " lastaccess=" + ki.LastAccess.Format(time.RFC3339Nano)
+	}
+	return s
+}
+
+// KeyInfo gives the metadata of a key, or ErrKeyNotFound.
+//
+// Keeping the access time of every key is a write for every read, so
+// miniredis only does it once something needs it: after the first KeyInfo()
+// call, a TOUCH, or a config file with an LRU or LFU maxmemory-policy. Call
+// KeyInfo() once at the start of a test to have all access times.
+func (m *Miniredis) KeyInfo(k string) (KeyInfo, error) {
+	return m.selected().KeyInfo(k)
+}
+
+// KeyInfo gives the metadata of a key, or ErrKeyNotFound. See
+// Miniredis.KeyInfo().
+func (db *RedisDB) KeyInfo(k string) (KeyInfo, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+
+	db.master.trackAccess = true
+
+	if !db.exists(k) {
+		return KeyInfo{}, ErrKeyNotFound
+	}
+	enc, size := db.encoding(k)
+	ttl, _ := db.ttl.get(k)
+	return KeyInfo{
+		Type:       db.t(k),
+		Encoding:   enc,
+		TTL:        ttl,
+		LastAccess: db.lastAccess[k],
+		Version:    db.keyVersion[k],
+		Size:       len(k) + size,
+	}, nil
+}
+
+// touch sets the access time of keys used by a command, if access times are
+// tracked. No locks!
+func (db *RedisDB) touch(keys []string) {
+	if !db.master.trackAccess {
+		return
+	}
+	now := db.master.effectiveNow()
+	for _, k := range keys {
+		db.lastAccess[k] = now
+	}
+}
+
+// encoding gives the encoding and the value size of an existing key. No locks!
+func (db *RedisDB) encoding(k string) (string, int) {
+	switch db.t(k) {
+	case "string":
+		n := db.stringKeys[k].Len()
+		switch {
+		case n <= 20 && isInt(db.stringGet(k)):
+			return "int", n
+		case n <= embstrMaxLen:
+			return "embstr", n
+		default:
+			return "raw", n
+		}
+	case "hash":
+		enc, size := "listpack", 0
+		h := db.hashKeys[k]
+		for f, v := range h {
+			size += len(f) + len(v)
+			if len(f) > listpackMaxValue || len(v) > listpackMaxValue {
+				enc = "hashtable"
+			}
+		}
+		if len(h) > listpackMaxEntries {
+			enc = "hashtable"
+		}
+		return enc, size
+	case "list":
+		enc, size := "listpack", 0
+		l := db.listKeys[k]
+		for _, v := range l {
+			size += len(v)
+			if len(v) > listpackMaxValue {
+				enc = "quicklist"
+			}
+		}
+		if len(l) > listpackMaxEntries {
+			enc = "quicklist"
+		}
+		return enc, size
+	case "set":
+		ints, small, size := true, true, 0
+		s := db.setKeys[k]
+		for v := range s {
+			size += len(v)
+			ints = ints && isInt(v)
+			small = small && len(v) <= listpackMaxValue
+		}
+		switch {
+		case ints && len(s) <= intsetMaxEntries:
+			return "intset", size
+		case small && len(s) <= listpackMaxEntries:
+			return "listpack", size
+		default:
+			return "hashtable", size
+		}
+	case "zset":
+		enc, size := "listpack", 0
+		ss := db.sortedsetKeys[k]
+		for v := range ss {
+			size += len(v) + 8
+			if len(v) > listpackMaxValue {
+				enc = "skiplist"
+			}
+		}
+		if len(ss) > listpackMaxEntries {
+			enc = "skiplist"
+		}
+		return enc, size
+	case "stream":
+		size := 0
+		for _, e := range db.streamKeys[k].entries {
+			size += len(e.ID)
+			for _, v := range e.Values {
+				size += len(v)
+			}
+		}
+		return "stream", size
+	case "hll":
+		return "raw", len(db.hllKeys[k].Bytes())
+	default:
+		panic("Unknown key type: " + db.t(k))
+	}
+}
+
+// isInt is true for the strings Redis stores as an integer. That excludes
+// "007" and "+7".
+func isInt(s string) bool {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && strconv.FormatInt(n, 10) == s
+}
+
+// KeyVersion returns the version counter of a key, which is what WATCH uses.
+// Every command (or direct call) which changes the key increases it by one, no
+// matter how many changes that command makes. Deleting a key, or a FLUSHDB,
+// counts as a change too. The counter is never reset, also not when the key
+// is deleted, so it's 0 only for keys which were never written.
+func (m *Miniredis) KeyVersion(db int, key string) uint {
+	return m.DB(db).KeyVersion(key)
+}
+
+// KeyVersion returns the version counter of a key. See
+// Miniredis.KeyVersion().
+func (db *RedisDB) KeyVersion(key string) uint {
+	db.master.Lock()
+	defer db.master.Unlock()
+	return db.keyVersion[key]
+}
@@ -5,12 +5,38 @@ package miniredis
 import (
 	"bytes"
 	"regexp"
+	"sync"
+)
+
+// maxPatternCache is the number of compiled patterns patternRE() keeps.
+const maxPatternCache = 1000
+
+var (
+	patternCacheMu sync.Mutex
+	patternCache   = map[string]*regexp.Regexp{}
 )
 
 // patternRE compiles a glob to a regexp. Returns nil if the given
 // pattern will never match anything.
-// The general strategy is to sandwich all non-meta characters between \Q...\E.
+// Compiled patterns are cached, so SCAN loops and repeated KEYS calls don't
+// compile the same pattern over and over.
 func patternRE(k string) *regexp.Regexp {
+	patternCacheMu.Lock()
+	defer patternCacheMu.Unlock()
+	if re, ok := patternCache[k]; ok {
+		return re
+	}
+	if len(patternCache) >= maxPatternCache {
+		patternCache = map[string]*regexp.Regexp{}
+	}
+	re := compilePattern(k)
+	patternCache[k] = re
+	return re
+}
+
+// compilePattern does the work for patternRE().
+// The general strategy is to sandwich all non-meta characters between \Q...\E.
+func compilePattern(k string) *regexp.Regexp {
 	re := bytes.Buffer{}
 	re.WriteString(`(?s)^\Q`)
 	for i := 0; i < len(k); i++ {
@@ -1,6 +1,7 @@
 package miniredis
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -140,3 +141,52 @@ func TestMatchKeys(t *testing.T) {
 		equals(t, false, ok)
 	})
 }
+
+func TestPatternCache(t *testing.T) {
+	a := patternRE("cache:[ab]*")
+	equals(t, true, a == patternRE("cache:[ab]*"))
+	equals(t, true, patternRE("cache:[") == nil)
+	equals(t, true, patternRE("cache:[") == nil)
+
+	for i := 0; i < maxPatternCache+10; i++ {
+		patternRE(fmt.Sprintf("cache:%d", i))
+	}
+	patternCacheMu.Lock()
+	n := len(patternCache)
+	patternCacheMu.Unlock()
+	assert(t, n <= maxPatternCache, "cache is bounded")
+	equals(t, true, patternRE("cache:12").MatchString("cache:12"))
+}
+
+func BenchmarkMatchKeys(b *testing.B) {
+	const n = 100000
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		keys = append(keys, fmt.Sprintf("user:%c%d:session:%02d:data", 'a'+i%26, i, i%100))
+	}
+	const pattern = "user:[a-c]*:session:?[1-3]:*"
+
+	b.Run("keys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matchKeys(keys, pattern)
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		// SCAN with MATCH and COUNT 10 matches a handful of keys per call
+		for i := 0; i < b.N; i++ {
+			start := (i * 10) % n
+			matchKeys(keys[start:start+10], pattern)
+		}
+	})
+
+	b.Run("scan uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			start := (i * 10) % n
+			re := compilePattern(pattern)
+			for _, k := range keys[start : start+10] {
+				re.MatchString(k)
+			}
+		}
+	})
+}
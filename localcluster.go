@@ -0,0 +1,185 @@
+package miniredis
+
+// A cluster of miniredis servers. See StartCluster().
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LocalCluster is a set of miniredis servers which form a cluster, made with
+// StartCluster().
+type LocalCluster struct {
+	// Shards has all nodes, per shard. The first node of a shard is the
+	// master, the others are its replicas.
+	Shards [][]*Miniredis
+	// FailoverDown is how long the slots of a shard are down during a
+	// Failover(). Default is 100ms.
+	FailoverDown time.Duration
+	ids          map[*Miniredis]string
+}
+
+// StartCluster starts a cluster with the given number of shards, each with a
+// master and the given number of replicas. The slots are divided evenly over
+// the masters, every replica is a ReplicaOf() its master, and all nodes have
+// the same Cluster() topology. Everything is closed when the test is done.
+//
+// Connect a cluster client to any of Addrs().
+func StartCluster(t Tester, shards, replicas int) *LocalCluster {
+	if shards < 1 || replicas < 0 {
+		t.Fatalf("invalid cluster: %d shards with %d replicas", shards, replicas)
+		// not reached
+	}
+
+	tc := &LocalCluster{
+		FailoverDown: 100 * time.Millisecond,
+		ids:          map[*Miniredis]string{},
+	}
+	for i := 0; i < shards; i++ {
+		var nodes []*Miniredis
+		for j := 0; j <= replicas; j++ {
+			m := RunT(t)
+			if j > 0 {
+				m.ReplicaOf(nodes[0])
+			}
+			nodes = append(nodes, m)
+			tc.ids[m] = sha1Hex(fmt.Sprintf("miniredis-%d-%d", i, j))
+		}
+		tc.Shards = append(tc.Shards, nodes)
+	}
+
+	for _, nodes := range tc.Shards {
+		for _, m := range nodes {
+			cl := tc.topology(m)
+			m.Lock()
+			m.cluster = cl
+			m.Unlock()
+		}
+	}
+	return tc
+}
+
+// topology as seen by one of the nodes.
+func (tc *LocalCluster) topology(myself *Miniredis) *Cluster {
+	cl := &Cluster{m: myself}
+	for i, nodes := range tc.Shards {
+		var master *clusterNode
+		for j, m := range nodes {
+			n := &clusterNode{
+				id:     tc.ids[m],
+				addr:   m.Addr(),
+				master: master,
+				epoch:  i + 1,
+			}
+			if m == myself {
+				n.addr = ""
+				cl.myself = n
+			}
+			if j == 0 {
+				master = n
+			}
+			cl.nodes = append(cl.nodes, n)
+		}
+		from, to := tc.shardSlots(i)
+		for s := from; s < to; s++ {
+			cl.slots[s] = master
+		}
+	}
+	return cl
+}
+
+// Masters gives the master of every shard.
+func (tc *LocalCluster) Masters() []*Miniredis {
+	var ms []*Miniredis
+	for _, nodes := range tc.Shards {
+		ms = append(ms, nodes[0])
+	}
+	return ms
+}
+
+// Nodes gives all masters and replicas.
+func (tc *LocalCluster) Nodes() []*Miniredis {
+	var ms []*Miniredis
+	for _, nodes := range tc.Shards {
+		ms = append(ms, nodes...)
+	}
+	return ms
+}
+
+// Addrs gives the addresses of all nodes, masters first. Use these as the
+// seed addresses for a cluster client.
+func (tc *LocalCluster) Addrs() []string {
+	var addrs []string
+	for _, m := range tc.Masters() {
+		addrs = append(addrs, m.Addr())
+	}
+	for _, nodes := range tc.Shards {
+		for _, m := range nodes[1:] {
+			addrs = append(addrs, m.Addr())
+		}
+	}
+	return addrs
+}
+
+// ForKey gives the master which has the slot of the key.
+func (tc *LocalCluster) ForKey(k string) *Miniredis {
+	slot := KeySlot(k)
+	for i, nodes := range tc.Shards {
+		if from, to := tc.shardSlots(i); slot >= from && slot < to {
+			return nodes[0]
+		}
+	}
+	return nil
+}
+
+// Failover promotes the first replica of a shard to master. First all slots
+// of the shard get CLUSTERDOWN errors for FailoverDown, then the replica takes
+// over the slots with a new config epoch, as seen in CLUSTER NODES and CLUSTER
+// SLOTS. The old master becomes the last replica of the new master. Failover
+// blocks until that's all done.
+func (tc *LocalCluster) Failover(shard int) error {
+	if shard < 0 || shard >= len(tc.Shards) {
+		return errors.New("no such shard")
+	}
+	nodes := tc.Shards[shard]
+	if len(nodes) < 2 {
+		return errors.New("shard has no replicas")
+	}
+	old, promoted := nodes[0], nodes[1]
+
+	tc.eachTopology(func(cl *Cluster) {
+		cl.node(tc.ids[old]).failed = true
+	})
+	time.Sleep(tc.FailoverDown)
+
+	promoted.ReplicaOf(nil)
+	shardNodes := []*Miniredis{promoted}
+	for _, m := range nodes[2:] {
+		m.ReplicaOf(promoted)
+		shardNodes = append(shardNodes, m)
+	}
+	old.ReplicaOf(promoted)
+	shardNodes = append(shardNodes, old)
+	tc.eachTopology(func(cl *Cluster) {
+		cl.node(tc.ids[old]).failed = false
+		cl.promote(tc.ids[promoted])
+	})
+	tc.Shards[shard] = shardNodes
+	return nil
+}
+
+// eachTopology calls f for the Cluster of every node, locked.
+func (tc *LocalCluster) eachTopology(f func(*Cluster)) {
+	for _, m := range tc.Nodes() {
+		m.Lock()
+		f(m.cluster)
+		m.Unlock()
+	}
+}
+
+// shardSlots is the slot range of a shard, end exclusive.
+func (tc *LocalCluster) shardSlots(i int) (int, int) {
+	n := len(tc.Shards)
+	return i * clusterSlots / n, (i + 1) * clusterSlots / n
+}
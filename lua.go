@@ -18,15 +18,19 @@ var luaRedisConstants = map[string]lua.LValue{
 	"LOG_WARNING": lua.LNumber(3),
 }
 
-func mkLua(srv *server.Server, c *server.Peer, sha string) (map[string]lua.LGFunction, map[string]lua.LValue) {
+func mkLua(srv *server.Server, c *server.Peer, sha string, keys []string) (map[string]lua.LGFunction, map[string]lua.LValue) {
+	resp3 := false // see redis.setresp()
+
 	mkCall := func(failFast bool) func(l *lua.LState) int {
 		// one server.Ctx for a single Lua run
 		pCtx := &connCtx{}
 		if getCtx(c).authenticated {
 			pCtx.authenticated = true
+			pCtx.user = getCtx(c).user
 		}
 		pCtx.nested = true
 		pCtx.nestedSHA = sha
+		pCtx.nestedKeys = keys
 		pCtx.selectedDB = getCtx(c).selectedDB
 
 		return func(l *lua.LState) int {
@@ -56,6 +60,7 @@ func mkLua(srv *server.Server, c *server.Peer, sha string) (map[string]lua.LGFun
 			wr := bufio.NewWriter(buf)
 			peer := server.NewPeer(wr)
 			peer.Ctx = pCtx
+			peer.Resp3 = resp3
 			srv.Dispatch(peer, args)
 			wr.Flush()
 
@@ -75,29 +80,11 @@ func mkLua(srv *server.Server, c *server.Peer, sha string) (map[string]lua.LGFun
 				return 1
 			}
 
-			if res == nil {
-				l.Push(lua.LFalse)
-			} else {
-				switch r := res.(type) {
-				case int64:
-					l.Push(lua.LNumber(r))
-				case int:
-					l.Push(lua.LNumber(r))
-				case []uint8:
-					l.Push(lua.LString(string(r)))
-				case []interface{}:
-					l.Push(redisToLua(l, r))
-				case server.Simple:
-					l.Push(luaStatusReply(string(r)))
-				case string:
-					l.Push(lua.LString(r))
-				case error:
-					l.Error(lua.LString(r.Error()), 1)
-					return 0
-				default:
-					panic(fmt.Sprintf("type not handled (%T)", r))
-				}
+			if err, ok := res.(error); ok {
+				l.Error(lua.LString(err.Error()), 1)
+				return 0
 			}
+			l.Push(redisToLua(l, res, resp3))
 			return 1
 		}
 	}
@@ -146,6 +133,17 @@ func mkLua(srv *server.Server, c *server.Peer, sha string) (map[string]lua.LGFun
 			l.Push(lua.LString(sha1Hex(msg)))
 			return 1
 		},
+		"setresp": func(l *lua.LState) int {
+			switch l.CheckInt(1) {
+			case 2:
+				resp3 = false
+			case 3:
+				resp3 = true
+			default:
+				l.Error(lua.LString("RESP version must be 2 or 3."), 1)
+			}
+			return 0
+		},
 		"replicate_commands": func(l *lua.LState) int {
 			// ignored
 			return 1
@@ -185,6 +183,41 @@ func luaToRedis(l *lua.LState, c *server.Peer, value lua.LValue) {
 			c.WriteInline(s.String())
 			return
 		}
+		// RESP3 types. These are converted for RESP2 clients.
+		if m, ok := t.RawGetString("map").(*lua.LTable); ok {
+			var kvs []lua.LValue
+			for k, v := m.Next(lua.LNil); k != lua.LNil; k, v = m.Next(k) {
+				kvs = append(kvs, k, v)
+			}
+			c.WriteMapLen(len(kvs) / 2)
+			for _, r := range kvs {
+				luaToRedis(l, c, r)
+			}
+			return
+		}
+		if m, ok := t.RawGetString("set").(*lua.LTable); ok {
+			var members []lua.LValue
+			for k, _ := m.Next(lua.LNil); k != lua.LNil; k, _ = m.Next(k) {
+				members = append(members, k)
+			}
+			c.WriteSetLen(len(members))
+			for _, r := range members {
+				luaToRedis(l, c, r)
+			}
+			return
+		}
+		if d, ok := t.RawGetString("double").(lua.LNumber); ok {
+			c.WriteFloat(float64(d))
+			return
+		}
+		if n, ok := t.RawGetString("big_number").(lua.LString); ok {
+			if c.Resp3 {
+				c.WriteRaw("(" + string(n) + "\r\n")
+			} else {
+				c.WriteBulk(string(n))
+			}
+			return
+		}
 
 		result := []lua.LValue{}
 		for j := 1; true; j++ {
@@ -210,32 +243,60 @@ func luaToRedis(l *lua.LState, c *server.Peer, value lua.LValue) {
 	}
 }
 
-func redisToLua(l *lua.LState, res []interface{}) *lua.LTable {
-	rettb := l.NewTable()
-	for _, e := range res {
-		var v lua.LValue
-		if e == nil {
-			v = lua.LFalse
-		} else {
-			switch et := e.(type) {
-			case int:
-				v = lua.LNumber(et)
-			case int64:
-				v = lua.LNumber(et)
-			case []uint8:
-				v = lua.LString(string(et))
-			case []interface{}:
-				v = redisToLua(l, et)
-			case string:
-				v = lua.LString(et)
-			default:
-				// TODO: oops?
-				v = lua.LString(e.(string))
-			}
+// redisToLua converts a reply from a redis.call() to Lua. With resp3 set the
+// replies are RESP3, see redis.setresp().
+func redisToLua(l *lua.LState, res interface{}, resp3 bool) lua.LValue {
+	switch r := res.(type) {
+	case nil:
+		if resp3 {
+			return lua.LNil
+		}
+		return lua.LFalse
+	case int:
+		return lua.LNumber(r)
+	case int64:
+		return lua.LNumber(r)
+	case []uint8:
+		return lua.LString(string(r))
+	case string:
+		return lua.LString(r)
+	case server.Simple:
+		return luaStatusReply(string(r))
+	case []interface{}:
+		tb := l.NewTable()
+		for i, e := range r {
+			l.RawSet(tb, lua.LNumber(i+1), redisToLua(l, e, resp3))
 		}
-		l.RawSet(rettb, lua.LNumber(rettb.Len()+1), v)
+		return tb
+	case server.Map:
+		m := l.NewTable()
+		for i := 0; i+1 < len(r); i += 2 {
+			l.RawSet(m, redisToLua(l, r[i], resp3), redisToLua(l, r[i+1], resp3))
+		}
+		tb := l.NewTable()
+		tb.RawSetString("map", m)
+		return tb
+	case server.Set:
+		m := l.NewTable()
+		for _, e := range r {
+			l.RawSet(m, redisToLua(l, e, resp3), lua.LTrue)
+		}
+		tb := l.NewTable()
+		tb.RawSetString("set", m)
+		return tb
+	case float64:
+		tb := l.NewTable()
+		tb.RawSetString("double", lua.LNumber(r))
+		return tb
+	case bool:
+		return lua.LBool(r)
+	case server.BigNumber:
+		tb := l.NewTable()
+		tb.RawSetString("big_number", lua.LString(string(r)))
+		return tb
+	default:
+		panic(fmt.Sprintf("type not handled (%T)", r))
 	}
-	return rettb
 }
 
 func luaStatusReply(msg string) *lua.LTable {
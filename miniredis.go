@@ -13,6 +13,11 @@
 //
 // For direct use you can select a Redis database with either `s.Select(12);
 // s.Get("foo")` or `s.DB(12).Get("foo")`.
+//
+// The direct methods are safe to use from any goroutine. Every change they make
+// is done when they return, and a command which miniredis reads after that
+// sees it: setting keys from a goroutine and then signalling the code which
+// connects to redis is enough, no sleeps are needed.
 package miniredis
 
 import (
@@ -20,9 +25,12 @@ import (
 	"crypto/tls"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
@@ -36,35 +44,104 @@ type setKey map[string]struct{}
 
 // RedisDB holds a single (numbered) Redis database.
 type RedisDB struct {
-	master        *Miniredis               // pointer to the lock in Miniredis
-	id            int                      // db id
-	keys          map[string]string        // Master map of keys with their type
-	stringKeys    map[string]string        // GET/SET &c. keys
-	hashKeys      map[string]hashKey       // MGET/MSET &c. keys
-	listKeys      map[string]listKey       // LPUSH &c. keys
-	setKeys       map[string]setKey        // SADD &c. keys
-	hllKeys       map[string]*hll          // PFADD &c. keys
-	sortedsetKeys map[string]sortedSet     // ZADD &c. keys
-	streamKeys    map[string]*streamKey    // XADD &c. keys
-	ttl           map[string]time.Duration // effective TTL values
-	keyVersion    map[string]uint          // used to watch values
+	master        *Miniredis            // pointer to the lock in Miniredis
+	id            int                   // db id
+	keys          map[string]string     // Master map of keys with their type
+	stringKeys    map[string]*rope      // GET/SET &c. keys
+	hashKeys      map[string]hashKey    // MGET/MSET &c. keys
+	listKeys      map[string]listKey    // LPUSH &c. keys
+	setKeys       map[string]setKey     // SADD &c. keys
+	hllKeys       map[string]*hll       // PFADD &c. keys
+	sortedsetKeys map[string]sortedSet  // ZADD &c. keys
+	streamKeys    map[string]*streamKey // XADD &c. keys
+	ttl           *expireSet            // effective TTL values
+	keyVersion    map[string]uint       // used to watch values. See bump().
+	versionOp     map[string]uint64     // operation of the last version change. See bump().
+	lastAccess    map[string]time.Time  // see KeyInfo()
 }
 
 // Miniredis is a Redis server implementation.
 type Miniredis struct {
 	sync.Mutex
-	srv         *server.Server
-	port        int
-	passwords   map[string]string // username password
-	dbs         map[int]*RedisDB
-	selectedDB  int               // DB id used in the direct Get(), Set() &c.
-	scripts     map[string]string // sha1 -> lua src
-	signal      *sync.Cond
-	now         time.Time // time.Now() if not set.
-	subscribers map[*Subscriber]struct{}
-	rand        *rand.Rand
-	Ctx         context.Context
-	CtxCancel   context.CancelFunc
+	srv             *server.Server
+	port            int
+	passwords       map[string]string // username password
+	dbs             map[int]*RedisDB
+	selectedDB      int               // DB id used in the direct Get(), Set() &c.
+	scripts         map[string]string // sha1 -> lua src
+	signal          *sync.Cond
+	now             time.Time     // time.Now() if not set.
+	scriptNow       time.Time     // time.Now() at the start of the running script, if any.
+	subscribers     []*Subscriber // in the order they subscribed
+	rand            *rand.Rand
+	errorMsg        string                               // see SetError()
+	cluster         *Cluster                             // see Cluster()
+	notifyFlags     int                                  // see NotifyKeyspaceEvents()
+	keyEvents       map[*KeyEventSubscription]struct{}   // see KeyEvents()
+	outbox          []outMessage                         // see flushOutbox()
+	cmdTimeout      time.Duration                        // see SetCommandTimeout()
+	maxBlockTime    time.Duration                        // see SetMaxBlockTime()
+	forwarded       time.Duration                        // total of all FastForward()s
+	aclLog          []ACLLogEntry                        // see ACLLog(). Newest first.
+	aclLogID        int                                  // next ACL LOG entry-id
+	version         string                               // see SetVersion()
+	deprecated      func(cmd, replacement string)        // see OnDeprecated()
+	published       []PublishedMessage                   // see PublishedMessages()
+	databases       int                                  // 0 is unlimited. See LoadConfigFile().
+	renames         [][2]string                          // see LoadConfigFile()
+	declaredKeys    bool                                 // see RequireDeclaredKeys()
+	tenants         map[string]string                    // prefix: password. See Tenant().
+	stableScan      bool                                 // see DeterministicScan()
+	scanEpoch       int64                                // number of restores, see scanPage()
+	op              uint64                               // see Lock()
+	writes          uint64                               // changes to keys and scripts, see syncMaster()
+	hijacks         map[string]HijackFunc                // see Hijack()
+	writeDelay      server.WriteDelay                    // see SetWriteDelay()
+	schedule        server.Schedule                      // see SetSchedule()
+	connTimeouts    server.ConnTimeouts                  // see SetConnTimeouts()
+	maxClients      int                                  // see SetMaxClients()
+	lockedAt        time.Time                            // see MaxLockHold()
+	maxLockHold     time.Duration                        // see MaxLockHold()
+	denyWrites      string                               // see StartDenyWrites()
+	keyLimits       map[int]keyLimit                     // see SetKeyLimit()
+	failureDump     *FailureDump                         // see SetFailureDump()
+	recentKeys      map[dbKey]uint64                     // see SetFailureDump()
+	allowOnly       map[string]bool                      // see AllowOnly()
+	profileDisabled map[string]bool                      // see SetProfile()
+	profileInfo     map[string]string                    // see SetProfile()
+	profileAliases  map[string]string                    // see SetProfile()
+	profileServer   string                               // see SetProfile()
+	luaAlias        string                               // see SetProfile()
+	goroutines      int32                                // see GoroutineLeakCheck()
+	slowAfter       time.Duration                        // see FailOnSlow()
+	slow            []SlowCommand                        // see SlowCommands()
+	lazyExpire      bool                                 // see SetActiveExpire()
+	customCommands  map[string]CommandFunc               // see RegisterCommand()
+	master          *Miniredis                           // see ReplicaOf()
+	masterWrites    uint64                               // master.writes of the last sync
+	masterSynced    bool                                 // synced since ReplicaOf()
+	replID          string                               // see ReplID()
+	replID2         string                               // the replID before the last promotion, if any
+	tracer          Tracer                               // see SetTracer()
+	capture         *capture                             // see StartCapture()
+	replyAttrs      ReplyAttributes                      // see SetReplyAttributes()
+	health          *http.Server                         // see StartHTTPHealth()
+	onFlush         func(db int, keys map[string]string) // see OnFlush()
+	onMiss          MissFunc                             // see OnMiss()
+	missed          map[dbKey]struct{}                   // keys onMiss was called for
+	onWrite         func(WriteOp)                        // see OnWrite()
+	written         []dbKey                              // changed keys, for onWrite
+	writeStates     map[dbKey]writeState                 // the TTLs as onWrite knows them
+	writeFields     map[dbKey]*fieldWrites               // the fields changed since Lock(), see before()
+	streamInfo      StreamInfoFunc                       // see SetStreamInfo()
+	trackAccess     bool                                 // see KeyInfo()
+	trackers        map[*server.Peer]*tracking           // see CLIENT TRACKING
+	trackedKeys     map[string]map[*server.Peer]bool     // keys trackers read, without BCAST
+	invalidated     []invalidation                       // changed keys, for trackers
+	invalidateAll   bool                                 // a flush, for trackers
+	writer          *server.Peer                         // connection of the running command, for NOLOOP
+	Ctx             context.Context
+	CtxCancel       context.CancelFunc
 }
 
 type txCmd func(*server.Peer, *connCtx)
@@ -79,24 +156,45 @@ type dbKey struct {
 // (this struct was named before context.Context existed)
 type connCtx struct {
 	selectedDB       int            // selected DB
-	authenticated    bool           // auth enabled and a valid AUTH seen
+	authenticated    bool           // auth enabled and a valid AUTH seen. See authRequired().
+	user             string         // the authenticated user, if any
+	name             string         // see HELLO SETNAME
 	transaction      []txCmd        // transaction callbacks. Or nil.
 	dirtyTransaction bool           // any error during QUEUEing
 	watch            map[dbKey]uint // WATCHed keys
 	subscriber       *Subscriber    // client is in PUBSUB mode if not nil
 	nested           bool           // this is called via Lua
 	nestedSHA        string         // set to the SHA of the nesting function
+	nestedKeys       []string       // the KEYS of the nesting function
+	tenant           string         // key prefix, see Miniredis.Tenant()
+}
+
+// Lock locks the Miniredis. Every Lock() starts a new operation, as does every
+// command in a MULTI or in a script: all changes to a key in an operation
+// count as a single change in KeyVersion().
+func (m *Miniredis) Lock() {
+	m.Mutex.Lock()
+	m.lockedAt = time.Now()
+	m.op++
+	if m.master != nil {
+		m.syncMaster()
+	}
 }
 
 // NewMiniRedis makes a new, non-started, Miniredis object.
 func NewMiniRedis() *Miniredis {
 	m := Miniredis{
-		dbs:         map[int]*RedisDB{},
-		scripts:     map[string]string{},
-		subscribers: map[*Subscriber]struct{}{},
+		dbs:            map[int]*RedisDB{},
+		scripts:        map[string]string{},
+		keyEvents:      map[*KeyEventSubscription]struct{}{},
+		tenants:        map[string]string{},
+		hijacks:        map[string]HijackFunc{},
+		customCommands: map[string]CommandFunc{},
+		maxClients:     defaultMaxClients,
 	}
 	m.Ctx, m.CtxCancel = context.WithCancel(context.Background())
 	m.signal = sync.NewCond(&m)
+	m.replID = m.newReplID()
 	return &m
 }
 
@@ -105,15 +203,17 @@ func newRedisDB(id int, m *Miniredis) RedisDB {
 		id:            id,
 		master:        m,
 		keys:          map[string]string{},
-		stringKeys:    map[string]string{},
+		stringKeys:    map[string]*rope{},
 		hashKeys:      map[string]hashKey{},
 		listKeys:      map[string]listKey{},
 		setKeys:       map[string]setKey{},
 		hllKeys:       map[string]*hll{},
 		sortedsetKeys: map[string]sortedSet{},
 		streamKeys:    map[string]*streamKey{},
-		ttl:           map[string]time.Duration{},
+		ttl:           newExpireSet(),
 		keyVersion:    map[string]uint{},
+		versionOp:     map[string]uint64{},
+		lastAccess:    map[string]time.Time{},
 	}
 }
 
@@ -136,13 +236,18 @@ type Tester interface {
 }
 
 // RunT start a new miniredis, pass it a testing.T. It also registers the cleanup after your test is done.
+// If the test failed the cleanup logs the keys, see SetFailureDump().
 func RunT(t Tester) *Miniredis {
 	m := NewMiniRedis()
+	m.failureDump = &FailureDump{}
 	if err := m.Start(); err != nil {
 		t.Fatalf("could not start miniredis: %s", err)
 		// not reached
 	}
-	t.Cleanup(m.Close)
+	t.Cleanup(func() {
+		m.logFailureDump(t)
+		m.Close()
+	})
 	return m
 }
 
@@ -180,6 +285,20 @@ func (m *Miniredis) start(s *server.Server) error {
 	defer m.Unlock()
 	m.srv = s
 	m.port = s.Addr().Port
+	m.srv.SetPreHook(m.preHook)
+	m.srv.SetErrorHook(m.txErrorHook)
+	m.srv.SetAttributeHook(m.attributeHook)
+	m.srv.SetCommandTimeout(m.cmdTimeout)
+	m.srv.SetWriteDelay(m.writeDelay)
+	m.srv.SetSchedule(m.schedule)
+	m.srv.SetConnTimeouts(m.connTimeouts)
+	m.srv.SetMaxClients(m.maxClients)
+	if m.slowAfter > 0 {
+		m.srv.SetSlowHook(m.slowAfter, m.slowHook)
+	}
+	if m.tracer != nil || m.capture != nil {
+		m.srv.SetTraceHook(m.traceHook)
+	}
 
 	commandsConnection(m)
 	commandsGeneric(m)
@@ -197,12 +316,28 @@ func (m *Miniredis) start(s *server.Server) error {
 	commandsCluster(m)
 	commandsHll(m)
 
-	return nil
+	for name, f := range m.customCommands {
+		if err := m.srv.Register(name, m.customCommand(f)); err != nil {
+			return err
+		}
+	}
+	for alias, cmd := range commandAliases {
+		if err := m.srv.Alias(alias, cmd); err != nil {
+			return err
+		}
+	}
+	if err := m.srv.RenameAll(m.renames); err != nil {
+		return err
+	}
+	return m.aliasProfile(m.profileAliases)
 }
 
 // Restart restarts a Close()d server on the same port. Values will be
-// preserved.
+// preserved. Same as a restarted redis, it gets a new replication ID (see
+// ReplID()), so replicas and clients which check for that know they need a
+// full resync.
 func (m *Miniredis) Restart() error {
+	m.ChangeReplID()
 	return m.Start()
 }
 
@@ -253,6 +388,13 @@ func (m *Miniredis) DB(i int) *RedisDB {
 	return m.db(i)
 }
 
+// selected is the DB chosen with Select(), for the direct Get(), Set() &c.
+func (m *Miniredis) selected() *RedisDB {
+	m.Lock()
+	defer m.Unlock()
+	return m.db(m.selectedDB)
+}
+
 // get DB. No locks!
 func (m *Miniredis) db(i int) *RedisDB {
 	if db, ok := m.dbs[i]; ok {
@@ -267,9 +409,15 @@ func (m *Miniredis) db(i int) *RedisDB {
 func (m *Miniredis) SwapDB(i, j int) bool {
 	m.Lock()
 	defer m.Unlock()
+	defer m.signal.Broadcast()
 	return m.swapDB(i, j)
 }
 
+// validDB checks a DB index, see LoadConfigFile(). No locks!
+func (m *Miniredis) validDB(i int) bool {
+	return i >= 0 && (m.databases == 0 || i < m.databases)
+}
+
 // swap DB. No locks!
 func (m *Miniredis) swapDB(i, j int) bool {
 	db1 := m.db(i)
@@ -277,6 +425,7 @@ func (m *Miniredis) swapDB(i, j int) bool {
 
 	db1.id = j
 	db2.id = i
+	m.writes++
 
 	m.dbs[i] = db2
 	m.dbs[j] = db1
@@ -320,6 +469,156 @@ func (m *Miniredis) CurrentConnectionCount() int {
 	return m.srv.ClientsLen()
 }
 
+// ConnectionInfo describes a client connection. See ActiveConnections().
+type ConnectionInfo struct {
+	ID      int    // client ID, as given by HELLO
+	Addr    string // remote address of the client
+	Blocked bool   // waiting in a blocking command, such as BLPOP
+}
+
+// ActiveConnections gives all connected clients, ordered by ID.
+func (m *Miniredis) ActiveConnections() []ConnectionInfo {
+	m.Lock()
+	srv := m.srv
+	m.Unlock()
+	if srv == nil {
+		return nil
+	}
+	var res []ConnectionInfo
+	for _, p := range srv.Peers() {
+		res = append(res, ConnectionInfo{
+			ID:      p.ID(),
+			Addr:    p.RemoteAddr(),
+			Blocked: srv.Blocked(p),
+		})
+	}
+	return res
+}
+
+// ClientFilter selects connections for KillClients(). Empty fields match
+// everything, and all other fields have to match.
+type ClientFilter struct {
+	ID     int           // client ID, as given by HELLO
+	Addr   string        // remote address of the client, "host:port"
+	LAddr  string        // address the client connected to, "host:port"
+	User   string        // the authenticated user. "default" if there was no AUTH.
+	Type   string        // "normal" or "pubsub". No connection is a "replica" or "master".
+	MaxAge time.Duration // only connections which are open for longer than this
+}
+
+// KillClients disconnects all clients which match the filter, same as CLIENT
+// KILL. Returns the number of disconnected clients.
+func (m *Miniredis) KillClients(filter ClientFilter) int {
+	m.Lock()
+	defer m.Unlock()
+	return m.killClients(nil, filter, false)
+}
+
+// killClients is CLIENT KILL. Skips the connection self if skipme is set. No
+// locks!
+func (m *Miniredis) killClients(self *server.Peer, filter ClientFilter, skipme bool) int {
+	if m.srv == nil {
+		return 0
+	}
+	n := 0
+	for _, p := range m.srv.Peers() {
+		if skipme && p == self {
+			continue
+		}
+		if !filter.match(p) {
+			continue
+		}
+		n++
+		if p == self {
+			// after the reply
+			p.Close()
+			continue
+		}
+		m.srv.Kill(p)
+	}
+	return n
+}
+
+func (f ClientFilter) match(p *server.Peer) bool {
+	ctx, ok := p.Ctx.(*connCtx)
+	if !ok {
+		// no commands yet
+		ctx = &connCtx{}
+	}
+	user := ctx.user
+	if user == "" {
+		user = "default"
+	}
+	typ := "normal"
+	if ctx.subscriber != nil {
+		typ = "pubsub"
+	}
+	return (f.ID == 0 || f.ID == p.ID()) &&
+		(f.Addr == "" || f.Addr == p.RemoteAddr()) &&
+		(f.LAddr == "" || f.LAddr == p.LocalAddr()) &&
+		(f.User == "" || f.User == user) &&
+		(f.Type == "" || f.Type == typ) &&
+		(f.MaxAge == 0 || time.Since(p.Created()) > f.MaxAge)
+}
+
+// userExists is true for users known to ACL. No locks!
+func (m *Miniredis) userExists(user string) bool {
+	if user == "default" {
+		return true
+	}
+	if _, ok := m.passwords[user]; ok {
+		return true
+	}
+	_, ok := m.tenants[user]
+	return ok
+}
+
+// GoroutineLeakCheck Close()s the miniredis, and fails the test if any of
+// its goroutines are still running after that. That would be connection
+// handlers, goroutines of blocking commands, and KeyEvents() subscriptions
+// which are never closed. Goroutines get a second to finish. Use it as:
+//
+//	m := miniredis.RunT(t)
+//	defer m.GoroutineLeakCheck(t)
+func (m *Miniredis) GoroutineLeakCheck(t Tester) {
+	m.Lock()
+	srv := m.srv
+	m.Unlock()
+	m.Close()
+
+	running := func() (int, int) {
+		n := 0
+		if srv != nil {
+			n = srv.Goroutines()
+		}
+		return n, int(atomic.LoadInt32(&m.goroutines))
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		server, other := running()
+		if server == 0 && other == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			m.Lock()
+			events := len(m.keyEvents)
+			m.Unlock()
+			t.Fatalf("miniredis goroutines still running after Close(): %d server goroutines, %d other goroutines (open KeyEvents() subscriptions: %d)", server, other, events)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// goroutine runs f in a goroutine, for GoroutineLeakCheck().
+func (m *Miniredis) goroutine(f func()) {
+	atomic.AddInt32(&m.goroutines, 1)
+	go func() {
+		defer atomic.AddInt32(&m.goroutines, -1)
+		f()
+	}()
+}
+
 // TotalConnectionCount returns the number of client connections since server start.
 func (m *Miniredis) TotalConnectionCount() int {
 	m.Lock()
@@ -330,11 +629,64 @@ func (m *Miniredis) TotalConnectionCount() int {
 // FastForward decreases all TTLs by the given duration. All TTLs <= 0 will be
 // expired.
 func (m *Miniredis) FastForward(duration time.Duration) {
+	m.AdvanceClock(duration)
+}
+
+// SetActiveExpire(false) makes FastForward() and AdvanceClock() decrease the
+// TTLs without removing the keys which expire. Same as with lazy expiry in redis,
+// such keys are only removed when a command uses them, and until then they
+// are counted by DBSIZE, are in Keys() &c., but not in KEYS or SCAN. This is
+// the same as DEBUG SET-ACTIVE-EXPIRE 0. SetActiveExpire(true), the default,
+// removes all expired keys right away.
+func (m *Miniredis) SetActiveExpire(b bool) {
 	m.Lock()
 	defer m.Unlock()
-	for _, db := range m.dbs {
-		db.fastForward(duration)
+	m.setActiveExpire(b)
+}
+
+// No locks!
+func (m *Miniredis) setActiveExpire(b bool) {
+	m.lazyExpire = !b
+	if b {
+		for _, id := range m.dbIDs() {
+			m.dbs[id].fastForward(0)
+		}
+	}
+}
+
+// ExpiredKey is a key which expired in AdvanceClock().
+type ExpiredKey struct {
+	DB  int
+	Key string
+}
+
+// AdvanceClock is FastForward(), but it also returns the keys which expired,
+// ordered by DB and key. Every expired key also gets an "expired" keyspace
+// event, in that same order. This doesn't change the time set with SetTime().
+func (m *Miniredis) AdvanceClock(duration time.Duration) []ExpiredKey {
+	m.Lock()
+	defer m.Unlock()
+
+	var expired []ExpiredKey
+	for _, id := range m.dbIDs() {
+		for _, k := range m.dbs[id].fastForward(duration) {
+			expired = append(expired, ExpiredKey{DB: id, Key: k})
+		}
 	}
+	m.forwarded += duration
+	m.writes++           // the TTLs changed
+	m.signal.Broadcast() // blocking commands count this towards their timeout
+	return expired
+}
+
+// dbIDs gives the ids of all used DBs, sorted. No locks!
+func (m *Miniredis) dbIDs() []int {
+	ids := make([]int, 0, len(m.dbs))
+	for id := range m.dbs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
 }
 
 // Server returns the underlying server to allow custom commands to be implemented
@@ -354,11 +706,22 @@ func (m *Miniredis) Dump() string {
 	m.Lock()
 	defer m.Unlock()
 
+	db := m.db(m.selectedDB)
+	r := ""
+	for _, k := range db.allKeys() {
+		r += db.dumpKey(k, 0)
+	}
+	return r
+}
+
+// dumpKey is a key in the Dump() format, with at most max elements (0 is no
+// limit). No locks!
+func (db *RedisDB) dumpKey(k string, max int) string {
 	var (
 		maxLen = DumpMaxLineLen
 		indent = "   "
-		db     = m.db(m.selectedDB)
-		r      = ""
+		r      = fmt.Sprintf("- %s\n", k)
+		n      = 0
 		v      = func(s string) string {
 			suffix := ""
 			if len(s) > maxLen {
@@ -367,45 +730,64 @@ func (m *Miniredis) Dump() string {
 			}
 			return fmt.Sprintf("%q%s", s, suffix)
 		}
+		more = func() bool {
+			n++
+			return max > 0 && n > max
+		}
 	)
 
-	for _, k := range db.allKeys() {
-		r += fmt.Sprintf("- %s\n", k)
-		t := db.t(k)
-		switch t {
-		case "string":
-			r += fmt.Sprintf("%s%s\n", indent, v(db.stringKeys[k]))
-		case "hash":
-			for _, hk := range db.hashFields(k) {
-				r += fmt.Sprintf("%s%s: %s\n", indent, hk, v(db.hashGet(k, hk)))
+	t := db.t(k)
+	switch t {
+	case "string":
+		r += fmt.Sprintf("%s%s\n", indent, v(db.stringGet(k)))
+	case "hash":
+		for _, hk := range db.hashFields(k) {
+			if more() {
+				break
 			}
-		case "list":
-			for _, lk := range db.listKeys[k] {
-				r += fmt.Sprintf("%s%s\n", indent, v(lk))
+			r += fmt.Sprintf("%s%s: %s\n", indent, hk, v(db.hashGet(k, hk)))
+		}
+	case "list":
+		for _, lk := range db.listKeys[k] {
+			if more() {
+				break
 			}
-		case "set":
-			for _, mk := range db.setMembers(k) {
-				r += fmt.Sprintf("%s%s\n", indent, v(mk))
+			r += fmt.Sprintf("%s%s\n", indent, v(lk))
+		}
+	case "set":
+		for _, mk := range db.setMembers(k) {
+			if more() {
+				break
 			}
-		case "zset":
-			for _, el := range db.ssetElements(k) {
-				r += fmt.Sprintf("%s%f: %s\n", indent, el.score, v(el.member))
+			r += fmt.Sprintf("%s%s\n", indent, v(mk))
+		}
+	case "zset":
+		for _, el := range db.ssetElements(k) {
+			if more() {
+				break
 			}
-		case "stream":
-			for _, entry := range db.streamKeys[k].entries {
-				r += fmt.Sprintf("%s%s\n", indent, entry.ID)
-				ev := entry.Values
-				for i := 0; i < len(ev)/2; i++ {
-					r += fmt.Sprintf("%s%s%s: %s\n", indent, indent, v(ev[2*i]), v(ev[2*i+1]))
-				}
+			r += fmt.Sprintf("%s%f: %s\n", indent, el.score, v(el.member))
+		}
+	case "stream":
+		for _, entry := range db.streamKeys[k].entries {
+			if more() {
+				break
 			}
-		case "hll":
-			for _, entry := range db.hllKeys {
-				r += fmt.Sprintf("%s%s\n", indent, v(string(entry.Bytes())))
+			r += fmt.Sprintf("%s%s\n", indent, entry.ID)
+			ev := entry.Values
+			for i := 0; i < len(ev)/2; i++ {
+				r += fmt.Sprintf("%s%s%s: %s\n", indent, indent, v(ev[2*i]), v(ev[2*i+1]))
 			}
-		default:
-			r += fmt.Sprintf("%s(a %s, fixme!)\n", indent, t)
 		}
+	case "hll":
+		for _, entry := range db.hllKeys {
+			r += fmt.Sprintf("%s%s\n", indent, v(string(entry.Bytes())))
+		}
+	default:
+		r += fmt.Sprintf("%s(a %s, fixme!)\n", indent, t)
+	}
+	if max > 0 && n > max {
+		r += fmt.Sprintf("%s...\n", indent)
 	}
 	return r
 }
@@ -425,14 +807,538 @@ func (m *Miniredis) SetTime(t time.Time) {
 //
 // Clear it with an empty string. Don't add newlines.
 func (m *Miniredis) SetError(msg string) {
-	cb := server.Hook(nil)
-	if msg != "" {
-		cb = func(c *server.Peer, cmd string, args ...string) bool {
+	m.Lock()
+	defer m.Unlock()
+	m.errorMsg = msg
+}
+
+// Errors for StartDenyWrites(), as redis sends them.
+const (
+	DenyOOM      = "OOM command not allowed when used memory > 'maxmemory'."
+	DenyMisconf  = "MISCONF Redis is configured to save RDB snapshots, but it's currently unable to persist to disk. Commands that may modify the data set are disabled, because this instance is configured to report errors during writes if RDB snapshotting fails (stop-writes-on-bgsave-error option). Please check the Redis logs for details about the RDB error."
+	DenyReadonly = "READONLY You can't write against a read only replica."
+)
+
+// StartDenyWrites makes all write commands return the error msg, until
+// StopDenyWrites() is called. Reads keep working. This simulates a full
+// redis (DenyOOM), a redis which can't save (DenyMisconf), or a failover
+// (DenyReadonly). Same as redis, an "OOM" error is only returned for commands
+// which can use more memory, so DEL and friends still work.
+// Commands from Lua scripts are denied as well. In a MULTI, the command is
+// denied when it's queued, which aborts the EXEC. Nothing changes for custom
+// commands.
+func (m *Miniredis) StartDenyWrites(msg string) {
+	m.Lock()
+	defer m.Unlock()
+	m.denyWrites = msg
+}
+
+// StopDenyWrites undoes StartDenyWrites().
+func (m *Miniredis) StopDenyWrites() {
+	m.Lock()
+	defer m.Unlock()
+	m.denyWrites = ""
+}
+
+// writeDenied gives the StartDenyWrites() error for the command, if any. No
+// locks!
+func (m *Miniredis) writeDenied(cmd string) string {
+	if m.denyWrites == "" {
+		return ""
+	}
+	flag := "write"
+	if strings.HasPrefix(m.denyWrites, "OOM") {
+		flag = "denyoom"
+	}
+	if !commandSpecs()[strings.ToLower(cmd)].hasFlag(flag) {
+		return ""
+	}
+	return m.denyWrites
+}
+
+// DefaultKeyLimitMsg is the SetKeyLimit() error when there is no message.
+const DefaultKeyLimitMsg = "ERR max number of keys exceeded"
+
+type keyLimit struct {
+	max int
+	msg string
+}
+
+// SetKeyLimit limits the number of keys in DB db to max. A command which
+// would make more keys returns the error msg (or DefaultKeyLimitMsg), the way
+// the quota proxy of a multi-tenant redis offering does, so tests can check
+// how an application deals with quota errors. The check is done before the
+// command runs: all keys the command writes to which don't exist yet count as
+// new. Keys which are only read, such as the sources of SUNIONSTORE, don't.
+// Only commands which can use more memory are checked, so DEL and friends
+// keep working.
+// Commands from Lua scripts are checked as well. In a MULTI, the command is
+// checked when it's queued, which aborts the EXEC. The limit stays with the DB
+// number after a SWAPDB. A max of 0 or less removes the limit.
+func (m *Miniredis) SetKeyLimit(db, max int, msg string) {
+	m.Lock()
+	defer m.Unlock()
+	if max <= 0 {
+		delete(m.keyLimits, db)
+		return
+	}
+	if msg == "" {
+		msg = DefaultKeyLimitMsg
+	}
+	if m.keyLimits == nil {
+		m.keyLimits = map[int]keyLimit{}
+	}
+	m.keyLimits[db] = keyLimit{max: max, msg: msg}
+}
+
+// keyLimitError gives the SetKeyLimit() error for the command, if any. No
+// locks!
+func (m *Miniredis) keyLimitError(ctx *connCtx, cmd string, keys []string) string {
+	l, ok := m.keyLimits[ctx.selectedDB]
+	if !ok || !commandSpecs()[strings.ToLower(cmd)].hasFlag("denyoom") {
+		return ""
+	}
+	db := m.db(ctx.selectedDB)
+	n := len(db.keys)
+	seen := map[string]bool{}
+	for _, k := range writtenKeys(cmd, keys) {
+		if !seen[k] && !db.exists(k) {
+			n++
+		}
+		seen[k] = true
+	}
+	if n <= l.max {
+		return ""
+	}
+	return l.msg
+}
+
+// AllowOnly makes every command which is not in cmds return a NOPERM error,
+// the way a user with restricted ACLs would see it. That's close to what
+// managed redis offerings do, which don't allow CONFIG, DEBUG, KEYS, &c., so
+// tests can check that code doesn't rely on them. It works for commands from
+// Lua scripts and in a MULTI as well. Don't forget the commands the client
+// sends when it connects, such as HELLO, AUTH, or SELECT.
+//
+// AllowOnly() without commands allows all commands again.
+func (m *Miniredis) AllowOnly(cmds ...string) {
+	m.Lock()
+	defer m.Unlock()
+	m.allowOnly = nil
+	if len(cmds) == 0 {
+		return
+	}
+	m.allowOnly = map[string]bool{}
+	for _, c := range cmds {
+		m.allowOnly[strings.ToUpper(c)] = true
+	}
+}
+
+// notAllowed gives the SetProfile() or AllowOnly() error for the command, if
+// any. No locks!
+func (m *Miniredis) notAllowed(c *server.Peer, cmd string, args []string) string {
+	if m.profileDisabled[cmd] {
+		return server.MsgUnknownCommand(cmd, args)
+	}
+	if m.allowOnly == nil || m.allowOnly[cmd] {
+		return ""
+	}
+	user := getCtx(c).user
+	if user == "" {
+		user = "default"
+	}
+	m.aclLogAdd(c, "command", strings.ToLower(cmd), user)
+	return fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user, strings.ToLower(cmd))
+}
+
+// RequireDeclaredKeys makes redis.call() and redis.pcall() from scripts
+// return an error for keys which were not passed in KEYS. Real Redis doesn't
+// check this, but it does need all keys to be declared for cluster setups.
+// Off by default.
+func (m *Miniredis) RequireDeclaredKeys(b bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.declaredKeys = b
+}
+
+// DeterministicScan makes SCAN, HSCAN, SSCAN, and ZSCAN return pages of COUNT
+// elements, in sorted order, with the offset as the cursor. MATCH and TYPE are
+// applied per page, as in Redis, so a page can be empty. This gives stable
+// output for tests of pagination code. Note that the cursors are only stable
+// as long as the keys don't change. The cursors from before a Restore() give
+// an "invalid cursor" error.
+// Off by default, which returns all elements on the first call.
+func (m *Miniredis) DeterministicScan(b bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.stableScan = b
+}
+
+// SetVersion changes the redis version reported by INFO and HELLO. Useful
+// for clients which enable features depending on the version. This doesn't
+// change which commands are supported.
+func (m *Miniredis) SetVersion(v string) {
+	m.Lock()
+	defer m.Unlock()
+	m.version = v
+}
+
+// the version for INFO and HELLO. No locks!
+func (m *Miniredis) redisVersion() string {
+	if m.version == "" {
+		return defaultVersion
+	}
+	return m.version
+}
+
+// OnDeprecated registers a callback which is called for every deprecated
+// command (GETSET, SETEX, HMSET, ZRANGEBYSCORE, &c.) a client uses, together
+// with what redis suggests to use instead. This is a cheap way to find
+// deprecated usage in tests, for example with:
+//
+//	m.OnDeprecated(func(cmd, replacement string) {
+//		t.Errorf("deprecated command %s, use %s", cmd, replacement)
+//	})
+//
+// The callback runs before the command, while miniredis is locked, so it must
+// not call any methods on the Miniredis. Use nil to remove the callback.
+func (m *Miniredis) OnDeprecated(f func(cmd, replacement string)) {
+	m.Lock()
+	defer m.Unlock()
+	m.deprecated = f
+}
+
+// OnFlush sets a callback which gets all keys a FLUSHDB or FLUSHALL removed,
+// with their types, such as "string" or "hash". It's called once for every
+// flushed DB, in order, also when there was nothing to remove. For
+// connections with a Tenant() the keys are without the prefix. Expired keys
+// are not included.
+//
+// The callback runs while miniredis is locked, so it must not call any
+// methods on the Miniredis. Use nil to remove the callback.
+func (m *Miniredis) OnFlush(f func(db int, keys map[string]string)) {
+	m.Lock()
+	defer m.Unlock()
+	m.onFlush = f
+}
+
+// SetCommandTimeout makes all clients get a "BUSY" error while a command runs
+// for longer than d, instead of waiting for it. This is mostly useful for
+// custom commands (see Server()) which might hang. The slow command itself is
+// not interrupted. Blocking commands don't count while they wait. 0 disables
+// the timeout, which is the default.
+func (m *Miniredis) SetCommandTimeout(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.cmdTimeout = d
+	if m.srv != nil {
+		m.srv.SetCommandTimeout(d)
+	}
+}
+
+// SetMaxBlockTime limits how long blocking commands, such as BLPOP and XREAD
+// BLOCK, wait. They time out after d, also when they were called with a
+// timeout of 0 (forever), so a test doesn't hang when the value it waits for
+// never arrives. 0 disables the limit, which is the default.
+//
+// The time blocking commands wait includes FastForward(): forwarding past
+// their timeout times them out right away.
+func (m *Miniredis) SetMaxBlockTime(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.maxBlockTime = d
+}
+
+// ReplyAttributes gives the RESP3 attributes for the reply of a command, with
+// the upper case command. See SetReplyAttributes().
+type ReplyAttributes func(cmd string, args []string) map[string]string
+
+// SetReplyAttributes makes miniredis send the attributes f returns as a RESP3
+// attribute before the reply of a command, so clients which handle attributes
+// can be tested. Real redis hardly ever sends them. For example, to send a
+// fake "ttl" with every GET:
+//
+//	m.SetReplyAttributes(func(cmd string, args []string) map[string]string {
+//		if cmd != "GET" {
+//			return nil
+//		}
+//		return map[string]string{"ttl": "10"}
+//	})
+//
+// Only RESP3 connections get attributes, and not for commands queued in a
+// MULTI, nor for the commands a script runs. f is called without any locks,
+// so it can use the Miniredis. Use nil to disable it.
+func (m *Miniredis) SetReplyAttributes(f ReplyAttributes) {
+	m.Lock()
+	defer m.Unlock()
+	m.replyAttrs = f
+}
+
+func (m *Miniredis) attributeHook(c *server.Peer, cmd string, args []string) map[string]string {
+	if ctx, ok := c.Ctx.(*connCtx); ok && (inTx(ctx) || ctx.nested) {
+		return nil
+	}
+	m.Lock()
+	f := m.replyAttrs
+	m.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f(cmd, args)
+}
+
+// SlowCommand is a command which took longer than the FailOnSlow() threshold.
+type SlowCommand struct {
+	ClientID int
+	Args     []string // the command and its arguments
+	Duration time.Duration
+}
+
+// FailOnSlow fails the test when any command took longer than threshold, to
+// catch things like accidentally quadratic use of redis. Same as the redis
+// SLOWLOG it counts the time to run the command, but not the time blocking
+// commands wait. It does count the time to write the reply, so slow replies
+// from SetWriteDelay() count as well.
+// The test fails at the end of the test, in a t.Cleanup(), since commands run
+// in other goroutines. The commands are also in SlowCommands().
+func (m *Miniredis) FailOnSlow(threshold time.Duration, t Tester) {
+	m.Lock()
+	defer m.Unlock()
+	m.slowAfter = threshold
+	if m.srv != nil {
+		m.srv.SetSlowHook(threshold, m.slowHook)
+	}
+	t.Cleanup(func() {
+		slow := m.SlowCommands()
+		if len(slow) == 0 {
+			return
+		}
+		var cmds []string
+		for i, c := range slow {
+			if i == 10 {
+				cmds = append(cmds, "...")
+				break
+			}
+			cmds = append(cmds, fmt.Sprintf("%q took %s", strings.Join(c.Args, " "), c.Duration))
+		}
+		t.Fatalf("%d redis commands took longer than %s: %s", len(slow), threshold, strings.Join(cmds, ", "))
+	})
+}
+
+// SlowCommands gives all commands which took longer than the FailOnSlow()
+// threshold, oldest first.
+func (m *Miniredis) SlowCommands() []SlowCommand {
+	m.Lock()
+	defer m.Unlock()
+	return append([]SlowCommand(nil), m.slow...)
+}
+
+func (m *Miniredis) slowHook(c *server.Peer, args []string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.slow = append(m.slow, SlowCommand{
+		ClientID: c.ID(),
+		Args:     append([]string(nil), args...),
+		Duration: d,
+	})
+}
+
+// SetWriteDelay slows down how replies are written, for all connections: every
+// reply waits d.Delay, and is written in pieces of d.ChunkSize bytes, with
+// d.ChunkDelay between the pieces. That simulates slow networks, and can be
+// used to test read timeouts and partial reads in clients. The zero value
+// disables it, which is the default.
+func (m *Miniredis) SetWriteDelay(d server.WriteDelay) {
+	m.Lock()
+	defer m.Unlock()
+	m.writeDelay = d
+	if m.srv != nil {
+		m.srv.SetWriteDelay(d)
+	}
+}
+
+// SetConnTimeouts closes connections which are idle for too long (t.Idle,
+// same as the "timeout" config), or which take too long to send a command or
+// to read a reply (t.Read and t.Write), so the dead connection detection and
+// reconnect logic of a client can be tested. Pubsub connections and blocking
+// commands are never idle, same as redis. t.KeepAlive is the TCP keepalive
+// period, for new connections. The zero value is the default: no timeouts.
+func (m *Miniredis) SetConnTimeouts(t server.ConnTimeouts) {
+	m.Lock()
+	defer m.Unlock()
+	m.connTimeouts = t
+	if m.srv != nil {
+		m.srv.SetConnTimeouts(t)
+	}
+}
+
+// defaultMaxClients is the "maxclients" default of redis.
+const defaultMaxClients = 10000
+
+// SetMaxClients makes new connections fail with "ERR max number of clients
+// reached" once there are n connections, same as the "maxclients" config (or
+// CONFIG SET maxclients). Connections which are already there stay. The
+// default is 10000, same as redis. 0 is no limit.
+func (m *Miniredis) SetMaxClients(n int) {
+	m.Lock()
+	defer m.Unlock()
+	m.setMaxClients(n)
+}
+
+// No locks!
+func (m *Miniredis) setMaxClients(n int) {
+	m.maxClients = n
+	if m.srv != nil {
+		m.srv.SetMaxClients(n)
+	}
+}
+
+// SetClientWriteDelay is SetWriteDelay() for a single connection, by its
+// client ID (as given by HELLO). It overrides SetWriteDelay(), until the
+// connection closes.
+func (m *Miniredis) SetClientWriteDelay(id int, d server.WriteDelay) error {
+	m.Lock()
+	srv := m.srv
+	m.Unlock()
+	if srv == nil || !srv.SetPeerWriteDelay(id, d) {
+		return fmt.Errorf("no such client: %d", id)
+	}
+	return nil
+}
+
+// preHook runs before every command. It returns true if it handled the
+// command.
+func (m *Miniredis) preHook(c *server.Peer, cmd string, args ...string) bool {
+	if getCtx(c).nested {
+		// via Lua. We're already locked.
+		m.checkDeprecated(cmd)
+		if m.errorMsg != "" {
+			c.WriteError(m.errorMsg)
+			return true
+		}
+		if msg := m.notAllowed(c, cmd, args); msg != "" {
+			c.WriteError(msg)
+			return true
+		}
+		if msg := m.writeDenied(cmd); msg != "" {
+			c.WriteError(msg)
+			return true
+		}
+		if msg := m.scriptKeysError(getCtx(c), cmd, args); msg != "" {
+			c.WriteError(msg)
+			return true
+		}
+		if msg := m.replicaDenied(cmd); msg != "" {
+			c.WriteError(msg)
+			return true
+		}
+		db := m.db(getCtx(c).selectedDB)
+		keys := commandKeys(cmd, args)
+		db.lazyExpire(keys)
+		if msg := m.keyLimitError(getCtx(c), cmd, keys); msg != "" {
+			c.WriteError(msg)
+			return true
+		}
+		db.synthesize(keys)
+		db.touch(keys)
+		m.used(getCtx(c).selectedDB, keys)
+		m.track(m.writer, cmd, keys, false)
+		return false
+	}
+
+	if m.hijacked(c, cmd, args) {
+		return true
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.checkDeprecated(cmd)
+	if m.errorMsg != "" {
+		c.WriteError(m.errorMsg)
+		return true
+	}
+	if m.authRequired(getCtx(c)) && !noAuthCommands[cmd] {
+		setDirty(c)
+		c.WriteError(msgNoAuth)
+		return true
+	}
+	if msg := m.notAllowed(c, cmd, args); msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return true
+	}
+	if msg := m.writeDenied(cmd); msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return true
+	}
+	if t := getCtx(c).tenant; t != "" {
+		// args is the same slice the command gets.
+		for _, i := range commandKeyPositions(cmd, args) {
+			args[i] = t + args[i]
+		}
+	}
+	if m.cluster != nil {
+		if msg := m.cluster.redirect(cmd, args); msg != "" {
+			setDirty(c)
 			c.WriteError(msg)
 			return true
 		}
 	}
-	m.srv.SetPreHook(cb)
+	if msg := m.replicaDenied(cmd); msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return true
+	}
+	db := m.db(getCtx(c).selectedDB)
+	keys := commandKeys(cmd, args)
+	db.lazyExpire(keys)
+	if msg := m.keyLimitError(getCtx(c), cmd, keys); msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return true
+	}
+	db.synthesize(keys)
+	db.touch(keys)
+	m.used(getCtx(c).selectedDB, keys)
+	m.track(c, cmd, keys, true)
+	return false
+}
+
+// scriptKeysError checks the keys of a command called from a script, see
+// RequireDeclaredKeys() and Cluster(). No locks!
+func (m *Miniredis) scriptKeysError(ctx *connCtx, cmd string, args []string) string {
+	if m.declaredKeys {
+		for _, k := range commandKeys(cmd, args) {
+			if !declaredKey(ctx.nestedKeys, k) {
+				return msgUndeclaredKey(k, ctx.nestedSHA)
+			}
+		}
+	}
+	if m.cluster != nil {
+		return m.cluster.scriptError(ctx.nestedKeys, cmd, args)
+	}
+	return ""
+}
+
+func declaredKey(keys []string, k string) bool {
+	for _, d := range keys {
+		if d == k {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDeprecated calls the OnDeprecated() callback, if needed. No locks!
+func (m *Miniredis) checkDeprecated(cmd string) {
+	if m.deprecated == nil {
+		return
+	}
+	if r, ok := deprecatedCommands[cmd]; ok {
+		m.deprecated(cmd, r)
+	}
 }
 
 // isValidCMD returns true if command is valid and can be executed.
@@ -449,22 +1355,57 @@ func (m *Miniredis) isValidCMD(c *server.Peer, cmd string) bool {
 
 // handleAuth returns false if connection has no access. It sends the reply.
 func (m *Miniredis) handleAuth(c *server.Peer) bool {
-	if getCtx(c).nested {
+	ctx := getCtx(c)
+	if ctx.nested {
 		return true
 	}
 
 	m.Lock()
 	defer m.Unlock()
-	if len(m.passwords) == 0 {
-		return true
-	}
-	if !getCtx(c).authenticated {
-		c.WriteError("NOAUTH Authentication required.")
+	if m.authRequired(ctx) {
+		c.WriteError(msgNoAuth)
 		return false
 	}
 	return true
 }
 
+// commands which can be used before authenticating.
+var noAuthCommands = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+	"QUIT":  true,
+}
+
+// authRequired is true if the connection needs to authenticate before it can
+// do anything. A connection starts out unauthenticated, and a successful
+// AUTH or HELLO AUTH makes it authenticated for as long as it lives. A failed
+// attempt keeps the current state. No locks!
+func (m *Miniredis) authRequired(ctx *connCtx) bool {
+	return len(m.passwords) > 0 && !ctx.authenticated
+}
+
+// authenticate checks a username/password pair, and marks the connection as
+// authenticated if they are valid. No locks!
+// Users with a password win over tenants with the same name. No locks!
+func (m *Miniredis) authenticate(ctx *connCtx, username, password string) bool {
+	if setPW, ok := m.passwords[username]; ok {
+		if setPW != password {
+			return false
+		}
+		ctx.authenticated = true
+		ctx.user = username
+		ctx.tenant = ""
+		return true
+	}
+	if setPW, ok := m.tenants[username]; ok && setPW == password {
+		ctx.authenticated = true
+		ctx.user = username
+		ctx.tenant = username
+		return true
+	}
+	return false
+}
+
 // handlePubsub sends an error to the user if the connection is in PUBSUB mode.
 // It'll return true if it did.
 func (m *Miniredis) checkPubsub(c *server.Peer, cmd string) bool {
@@ -538,23 +1479,32 @@ func setDirty(c *server.Peer) {
 }
 
 func (m *Miniredis) addSubscriber(s *Subscriber) {
-	m.subscribers[s] = struct{}{}
+	m.subscribers = append(m.subscribers, s)
 }
 
 // closes and remove the subscriber.
 func (m *Miniredis) removeSubscriber(s *Subscriber) {
-	_, ok := m.subscribers[s]
-	delete(m.subscribers, s)
-	if ok {
-		s.Close()
+	for i, sub := range m.subscribers {
+		if sub == s {
+			m.subscribers = append(m.subscribers[:i:i], m.subscribers[i+1:]...)
+			s.Close()
+			return
+		}
 	}
 }
 
+// publish counts the receivers of a message, and queues it. It's sent to the
+// subscribers when the lock is released, see flushOutbox(). No locks!
 func (m *Miniredis) publish(c, msg string) int {
 	n := 0
-	for s := range m.subscribers {
-		n += s.Publish(c, msg)
+	for _, s := range m.subscribers {
+		n += s.receivers(c)
+	}
+	m.outbox = append(m.outbox, outMessage{channel: c, message: msg})
+	if len(m.published) >= maxPublished {
+		m.published = m.published[1:]
 	}
+	m.published = append(m.published, PublishedMessage{Channel: c, Message: msg, Receivers: n})
 	return n
 }
 
@@ -567,7 +1517,9 @@ func (m *Miniredis) subscribedState(c *server.Peer) *Subscriber {
 	}
 
 	sub = newSubscriber()
+	sub.peer = c
 	m.addSubscriber(sub)
+	c.SetNoIdle(true)
 
 	c.OnDisconnect(func() {
 		m.Lock()
@@ -576,10 +1528,6 @@ func (m *Miniredis) subscribedState(c *server.Peer) *Subscriber {
 	})
 
 	ctx.subscriber = sub
-
-	go monitorPublish(c, sub.publish)
-	go monitorPpublish(c, sub.ppublish)
-
 	return sub
 }
 
@@ -591,6 +1539,7 @@ func endSubscriber(m *Miniredis, c *server.Peer) {
 		m.removeSubscriber(sub) // will Close() the sub
 	}
 	ctx.subscriber = nil
+	c.SetNoIdle(false)
 }
 
 // Start a new pubsub subscriber. It can (un) subscribe to channels and
@@ -608,11 +1557,7 @@ func (m *Miniredis) NewSubscriber() *Subscriber {
 }
 
 func (m *Miniredis) allSubscribers() []*Subscriber {
-	var subs []*Subscriber
-	for s := range m.subscribers {
-		subs = append(subs, s)
-	}
-	return subs
+	return append([]*Subscriber(nil), m.subscribers...)
 }
 
 func (m *Miniredis) Seed(seed int) {
@@ -639,22 +1584,27 @@ func (m *Miniredis) shuffle(l []string) {
 	}
 }
 
+// effectiveNow is the time set with SetTime(), or the current time. The current
+// time doesn't change while a Lua script runs, same as with redis.
 func (m *Miniredis) effectiveNow() time.Time {
 	if !m.now.IsZero() {
 		return m.now
 	}
+	if !m.scriptNow.IsZero() {
+		return m.scriptNow
+	}
 	return time.Now().UTC()
 }
 
 // convert a unixtimestamp to a duration, to use an absolute time as TTL.
 // d can be either time.Second or time.Millisecond.
-func (m *Miniredis) at(i int, d time.Duration) time.Duration {
+func (m *Miniredis) at(i int64, d time.Duration) time.Duration {
 	var ts time.Time
 	switch d {
 	case time.Millisecond:
-		ts = time.Unix(int64(i/1000), 1000000*int64(i%1000))
+		ts = time.Unix(i/1000, 1000000*(i%1000))
 	case time.Second:
-		ts = time.Unix(int64(i), 0)
+		ts = time.Unix(i, 0)
 	default:
 		panic("invalid time unit (d). Fixme!")
 	}
@@ -671,13 +1621,21 @@ func (m *Miniredis) copy(
 		return ErrKeyNotFound
 	}
 
+	destDB.beforeAll(dst)
+	cloneKey(srcDB, src, destDB, dst)
+	destDB.bump(dst)
+	return nil
+}
+
+// cloneKey copies a key, with its TTL, without marking it as changed. No locks!
+func cloneKey(srcDB *RedisDB, src string, destDB *RedisDB, dst string) {
 	switch srcDB.t(src) {
 	case "string":
-		destDB.stringKeys[dst] = srcDB.stringKeys[src]
+		destDB.stringKeys[dst] = srcDB.stringKeys[src].copy()
 	case "hash":
 		destDB.hashKeys[dst] = copyHashKey(srcDB.hashKeys[src])
 	case "list":
-		destDB.listKeys[dst] = srcDB.listKeys[src]
+		destDB.listKeys[dst] = append(listKey(nil), srcDB.listKeys[src]...)
 	case "set":
 		destDB.setKeys[dst] = copySetKey(srcDB.setKeys[src])
 	case "zset":
@@ -690,11 +1648,9 @@ func (m *Miniredis) copy(
 		panic("missing case")
 	}
 	destDB.keys[dst] = srcDB.keys[src]
-	destDB.keyVersion[dst]++
-	if v, ok := srcDB.ttl[src]; ok {
-		destDB.ttl[dst] = v
+	if v, ok := srcDB.ttl.get(src); ok {
+		destDB.ttl.set(dst, v)
 	}
-	return nil
 }
 
 func copyHashKey(orig hashKey) hashKey {
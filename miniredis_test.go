@@ -3,7 +3,12 @@ package miniredis
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -240,6 +245,54 @@ func TestExpireWithFastForward(t *testing.T) {
 	equals(t, 1, len(s.Keys()))
 }
 
+func TestAdvanceClock(t *testing.T) {
+	s := RunT(t)
+	sub, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer sub.Close()
+
+	ok(t, s.NotifyKeyspaceEvents("Ex"))
+	mustDo(t, sub,
+		"PSUBSCRIBE", "__keyevent@*__:expired",
+		proto.Array(proto.String("psubscribe"), proto.String("__keyevent@*__:expired"), proto.Int(1)),
+	)
+
+	s.Set("b", "1")
+	s.Set("a", "1")
+	s.Set("c", "1")
+	s.Set("persistent", "1")
+	s.SetTTL("b", 10*time.Second)
+	s.SetTTL("a", 10*time.Second)
+	s.SetTTL("c", time.Minute)
+	s.DB(2).Set("other", "1")
+	s.DB(2).SetTTL("other", time.Second)
+	events := s.KeyEvents("*", 10)
+
+	equals(t, []ExpiredKey(nil), s.AdvanceClock(time.Second/2))
+	equals(t, []ExpiredKey{
+		{DB: 0, Key: "a"},
+		{DB: 0, Key: "b"},
+		{DB: 2, Key: "other"},
+	}, s.AdvanceClock(10*time.Second))
+	equals(t, []string{"c", "persistent"}, s.Keys())
+
+	for _, k := range []string{"0 a", "0 b", "2 other"} {
+		mustRead(t, sub,
+			proto.Strings("pmessage", "__keyevent@*__:expired", "__keyevent@"+k[:1]+"__:expired", k[2:]),
+		)
+	}
+	events.Close()
+	var seen []KeyEvent
+	for e := range events.Events() {
+		seen = append(seen, e)
+	}
+	equals(t, []KeyEvent{
+		{DB: 0, Key: "a", Event: "expired"},
+		{DB: 0, Key: "b", Event: "expired"},
+		{DB: 2, Key: "other", Event: "expired"},
+	}, seen)
+}
+
 /*
 we don't have the redis client anymore
 func TestPool(t *testing.T) {
@@ -314,3 +367,891 @@ func TestMiniredis_isValidCMD(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandTimeout(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	s.SetCommandTimeout(10 * time.Millisecond)
+
+	release := make(chan struct{})
+	s.Server().Register("HANG", func(c *server.Peer, cmd string, args []string) {
+		s.Lock()
+		defer s.Unlock()
+		<-release
+		c.WriteOK()
+	})
+
+	c1, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c1.Close()
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+
+	t.Run("blocking", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c1.Do("BLPOP", "l", "1")
+		}()
+		time.Sleep(30 * time.Millisecond)
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+		mustDo(t, c2, "LPUSH", "l", "a", proto.Int(1))
+		<-done
+	})
+
+	t.Run("hanging", func(t *testing.T) {
+		done := make(chan string)
+		go func() {
+			res, _ := c1.Do("HANG")
+			done <- res
+		}()
+		time.Sleep(30 * time.Millisecond)
+		mustDo(t, c2, "PING", proto.Error(server.MsgBusy))
+
+		close(release)
+		equals(t, proto.Inline("OK"), <-done)
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+	})
+}
+
+func TestOnDeprecated(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	var seen []string
+	s.OnDeprecated(func(cmd, replacement string) {
+		seen = append(seen, cmd+": "+replacement)
+	})
+
+	mustOK(t, c, "SETEX", "foo", "10", "bar")
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	mustOK(t, c, "HMSET", "h", "k", "v")
+	mustDo(t, c,
+		"EVAL", "return redis.call('GETSET', 'foo', 'baz')", "0",
+		proto.String("bar"),
+	)
+	equals(t, []string{
+		"SETEX: SET with the EX argument",
+		"HMSET: HSET with multiple field-value pairs",
+		"GETSET: SET with the GET argument",
+	}, seen)
+
+	s.OnDeprecated(nil)
+	mustDo(t, c, "GETSET", "foo", "bar", proto.String("baz"))
+	equals(t, 3, len(seen))
+}
+
+func TestKeyInfo(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	now := time.Date(2022, 3, 14, 12, 0, 0, 0, time.UTC)
+	s.SetTime(now)
+
+	_, err = s.KeyInfo("nosuch")
+	equals(t, ErrKeyNotFound, err)
+
+	s.Set("direct", "value")
+	ki, err := s.KeyInfo("direct")
+	ok(t, err)
+	equals(t, KeyInfo{Type: "string", Encoding: "embstr", Version: 1, Size: 11}, ki)
+
+	mustOK(t, c, "SET", "foo", "12", "EX", "10")
+	ki, err = s.KeyInfo("foo")
+	ok(t, err)
+	equals(t, KeyInfo{Type: "string", Encoding: "int", TTL: 10 * time.Second, LastAccess: now, Version: 1, Size: 5}, ki)
+	equals(t, "type=string encoding=int ttl=10s version=1 size=5 lastaccess=2022-03-14T12:00:00Z", ki.String())
+
+	for _, cas := range []struct {
+		cmd      []string
+		key      string
+		encoding string
+	}{
+		{[]string{"SET", "007", "007"}, "007", "embstr"},
+		{[]string{"SET", "long", strings.Repeat("x", 45)}, "long", "raw"},
+		{[]string{"HSET", "h", "f", "v"}, "h", "listpack"},
+		{[]string{"HSET", "bigh", "f", strings.Repeat("x", 65)}, "bigh", "hashtable"},
+		{[]string{"RPUSH", "l", "a", "b"}, "l", "listpack"},
+		{[]string{"SADD", "ints", "1", "2"}, "ints", "intset"},
+		{[]string{"SADD", "strs", "1", "two"}, "strs", "listpack"},
+		{[]string{"ZADD", "z", "1", "one"}, "z", "listpack"},
+		{[]string{"XADD", "planets", "1-1", "name", "Mercury"}, "planets", "stream"},
+		{[]string{"PFADD", "hll", "a"}, "hll", "raw"},
+	} {
+		_, err := c.Do(cas.cmd...)
+		ok(t, err)
+		ki, err := s.KeyInfo(cas.key)
+		ok(t, err)
+		equals(t, cas.encoding, ki.Encoding)
+	}
+
+	later := now.Add(time.Minute)
+	s.SetTime(later)
+	mustDo(t, c, "HGET", "h", "f", proto.String("v"))
+	ki, err = s.KeyInfo("h")
+	ok(t, err)
+	equals(t, later, ki.LastAccess)
+	equals(t, 3, ki.Size)
+
+	t.Run("lazy access times", func(t *testing.T) {
+		m := RunT(t)
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		m.SetTime(now)
+		mustOK(t, c, "SET", "foo", "bar")
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		equals(t, 0, len(m.db(0).lastAccess))
+
+		ki, err := m.KeyInfo("foo")
+		ok(t, err)
+		equals(t, time.Time{}, ki.LastAccess)
+
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		ki, err = m.KeyInfo("foo")
+		ok(t, err)
+		equals(t, now, ki.LastAccess)
+	})
+
+	t.Run("deleted keys", func(t *testing.T) {
+		m := RunT(t)
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		m.SetTime(now)
+		_, err = m.KeyInfo("nosuch") // tracks access times from now on
+		equals(t, ErrKeyNotFound, err)
+		mustOK(t, c, "SET", "foo", "bar")
+		must1(t, c, "DEL", "foo")
+		equals(t, 0, len(m.db(0).lastAccess))
+		m.Set("foo", "again")
+		ki, err := m.KeyInfo("foo")
+		ok(t, err)
+		equals(t, time.Time{}, ki.LastAccess)
+
+		// MOVE takes the access time along
+		must1(t, c, "MOVE", "foo", "1")
+		equals(t, 0, len(m.db(0).lastAccess))
+		ki, err = m.DB(1).KeyInfo("foo")
+		ok(t, err)
+		equals(t, now, ki.LastAccess)
+	})
+}
+
+func TestCopyFrom(t *testing.T) {
+	src := RunT(t)
+	src.Set("str", "value")
+	src.SetTTL("str", time.Minute)
+	src.HSet("hash", "f1", "v1", "f2", "v2")
+	src.RPush("list", "a", "b", "c")
+	src.SAdd("set", "x", "y")
+	src.ZAdd("zset", 1.5, "one")
+	src.ZAdd("zset", math.Inf(1), "inf")
+	_, err := src.XAdd("planets", "1-1", []string{"name", "Mercury"})
+	ok(t, err)
+	for i := 0; i < 250; i++ {
+		src.Set(fmt.Sprintf("many%d", i), "v")
+	}
+
+	s := RunT(t)
+	s.Set("str", "old")
+	s.Set("other", "stays")
+	ok(t, s.CopyFrom(src.Addr()))
+
+	equals(t, len(src.Keys())+1, len(s.Keys()))
+	s.CheckGet(t, "str", "value")
+	s.CheckGet(t, "other", "stays")
+	equals(t, time.Minute, s.TTL("str"))
+	equals(t, "v2", s.HGet("hash", "f2"))
+	s.CheckList(t, "list", "a", "b", "c")
+	s.CheckSet(t, "set", "x", "y")
+	zs, err := s.SortedSet("zset")
+	ok(t, err)
+	equals(t, map[string]float64{"one": 1.5, "inf": math.Inf(1)}, zs)
+	stream, err := s.Stream("planets")
+	ok(t, err)
+	equals(t, []StreamEntry{{ID: "1-1", Values: []string{"name", "Mercury"}}}, stream)
+
+	addr := src.Addr()
+	src.Close()
+	assert(t, s.CopyFrom(addr) != nil, "no server")
+}
+
+func TestKeyVersion(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	equals(t, uint(0), s.KeyVersion(0, "foo"))
+
+	mustOK(t, c, "SET", "foo", "bar")
+	equals(t, uint(1), s.KeyVersion(0, "foo"))
+	// overwriting is a single change
+	mustOK(t, c, "SET", "foo", "baz")
+	equals(t, uint(2), s.KeyVersion(0, "foo"))
+	mustNil(t, c, "SET", "foo", "baz", "NX")
+	equals(t, uint(2), s.KeyVersion(0, "foo"))
+	ok(t, s.Set("foo", "direct"))
+	equals(t, uint(3), s.KeyVersion(0, "foo"))
+
+	mustDo(t, c, "RPUSH", "l", "a", "b", "c", proto.Int(3))
+	equals(t, uint(1), s.KeyVersion(0, "l"))
+
+	t.Run("multi", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SET", "m", "1", proto.Inline("QUEUED"))
+		mustDo(t, c, "INCR", "m", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Inline("OK"), proto.Int(2)))
+		equals(t, uint(2), s.KeyVersion(0, "m"))
+	})
+
+	t.Run("script", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "redis.call('SET', KEYS[1], '1'); redis.call('INCR', KEYS[1]); return 0", "1", "lua",
+			proto.Int(0),
+		)
+		equals(t, uint(2), s.KeyVersion(0, "lua"))
+	})
+
+	t.Run("rename and del", func(t *testing.T) {
+		mustOK(t, c, "RENAME", "foo", "foo2")
+		equals(t, uint(4), s.KeyVersion(0, "foo"))
+		equals(t, uint(1), s.KeyVersion(0, "foo2"))
+		must1(t, c, "DEL", "foo2")
+		equals(t, uint(2), s.KeyVersion(0, "foo2"))
+		must0(t, c, "DEL", "foo2")
+		equals(t, uint(2), s.KeyVersion(0, "foo2"))
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		mustOK(t, c, "SELECT", "1")
+		mustOK(t, c, "SET", "w", "1")
+		equals(t, uint(0), s.KeyVersion(0, "w"))
+		equals(t, uint(1), s.KeyVersion(1, "w"))
+
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustOK(t, c2, "SELECT", "1")
+
+		mustOK(t, c, "WATCH", "w")
+		mustOK(t, c2, "FLUSHDB")
+		equals(t, uint(2), s.KeyVersion(1, "w"))
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "GET", "w", proto.Inline("QUEUED"))
+		mustNilList(t, c, "EXEC")
+	})
+}
+
+func TestWriteDelay(t *testing.T) {
+	s := RunT(t)
+	s.Set("foo", "bar")
+
+	// read whatever arrives in a single read
+	dial := func(t *testing.T) (net.Conn, func() (string, time.Duration)) {
+		t.Helper()
+		c, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		t.Cleanup(func() { c.Close() })
+		read := func() (string, time.Duration) {
+			start := time.Now()
+			c.SetReadDeadline(start.Add(time.Second))
+			buf := make([]byte, 100)
+			n, err := c.Read(buf)
+			ok(t, err)
+			return string(buf[:n]), time.Since(start)
+		}
+		return c, read
+	}
+
+	c, read := dial(t) // client ID 1
+	s.SetWriteDelay(server.WriteDelay{
+		Delay:      20 * time.Millisecond,
+		ChunkSize:  3,
+		ChunkDelay: 20 * time.Millisecond,
+	})
+	_, err := c.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"))
+	ok(t, err)
+	res, took := read()
+	equals(t, "$3\r", res)
+	assert(t, took >= 20*time.Millisecond, "delay")
+	res, took = read()
+	equals(t, "\nba", res)
+	assert(t, took >= 10*time.Millisecond, "chunk delay")
+	res, _ = read()
+	equals(t, "r\r\n", res)
+
+	t.Run("client", func(t *testing.T) {
+		c2, read2 := dial(t)
+		ok(t, s.SetClientWriteDelay(1, server.WriteDelay{ChunkSize: 1, ChunkDelay: 10 * time.Millisecond}))
+		assert(t, s.SetClientWriteDelay(99, server.WriteDelay{}) != nil, "no such client")
+
+		_, err := c.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		ok(t, err)
+		res, _ := read()
+		equals(t, "+", res)
+
+		// others still use the server delay
+		_, err = c2.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		ok(t, err)
+		res, _ = read2()
+		equals(t, "+PO", res)
+		read2()
+	})
+
+	t.Run("subscriber", func(t *testing.T) {
+		// a slow subscriber doesn't slow down anybody else
+		s.SetWriteDelay(server.WriteDelay{})
+		sub, readSub := dial(t) // client ID 3
+		_, err := sub.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$4\r\nchan\r\n"))
+		ok(t, err)
+		readSub()
+
+		ok(t, s.SetClientWriteDelay(3, server.WriteDelay{Delay: 500 * time.Millisecond}))
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		start := time.Now()
+		mustDo(t, c, "PUBLISH", "chan", "hi", proto.Int(1))
+		assert(t, time.Since(start) < 250*time.Millisecond, "publish took %s", time.Since(start))
+		res, took := readSub()
+		equals(t, proto.Strings("message", "chan", "hi"), res)
+		assert(t, took >= 200*time.Millisecond, "delay")
+	})
+
+	t.Run("off", func(t *testing.T) {
+		s.SetWriteDelay(server.WriteDelay{})
+		c, read := dial(t)
+		_, err := c.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"))
+		ok(t, err)
+		res, _ := read()
+		equals(t, "$3\r\nbar\r\n", res)
+	})
+}
+
+func TestDenyWrites(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("foo", "bar")
+	s.StartDenyWrites(DenyReadonly)
+	mustDo(t, c, "SET", "foo", "baz", proto.Error(DenyReadonly))
+	mustDo(t, c, "DEL", "foo", proto.Error(DenyReadonly))
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	mustContain(t, c, "EVAL", "return redis.call('SET', 'foo', 'baz')", "0", "READONLY")
+
+	mustOK(t, c, "MULTI")
+	mustDo(t, c, "INCR", "count", proto.Error(DenyReadonly))
+	mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+	mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+
+	// OOM only for commands which might use memory
+	s.StartDenyWrites(DenyOOM)
+	mustDo(t, c, "SET", "foo", "baz", proto.Error(DenyOOM))
+	must1(t, c, "DEL", "foo")
+
+	s.StopDenyWrites()
+	mustOK(t, c, "SET", "foo", "baz")
+	s.CheckGet(t, "foo", "baz")
+}
+
+func TestKeyLimit(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("foo", "bar")
+	s.SetKeyLimit(0, 2, "ERR quota exceeded")
+	mustOK(t, c, "SET", "foo", "baz")
+	mustOK(t, c, "SET", "bar", "baz")
+	mustDo(t, c, "SET", "baz", "baz", proto.Error("ERR quota exceeded"))
+	mustDo(t, c, "MSET", "foo", "1", "new", "2", proto.Error("ERR quota exceeded"))
+	mustOK(t, c, "MSET", "foo", "1", "bar", "2")
+	mustDo(t, c, "APPEND", "foo", "2", proto.Int(2))
+	mustContain(t, c, "EVAL", "return redis.call('SET', 'baz', 'baz')", "0", "quota exceeded")
+
+	// only the destination counts
+	must0(t, c, "SUNIONSTORE", "bar", "nosuch1", "nosuch2")
+	mustOK(t, c, "SET", "bar", "baz")
+	must0(t, c, "ZUNIONSTORE", "bar", "2", "nosuch1", "nosuch2")
+	mustOK(t, c, "SET", "bar", "baz")
+	must0(t, c, "BITOP", "OR", "bar", "nosuch1", "nosuch2")
+	mustOK(t, c, "SET", "bar", "baz")
+	must0(t, c, "ZRANGESTORE", "bar", "nosuch1", "0", "-1")
+	mustOK(t, c, "SET", "bar", "baz")
+	must0(t, c, "COPY", "nosuch1", "bar")
+	mustDo(t, c, "SUNIONSTORE", "new", "foo", proto.Error("ERR quota exceeded"))
+
+	mustOK(t, c, "MULTI")
+	mustDo(t, c, "LPUSH", "list", "a", proto.Error("ERR quota exceeded"))
+	mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+	mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+
+	// other DBs are not limited
+	mustOK(t, c, "SELECT", "1")
+	mustOK(t, c, "MSET", "a", "1", "b", "2", "c", "3")
+	mustOK(t, c, "SELECT", "0")
+
+	// deleting makes room
+	must1(t, c, "DEL", "foo")
+	mustOK(t, c, "SET", "baz", "baz")
+
+	s.SetKeyLimit(0, 3, "")
+	mustOK(t, c, "SET", "three", "3")
+	mustDo(t, c, "SET", "four", "4", proto.Error(DefaultKeyLimitMsg))
+
+	s.SetKeyLimit(0, 0, "")
+	mustOK(t, c, "SET", "four", "4")
+	equals(t, 4, len(s.Keys()))
+}
+
+func TestAllowOnly(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.AllowOnly("get", "SET", "Del", "MULTI", "EXEC", "EVAL")
+	mustOK(t, c, "SET", "foo", "bar")
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	mustDo(t, c, "CONFIG", "GET", "maxmemory",
+		proto.Error("NOPERM User default has no permissions to run the 'config' command"),
+	)
+	mustDo(t, c, "FLUSHALL",
+		proto.Error("NOPERM User default has no permissions to run the 'flushall' command"),
+	)
+	mustContain(t, c, "EVAL", "return redis.call('KEYS', '*')", "0", "NOPERM")
+	mustDo(t, c, "EVAL", "return redis.call('GET', 'foo')", "0", proto.String("bar"))
+
+	mustOK(t, c, "MULTI")
+	mustDo(t, c, "INCR", "count", proto.Error("NOPERM User default has no permissions to run the 'incr' command"))
+	mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+	mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+
+	t.Run("acl log", func(t *testing.T) {
+		log := s.ACLLog()
+		equals(t, 4, len(log))
+		equals(t, "command", log[0].Reason)
+		equals(t, "multi", log[0].Context)
+		equals(t, "incr", log[0].Object)
+		equals(t, "default", log[0].Username)
+		equals(t, "lua", log[1].Context)
+		equals(t, "keys", log[1].Object)
+		equals(t, "toplevel", log[3].Context)
+		equals(t, "config", log[3].Object)
+
+		mustDo(t, c, "FLUSHALL",
+			proto.Error("NOPERM User default has no permissions to run the 'flushall' command"),
+		)
+		equals(t, 4, len(s.ACLLog()))
+		equals(t, 2, s.ACLLog()[0].Count)
+		s.ResetACLLog()
+	})
+
+	t.Run("user", func(t *testing.T) {
+		s.RequireUserAuth("alice", "secret")
+		defer s.RequireAuth("")
+		s.AllowOnly("AUTH", "GET")
+		mustOK(t, c, "AUTH", "alice", "secret")
+		mustDo(t, c, "SET", "foo", "baz",
+			proto.Error("NOPERM User alice has no permissions to run the 'set' command"),
+		)
+		equals(t, "alice", s.ACLLog()[0].Username)
+	})
+
+	s.AllowOnly()
+	must1(t, c, "DEL", "foo")
+	mustDo(t, c, "KEYS", "*", proto.Strings())
+}
+
+type fakeTester struct {
+	failed  string
+	cleanup []func()
+	logs    []string
+}
+
+func (f *fakeTester) Fatalf(format string, args ...interface{}) {
+	f.failed = fmt.Sprintf(format, args...)
+}
+
+func (f *fakeTester) Cleanup(cb func()) {
+	f.cleanup = append(f.cleanup, cb)
+}
+
+func (f *fakeTester) Failed() bool {
+	return f.failed != ""
+}
+
+func (f *fakeTester) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func TestGoroutineLeakCheck(t *testing.T) {
+	waitFor := func(t *testing.T, what string, f func() bool) {
+		t.Helper()
+		for i := 0; i < 100 && !f(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert(t, f(), what)
+	}
+
+	t.Run("connections", func(t *testing.T) {
+		s := RunT(t)
+		defer s.GoroutineLeakCheck(t)
+
+		c1, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c1.Close()
+		mustDo(t, c1, "PING", proto.Inline("PONG"))
+
+		c2, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		_, err = c2.Write([]byte("*3\r\n$5\r\nBLPOP\r\n$4\r\nlist\r\n$1\r\n0\r\n"))
+		ok(t, err)
+		waitFor(t, "blocked", func() bool {
+			cs := s.ActiveConnections()
+			return len(cs) == 2 && cs[1].Blocked
+		})
+		cs := s.ActiveConnections()
+		equals(t, 1, cs[0].ID)
+		equals(t, false, cs[0].Blocked)
+		equals(t, 2, cs[1].ID)
+		equals(t, c2.LocalAddr().String(), cs[1].Addr)
+
+		// an abandoned blocked client doesn't keep its goroutines
+		c2.Close()
+		waitFor(t, "gone", func() bool {
+			return len(s.ActiveConnections()) == 1 && atomic.LoadInt32(&s.goroutines) == 0
+		})
+	})
+
+	t.Run("blocked on close", func(t *testing.T) {
+		s := RunT(t)
+		c, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c.Close()
+		_, err = c.Write([]byte("*3\r\n$5\r\nBLPOP\r\n$4\r\nlist\r\n$1\r\n0\r\n"))
+		ok(t, err)
+		waitFor(t, "blocked", func() bool {
+			cs := s.ActiveConnections()
+			return len(cs) == 1 && cs[0].Blocked
+		})
+		s.GoroutineLeakCheck(t)
+	})
+
+	t.Run("leak", func(t *testing.T) {
+		s := RunT(t)
+		sub := s.KeyEvents("*", 0)
+		f := &fakeTester{}
+		s.GoroutineLeakCheck(f)
+		mustContain := func(have, want string) {
+			t.Helper()
+			assert(t, strings.Contains(have, want), "have %q, want %q", have, want)
+		}
+		mustContain(f.failed, "1 other goroutines")
+		mustContain(f.failed, "open KeyEvents() subscriptions: 1")
+
+		sub.Close()
+		f = &fakeTester{}
+		s.GoroutineLeakCheck(f)
+		equals(t, "", f.failed)
+	})
+}
+
+func TestFailOnSlow(t *testing.T) {
+	s := RunT(t)
+	f := &fakeTester{}
+	s.FailOnSlow(50*time.Millisecond, f)
+	s.Server().Register("SLEEP", func(c *server.Peer, cmd string, args []string) {
+		time.Sleep(100 * time.Millisecond)
+		c.WriteOK()
+	})
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustOK(t, c, "SET", "foo", "bar")
+	mustOK(t, c, "SLEEP", "a")
+
+	// waiting doesn't count
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.Push("list", "v")
+	}()
+	mustDo(t, c, "BLPOP", "list", "0", proto.Strings("list", "v"))
+
+	// but slow replies do
+	s.SetWriteDelay(server.WriteDelay{Delay: 60 * time.Millisecond})
+	mustOK(t, c, "SET", "foo", "baz")
+	s.SetWriteDelay(server.WriteDelay{})
+	// the hook runs once the reply is sent, which is before the next command
+	mustDo(t, c, "PING", proto.Inline("PONG"))
+
+	slow := s.SlowCommands()
+	equals(t, 2, len(slow))
+	equals(t, []string{"SLEEP", "a"}, slow[0].Args)
+	assert(t, slow[0].Duration >= 100*time.Millisecond, "duration")
+	equals(t, 1, slow[0].ClientID)
+	equals(t, []string{"SET", "foo", "baz"}, slow[1].Args)
+
+	equals(t, 1, len(f.cleanup))
+	f.cleanup[0]()
+	assert(t, strings.HasPrefix(f.failed, "2 redis commands took longer than 50ms: \"SLEEP a\" took "), "failed: %q", f.failed)
+}
+
+func TestTracer(t *testing.T) {
+	s := RunT(t)
+	spans := make(chan Span, 10)
+	s.SetTracer(func(sp Span) {
+		spans <- sp
+	})
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	before := time.Now()
+	mustOK(t, c, "SET", "foo", "bar")
+	sp := <-spans
+	equals(t, "SET", sp.Name)
+	equals(t, []string{"foo", "bar"}, sp.Args)
+	equals(t, "foo", sp.Key)
+	equals(t, 0, sp.DB)
+	equals(t, "", sp.Error)
+	equals(t, 1, sp.ClientID)
+	assert(t, !sp.Start.Before(before), "start")
+	assert(t, sp.Duration > 0, "duration")
+
+	mustOK(t, c, "select", "2")
+	sp = <-spans
+	equals(t, "SELECT", sp.Name)
+	equals(t, "", sp.Key)
+	equals(t, 2, sp.DB)
+
+	mustDo(t, c, "LPUSH", "foo", proto.Error(errWrongNumber("lpush")))
+	sp = <-spans
+	equals(t, "LPUSH", sp.Name)
+	equals(t, errWrongNumber("lpush"), sp.Error)
+
+	// the tracer can use miniredis
+	s.SetTracer(func(sp Span) {
+		s.Set("traced", sp.Name)
+		spans <- sp
+	})
+	mustOK(t, c, "SET", "foo", "bar")
+	<-spans
+	v, err := s.Get("traced")
+	ok(t, err)
+	equals(t, "SET", v)
+
+	s.SetTracer(nil)
+	mustOK(t, c, "SET", "foo", "bar")
+	mustOK(t, c, "SET", "foo", "bar")
+	equals(t, 0, len(spans))
+}
+
+func TestReplyAttributes(t *testing.T) {
+	s := RunT(t)
+	s.SetReplyAttributes(func(cmd string, args []string) map[string]string {
+		if cmd != "GET" {
+			return nil
+		}
+		return map[string]string{"ttl": "10", "key": args[0]}
+	})
+	s.Set("foo", "bar")
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	// RESP2 has no attributes
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+
+	withAttrs := "|2\r\n" + proto.String("key") + proto.String("foo") +
+		proto.String("ttl") + proto.String("10")
+	mustContain(t, c, "HELLO", "3", "miniredis")
+	mustDo(t, c, "GET", "foo", withAttrs+proto.String("bar"))
+	mustDo(t, c, "GET", "nosuch", "|2\r\n"+proto.String("key")+proto.String("nosuch")+
+		proto.String("ttl")+proto.String("10")+proto.NilResp3)
+	mustOK(t, c, "SET", "foo", "baz")
+
+	t.Run("multi", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.String("baz")))
+	})
+
+	t.Run("script", func(t *testing.T) {
+		mustDo(t, c, "EVAL", "return redis.call('GET', 'foo')", "0", proto.String("baz"))
+	})
+
+	s.SetReplyAttributes(nil)
+	mustDo(t, c, "GET", "foo", proto.String("baz"))
+}
+
+func TestHappensBefore(t *testing.T) {
+	m := RunT(t)
+
+	for i := 0; i < 50; i++ {
+		seeded := make(chan struct{})
+		go func() {
+			m.Set("foo", strconv.Itoa(i))
+			m.DB(3).HSet("h", "f", strconv.Itoa(i))
+			m.Copy(0, "foo", 2, "copied")
+			close(seeded)
+		}()
+
+		<-seeded
+		c, err := proto.Dial(m.Addr())
+		ok(t, err)
+		mustDo(t, c, "GETDEL", "foo", proto.String(strconv.Itoa(i)))
+		mustOK(t, c, "SELECT", "2")
+		mustDo(t, c, "GET", "copied", proto.String(strconv.Itoa(i)))
+		mustOK(t, c, "SELECT", "3")
+		mustDo(t, c, "HGET", "h", "f", proto.String(strconv.Itoa(i)))
+		c.Close()
+	}
+
+	// no races between the methods which use the selected DB, and Select()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			m.Select(i % 2)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		m.Set("foo", "bar")
+		m.Copy(0, "foo", 1, "bar")
+	}
+	<-done
+}
+
+func TestReplaceWith(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("user", "v1 blob")
+	s.SetTTL("user", time.Hour)
+	s.ReplaceWithHash("user", map[string]string{"name": "alice", "age": "42"})
+	equals(t, "hash", s.Type("user"))
+	equals(t, time.Hour, s.TTL("user"))
+	mustDo(t, c, "HGET", "user", "name", proto.String("alice"))
+	mustDo(t, c, "HLEN", "user", proto.Int(2))
+
+	// a hash replaces the old fields
+	s.ReplaceWithHash("user", map[string]string{"name": "bob"})
+	mustDo(t, c, "HGETALL", "user", proto.Strings("name", "bob"))
+
+	s.ReplaceWithList("user", "a", "b")
+	mustDo(t, c, "LRANGE", "user", "0", "-1", proto.Strings("a", "b"))
+	s.ReplaceWithSet("user", "a")
+	mustDo(t, c, "SMEMBERS", "user", proto.Strings("a"))
+	s.ReplaceWithSortedSet("user", map[string]float64{"a": 1, "b": 2})
+	mustDo(t, c, "ZRANGE", "user", "0", "-1", "WITHSCORES", proto.Strings("a", "1", "b", "2"))
+	s.ReplaceWithString("user", "v3")
+	mustDo(t, c, "GET", "user", proto.String("v3"))
+	equals(t, time.Hour, s.TTL("user"))
+
+	// empty deletes the key, and its TTL
+	s.ReplaceWithList("user")
+	equals(t, false, s.Exists("user"))
+	equals(t, time.Duration(0), s.TTL("user"))
+
+	// new keys have no TTL
+	s.ReplaceWithSet("new", "a")
+	equals(t, time.Duration(0), s.TTL("new"))
+
+	s.DB(2).ReplaceWithHash("user", map[string]string{"f": "v"})
+	equals(t, "hash", s.DB(2).Type("user"))
+}
+
+func TestConnTimeouts(t *testing.T) {
+	s := RunT(t)
+	s.SetConnTimeouts(server.ConnTimeouts{Idle: 50 * time.Millisecond, Read: 50 * time.Millisecond})
+	dial := func(t *testing.T) *proto.Client {
+		t.Helper()
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		c := dial(t)
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+		time.Sleep(150 * time.Millisecond)
+		_, err := c.Do("PING")
+		assert(t, err != nil, "connection is closed")
+	})
+
+	t.Run("active", func(t *testing.T) {
+		c := dial(t)
+		for i := 0; i < 6; i++ {
+			mustDo(t, c, "PING", proto.Inline("PONG"))
+			time.Sleep(25 * time.Millisecond)
+		}
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		c := dial(t)
+		mustDo(t, c, "BLPOP", "nosuch", "0.15", proto.NilList)
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+	})
+
+	t.Run("slow reply", func(t *testing.T) {
+		c := dial(t)
+		s.SetWriteDelay(server.WriteDelay{Delay: 150 * time.Millisecond})
+		mustDo(t, c, "BLPOP", "nosuch", "0.15", proto.NilList)
+		s.SetWriteDelay(server.WriteDelay{})
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+	})
+
+	t.Run("pubsub", func(t *testing.T) {
+		c := dial(t)
+		mustDo(t, c, "SUBSCRIBE", "news",
+			proto.Array(proto.String("subscribe"), proto.String("news"), proto.Int(1)),
+		)
+		time.Sleep(150 * time.Millisecond)
+		s.Publish("news", "still there")
+		res, err := c.Read()
+		ok(t, err)
+		equals(t, proto.Strings("message", "news", "still there"), res)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		_, err = raw.Write([]byte("*1\r\n$4\r\nPI"))
+		ok(t, err)
+		raw.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = raw.Read(make([]byte, 10))
+		assert(t, err != nil && !isTimeoutErr(err), "connection is closed")
+	})
+
+	t.Run("config", func(t *testing.T) {
+		m := NewMiniRedis()
+		ok(t, m.LoadConfigFile("testdata/redis.conf"))
+		equals(t, server.ConnTimeouts{Idle: 300 * time.Second, KeepAlive: 60 * time.Second}, m.connTimeouts)
+	})
+}
+
+func isTimeoutErr(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
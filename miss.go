@@ -0,0 +1,89 @@
+package miniredis
+
+// Keys made on demand. See Miniredis.OnMiss().
+
+import (
+	"fmt"
+)
+
+// MissFunc gives the value of a key which doesn't exist, see OnMiss(). The
+// value is a string for a string key, a map[string]string for a hash, a
+// []string for a list, a map[string]struct{} for a set, or a
+// map[string]float64 for a sorted set. ok is false if the key should stay
+// missing.
+type MissFunc func(db int, key string) (value interface{}, ok bool)
+
+// OnMiss makes miniredis call f when a command uses a key which doesn't
+// exist, so tests can make fixtures on demand (say, a hash for every
+// "user:N"), instead of adding millions of keys up front. If f gives a value
+// the key is added, and the command runs as if the key was always there.
+//
+// f is called at most once for every key, as if all keys were added before
+// the test: a key which is deleted stays deleted. KEYS, SCAN, DBSIZE, and the
+// Go methods, such as Get(), only see the keys which a command made. For
+// connections with a Tenant() the key includes the prefix.
+//
+// f runs while miniredis is locked, so it must not call any methods on the
+// Miniredis. Use nil to remove it.
+func (m *Miniredis) OnMiss(f MissFunc) {
+	m.Lock()
+	defer m.Unlock()
+	m.onMiss = f
+	m.missed = map[dbKey]struct{}{}
+}
+
+// synthesize adds the OnMiss() values of keys which don't exist. No locks!
+func (db *RedisDB) synthesize(keys []string) {
+	m := db.master
+	if m.onMiss == nil {
+		return
+	}
+	for _, k := range keys {
+		dk := dbKey{db: db.id, key: k}
+		if _, ok := m.missed[dk]; ok || db.exists(k) {
+			continue
+		}
+		m.missed[dk] = struct{}{}
+		v, ok := m.onMiss(db.id, k)
+		if !ok {
+			continue
+		}
+		db.addMissed(k, v)
+	}
+}
+
+// addMissed adds an OnMiss() value. It doesn't bump() the key, since it's
+// not a change: it was "always" there. No locks!
+func (db *RedisDB) addMissed(k string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		db.keys[k] = "string"
+		db.stringKeys[k] = newRope(v)
+	case map[string]string:
+		if len(v) == 0 {
+			return
+		}
+		db.keys[k] = "hash"
+		db.hashKeys[k] = copyHashKey(v)
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+		db.keys[k] = "list"
+		db.listKeys[k] = append(listKey(nil), v...)
+	case map[string]struct{}:
+		if len(v) == 0 {
+			return
+		}
+		db.keys[k] = "set"
+		db.setKeys[k] = copySetKey(v)
+	case map[string]float64:
+		if len(v) == 0 {
+			return
+		}
+		db.keys[k] = "zset"
+		db.sortedsetKeys[k] = copySortedSet(v)
+	default:
+		panic(fmt.Sprintf("OnMiss: unsupported value type %T for key %q", v, k))
+	}
+}
@@ -0,0 +1,79 @@
+package miniredis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestOnMiss(t *testing.T) {
+	m := RunT(t)
+	var asked []string
+	m.OnMiss(func(db int, key string) (interface{}, bool) {
+		asked = append(asked, key)
+		switch {
+		case db != 0:
+			return nil, false
+		case strings.HasPrefix(key, "user:"):
+			return map[string]string{"name": "user " + key[5:]}, true
+		case key == "counter":
+			return "41", true
+		case key == "list":
+			return []string{"a", "b"}, true
+		case key == "set":
+			return map[string]struct{}{"a": {}}, true
+		case key == "zset":
+			return map[string]float64{"a": 1}, true
+		case key == "empty":
+			return []string{}, true
+		}
+		return nil, false
+	})
+	c, err := proto.Dial(m.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c, "HGET", "user:12", "name", proto.String("user 12"))
+	mustDo(t, c, "INCR", "counter", proto.Int(42))
+	mustDo(t, c, "LRANGE", "list", "0", "-1", proto.Strings("a", "b"))
+	mustDo(t, c, "SMEMBERS", "set", proto.Strings("a"))
+	mustDo(t, c, "ZSCORE", "zset", "a", proto.String("1"))
+	mustNilList(t, c, "LPOP", "empty", "1")
+	mustNil(t, c, "GET", "nosuch")
+	equals(t, []string{"user:12", "counter", "list", "set", "zset", "empty", "nosuch"}, asked)
+
+	// only the used keys exist
+	equals(t, []string{"counter", "list", "set", "user:12", "zset"}, m.Keys())
+
+	t.Run("once", func(t *testing.T) {
+		asked = nil
+		mustDo(t, c, "DEL", "user:12", proto.Int(1))
+		mustNil(t, c, "HGET", "user:12", "name")
+		mustNil(t, c, "GET", "nosuch")
+		equals(t, []string(nil), asked)
+	})
+
+	t.Run("db", func(t *testing.T) {
+		asked = nil
+		mustOK(t, c, "SELECT", "2")
+		mustDo(t, c, "EXISTS", "counter", proto.Int(0))
+		equals(t, []string{"counter"}, asked)
+		mustOK(t, c, "SELECT", "0")
+	})
+
+	t.Run("script", func(t *testing.T) {
+		mustDo(t, c, "EVAL", "return redis.call('HGET', KEYS[1], 'name')", "1", "user:99", proto.String("user 99"))
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		// a made key is not a change
+		mustOK(t, c, "WATCH", "user:7")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "HGET", "user:7", "name", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.String("user 7")))
+	})
+
+	m.OnMiss(nil)
+	mustNil(t, c, "HGET", "user:13", "name")
+}
@@ -0,0 +1,234 @@
+package miniredis
+
+// Keyspace notifications. See https://redis.io/docs/manual/keyspace-notifications/
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// notification classes, as used in the "notify-keyspace-events" config.
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZset                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	notifyModule               // d
+	notifyNew                  // n
+
+	// A: alias for "g$lshzxet"
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZset | notifyExpired | notifyEvicted | notifyStream
+)
+
+var errInvalidNotifyFlags = errors.New("ERR Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+
+func parseNotifyFlags(flags string) (int, error) {
+	res := 0
+	for _, f := range flags {
+		switch f {
+		case 'A':
+			res |= notifyAll
+		case 'g':
+			res |= notifyGeneric
+		case '$':
+			res |= notifyString
+		case 'l':
+			res |= notifyList
+		case 's':
+			res |= notifySet
+		case 'h':
+			res |= notifyHash
+		case 'z':
+			res |= notifyZset
+		case 'x':
+			res |= notifyExpired
+		case 'e':
+			res |= notifyEvicted
+		case 'K':
+			res |= notifyKeyspace
+		case 'E':
+			res |= notifyKeyevent
+		case 't':
+			res |= notifyStream
+		case 'm':
+			res |= notifyKeyMiss
+		case 'd':
+			res |= notifyModule
+		case 'n':
+			res |= notifyNew
+		default:
+			return 0, errInvalidNotifyFlags
+		}
+	}
+	return res, nil
+}
+
+// NotifyKeyspaceEvents is the equivalent of `CONFIG SET
+// notify-keyspace-events <flags>`, with flags such as "KEA" or "Kt". An empty
+// string disables notifications, which is the default.
+// Events are published as normal pubsub messages on the "__keyspace@<db>__:<key>"
+// and "__keyevent@<db>__:<event>" channels.
+//
+// Only the events of stream commands, and "expired" events from FastForward(),
+// are currently implemented.
+//
+// Like redis, the events of a MULTI or a script are sent after the EXEC or
+// the script is done, in the order they happened, together with the messages
+// of the PUBLISH calls in there.
+func (m *Miniredis) NotifyKeyspaceEvents(flags string) error {
+	f, err := parseNotifyFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.notifyFlags = f
+	return nil
+}
+
+// outMessage is a keyspace event or a pubsub message, waiting in the outbox.
+type outMessage struct {
+	event   *KeyEvent // for the KeyEvents() subscriptions
+	channel string
+	message string
+}
+
+// flushOutbox sends everything in the outbox, in order. It's called by
+// Unlock(), so the events and messages of a command, a MULTI, or a script
+// are sent once it's done, before the next command can start. No locks!
+func (m *Miniredis) flushOutbox() {
+	for _, o := range m.outbox {
+		if o.event != nil {
+			for s := range m.keyEvents {
+				s.add(*o.event)
+			}
+			continue
+		}
+		for _, s := range m.subscribers {
+			s.Publish(o.channel, o.message)
+		}
+	}
+	m.outbox = nil
+}
+
+// notify publishes a keyspace event, if the class is enabled. Subscriptions
+// from KeyEvents() always get the event. Nothing's sent until the lock is
+// released, see flushOutbox(). No locks!
+func (m *Miniredis) notify(db int, class int, event, key string) {
+	if len(m.keyEvents) > 0 {
+		m.outbox = append(m.outbox, outMessage{event: &KeyEvent{DB: db, Key: key, Event: event}})
+	}
+
+	if m.notifyFlags&class == 0 {
+		return
+	}
+	if m.notifyFlags&notifyKeyspace != 0 {
+		m.publish(fmt.Sprintf("__keyspace@%d__:%s", db, key), event)
+	}
+	if m.notifyFlags&notifyKeyevent != 0 {
+		m.publish(fmt.Sprintf("__keyevent@%d__:%s", db, event), key)
+	}
+}
+
+// KeyEvent is a keyspace event, as delivered by KeyEvents().
+type KeyEvent struct {
+	DB    int
+	Key   string
+	Event string // "xadd", "xtrim", &c.
+}
+
+// KeyEventSubscription gets keyspace events. See Miniredis.KeyEvents().
+type KeyEventSubscription struct {
+	m       *Miniredis
+	pattern *regexp.Regexp // nil matches nothing
+	events  chan KeyEvent
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []KeyEvent
+	closed  bool
+}
+
+// KeyEvents subscribes to the keyspace events of all keys matching the glob
+// pattern, in any DB. These events are independent of the
+// NotifyKeyspaceEvents() config, and only the events which are implemented
+// there are sent.
+//
+// The events of a MULTI or a script are queued after the EXEC or the script
+// is done, in order. Events are queued and never block commands. Events() is
+// a channel with the given buffer size, which can be 0 for an unbuffered
+// channel. After Close() the remaining events are still delivered, and the
+// channel is closed after the last one, so keep reading until then.
+func (m *Miniredis) KeyEvents(pattern string, buffer int) *KeyEventSubscription {
+	s := &KeyEventSubscription{
+		m:       m,
+		pattern: patternRE(pattern),
+		events:  make(chan KeyEvent, buffer),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	m.goroutine(s.run)
+
+	m.Lock()
+	defer m.Unlock()
+	m.keyEvents[s] = struct{}{}
+	return s
+}
+
+// Events gives the events, in order.
+func (s *KeyEventSubscription) Events() <-chan KeyEvent {
+	return s.events
+}
+
+// Close stops the subscription. Events which happened before Close() are still
+// delivered on the channel, which is closed afterwards.
+func (s *KeyEventSubscription) Close() {
+	s.m.Lock()
+	delete(s.m.keyEvents, s)
+	s.m.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Signal()
+}
+
+func (s *KeyEventSubscription) add(e KeyEvent) {
+	if s.pattern == nil || !s.pattern.MatchString(e.Key) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, e)
+	s.cond.Signal()
+}
+
+// run moves queued events to the channel.
+func (s *KeyEventSubscription) run() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			close(s.events)
+			return
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		s.events <- e
+	}
+}
@@ -26,6 +26,20 @@ func optIntErr(c *server.Peer, src string, dest *int, errMsg string) bool {
 	return true
 }
 
+// optCursor parses the cursor of a SCAN like command. Cursors are int64, also
+// on 32 bit platforms, since they can have a Restore() count in the high
+// bits. See scanPage().
+func optCursor(c *server.Peer, src string, dest *int64) bool {
+	n, err := strconv.ParseInt(src, 10, 64)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidCursor)
+		return false
+	}
+	*dest = n
+	return true
+}
+
 func optDuration(c *server.Peer, src string, dest *time.Duration) bool {
 	n, err := strconv.ParseFloat(src, 64)
 	if err != nil {
@@ -42,3 +56,49 @@ func optDuration(c *server.Peer, src string, dest *time.Duration) bool {
 	*dest = time.Duration(n*1_000_000) * time.Microsecond
 	return true
 }
+
+// optExpire parses the TTL option of cmd, in unit d (time.Second or
+// time.Millisecond), with the range checks redis does: in milliseconds the TTL
+// has to fit an int64, and, if it's not a unix timestamp, so does the TTL
+// plus now. With positive the TTL also has to be > 0, as for SET and GETEX.
+// Writes "invalid expire time" error to c if it's out of range. Returns
+// whether or not things were okay.
+func optExpire(c *server.Peer, cmd, src string, d time.Duration, unix, positive bool, now time.Time, dest *int64) bool {
+	n, err := strconv.ParseInt(src, 10, 64)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return false
+	}
+	ms, valid := n, true
+	switch {
+	case positive && n <= 0:
+		valid = false
+	case d == time.Second && (n > math.MaxInt64/1000 || n < math.MinInt64/1000):
+		valid = false
+	case d == time.Second:
+		ms = n * 1000
+	}
+	if !unix && ms > math.MaxInt64-(now.Unix()*1000+int64(now.Nanosecond())/int64(time.Millisecond)) {
+		valid = false
+	}
+	if !valid {
+		setDirty(c)
+		c.WriteError(errInvalidExpireTime(cmd))
+		return false
+	}
+	*dest = n
+	return true
+}
+
+// ttlDuration converts a TTL in unit d to a time.Duration. Those only go up
+// to ~292 years, so longer TTLs are clamped.
+func ttlDuration(n int64, d time.Duration) time.Duration {
+	switch {
+	case n > 0 && time.Duration(n) > math.MaxInt64/d:
+		return math.MaxInt64
+	case n < 0 && time.Duration(n) < math.MinInt64/d:
+		return math.MinInt64
+	}
+	return time.Duration(n) * d
+}
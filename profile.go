@@ -0,0 +1,164 @@
+package miniredis
+
+// Quirks of managed redis offerings and redis forks. See Miniredis.SetProfile().
+
+import (
+	"sort"
+	"strings"
+)
+
+// Profile bundles the differences of a redis flavor, see SetProfile().
+type Profile struct {
+	Disabled []string          // commands which don't exist, such as CONFIG
+	Cluster  bool              // always runs in cluster mode, see Cluster()
+	Info     map[string]string // added to, or replacing, fields in INFO server
+	Server   string            // "server" in HELLO. "miniredis" if empty.
+	Version  string            // same as SetVersion(), if not empty
+	Aliases  map[string]string // extra command names: alias -> command
+	LuaAlias string            // another name for the "redis" object in Lua
+}
+
+// Profiles of managed redis offerings, as they are by default. They are
+// approximations, based on what the providers document as restricted; make a
+// copy and change it if your setup differs.
+var (
+	// ProfileElastiCache is AWS ElastiCache, with cluster mode enabled.
+	ProfileElastiCache = Profile{
+		Disabled: []string{
+			"BGREWRITEAOF", "BGSAVE", "CONFIG", "DEBUG", "MIGRATE", "MODULE",
+			"PSYNC", "REPLCONF", "REPLICAOF", "SAVE", "SHUTDOWN", "SLAVEOF",
+			"SYNC",
+		},
+		Cluster: true,
+	}
+	// ProfileMemorystore is Google Cloud Memorystore for Redis, which is not
+	// clustered.
+	ProfileMemorystore = Profile{
+		Disabled: []string{
+			"BGREWRITEAOF", "BGSAVE", "CONFIG", "DEBUG", "LASTSAVE", "MIGRATE",
+			"MODULE", "MONITOR", "PSYNC", "REPLCONF", "REPLICAOF", "SAVE",
+			"SHUTDOWN", "SLAVEOF", "SYNC",
+		},
+	}
+	// ProfileValkey is Valkey 8. It says it's "valkey" in HELLO, but reports
+	// the last redis version it's compatible with as redis_version in INFO,
+	// and scripts can use server.call() as well as redis.call().
+	ProfileValkey = Profile{
+		Server:  "valkey",
+		Version: "8.0.1",
+		Info: map[string]string{
+			"redis_version":  "7.2.4",
+			"server_name":    "valkey",
+			"valkey_version": "8.0.1",
+		},
+		LuaAlias: "server",
+	}
+	// ProfileKeyDB is KeyDB 6, which looks like a redis 6.
+	ProfileKeyDB = Profile{
+		Server:  "redis",
+		Version: "6.3.4",
+	}
+)
+
+// SetProfile makes miniredis behave like a specific redis flavor, such as
+// ProfileElastiCache, ProfileMemorystore, or ProfileValkey, so tests can check
+// code against what it's deployed to, and code which detects the flavor can
+// be tested for every flavor: disabled commands give the same "unknown
+// command" error as they do there, HELLO and INFO report what the flavor
+// reports, the aliases work as commands, and Cluster() is turned on if the
+// profile needs it. A zero Profile{} undoes it, other than the cluster mode
+// and the version, which stay.
+//
+// It fails if an alias is for a command which doesn't exist, or already is a
+// command.
+func (m *Miniredis) SetProfile(p Profile) error {
+	if p.Cluster {
+		m.Cluster()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.srv != nil {
+		m.unaliasProfile()
+		if err := m.aliasProfile(p.Aliases); err != nil {
+			m.aliasProfile(m.profileAliases)
+			return err
+		}
+	}
+	m.profileAliases = p.Aliases
+	m.profileServer = p.Server
+	m.luaAlias = p.LuaAlias
+	if p.Version != "" {
+		m.version = p.Version
+	}
+	m.profileDisabled = nil
+	for _, c := range p.Disabled {
+		if m.profileDisabled == nil {
+			m.profileDisabled = map[string]bool{}
+		}
+		m.profileDisabled[strings.ToUpper(c)] = true
+	}
+	m.profileInfo = nil
+	for k, v := range p.Info {
+		if m.profileInfo == nil {
+			m.profileInfo = map[string]string{}
+		}
+		m.profileInfo[k] = v
+	}
+	return nil
+}
+
+// aliasProfile registers the aliases of a profile. On error none are. No
+// locks!
+func (m *Miniredis) aliasProfile(aliases map[string]string) error {
+	var done []string
+	for alias, cmd := range aliases {
+		if err := m.srv.Alias(alias, cmd); err != nil {
+			for _, a := range done {
+				m.srv.Rename(a, "")
+			}
+			return err
+		}
+		done = append(done, alias)
+	}
+	return nil
+}
+
+// unaliasProfile removes the aliases of the current profile. No locks!
+func (m *Miniredis) unaliasProfile() {
+	for alias := range m.profileAliases {
+		m.srv.Rename(alias, "")
+	}
+}
+
+// serverName is "server" in HELLO. No locks!
+func (m *Miniredis) serverName() string {
+	if m.profileServer == "" {
+		return "miniredis"
+	}
+	return m.profileServer
+}
+
+// profileFields changes the "field:value" lines of INFO server to what the
+// profile has. No locks!
+func (m *Miniredis) profileFields(lines []string) []string {
+	if len(m.profileInfo) == 0 {
+		return lines
+	}
+	seen := map[string]bool{}
+	for i, l := range lines {
+		k := strings.SplitN(l, ":", 2)[0]
+		if v, ok := m.profileInfo[k]; ok {
+			lines[i] = k + ":" + v
+			seen[k] = true
+		}
+	}
+	var extra []string
+	for k, v := range m.profileInfo {
+		if !seen[k] {
+			extra = append(extra, k+":"+v)
+		}
+	}
+	sort.Strings(extra)
+	return append(lines, extra...)
+}
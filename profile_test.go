@@ -0,0 +1,110 @@
+package miniredis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestProfile(t *testing.T) {
+	t.Run("elasticache", func(t *testing.T) {
+		s := RunT(t)
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		ok(t, s.SetProfile(ProfileElastiCache))
+		mustDo(t, c, "CONFIG", "GET", "maxmemory",
+			proto.Error("ERR unknown command `CONFIG`, with args beginning with: `GET`, `maxmemory`, "),
+		)
+		mustContain(t, c, "DEBUG", "SLEEP", "0", "unknown command `DEBUG`")
+		mustContain(t, c, "EVAL", "return redis.call('SAVE')", "0", "Unknown Redis command")
+		mustContain(t, c, "INFO", "server", "redis_mode:cluster")
+		mustContain(t, c, "CLUSTER", "NODES", "myself,master")
+		mustOK(t, c, "SET", "foo", "bar")
+
+		mustOK(t, c, "MULTI")
+		mustContain(t, c, "BGSAVE", "unknown command `BGSAVE`")
+		mustDo(t, c, "EXEC", proto.Error("EXECABORT Transaction discarded because of previous errors."))
+
+		ok(t, s.SetProfile(Profile{}))
+		mustContain(t, c, "CONFIG", "GET", "maxclients", "maxclients")
+		mustContain(t, c, "INFO", "server", "redis_mode:cluster")
+	})
+
+	t.Run("memorystore", func(t *testing.T) {
+		s := RunT(t)
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		ok(t, s.SetProfile(ProfileMemorystore))
+		mustContain(t, c, "MONITOR", "unknown command `MONITOR`")
+		mustContain(t, c, "INFO", "server", "redis_mode:standalone")
+		mustOK(t, c, "SET", "foo", "bar")
+	})
+
+	t.Run("info", func(t *testing.T) {
+		s := RunT(t)
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		s.SetVersion("7.0.7")
+		ok(t, s.SetProfile(Profile{
+			Info: map[string]string{
+				"redis_version": "7.1.0",
+				"os":            "Amazon ElastiCache",
+			},
+		}))
+		mustDo(t, c, "INFO", "server",
+			proto.String("# Server\r\nredis_version:7.1.0\r\nredis_mode:standalone\r\nos:Amazon ElastiCache\r\n"),
+		)
+	})
+
+	t.Run("valkey", func(t *testing.T) {
+		s := RunT(t)
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		ok(t, s.SetProfile(ProfileValkey))
+		mustContain(t, c, "HELLO", "2", "valkey")
+		mustContain(t, c, "HELLO", "2", "8.0.1")
+		mustDo(t, c, "INFO", "server",
+			proto.String("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\nserver_name:valkey\r\nvalkey_version:8.0.1\r\n"),
+		)
+		mustOK(t, c, "SET", "foo", "bar")
+		mustDo(t, c, "EVAL", "return server.call('GET', 'foo')", "0", proto.String("bar"))
+		mustDo(t, c, "EVAL", "return redis.call('GET', 'foo')", "0", proto.String("bar"))
+
+		ok(t, s.SetProfile(ProfileKeyDB))
+		mustContain(t, c, "HELLO", "2", "6.3.4")
+		mustContain(t, c, "INFO", "server", "redis_version:6.3.4")
+		mustContain(t, c, "EVAL", "return server.call('GET', 'foo')", "0", "server")
+	})
+
+	t.Run("aliases", func(t *testing.T) {
+		s := RunT(t)
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustFail(t, s.SetProfile(Profile{Aliases: map[string]string{"GET": "SET"}}), "command already registered: GET")
+		mustFail(t, s.SetProfile(Profile{Aliases: map[string]string{"FETCH": "NOSUCH"}}), "no such command: NOSUCH")
+
+		ok(t, s.SetProfile(Profile{Aliases: map[string]string{"FETCH": "GET"}}))
+		mustOK(t, c, "SET", "foo", "bar")
+		mustDo(t, c, "FETCH", "foo", proto.String("bar"))
+
+		s.Close()
+		ok(t, s.Restart())
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2, "FETCH", "foo", proto.String("bar"))
+
+		ok(t, s.SetProfile(Profile{}))
+		mustContain(t, c2, "FETCH", "foo", "unknown command `FETCH`")
+	})
+}
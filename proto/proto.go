@@ -149,12 +149,14 @@ func Read(r *bufio.Reader) (string, error) {
 	switch line[0] {
 	default:
 		return "", ErrProtocol
-	case '+', '-', ':', ',', '_':
+	case '+', '-', ':', ',', '_', '#', '(':
 		// +: inline string
 		// -: errors
 		// :: integer
 		// ,: float
 		// _: null
+		// #: boolean
+		// (: big number
 		// Simple line based replies.
 		return line, nil
 	case '$':
@@ -209,9 +211,37 @@ func Read(r *bufio.Reader) (string, error) {
 			line += next
 		}
 		return line, nil
+	case '|':
+		// attributes are: `|1\r\n...`, followed by the actual reply
+		attrs, err := readAttributes(r, line)
+		if err != nil {
+			return "", err
+		}
+		next, err := Read(r)
+		if err != nil {
+			return "", err
+		}
+		return attrs + next, nil
 	}
 }
 
+// readAttributes reads the key/value pairs of an attribute. line is its
+// first line.
+func readAttributes(r *bufio.Reader, line string) (string, error) {
+	length, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < length*2; i++ {
+		next, err := Read(r)
+		if err != nil {
+			return "", err
+		}
+		line += next
+	}
+	return line, nil
+}
+
 // Write a command in RESP3 proto. Used to write commands to redis.
 // Currently only supports string arrays.
 func Write(w io.Writer, cmd []string) error {
@@ -251,6 +281,21 @@ func Parse(b string) (interface{}, error) {
 		return strconv.Atoi(e)
 	case '$':
 		return ReadString(b)
+	case '|':
+		// attributes go before the reply, and are skipped.
+		r := bufio.NewReader(strings.NewReader(b))
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := readAttributes(r, line); err != nil {
+			return nil, err
+		}
+		next, err := Read(r)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(next)
 	case '*':
 		elems, err := ReadArray(b)
 		if err != nil {
@@ -115,6 +115,11 @@ func TestRead(t *testing.T) {
 		test(t, "~2\r\n-foo\r\n$3\r\nfoo\r\n")
 		test(t, "~-1\r\n")
 	})
+
+	t.Run("attributes", func(t *testing.T) {
+		test(t, "|1\r\n$3\r\nttl\r\n:10\r\n$3\r\nbar\r\n")
+		test(t, "|0\r\n*1\r\n-foo\r\n")
+	})
 }
 
 func TestReadArray(t *testing.T) {
@@ -24,6 +24,7 @@ type PubsubPmessage struct {
 type Subscriber struct {
 	publish  chan PubsubMessage
 	ppublish chan PubsubPmessage
+	peer     *server.Peer // for SUBSCRIBE, messages are written here directly
 	channels map[string]struct{}
 	patterns map[string]*regexp.Regexp
 	mu       sync.Mutex
@@ -124,7 +125,8 @@ func (s *Subscriber) Patterns() []string {
 }
 
 // Publish a message. Will return return how often we sent the message (can be
-// a match for a subscription and for a psubscription.
+// a match for a subscription and for a psubscription. The message is sent
+// before the pmessage.
 func (s *Subscriber) Publish(c, msg string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -134,7 +136,7 @@ func (s *Subscriber) Publish(c, msg string) int {
 subs:
 	for sub := range s.channels {
 		if sub == c {
-			s.publish <- PubsubMessage{c, msg}
+			s.sendMessage(PubsubMessage{c, msg})
 			found++
 			break subs
 		}
@@ -143,7 +145,7 @@ subs:
 pats:
 	for orig, pat := range s.patterns {
 		if pat != nil && pat.MatchString(c) {
-			s.ppublish <- PubsubPmessage{orig, c, msg}
+			s.sendPmessage(PubsubPmessage{orig, c, msg})
 			found++
 			break pats
 		}
@@ -152,6 +154,25 @@ pats:
 	return found
 }
 
+// receivers counts how often Publish() would send the message, without
+// sending it.
+func (s *Subscriber) receivers(c string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := 0
+	if _, ok := s.channels[c]; ok {
+		found++
+	}
+	for _, pat := range s.patterns {
+		if pat != nil && pat.MatchString(c) {
+			found++
+			break
+		}
+	}
+	return found
+}
+
 // The channel to read messages for this subscriber. Only for messages matching
 // a SUBSCRIBE.
 func (s *Subscriber) Messages() <-chan PubsubMessage {
@@ -214,27 +235,36 @@ func countPsubs(subs []*Subscriber) int {
 	return n
 }
 
-func monitorPublish(conn *server.Peer, msgs <-chan PubsubMessage) {
-	for msg := range msgs {
-		conn.Block(func(c *server.Writer) {
-			c.WritePushLen(3)
-			c.WriteBulk("message")
-			c.WriteBulk(msg.Channel)
-			c.WriteBulk(msg.Message)
-			c.Flush()
-		})
+// sendMessage queues the message for the connection of the subscriber, or, if
+// there is none, puts it on the Messages() channel. The connection writes its
+// queue itself, in order, so a slow client doesn't hold anything up. Needs
+// s.mu.
+func (s *Subscriber) sendMessage(msg PubsubMessage) {
+	if s.peer == nil {
+		s.publish <- msg
+		return
 	}
+	s.peer.Block(func(c *server.Writer) {
+		c.WritePushLen(3)
+		c.WriteBulk("message")
+		c.WriteBulk(msg.Channel)
+		c.WriteBulk(msg.Message)
+		c.Flush()
+	})
 }
 
-func monitorPpublish(conn *server.Peer, msgs <-chan PubsubPmessage) {
-	for msg := range msgs {
-		conn.Block(func(c *server.Writer) {
-			c.WritePushLen(4)
-			c.WriteBulk("pmessage")
-			c.WriteBulk(msg.Pattern)
-			c.WriteBulk(msg.Channel)
-			c.WriteBulk(msg.Message)
-			c.Flush()
-		})
+// sendPmessage is sendMessage() for PSUBSCRIBE messages. Needs s.mu.
+func (s *Subscriber) sendPmessage(msg PubsubPmessage) {
+	if s.peer == nil {
+		s.ppublish <- msg
+		return
 	}
+	s.peer.Block(func(c *server.Writer) {
+		c.WritePushLen(4)
+		c.WriteBulk("pmessage")
+		c.WriteBulk(msg.Pattern)
+		c.WriteBulk(msg.Channel)
+		c.WriteBulk(msg.Message)
+		c.Flush()
+	})
 }
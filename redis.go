@@ -2,9 +2,12 @@ package miniredis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,24 +15,29 @@ import (
 	"github.com/alicebob/miniredis/v2/server"
 )
 
+// the version we report if nothing is set with SetVersion().
+const defaultVersion = "6.0.5"
+
 const (
 	msgWrongType            = "WRONGTYPE Operation against a key holding the wrong kind of value"
 	msgNotValidHllValue     = "WRONGTYPE Key is not a valid HyperLogLog string value."
 	msgInvalidInt           = "ERR value is not an integer or out of range"
 	msgInvalidFloat         = "ERR value is not a valid float"
+	msgStringTooLong        = "ERR string exceeds maximum allowed size (proto-max-bulk-len)"
+	msgHashNotFloat         = "ERR hash value is not a float"
+	msgIncrNaNInf           = "ERR increment would produce NaN or Infinity"
+	msgScoreNaN             = "ERR resulting score is not a number (NaN)"
 	msgInvalidMinMax        = "ERR min or max is not a float"
 	msgInvalidRangeItem     = "ERR min or max not valid string range item"
 	msgInvalidTimeout       = "ERR timeout is not a float or out of range"
 	msgInvalidRange         = "ERR value is out of range, must be positive"
+	msgValueOutOfRange      = "ERR value is out of range"
 	msgSyntaxError          = "ERR syntax error"
 	msgKeyNotFound          = "ERR no such key"
 	msgOutOfRange           = "ERR index out of range"
 	msgInvalidCursor        = "ERR invalid cursor"
 	msgXXandNX              = "ERR XX and NX options at the same time are not compatible"
 	msgNegTimeout           = "ERR timeout is negative"
-	msgInvalidSETime        = "ERR invalid expire time in set"
-	msgInvalidSETEXTime     = "ERR invalid expire time in setex"
-	msgInvalidPSETEXTime    = "ERR invalid expire time in psetex"
 	msgInvalidKeysNumber    = "ERR Number of keys can't be greater than number of args"
 	msgNegativeKeysNumber   = "ERR Number of keys can't be negative"
 	msgFScriptUsage         = "ERR unknown subcommand or wrong number of arguments for '%s'. Try SCRIPT HELP."
@@ -51,15 +59,24 @@ const (
 	msgXtrimInvalidLimit    = "ERR syntax error, LIMIT cannot be used without the special ~ option"
 	msgDBIndexOutOfRange    = "ERR DB index is out of range"
 	msgLimitCombination     = "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"
+	msgWithScoresByLex      = "ERR syntax error, WITHSCORES not supported in combination with BYLEX"
 	msgRankIsZero           = "ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"
 	msgCountIsNegative      = "ERR COUNT can't be negative"
 	msgMaxLengthIsNegative  = "ERR MAXLEN can't be negative"
+	msgNoAuth               = "NOAUTH Authentication required."
+	msgWrongPass            = "WRONGPASS invalid username-password pair"
+	msgInvalidClientName    = "ERR Client names cannot contain spaces, newlines or special characters."
+	msgHelloNoAuth          = "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
 )
 
 func errWrongNumber(cmd string) string {
 	return fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
 }
 
+func errInvalidExpireTime(cmd string) string {
+	return fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(cmd))
+}
+
 func errLuaParseError(err error) string {
 	return fmt.Sprintf("ERR Error compiling script (new function): %s", err.Error())
 }
@@ -76,6 +93,10 @@ func msgNotFromScripts(sha string) string {
 	return fmt.Sprintf("This Redis command is not allowed from script script: %s, &c", sha)
 }
 
+func msgUndeclaredKey(key, sha string) string {
+	return fmt.Sprintf("ERR Script attempted to access key '%s' which was not declared in KEYS script: %s, &c.", key, sha)
+}
+
 // withTx wraps the non-argument-checking part of command handling code in
 // transaction logic.
 func withTx(
@@ -87,6 +108,7 @@ func withTx(
 
 	if ctx.nested {
 		// this is a call via Lua's .call(). It's already locked.
+		m.op++
 		cb(c, ctx)
 		m.signal.Broadcast()
 		return
@@ -98,10 +120,12 @@ func withTx(
 		return
 	}
 	m.Lock()
+	defer m.Unlock()
+	m.writer = c
 	cb(c, ctx)
+	m.writer = nil
 	// done, wake up anyone who waits on anything.
 	m.signal.Broadcast()
-	m.Unlock()
 }
 
 // blockCmd is executed returns whether it is done
@@ -109,6 +133,9 @@ type blockCmd func(*server.Peer, *connCtx) bool
 
 // blocking keeps trying a command until the callback returns true. Calls
 // onTimeout after the timeout (or when we call this in a transaction).
+// The callback is tried again after every change, in any DB, so it has to look
+// up its DB via ctx.selectedDB every time: changes to the same key in another
+// DB must not unblock it, and after a SWAPDB it has to see the swapped DB.
 func blocking(
 	m *Miniredis,
 	c *server.Peer,
@@ -129,19 +156,33 @@ func blocking(
 		return
 	}
 
+	m.Lock()
+	defer m.Unlock()
+	if m.maxBlockTime != 0 && (timeout == 0 || timeout > m.maxBlockTime) {
+		timeout = m.maxBlockTime
+	}
+	start, forwarded := time.Now(), m.forwarded
+
 	localCtx, cancel := context.WithCancel(m.Ctx)
 	defer cancel()
 	timedOut := false
 	if timeout != 0 {
-		go setCondTimer(localCtx, m.signal, &timedOut, timeout)
+		m.goroutine(func() { setCondTimer(localCtx, m.signal, &timedOut, timeout) })
 	}
-	go func() {
-		<-localCtx.Done()
-		m.signal.Broadcast() // main loop might miss this signal
-	}()
+	m.goroutine(func() {
+		select {
+		case <-localCtx.Done():
+			m.signal.Broadcast() // main loop might miss this signal
+		case <-c.Done():
+			// The client went away. Wake up the loop below, so it doesn't
+			// wait for the next change of anything.
+			m.Lock()
+			m.signal.Broadcast()
+			m.Unlock()
+		}
+	})
 
-	m.Lock()
-	defer m.Unlock()
+	srv := m.srv
 	for {
 		if c.Closed() {
 			return
@@ -151,17 +192,25 @@ func blocking(
 			return
 		}
 
+		m.writer = c
 		done := cb(c, ctx)
+		m.writer = nil
 		if done {
 			return
 		}
 
-		if timedOut {
+		if timedOut || timeout != 0 && time.Since(start)+m.forwarded-forwarded >= timeout {
 			onTimeout(c)
 			return
 		}
 
+		srv.Pause(c)
 		m.signal.Wait()
+		// Resume() can wait for our turn, and the connection which has it
+		// needs the lock.
+		m.Unlock()
+		srv.Resume(c)
+		m.Lock()
 	}
 }
 
@@ -178,16 +227,34 @@ func setCondTimer(ctx context.Context, sig *sync.Cond, timedOut *bool, timeout t
 	}
 }
 
-// formatBig formats a float the way redis does
+// floatPrec is the precision of INCRBYFLOAT and HINCRBYFLOAT. Redis uses a
+// C long double, which has a 64 bit mantissa on x86.
+const floatPrec = 64
+
+// maxStringLen is the biggest string SETRANGE and SETBIT make, the default
+// proto-max-bulk-len.
+const maxStringLen = 512 * 1024 * 1024
+
+// formatBig formats a float the way redis does: never in exponent notation,
+// with at most 17 significant digits (but all digits before the '.'), no
+// trailing 0s, and never "-0".
 func formatBig(v *big.Float) string {
-	// Format with %f and strip trailing 0s.
 	if v.IsInf() {
 		return "inf"
 	}
-	// if math.IsInf(v, -1) {
-	// return "-inf"
-	// }
-	return stripZeros(fmt.Sprintf("%.17f", v))
+	decimals := 17
+	if i, _ := new(big.Float).Abs(v).Int(nil); i.Sign() != 0 {
+		decimals -= len(i.String())
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	// Format with %f and strip trailing 0s.
+	s := stripZeros(v.Text('f', decimals))
+	if s == "-0" {
+		return "0"
+	}
+	return s
 }
 
 func stripZeros(sv string) string {
@@ -244,3 +311,76 @@ func redisRange(l, start, end int, stringSymantics bool) (int, int) {
 	}
 	return start, end
 }
+
+// scanPage gives the elements for a SCAN like command with
+// DeterministicScan() enabled: at most count elements, starting at offset
+// cursor, and the cursor for the next page, which is 0 at the end.
+// Offsets are only meaningful for the keys they came from, so after a
+// Restore() the cursors also have the number of restores, in the high 32
+// bits, and the cursors from before it are an error. No locks!
+func (m *Miniredis) scanPage(elems []string, cursor int64, count int) ([]string, int64, error) {
+	if count <= 0 {
+		count = 10 // redis' default
+	}
+	if cursor < 0 {
+		return nil, 0, nil
+	}
+	if cursor != 0 && cursor>>32 != m.scanEpoch {
+		return nil, 0, errors.New(msgInvalidCursor)
+	}
+	offset := cursor & (1<<32 - 1)
+	if offset >= int64(len(elems)) {
+		return nil, 0, nil
+	}
+	start := int(offset)
+	if count >= len(elems)-start {
+		return elems[start:], 0, nil
+	}
+	end := start + count
+	return elems[start:end], m.scanEpoch<<32 | int64(end), nil
+}
+
+// hashScanPage gives the elements for a SCAN like command with a real
+// cursor. The elements are ordered by a hash, and the cursor is the hash to
+// continue from, so an element which is there during the whole iteration is
+// returned at least once, even when other elements come and go. Elements with
+// the same hash are never split over pages, so a page can have more than
+// count elements. The next cursor is 0 at the end.
+func hashScanPage(elems []string, cursor int64, count int) ([]string, int64) {
+	if count <= 0 {
+		count = 10 // redis' default
+	}
+	type hashed struct {
+		hash int64
+		elem string
+	}
+	var hs []hashed
+	for _, e := range elems {
+		if h := scanHash(e); h >= cursor {
+			hs = append(hs, hashed{h, e})
+		}
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		if hs[i].hash != hs[j].hash {
+			return hs[i].hash < hs[j].hash
+		}
+		return hs[i].elem < hs[j].elem
+	})
+
+	var page []string
+	for i, h := range hs {
+		if len(page) >= count && h.hash != hs[i-1].hash {
+			return page, h.hash
+		}
+		page = append(page, h.elem)
+	}
+	return page, 0
+}
+
+// scanHash is the cursor of an element for hashScanPage(). Never 0, since
+// that's the start and the end.
+func scanHash(e string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(e))
+	return int64(h.Sum32()>>2) + 1
+}
@@ -1,10 +1,12 @@
 package miniredis
 
 import (
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2/proto"
 	"github.com/alicebob/miniredis/v2/server"
 )
 
@@ -36,3 +38,183 @@ func TestRedis(t *testing.T) {
 	s.Close()
 	wg.Wait()
 }
+
+// Every command on a key of the wrong type should give a WRONGTYPE error.
+func TestWrongType(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	// "KEY" is replaced with a key of every other type.
+	for _, cas := range []struct {
+		types string // accepted types
+		cmd   []string
+	}{
+		{"string", []string{"GET", "KEY"}},
+		{"string", []string{"GETRANGE", "KEY", "0", "1"}},
+		{"string", []string{"STRLEN", "KEY"}},
+		{"string", []string{"APPEND", "KEY", "x"}},
+		{"string", []string{"GETSET", "KEY", "x"}},
+		{"string", []string{"GETDEL", "KEY"}},
+		{"string", []string{"GETEX", "KEY"}},
+		{"string", []string{"SET", "KEY", "x", "GET"}},
+		{"string", []string{"INCR", "KEY"}},
+		{"string", []string{"DECR", "KEY"}},
+		{"string", []string{"INCRBY", "KEY", "1"}},
+		{"string", []string{"DECRBY", "KEY", "1"}},
+		{"string", []string{"INCRBYFLOAT", "KEY", "1"}},
+		{"string", []string{"SETRANGE", "KEY", "0", "x"}},
+		{"string", []string{"GETBIT", "KEY", "0"}},
+		{"string", []string{"SETBIT", "KEY", "0", "1"}},
+		{"string", []string{"BITCOUNT", "KEY"}},
+		{"string", []string{"BITPOS", "KEY", "1"}},
+		{"string", []string{"BITOP", "AND", "dst", "KEY"}},
+		{"hash", []string{"HGET", "KEY", "f"}},
+		{"hash", []string{"HSET", "KEY", "f", "v"}},
+		{"hash", []string{"HSETNX", "KEY", "f", "v"}},
+		{"hash", []string{"HMSET", "KEY", "f", "v"}},
+		{"hash", []string{"HDEL", "KEY", "f"}},
+		{"hash", []string{"HEXISTS", "KEY", "f"}},
+		{"hash", []string{"HGETALL", "KEY"}},
+		{"hash", []string{"HKEYS", "KEY"}},
+		{"hash", []string{"HVALS", "KEY"}},
+		{"hash", []string{"HLEN", "KEY"}},
+		{"hash", []string{"HMGET", "KEY", "f"}},
+		{"hash", []string{"HSTRLEN", "KEY", "f"}},
+		{"hash", []string{"HINCRBY", "KEY", "f", "1"}},
+		{"hash", []string{"HINCRBYFLOAT", "KEY", "f", "1"}},
+		{"hash", []string{"HSCAN", "KEY", "0"}},
+		{"list", []string{"LPUSH", "KEY", "a"}},
+		{"list", []string{"RPUSH", "KEY", "a"}},
+		{"list", []string{"LPUSHX", "KEY", "a"}},
+		{"list", []string{"RPUSHX", "KEY", "a"}},
+		{"list", []string{"LPOP", "KEY"}},
+		{"list", []string{"RPOP", "KEY"}},
+		{"list", []string{"LLEN", "KEY"}},
+		{"list", []string{"LINDEX", "KEY", "0"}},
+		{"list", []string{"LRANGE", "KEY", "0", "-1"}},
+		{"list", []string{"LSET", "KEY", "0", "a"}},
+		{"list", []string{"LREM", "KEY", "0", "a"}},
+		{"list", []string{"LTRIM", "KEY", "0", "1"}},
+		{"list", []string{"LINSERT", "KEY", "BEFORE", "a", "b"}},
+		{"list", []string{"LPOS", "KEY", "a"}},
+		{"list", []string{"RPOPLPUSH", "KEY", "dst"}},
+		{"list", []string{"LMOVE", "KEY", "dst", "LEFT", "LEFT"}},
+		{"list", []string{"BLPOP", "KEY", "1"}},
+		{"list", []string{"BRPOP", "KEY", "1"}},
+		{"list", []string{"BRPOPLPUSH", "KEY", "dst", "1"}},
+		{"set", []string{"SADD", "KEY", "a"}},
+		{"set", []string{"SREM", "KEY", "a"}},
+		{"set", []string{"SCARD", "KEY"}},
+		{"set", []string{"SISMEMBER", "KEY", "a"}},
+		{"set", []string{"SMEMBERS", "KEY"}},
+		{"set", []string{"SPOP", "KEY"}},
+		{"set", []string{"SRANDMEMBER", "KEY"}},
+		{"set", []string{"SMOVE", "KEY", "dst", "a"}},
+		{"set", []string{"SDIFF", "KEY"}},
+		{"set", []string{"SINTER", "KEY"}},
+		{"set", []string{"SUNION", "KEY"}},
+		{"set", []string{"SDIFFSTORE", "dst", "KEY"}},
+		{"set", []string{"SINTERSTORE", "dst", "KEY"}},
+		{"set", []string{"SUNIONSTORE", "dst", "KEY"}},
+		{"set", []string{"SSCAN", "KEY", "0"}},
+		{"zset", []string{"ZADD", "KEY", "1", "a"}},
+		{"zset", []string{"ZCARD", "KEY"}},
+		{"zset", []string{"ZCOUNT", "KEY", "0", "1"}},
+		{"zset", []string{"ZINCRBY", "KEY", "1", "a"}},
+		{"zset", []string{"ZLEXCOUNT", "KEY", "-", "+"}},
+		{"zset", []string{"ZPOPMIN", "KEY"}},
+		{"zset", []string{"ZPOPMAX", "KEY"}},
+		{"zset", []string{"ZRANDMEMBER", "KEY"}},
+		{"zset", []string{"ZRANGE", "KEY", "0", "-1"}},
+		{"zset", []string{"ZRANGEBYLEX", "KEY", "-", "+"}},
+		{"zset", []string{"ZRANGEBYSCORE", "KEY", "0", "1"}},
+		{"zset", []string{"ZRANK", "KEY", "a"}},
+		{"zset", []string{"ZREM", "KEY", "a"}},
+		{"zset", []string{"ZREMRANGEBYLEX", "KEY", "-", "+"}},
+		{"zset", []string{"ZREMRANGEBYRANK", "KEY", "0", "1"}},
+		{"zset", []string{"ZREMRANGEBYSCORE", "KEY", "0", "1"}},
+		{"zset", []string{"ZREVRANGE", "KEY", "0", "1"}},
+		{"zset", []string{"ZREVRANGEBYLEX", "KEY", "+", "-"}},
+		{"zset", []string{"ZREVRANGEBYSCORE", "KEY", "1", "0"}},
+		{"zset", []string{"ZREVRANK", "KEY", "a"}},
+		{"zset", []string{"ZSCORE", "KEY", "a"}},
+		{"zset", []string{"ZSCAN", "KEY", "0"}},
+		{"zset set", []string{"ZUNION", "1", "KEY"}},
+		{"zset set", []string{"ZUNIONSTORE", "dst", "1", "KEY"}},
+		{"zset set", []string{"ZINTERSTORE", "dst", "1", "KEY"}},
+		{"zset", []string{"GEOADD", "KEY", "1", "1", "a"}},
+		{"zset", []string{"GEODIST", "KEY", "a", "b"}},
+		{"zset", []string{"GEOPOS", "KEY", "a"}},
+		{"zset", []string{"GEORADIUS", "KEY", "1", "1", "1", "km"}},
+		{"zset", []string{"GEORADIUS_RO", "KEY", "1", "1", "1", "km"}},
+		{"zset", []string{"GEORADIUSBYMEMBER", "KEY", "a", "1", "km"}},
+		{"zset", []string{"GEORADIUSBYMEMBER_RO", "KEY", "a", "1", "km"}},
+		{"stream", []string{"XADD", "KEY", "*", "a", "b"}},
+		{"stream", []string{"XLEN", "KEY"}},
+		{"stream", []string{"XRANGE", "KEY", "-", "+"}},
+		{"stream", []string{"XREVRANGE", "KEY", "+", "-"}},
+		{"stream", []string{"XDEL", "KEY", "1-1"}},
+		{"stream", []string{"XTRIM", "KEY", "MAXLEN", "1"}},
+		{"stream", []string{"XREAD", "STREAMS", "KEY", "0"}},
+		{"stream", []string{"XREAD", "STREAMS", "KEY", "$"}},
+		{"stream", []string{"XGROUP", "CREATE", "KEY", "g", "0"}},
+		{"stream", []string{"XINFO", "STREAM", "KEY"}},
+		{"stream", []string{"XPENDING", "KEY", "g"}},
+		{"stream", []string{"XACK", "KEY", "g", "1-1"}},
+		{"stream", []string{"XREADGROUP", "GROUP", "g", "c", "STREAMS", "KEY", ">"}},
+		{"stream", []string{"XCLAIM", "KEY", "g", "c", "0", "1-1"}},
+		{"stream", []string{"XAUTOCLAIM", "KEY", "g", "c", "0", "0"}},
+	} {
+		for _, typ := range []string{"string", "hash", "list", "set", "zset", "stream"} {
+			if strings.Contains(" "+cas.types+" ", " "+typ+" ") {
+				continue
+			}
+			cmd := make([]string, len(cas.cmd))
+			for i, a := range cas.cmd {
+				if a == "KEY" {
+					a = typ
+				}
+				cmd[i] = a
+			}
+			t.Run(strings.Join(cmd, " "), func(t *testing.T) {
+				s.FlushAll()
+				s.Set("string", "v")
+				s.HSet("hash", "f", "v")
+				s.Push("list", "a")
+				s.SAdd("set", "a")
+				s.ZAdd("zset", 1, "a")
+				s.XAdd("stream", "1-1", []string{"a", "b"})
+
+				mustDo(t, c, append(cmd, proto.Error(msgWrongType))...)
+				// exactly one reply
+				mustDo(t, c, "PING", proto.Inline("PONG"))
+				equals(t, typ, s.Type(typ))
+			})
+		}
+	}
+
+	t.Run("hll", func(t *testing.T) {
+		s.HSet("hash", "f", "v")
+		mustDo(t, c, "PFADD", "hash", "a", proto.Error(msgNotValidHllValue))
+		mustDo(t, c, "PFCOUNT", "hash", proto.Error(msgNotValidHllValue))
+		mustDo(t, c, "PFMERGE", "dst", "hash", proto.Error(msgNotValidHllValue))
+		mustDo(t, c, "PFMERGE", "hash", proto.Error(msgNotValidHllValue))
+	})
+
+	// These don't care about the type.
+	t.Run("any type", func(t *testing.T) {
+		s.FlushAll()
+		s.HSet("hash", "f", "v")
+		s.Set("string", "v")
+		s.SAdd("set", "a")
+		mustDo(t, c, "MGET", "hash", "string", proto.Array(proto.Nil, proto.String("v")))
+		must1(t, c, "EXISTS", "hash")
+		mustDo(t, c, "TYPE", "hash", proto.Inline("hash"))
+		must1(t, c, "SUNIONSTORE", "hash", "set")
+		mustDo(t, c, "TYPE", "hash", proto.Inline("set"))
+		mustOK(t, c, "SET", "hash", "v")
+		mustDo(t, c, "TYPE", "hash", proto.Inline("string"))
+	})
+}
@@ -0,0 +1,143 @@
+package miniredis
+
+// Emulated replication. See Miniredis.ReplicaOf().
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noReplID is the replication ID redis uses for "none".
+const noReplID = "0000000000000000000000000000000000000000"
+
+// ReplicaOf makes this miniredis a replica of another one. A replica has the
+// same keys and scripts as its master: they are copied whenever the replica
+// is used after keys or scripts changed on the master. Commands which write get a
+// READONLY error, but the Go methods, such as Set(), can still change keys,
+// until the next copy.
+//
+// Replication is instant, there is no replication lag. A nil master turns a
+// replica back into a master, which keeps its keys.
+func (m *Miniredis) ReplicaOf(master *Miniredis) {
+	if master == m {
+		master = nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.master != nil && master == nil {
+		// a promoted replica keeps the ID of its old master as the
+		// secondary ID, so replicas of that master can continue.
+		m.replID2 = m.masterReplID()
+		m.replID = m.newReplID()
+	}
+	m.master = master
+	m.masterSynced = false
+}
+
+// ReplID gives the replication ID, which is the master_replid in INFO
+// replication. A replica has the ID of its master. The ID changes with
+// ChangeReplID(), with Restart(), and when a replica is promoted with
+// ReplicaOf(nil), so code which detects that a full resync is needed can be
+// tested.
+func (m *Miniredis) ReplID() string {
+	m.Lock()
+	defer m.Unlock()
+	return m.masterReplID()
+}
+
+// ChangeReplID gives this miniredis a new random replication ID, and forgets
+// the secondary ID. Same as DEBUG CHANGE-REPL-ID.
+func (m *Miniredis) ChangeReplID() {
+	m.Lock()
+	defer m.Unlock()
+	m.changeReplID()
+}
+
+// changeReplID is ChangeReplID(). No locks!
+func (m *Miniredis) changeReplID() {
+	m.replID = m.newReplID()
+	m.replID2 = ""
+}
+
+// newReplID makes a random replication ID: 40 hex characters. It uses the
+// Seed(), if any. No locks!
+func (m *Miniredis) newReplID() string {
+	id := make([]byte, 0, len(noReplID))
+	for len(id) < cap(id) {
+		id = append(id, "0123456789abcdef"[m.randIntn(16)])
+	}
+	return string(id)
+}
+
+// masterReplID is the replication ID of the master, if we're a replica, or our
+// own. No locks!
+func (m *Miniredis) masterReplID() string {
+	ma := m.master
+	if ma == nil {
+		return m.replID
+	}
+	// Not ma.Lock(), that would be a new operation.
+	ma.Mutex.Lock()
+	defer ma.Mutex.Unlock()
+	return ma.masterReplID()
+}
+
+// infoReplication is the "replication" section of INFO. There is no
+// replication stream, so the offsets are always 0. No locks!
+func (m *Miniredis) infoReplication() string {
+	res := "# Replication\r\n"
+	if ma := m.master; ma == nil {
+		res += "role:master\r\n"
+	} else {
+		res += "role:slave\r\n"
+		ma.Mutex.Lock()
+		if ma.srv != nil {
+			addr := ma.srv.Addr()
+			res += fmt.Sprintf("master_host:%s\r\nmaster_port:%d\r\nmaster_link_status:up\r\n", addr.IP, addr.Port)
+		} else {
+			res += "master_link_status:down\r\n"
+		}
+		ma.Mutex.Unlock()
+	}
+	id2, offset2 := m.replID2, -1
+	if id2 == "" {
+		id2 = noReplID
+	} else {
+		offset2 = 1
+	}
+	res += fmt.Sprintf("master_replid:%s\r\nmaster_replid2:%s\r\nmaster_repl_offset:0\r\nsecond_repl_offset:%d\r\n", m.masterReplID(), id2, offset2)
+	return res
+}
+
+// syncMaster copies all keys and scripts from the master, if any of them
+// changed since the last time. Commands which only read don't count. No
+// locks!
+func (m *Miniredis) syncMaster() {
+	ma := m.master
+	// Not ma.Lock(), that would be a new operation.
+	ma.Mutex.Lock()
+	defer ma.Mutex.Unlock()
+
+	if m.masterSynced && ma.writes == m.masterWrites {
+		return
+	}
+	m.masterWrites, m.masterSynced = ma.writes, true
+	m.syncDBs(ma.dbs)
+	m.scripts = map[string]string{}
+	for sha, src := range ma.scripts {
+		m.scripts[sha] = src
+	}
+	m.writes++ // for replicas of this replica
+}
+
+// replicaDenied gives the error for a write command when we're a replica, or
+// "". No locks!
+func (m *Miniredis) replicaDenied(cmd string) string {
+	if m.master == nil {
+		return ""
+	}
+	if !commandSpecs()[strings.ToLower(cmd)].hasFlag("write") {
+		return ""
+	}
+	return DenyReadonly
+}
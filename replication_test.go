@@ -0,0 +1,191 @@
+package miniredis
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestReplicaOf(t *testing.T) {
+	master := RunT(t)
+	replica := RunT(t)
+	replica.Set("gone", "soon")
+	replica.ReplicaOf(master)
+
+	mc, err := proto.Dial(master.Addr())
+	ok(t, err)
+	defer mc.Close()
+	rc, err := proto.Dial(replica.Addr())
+	ok(t, err)
+	defer rc.Close()
+
+	mustOK(t, mc, "SET", "foo", "bar")
+	mustOK(t, mc, "SELECT", "3")
+	mustDo(t, mc, "RPUSH", "l", "a", "b", proto.Int(2))
+	mustDo(t, mc,
+		"SCRIPT", "LOAD", "return 1",
+		proto.String("e0e1f9fabfc9d4800c877a703b823ac0578ff8db"),
+	)
+
+	mustDo(t, rc, "GET", "foo", proto.String("bar"))
+	mustNil(t, rc, "GET", "gone")
+	mustDo(t, rc, "EVALSHA", "e0e1f9fabfc9d4800c877a703b823ac0578ff8db", "0", proto.Int(1))
+	equals(t, []string{"l"}, replica.DB(3).Keys())
+
+	t.Run("readonly", func(t *testing.T) {
+		mustDo(t, rc,
+			"SET", "foo", "baz",
+			proto.Error(DenyReadonly),
+		)
+		mustContain(t, rc,
+			"EVAL", "return redis.call('SET', 'foo', 'baz')", "0",
+			DenyReadonly,
+		)
+		mustDo(t, rc, "GET", "foo", proto.String("bar"))
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		mustOK(t, mc, "SELECT", "0")
+		mustOK(t, mc, "SET", "foo", "baz")
+		mustDo(t, rc, "GET", "foo", proto.String("baz"))
+		master.Del("foo")
+		mustNil(t, rc, "GET", "foo")
+	})
+
+	t.Run("reads", func(t *testing.T) {
+		// only writes on the master need a new copy
+		replica.Set("local", "v")
+		mustNil(t, mc, "GET", "nosuch")
+		master.Get("foo")
+		mustDo(t, rc, "GET", "local", proto.String("v"))
+		master.FastForward(time.Second)
+		mustNil(t, rc, "GET", "local")
+
+		replica.Set("local", "v")
+		mustDo(t, mc, "EVAL", "return 1", "0", proto.Int(1))
+		mustNil(t, rc, "GET", "local")
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		// keys which didn't change on the master don't change on the replica
+		master.Set("w", "v")
+		c, err := proto.Dial(replica.Addr())
+		ok(t, err)
+		defer c.Close()
+		useRESP3(t, c)
+		mustOK(t, c, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c, "GET", "w", proto.String("v"))
+		mustOK(t, c, "WATCH", "w")
+
+		var (
+			mu  sync.Mutex
+			ops []WriteOp
+		)
+		replica.OnWrite(func(op WriteOp) {
+			mu.Lock()
+			defer mu.Unlock()
+			ops = append(ops, op)
+		})
+		master.Set("other", "v")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "GET", "w", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.String("v")))
+		replica.OnWrite(nil)
+		mu.Lock()
+		equals(t, []WriteOp{{Key: "other", Type: "string"}}, ops)
+		mu.Unlock()
+
+		master.Set("w", "v2")
+		mustDo(t, c, "PING", proto.Push(proto.String("invalidate"), proto.Strings("w")))
+		res, err := c.Read()
+		ok(t, err)
+		equals(t, proto.Inline("PONG"), res)
+		master.Del("w")
+		master.Del("other")
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		// syncing with the master doesn't invalidate the cursors
+		replica.DeterministicScan(true)
+		defer replica.DeterministicScan(false)
+		master.Set("k1", "v")
+		master.Set("k2", "v")
+		mustDo(t, rc, "SCAN", "0", "COUNT", "1",
+			proto.Array(proto.String("1"), proto.Strings("k1")))
+		master.Get("k1")
+		mustDo(t, rc, "SCAN", "1", "COUNT", "1",
+			proto.Array(proto.String("0"), proto.Strings("k2")))
+		master.Del("k1")
+		master.Del("k2")
+	})
+
+	t.Run("hello", func(t *testing.T) {
+		c, err := proto.Dial(replica.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustContain(t, c, "HELLO", "3", proto.String("role")+proto.String("replica"))
+	})
+
+	t.Run("promote", func(t *testing.T) {
+		replica.ReplicaOf(nil)
+		mustOK(t, rc, "SET", "foo", "replica")
+		mustNil(t, mc, "GET", "foo")
+		equals(t, []string{"l"}, replica.DB(3).Keys())
+	})
+}
+
+func TestReplID(t *testing.T) {
+	master := RunT(t)
+	c, err := proto.Dial(master.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	id := master.ReplID()
+	equals(t, 40, len(id))
+	info := func(id, id2 string, offset2 int) string {
+		return proto.String(fmt.Sprintf("# Replication\r\nrole:master\r\nmaster_replid:%s\r\nmaster_replid2:%s\r\nmaster_repl_offset:0\r\nsecond_repl_offset:%d\r\n", id, id2, offset2))
+	}
+	mustDo(t, c, "INFO", "replication", info(id, noReplID, -1))
+
+	t.Run("debug", func(t *testing.T) {
+		mustOK(t, c, "DEBUG", "CHANGE-REPL-ID")
+		assert(t, master.ReplID() != id, "changed")
+		id = master.ReplID()
+		mustDo(t, c, "INFO", "replication", info(id, noReplID, -1))
+
+		mustDo(t, c, "DEBUG", "CHANGE-REPL-ID", "foo",
+			proto.Error("ERR unknown subcommand or wrong number of arguments for 'CHANGE-REPL-ID'. Try DEBUG HELP."),
+		)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		master.Close()
+		ok(t, master.Restart())
+		assert(t, master.ReplID() != id, "changed")
+		id = master.ReplID()
+	})
+
+	t.Run("replica", func(t *testing.T) {
+		replica := RunT(t)
+		replica.ReplicaOf(master)
+		equals(t, id, replica.ReplID())
+
+		rc, err := proto.Dial(replica.Addr())
+		ok(t, err)
+		defer rc.Close()
+		mustDo(t, rc, "INFO", "replication", proto.String(fmt.Sprintf(
+			"# Replication\r\nrole:slave\r\nmaster_host:127.0.0.1\r\nmaster_port:%d\r\nmaster_link_status:up\r\n"+
+				"master_replid:%s\r\nmaster_replid2:%s\r\nmaster_repl_offset:0\r\nsecond_repl_offset:-1\r\n",
+			master.Server().Addr().Port, id, noReplID)),
+		)
+
+		// promotion: the old ID is the secondary one
+		replica.ReplicaOf(nil)
+		newID := replica.ReplID()
+		assert(t, newID != id, "changed")
+		mustDo(t, rc, "INFO", "replication", info(newID, id, 1))
+	})
+}
@@ -0,0 +1,113 @@
+package miniredis
+
+import (
+	"strings"
+)
+
+// ropeChunk is the size of a chunk of a rope.
+const ropeChunk = 64 * 1024
+
+// rope is the value of a string key. It's split in chunks, so APPEND and
+// SETRANGE on a huge value only touch the chunks they change, and don't copy
+// the whole value every time.
+type rope struct {
+	chunks [][]byte // every chunk but the last one is ropeChunk long
+	n      int
+}
+
+func newRope(s string) *rope {
+	r := &rope{}
+	r.Append(s)
+	return r
+}
+
+// Len is the length in bytes.
+func (r *rope) Len() int {
+	return r.n
+}
+
+// String returns the whole value.
+func (r *rope) String() string {
+	return r.Slice(0, r.n)
+}
+
+// Slice returns the bytes from start up to end. Both have to be in range.
+func (r *rope) Slice(start, end int) string {
+	var b strings.Builder
+	b.Grow(end - start)
+	for start < end {
+		c, o := start/ropeChunk, start%ropeChunk
+		chunk := r.chunks[c][o:]
+		if len(chunk) > end-start {
+			chunk = chunk[:end-start]
+		}
+		b.Write(chunk)
+		start += len(chunk)
+	}
+	return b.String()
+}
+
+// Append adds s at the end.
+func (r *rope) Append(s string) {
+	pos := r.n
+	r.grow(pos + len(s))
+	r.write(pos, s)
+}
+
+// SetRange overwrites the value at pos with s, padding the value with zero
+// bytes if it's too short.
+func (r *rope) SetRange(pos int, s string) {
+	r.grow(pos + len(s))
+	r.write(pos, s)
+}
+
+// grow pads the value with zero bytes until it's n long.
+func (r *rope) grow(n int) {
+	for r.n < n {
+		if len(r.chunks) == 0 || len(r.chunks[len(r.chunks)-1]) == ropeChunk {
+			r.chunks = append(r.chunks, nil)
+		}
+		last := &r.chunks[len(r.chunks)-1]
+		add := ropeChunk - len(*last)
+		if add > n-r.n {
+			add = n - r.n
+		}
+		if l := len(*last) + add; l > cap(*last) {
+			// grow like append() would, but never past ropeChunk
+			c := 2 * cap(*last)
+			if c < l {
+				c = l
+			}
+			if c > ropeChunk {
+				c = ropeChunk
+			}
+			b := make([]byte, len(*last), c)
+			copy(b, *last)
+			*last = b
+		}
+		*last = (*last)[:len(*last)+add] // capacity is always zeroed
+		r.n += add
+	}
+}
+
+// write overwrites the value at pos with s. Needs to be in range.
+func (r *rope) write(pos int, s string) {
+	for len(s) > 0 {
+		c, o := pos/ropeChunk, pos%ropeChunk
+		n := copy(r.chunks[c][o:], s)
+		s = s[n:]
+		pos += n
+	}
+}
+
+func (r *rope) copy() *rope {
+	cp := &rope{
+		chunks: make([][]byte, len(r.chunks)),
+		n:      r.n,
+	}
+	for i, c := range r.chunks {
+		cp.chunks[i] = make([]byte, len(c))
+		copy(cp.chunks[i], c)
+	}
+	return cp
+}
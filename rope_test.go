@@ -0,0 +1,101 @@
+package miniredis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRope(t *testing.T) {
+	r := newRope("hello")
+	equals(t, 5, r.Len())
+	equals(t, "hello", r.String())
+	equals(t, "ell", r.Slice(1, 4))
+	equals(t, "", r.Slice(2, 2))
+
+	t.Run("append", func(t *testing.T) {
+		r := newRope("")
+		want := ""
+		for i := 0; i < 100; i++ {
+			s := strings.Repeat(string(rune('a'+i%26)), 1000*i)
+			r.Append(s)
+			want += s
+		}
+		equals(t, len(want), r.Len())
+		assert(t, want == r.String(), "append")
+		assert(t, want[ropeChunk-10:3*ropeChunk+10] == r.Slice(ropeChunk-10, 3*ropeChunk+10), "slice")
+		for _, c := range r.chunks[:len(r.chunks)-1] {
+			equals(t, ropeChunk, len(c))
+			equals(t, ropeChunk, cap(c))
+		}
+	})
+
+	t.Run("setrange", func(t *testing.T) {
+		r := newRope("hello")
+		r.SetRange(1, "EL")
+		equals(t, "hELlo", r.String())
+		r.SetRange(8, "world")
+		equals(t, "hELlo\x00\x00\x00world", r.String())
+
+		long := strings.Repeat("x", 3*ropeChunk)
+		r.SetRange(ropeChunk-2, long)
+		want := "hELlo\x00\x00\x00world" + strings.Repeat("\x00", ropeChunk-2-13) + long
+		equals(t, len(want), r.Len())
+		assert(t, want == r.String(), "setrange")
+
+		r.SetRange(2*ropeChunk-1, "AB")
+		want = want[:2*ropeChunk-1] + "AB" + want[2*ropeChunk+1:]
+		assert(t, want == r.String(), "setrange over a chunk boundary")
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		r := newRope(strings.Repeat("a", ropeChunk+1))
+		cp := r.copy()
+		r.SetRange(ropeChunk, "b")
+		equals(t, "a", cp.Slice(ropeChunk, ropeChunk+1))
+		equals(t, "b", r.Slice(ropeChunk, ropeChunk+1))
+	})
+}
+
+// 100MB strings, changed a little bit at a time.
+func BenchmarkHugeString(b *testing.B) {
+	const size = 100 * 1024 * 1024
+
+	b.Run("append", func(b *testing.B) {
+		db := NewMiniRedis().db(0)
+		chunk := strings.Repeat("v", 1024)
+		db.stringSetRange("k", size, "")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if i%10000 == 9999 {
+				// don't grow forever
+				b.StopTimer()
+				db.stringSet("k", "")
+				db.stringSetRange("k", size, "")
+				b.StartTimer()
+			}
+			db.stringAppend("k", chunk)
+		}
+	})
+
+	b.Run("setrange", func(b *testing.B) {
+		db := NewMiniRedis().db(0)
+		db.stringSetRange("k", size, "")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			db.stringSetRange("k", (i*4096)%size, "value")
+		}
+	})
+
+	b.Run("getrange", func(b *testing.B) {
+		db := NewMiniRedis().db(0)
+		db.stringSetRange("k", size, "")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pos := (i * 4096) % size
+			db.stringKeys["k"].Slice(pos, pos+100)
+		}
+	})
+}
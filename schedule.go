@@ -0,0 +1,53 @@
+package miniredis
+
+// How connections take turns. See Miniredis.SetSchedule().
+
+import (
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// SetSchedule changes how the commands of different connections take turns,
+// for latency tests. By default every command takes its own turn, so the
+// commands of a huge pipeline mix with the commands of other connections.
+//
+// With s.Pipelines the commands a connection sent in one go run back to back,
+// same as redis, which makes all other connections wait. That's the unfair
+// mode. With s.Yield the other connections get a turn every s.Yield commands,
+// which is the fair mode. Blocking commands give up their turn while they
+// wait. The zero value is the default.
+func (m *Miniredis) SetSchedule(s server.Schedule) {
+	m.Lock()
+	defer m.Unlock()
+	m.schedule = s
+	if m.srv != nil {
+		m.srv.SetSchedule(s)
+	}
+}
+
+// MaxLockHold is the longest time any connection kept all others waiting,
+// since the start or the last ResetMaxLockHold(): the longest time the
+// Miniredis was locked, or, with SetSchedule(), the longest turn of a
+// connection.
+func (m *Miniredis) MaxLockHold() time.Duration {
+	m.Lock()
+	d, srv := m.maxLockHold, m.srv
+	m.Unlock()
+	if srv != nil {
+		if t := srv.MaxTurn(); t > d {
+			d = t
+		}
+	}
+	return d
+}
+
+// ResetMaxLockHold sets MaxLockHold() back to zero.
+func (m *Miniredis) ResetMaxLockHold() {
+	m.Lock()
+	defer m.Unlock()
+	m.maxLockHold = 0
+	if m.srv != nil {
+		m.srv.ResetMaxTurn()
+	}
+}
@@ -0,0 +1,143 @@
+package miniredis
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestSchedule(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	started := make(chan struct{}, 1)
+	s.Hijack("GET", func(w RawWriter, args []string) {
+		started <- struct{}{}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("$-1\r\n"))
+	})
+
+	// a pipeline of a slow GET and two RPUSHes, with an RPUSH from c while the
+	// GET runs.
+	run := func(t *testing.T, sc server.Schedule) []string {
+		t.Helper()
+		s.SetSchedule(sc)
+		s.Del("l")
+		s.ResetMaxLockHold()
+
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		var b bytes.Buffer
+		ok(t, proto.Write(&b, []string{"GET", "slow"}))
+		ok(t, proto.Write(&b, []string{"RPUSH", "l", "a"}))
+		ok(t, proto.Write(&b, []string{"RPUSH", "l", "a"}))
+		_, err = raw.Write(b.Bytes())
+		ok(t, err)
+
+		<-started
+		_, err = c.Do("RPUSH", "l", "b")
+		ok(t, err)
+
+		rd := bufio.NewReader(raw)
+		for i := 0; i < 3; i++ {
+			_, err := proto.Read(rd)
+			ok(t, err)
+		}
+		l, err := s.List("l")
+		ok(t, err)
+		return l
+	}
+
+	t.Run("default", func(t *testing.T) {
+		equals(t, []string{"b", "a", "a"}, run(t, server.Schedule{}))
+		assert(t, s.MaxLockHold() < 50*time.Millisecond, "lock hold")
+	})
+
+	t.Run("pipelines", func(t *testing.T) {
+		equals(t, []string{"a", "a", "b"}, run(t, server.Schedule{Pipelines: true}))
+		assert(t, s.MaxLockHold() >= 50*time.Millisecond, "lock hold")
+	})
+
+	t.Run("yield", func(t *testing.T) {
+		equals(t, []string{"b", "a", "a"}, run(t, server.Schedule{Yield: 1}))
+		equals(t, []string{"a", "b", "a"}, run(t, server.Schedule{Yield: 2}))
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		// a waiting BLPOP doesn't keep the turn
+		s.SetSchedule(server.Schedule{Pipelines: true})
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		done := make(chan string)
+		go func() {
+			res, _ := c2.Do("BLPOP", "queue", "2")
+			done <- res
+		}()
+		time.Sleep(20 * time.Millisecond)
+		mustDo(t, c, "RPUSH", "queue", "job", proto.Int(1))
+		equals(t, proto.Strings("queue", "job"), <-done)
+	})
+
+	t.Run("blocking resume", func(t *testing.T) {
+		// a BLPOP which can go on waits for the turn
+		s.SetSchedule(server.Schedule{Pipelines: true})
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		done := make(chan string)
+		go func() {
+			res, _ := c2.Do("BLPOP", "queue", "2")
+			done <- res
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		var b bytes.Buffer
+		ok(t, proto.Write(&b, []string{"RPUSH", "queue", "job"}))
+		ok(t, proto.Write(&b, []string{"LLEN", "queue"}))
+		_, err = raw.Write(b.Bytes())
+		ok(t, err)
+		rd := bufio.NewReader(raw)
+		for _, want := range []string{proto.Int(1), proto.Int(1)} {
+			res, err := proto.Read(rd)
+			ok(t, err)
+			equals(t, want, res)
+		}
+		equals(t, proto.Strings("queue", "job"), <-done)
+	})
+
+	t.Run("partial command", func(t *testing.T) {
+		// the start of the next command doesn't keep the turn
+		s.SetSchedule(server.Schedule{Pipelines: true})
+		raw, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer raw.Close()
+		_, err = raw.Write([]byte("*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nECHO\r\n$5\r\nhel"))
+		ok(t, err)
+		res, err := proto.Read(bufio.NewReader(raw))
+		ok(t, err)
+		equals(t, proto.Inline("PONG"), res)
+
+		done := make(chan struct{})
+		go func() {
+			c.Do("PING")
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("PING waits for the partial command")
+		}
+	})
+}
@@ -2,18 +2,33 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"math"
 	"strconv"
 )
 
 type Simple string
 
+// Map is a RESP3 map reply, as key, value, key, value, &c.
+type Map []interface{}
+
+// Set is a RESP3 set reply.
+type Set []interface{}
+
+// BigNumber is a RESP3 big number reply.
+type BigNumber string
+
 // ErrProtocol is the general error for unexpected input
 var ErrProtocol = errors.New("invalid request")
 
+// maxPrealloc is the most arguments readArray() makes room for up front, so
+// a bogus length doesn't allocate a huge slice.
+const maxPrealloc = 1 << 16
+
 // client always sends arrays with bulk strings
 func readArray(rd *bufio.Reader) ([]string, error) {
-	line, err := rd.ReadString('\n')
+	line, err := readLine(rd)
 	if err != nil {
 		return nil, err
 	}
@@ -25,12 +40,19 @@ func readArray(rd *bufio.Reader) ([]string, error) {
 	default:
 		return nil, ErrProtocol
 	case '*':
-		l, err := strconv.Atoi(line[1 : len(line)-2])
+		l, err := parseLen(line[1 : len(line)-2])
 		if err != nil {
 			return nil, err
 		}
 		// l can be -1
 		var fields []string
+		if l > 0 {
+			n := l
+			if n > maxPrealloc {
+				n = maxPrealloc
+			}
+			fields = make([]string, 0, n)
+		}
 		for ; l > 0; l-- {
 			s, err := readString(rd)
 			if err != nil {
@@ -43,7 +65,7 @@ func readArray(rd *bufio.Reader) ([]string, error) {
 }
 
 func readString(rd *bufio.Reader) (string, error) {
-	line, err := rd.ReadString('\n')
+	line, err := readLine(rd)
 	if err != nil {
 		return "", err
 	}
@@ -62,7 +84,7 @@ func readString(rd *bufio.Reader) (string, error) {
 		return string(line[1 : len(line)-2]), nil
 	case '$':
 		// bulk strings are: `$5\r\nhello\r\n`
-		length, err := strconv.Atoi(line[1 : len(line)-2])
+		length, err := parseLen(line[1 : len(line)-2])
 		if err != nil {
 			return "", err
 		}
@@ -70,6 +92,16 @@ func readString(rd *bufio.Reader) (string, error) {
 			// -1 is a nil response
 			return "", nil
 		}
+		if length+2 <= rd.Size() {
+			// fits in the read buffer: copy it only once
+			b, err := rd.Peek(length + 2)
+			if err != nil {
+				return "", err
+			}
+			s := string(b[:length])
+			rd.Discard(length + 2)
+			return s, nil
+		}
 		var (
 			buf = make([]byte, length+2)
 			pos = 0
@@ -85,6 +117,91 @@ func readString(rd *bufio.Reader) (string, error) {
 	}
 }
 
+// buffered is true if the buffer of rd has a complete request, so
+// readArray() won't wait for the client. Invalid requests count as complete,
+// since readArray() fails right away on those.
+func buffered(rd *bufio.Reader) bool {
+	buf, _ := rd.Peek(rd.Buffered())
+	line, buf, ok := cutLine(buf)
+	if !ok {
+		return false
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return true
+	}
+	n, err := parseLen(line[1 : len(line)-2])
+	if err != nil {
+		return true
+	}
+	for ; n > 0; n-- {
+		line, buf, ok = cutLine(buf)
+		if !ok {
+			return false
+		}
+		if len(line) < 3 || line[0] != '$' {
+			continue
+		}
+		length, err := parseLen(line[1 : len(line)-2])
+		if err != nil {
+			return true
+		}
+		if length < 0 {
+			continue
+		}
+		if len(buf) < length+2 {
+			return false
+		}
+		buf = buf[length+2:]
+	}
+	return true
+}
+
+// cutLine splits off the first line of b, with its \n.
+func cutLine(b []byte) ([]byte, []byte, bool) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return nil, b, false
+	}
+	return b[:i+1], b[i+1:], true
+}
+
+// readLine reads up to and including the next \n. The line is only valid
+// until the next read.
+func readLine(rd *bufio.Reader) ([]byte, error) {
+	line, err := rd.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// a line longer than the buffer is never a valid length
+		return nil, ErrProtocol
+	}
+	return line, err
+}
+
+// parseLen is strconv.Atoi() for the lengths in a request, without
+// allocating.
+func parseLen(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, ErrProtocol
+	}
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 {
+		return 0, ErrProtocol
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, ErrProtocol
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
 // parse a reply
 func ParseReply(rd *bufio.Reader) (interface{}, error) {
 	line, err := rd.ReadString('\n')
@@ -137,12 +254,15 @@ func ParseReply(rd *bufio.Reader) (interface{}, error) {
 			pos += n
 		}
 		return string(buf[:length]), nil
-	case '*':
-		// array
+	case '*', '~', '%':
+		// array, and the RESP3 set and map
 		l, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return nil, ErrProtocol
 		}
+		if line[0] == '%' {
+			l *= 2
+		}
 		// l can be -1
 		var fields []interface{}
 		for ; l > 0; l-- {
@@ -152,6 +272,53 @@ func ParseReply(rd *bufio.Reader) (interface{}, error) {
 			}
 			fields = append(fields, s)
 		}
+		switch line[0] {
+		case '~':
+			return Set(fields), nil
+		case '%':
+			return Map(fields), nil
+		}
 		return fields, nil
+	case '|':
+		// RESP3 attribute, which goes before the actual reply. Skipped.
+		l, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		for l *= 2; l > 0; l-- {
+			if _, err := ParseReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return ParseReply(rd)
+	case '_':
+		// RESP3 null
+		return nil, nil
+	case ',':
+		// RESP3 double
+		v := line[1 : len(line)-2]
+		switch v {
+		case "inf":
+			return math.Inf(1), nil
+		case "-inf":
+			return math.Inf(-1), nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		return f, nil
+	case '#':
+		// RESP3 boolean
+		switch line[1 : len(line)-2] {
+		case "t":
+			return true, nil
+		case "f":
+			return false, nil
+		}
+		return nil, ErrProtocol
+	case '(':
+		// RESP3 big number
+		return BigNumber(line[1 : len(line)-2]), nil
 	}
 }
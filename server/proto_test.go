@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -40,6 +41,18 @@ func TestReadArray(t *testing.T) {
 		{
 			payload: "*-1\r\n", // not sure this is legal in a request
 		},
+		{
+			payload: "*x\r\n",
+			err:     ErrProtocol,
+		},
+		{
+			payload: "*1000000000\r\n$4\r\nPING\r\n",
+			err:     io.EOF,
+		},
+		{
+			payload: "*1" + strings.Repeat("0", 5000) + "\r\n",
+			err:     ErrProtocol,
+		},
 	} {
 		res, err := readArray(bufio.NewReader(bytes.NewBufferString(c.payload)))
 		if have, want := err, c.err; have != want {
@@ -52,6 +65,28 @@ func TestReadArray(t *testing.T) {
 	}
 }
 
+func TestBuffered(t *testing.T) {
+	for payload, want := range map[string]bool{
+		"":                                 false,
+		"*1\r\n$4\r\nPING\r\n":             true,
+		"*1\r\n$4\r\nPING\r\n*1\r\n":       true,
+		"*2\r\n$4\r\nLLEN\r\n$-1\r\n":      true,
+		"*0\r\n":                           true,
+		"PING\r\n":                         true,
+		"*1\r\n$x\r\n":                     true,
+		"*1":                               false,
+		"*2\r\n$4\r\nLLEN\r\n":             false,
+		"*2\r\n$4\r\nLLEN\r\n$6\r\nmyl":    false,
+		"*2\r\n$4\r\nLLEN\r\n$6\r\nmylist": false,
+	} {
+		rd := bufio.NewReader(strings.NewReader(payload))
+		rd.Peek(len(payload))
+		if have := buffered(rd); have != want {
+			t.Errorf("%q: have %t, want %t", payload, have, want)
+		}
+	}
+}
+
 func TestReadString(t *testing.T) {
 	type cas struct {
 		payload string
@@ -109,6 +144,14 @@ func TestReadString(t *testing.T) {
 			payload: "XXXX\r\n",
 			err:     ErrProtocol,
 		},
+		{
+			payload: "$4x\r\nabcd\r\n",
+			err:     ErrProtocol,
+		},
+		{
+			payload: "$4\r\nab",
+			err:     io.EOF,
+		},
 	} {
 		res, err := readString(bufio.NewReader(bytes.NewBufferString(c.payload)))
 		if have, want := err, c.err; have != want {
@@ -153,6 +196,42 @@ func TestParseReply(t *testing.T) {
 			payload: fmt.Sprintf("$%d\r\n%s\r\n", len(bigPayload), bigPayload),
 			res:     bigPayload,
 		},
+		{
+			payload: "*2\r\n:1\r\n$1\r\na\r\n",
+			res:     []interface{}{1, "a"},
+		},
+		{
+			payload: "%1\r\n$1\r\nk\r\n:1\r\n",
+			res:     Map{"k", 1},
+		},
+		{
+			payload: "~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			res:     Set{"a", "b"},
+		},
+		{
+			payload: "_\r\n",
+			res:     nil,
+		},
+		{
+			payload: ",3.14\r\n",
+			res:     3.14,
+		},
+		{
+			payload: ",-inf\r\n",
+			res:     math.Inf(-1),
+		},
+		{
+			payload: "#t\r\n",
+			res:     true,
+		},
+		{
+			payload: "(12345678901234567890\r\n",
+			res:     BigNumber("12345678901234567890"),
+		},
+		{
+			payload: "|1\r\n$3\r\nttl\r\n:10\r\n$3\r\nbar\r\n",
+			res:     "bar",
+		},
 
 		{
 			payload: "",
@@ -189,3 +268,22 @@ func TestParseReply(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkReadArray(b *testing.B) {
+	// MSET with 100k pairs
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n$4\r\nMSET\r\n", 1+2*100000)
+	for i := 0; i < 100000; i++ {
+		k, v := fmt.Sprintf("key:%d", i), fmt.Sprintf("value:%d", i)
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(k), k, len(v), v)
+	}
+	payload := buf.Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readArray(bufio.NewReader(bytes.NewReader(payload))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
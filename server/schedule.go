@@ -0,0 +1,117 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Schedule is how the commands of different connections take turns. See
+// SetSchedule(). The zero value is the default: every command takes its own
+// turn, and commands of all connections mix in whatever order they come in.
+type Schedule struct {
+	// Pipelines makes all the commands a connection sent in one go run back
+	// to back, without commands of other connections in between. That's what
+	// redis does, which runs everything in the buffer of a connection before
+	// it looks at the next connection, so a huge pipeline makes all other
+	// connections wait.
+	Pipelines bool
+	// Yield lets the other connections have a turn after this many commands
+	// of a pipeline, so a huge pipeline can't make them wait for all of it.
+	// Implies Pipelines. 0 is never.
+	Yield int
+}
+
+func (s Schedule) on() bool {
+	return s.Pipelines || s.Yield > 0
+}
+
+// turns lets one peer at a time run commands, in the order they asked.
+type turns struct {
+	mu      sync.Mutex
+	holder  *Peer
+	since   time.Time
+	waiting []turnWait
+	maxHold time.Duration
+}
+
+type turnWait struct {
+	peer *Peer
+	ch   chan struct{}
+}
+
+// acquire waits until it's the turn of the peer.
+func (t *turns) acquire(p *Peer) {
+	t.mu.Lock()
+	if t.holder == nil {
+		t.holder, t.since = p, time.Now()
+		t.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	t.waiting = append(t.waiting, turnWait{peer: p, ch: ch})
+	t.mu.Unlock()
+	<-ch
+}
+
+// release ends the turn of the peer, if it has it, and gives it to the peer
+// which waits the longest.
+func (t *turns) release(p *Peer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.holder != p {
+		return
+	}
+	if d := time.Since(t.since); d > t.maxHold {
+		t.maxHold = d
+	}
+	t.holder = nil
+	if len(t.waiting) > 0 {
+		next := t.waiting[0]
+		t.waiting = t.waiting[1:]
+		t.holder, t.since = next.peer, time.Now()
+		close(next.ch)
+	}
+}
+
+// holds is true if it's the turn of the peer.
+func (t *turns) holds(p *Peer) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.holder == p
+}
+
+func (t *turns) max() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.maxHold
+}
+
+func (t *turns) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxHold = 0
+}
+
+// SetSchedule changes how the commands of different connections take turns.
+func (s *Server) SetSchedule(sc Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = sc
+}
+
+func (s *Server) getSchedule() Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.schedule
+}
+
+// MaxTurn is the longest time a connection had the turn with SetSchedule(),
+// which is the longest time all other connections had to wait.
+func (s *Server) MaxTurn() time.Duration {
+	return s.turns.max()
+}
+
+// ResetMaxTurn sets MaxTurn() back to zero.
+func (s *Server) ResetMaxTurn() {
+	s.turns.reset()
+}
@@ -4,14 +4,27 @@ import (
 	"bufio"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"math"
 	"net"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 )
 
-func errUnknownCommand(cmd string, args []string) string {
+// MsgMaxClients is the error for connections past the limit of
+// SetMaxClients().
+const MsgMaxClients = "ERR max number of clients reached"
+
+// MsgBusy is the error clients get when another command takes longer than the
+// command timeout. See SetCommandTimeout().
+const MsgBusy = "BUSY Redis is busy running a command. You can only wait."
+
+// MsgUnknownCommand is the error for a command which doesn't exist.
+func MsgUnknownCommand(cmd string, args []string) string {
 	s := fmt.Sprintf("ERR unknown command `%s`, with args beginning with: ", cmd)
 	if len(args) > 20 {
 		args = args[:20]
@@ -32,14 +45,53 @@ type Hook func(*Peer, string, ...string) bool
 
 // Server is a simple redis server
 type Server struct {
-	l         net.Listener
-	cmds      map[string]Cmd
-	preHook   Hook
-	peers     map[net.Conn]struct{}
-	mu        sync.Mutex
-	wg        sync.WaitGroup
-	infoConns int
-	infoCmds  int
+	l            net.Listener
+	cmds         map[string]Cmd
+	preHook      Hook
+	peers        map[net.Conn]*Peer
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+	infoConns    int
+	infoCmds     int
+	timeout      time.Duration           // see SetCommandTimeout()
+	running      map[*Peer]time.Time     // start of the running commands. Zero when paused.
+	ran          map[*Peer]time.Duration // running time before the last Pause()
+	replying     map[*Peer]struct{}      // done running, and flushing the reply
+	slow         WriteDelay              // see SetWriteDelay()
+	goroutines   int32                   // see Goroutines()
+	slowAfter    time.Duration           // see SetSlowHook()
+	slowHook     SlowHook                // see SetSlowHook()
+	traceHook    TraceHook               // see SetTraceHook()
+	errorHook    ErrorHook               // see SetErrorHook()
+	attrHook     AttributeHook           // see SetAttributeHook()
+	schedule     Schedule                // see SetSchedule()
+	turns        turns                   // see SetSchedule()
+	connTimeouts ConnTimeouts            // see SetConnTimeouts()
+	maxClients   int                     // see SetMaxClients()
+	rejected     int                     // see RejectedConnections()
+}
+
+// SlowHook is called for commands which took longer than the threshold. See
+// SetSlowHook().
+type SlowHook func(c *Peer, args []string, d time.Duration)
+
+// TraceHook is called after every command. See SetTraceHook().
+type TraceHook func(c *Peer, args []string, start time.Time, d time.Duration, errReply string)
+
+// ErrorHook is called after a command which replied with an error. See
+// SetErrorHook().
+type ErrorHook func(c *Peer, cmd string, errReply string)
+
+// AttributeHook gives the RESP3 attributes to send before the reply of a
+// command. See SetAttributeHook().
+type AttributeHook func(c *Peer, cmd string, args []string) map[string]string
+
+// WriteDelay slows down how replies are written to a connection, to simulate
+// slow networks or small packets. See SetWriteDelay().
+type WriteDelay struct {
+	Delay      time.Duration // wait before every reply
+	ChunkSize  int           // write replies in pieces of at most this many bytes. 0 is no limit.
+	ChunkDelay time.Duration // wait between pieces
 }
 
 // NewServer makes a server listening on addr. Close with .Close().
@@ -61,14 +113,15 @@ func NewServerTLS(addr string, cfg *tls.Config) (*Server, error) {
 
 func newServer(l net.Listener) *Server {
 	s := Server{
-		cmds:  map[string]Cmd{},
-		peers: map[net.Conn]struct{}{},
-		l:     l,
+		cmds:     map[string]Cmd{},
+		peers:    map[net.Conn]*Peer{},
+		running:  map[*Peer]time.Time{},
+		ran:      map[*Peer]time.Duration{},
+		replying: map[*Peer]struct{}{},
+		l:        l,
 	}
 
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
+	s.goroutine(func() {
 		s.serve(l)
 
 		s.mu.Lock()
@@ -76,10 +129,27 @@ func newServer(l net.Listener) *Server {
 			c.Close()
 		}
 		s.mu.Unlock()
-	}()
+	})
 	return &s
 }
 
+// goroutine runs f in a goroutine, which Close() waits for.
+func (s *Server) goroutine(f func()) {
+	s.wg.Add(1)
+	atomic.AddInt32(&s.goroutines, 1)
+	go func() {
+		defer s.wg.Done()
+		defer atomic.AddInt32(&s.goroutines, -1)
+		f()
+	}()
+}
+
+// Goroutines is the number of goroutines of the server: the listener, and
+// two per connection. All of them are gone after Close().
+func (s *Server) Goroutines() int {
+	return int(atomic.LoadInt32(&s.goroutines))
+}
+
 // (un)set a hook which is ran before every call. It returns true if the command is done.
 func (s *Server) SetPreHook(h Hook) {
 	s.mu.Lock()
@@ -87,6 +157,195 @@ func (s *Server) SetPreHook(h Hook) {
 	s.mu.Unlock()
 }
 
+// SetErrorHook sets a hook which is called after every command which replied
+// with an error, with the upper case command and the first error. Use nil to
+// disable it.
+func (s *Server) SetErrorHook(h ErrorHook) {
+	s.mu.Lock()
+	s.errorHook = h
+	s.mu.Unlock()
+}
+
+// SetAttributeHook sets a hook which is called before every known command of
+// a RESP3 client, with the upper case command. The attributes it returns, if
+// any, are written as a RESP3 attribute before the reply. Use nil to disable
+// it.
+func (s *Server) SetAttributeHook(h AttributeHook) {
+	s.mu.Lock()
+	s.attrHook = h
+	s.mu.Unlock()
+}
+
+// SetCommandTimeout sets the maximum time a command can run. While a command
+// runs longer than that, all other clients get a BUSY error, instead of
+// waiting for it to finish. The slow command itself is not interrupted. 0
+// disables the timeout, which is the default.
+func (s *Server) SetCommandTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeout = d
+}
+
+// SetWriteDelay slows down the replies to all connections, including the
+// connections which are already open. Connections with their own delay (see
+// Peer.SetWriteDelay()) are not changed. The zero value disables it, which is
+// the default.
+func (s *Server) SetWriteDelay(d WriteDelay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slow = d
+}
+
+// SetPeerWriteDelay calls SetWriteDelay() on the peer with the given ID.
+// Returns false if there is no such peer.
+func (s *Server) SetPeerWriteDelay(id int, d WriteDelay) bool {
+	var peer *Peer
+	s.mu.Lock()
+	for _, p := range s.peers {
+		if p.id == id {
+			peer = p
+		}
+	}
+	s.mu.Unlock()
+	if peer == nil {
+		return false
+	}
+	peer.SetWriteDelay(d)
+	return true
+}
+
+func (s *Server) writeDelay() WriteDelay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slow
+}
+
+// SetSlowHook makes the server call f for every command which takes longer
+// than the threshold, including the time to write the reply. Time spend in
+// Pause() (blocking commands which are waiting) doesn't count, same as with
+// the redis SLOWLOG. f is called from the goroutine of the connection. Use a
+// nil f to disable it.
+func (s *Server) SetSlowHook(threshold time.Duration, f SlowHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowAfter = threshold
+	s.slowHook = f
+}
+
+// SetTraceHook sets a function which is called after every command, with
+// when it started, how long it took including writing the reply, and the
+// first error the command replied, if any. f is called from the goroutine of
+// the connection. Use a nil f to disable it.
+func (s *Server) SetTraceHook(f TraceHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traceHook = f
+}
+
+// trace calls the SetTraceHook() hook, if any.
+func (s *Server) trace(c *Peer, args []string, start time.Time) {
+	s.mu.Lock()
+	h := s.traceHook
+	s.mu.Unlock()
+	if h == nil {
+		return
+	}
+	c.mu.Lock()
+	errReply := c.errReply
+	c.mu.Unlock()
+	h(c, args, start, time.Since(start), errReply)
+}
+
+// Pause marks the running command of the peer as idle, until Resume() is
+// called. Blocking commands use this while they are waiting, so they don't
+// count towards the command timeout, and other connections get a turn, see
+// SetSchedule().
+func (s *Server) Pause(c *Peer) {
+	s.turns.release(c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.running[c]; ok && !t.IsZero() {
+		s.running[c] = time.Time{}
+		s.ran[c] += time.Since(t)
+	}
+}
+
+// Resume undoes a Pause(). The running time starts again from zero. With
+// SetSchedule() it waits until it's the turn of the peer again, so don't hold
+// any locks the other connections need.
+func (s *Server) Resume(c *Peer) {
+	if s.getSchedule().on() && !s.turns.holds(c) {
+		s.turns.acquire(c)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.running[c]; ok && t.IsZero() {
+		s.running[c] = time.Now()
+	}
+}
+
+// Blocked is true if the peer is Pause()d.
+func (s *Server) Blocked(c *Peer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.running[c]
+	return ok && t.IsZero()
+}
+
+// busy is true if another peer runs a command for longer than the timeout.
+func (s *Server) busy(c *Peer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timeout <= 0 {
+		return false
+	}
+	for p, t := range s.running {
+		if p != c && !t.IsZero() && time.Since(t) > s.timeout {
+			return true
+		}
+	}
+	return false
+}
+
+// setRunning marks the start and the end of a command. At the end it returns
+// how long the command ran, without the Pause()d time, and the peer is
+// replying until setReplied().
+func (s *Server) setRunning(c *Peer, running bool) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if running {
+		s.running[c] = time.Now()
+		return 0
+	}
+	d := s.ran[c]
+	if t := s.running[c]; !t.IsZero() {
+		d += time.Since(t)
+	}
+	delete(s.running, c)
+	delete(s.ran, c)
+	s.replying[c] = struct{}{}
+	return d
+}
+
+// setReplied marks that the reply of the command is sent. The Idle timeout
+// starts from now.
+func (s *Server) setReplied(c *Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.replying, c)
+	c.touch()
+}
+
+// checkSlow calls the SetSlowHook() hook, if needed.
+func (s *Server) checkSlow(c *Peer, args []string, d time.Duration) {
+	s.mu.Lock()
+	h, threshold := s.slowHook, s.slowAfter
+	s.mu.Unlock()
+	if h != nil && d > threshold {
+		h(c, args, d)
+	}
+}
+
 func (s *Server) serve(l net.Listener) {
 	for {
 		conn, err := l.Accept()
@@ -99,22 +358,48 @@ func (s *Server) serve(l net.Listener) {
 
 // ServeConn handles a net.Conn. Nice with net.Pipe()
 func (s *Server) ServeConn(conn net.Conn) {
-	s.wg.Add(1)
 	s.mu.Lock()
-	s.peers[conn] = struct{}{}
+	if s.maxClients > 0 && len(s.peers) >= s.maxClients {
+		s.rejected++
+		s.mu.Unlock()
+		s.goroutine(func() {
+			defer conn.Close()
+			conn.Write([]byte("-" + MsgMaxClients + "\r\n"))
+		})
+		return
+	}
 	s.infoConns++
+	peer := s.newPeer(conn, s.infoConns)
+	s.peers[conn] = peer
+	setKeepAlive(conn, s.connTimeouts.KeepAlive)
 	s.mu.Unlock()
 
-	go func() {
-		defer s.wg.Done()
+	s.goroutine(func() {
 		defer conn.Close()
 
-		s.servePeer(conn)
+		s.servePeer(conn, peer)
 
 		s.mu.Lock()
 		delete(s.peers, conn)
 		s.mu.Unlock()
-	}()
+	})
+}
+
+// SetMaxClients makes the server refuse new connections once there are n, the
+// same as the "maxclients" config. The connections get a MsgMaxClients error
+// first. Connections which are already there stay. 0 is no limit.
+func (s *Server) SetMaxClients(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxClients = n
+}
+
+// RejectedConnections is the number of connections refused because of
+// SetMaxClients().
+func (s *Server) RejectedConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rejected
 }
 
 // Addr has the net.Addr struct
@@ -153,11 +438,81 @@ func (s *Server) Register(cmd string, f Cmd) error {
 	return nil
 }
 
-func (s *Server) servePeer(c net.Conn) {
-	r := bufio.NewReader(c)
+// Rename changes the name of a registered command, same as the
+// "rename-command" config. An empty name removes the command.
+func (s *Server) Rename(from, to string) error {
+	return s.RenameAll([][2]string{{from, to}})
+}
+
+// RenameAll does a Rename() for every from, to pair, in order. If any of them
+// fails nothing is renamed.
+func (s *Server) RenameAll(renames [][2]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmds := make(map[string]Cmd, len(s.cmds))
+	for k, v := range s.cmds {
+		cmds[k] = v
+	}
+	for _, r := range renames {
+		from, to := strings.ToUpper(r[0]), strings.ToUpper(r[1])
+		f, ok := cmds[from]
+		if !ok {
+			return fmt.Errorf("no such command: %s", from)
+		}
+		if _, ok := cmds[to]; ok {
+			return fmt.Errorf("command already registered: %s", to)
+		}
+		delete(cmds, from)
+		if to != "" {
+			cmds[to] = f
+		}
+	}
+	s.cmds = cmds
+	return nil
+}
+
+// Alias registers another name for a registered command. The handler gets the
+// name which was used.
+func (s *Server) Alias(alias, cmd string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alias, cmd = strings.ToUpper(alias), strings.ToUpper(cmd)
+	f, ok := s.cmds[cmd]
+	if !ok {
+		return fmt.Errorf("no such command: %s", cmd)
+	}
+	if _, ok := s.cmds[alias]; ok {
+		return fmt.Errorf("command already registered: %s", alias)
+	}
+	s.cmds[alias] = f
+	return nil
+}
+
+func (s *Server) newPeer(c net.Conn, id int) *Peer {
+	sw := &slowWriter{
+		w:        c,
+		delay:    s.writeDelay,
+		deadline: s.writeDeadline,
+		first:    true,
+		wake:     make(chan struct{}, 1),
+	}
+	now := time.Now()
 	peer := &Peer{
-		w: bufio.NewWriter(c),
+		w:       bufio.NewWriter(sw),
+		done:    make(chan struct{}),
+		sw:      sw,
+		id:      id,
+		addr:    c.RemoteAddr().String(),
+		laddr:   c.LocalAddr().String(),
+		created: now,
+		active:  now,
 	}
+	sw.cond = sync.NewCond(&peer.mu)
+	return peer
+}
+
+func (s *Server) servePeer(c net.Conn, peer *Peer) {
+	r := bufio.NewReader(c)
 
 	defer func() {
 		for _, f := range peer.onDisconnect {
@@ -165,25 +520,63 @@ func (s *Server) servePeer(c net.Conn) {
 		}
 	}()
 
-	readCh := make(chan []string)
+	stop := make(chan struct{})
+	defer close(stop)
+	s.goroutine(func() { peer.send(stop) })
 
-	go func() {
+	readCh := make(chan request)
+
+	s.goroutine(func() {
 		defer close(readCh)
 
 		for {
+			// wait for a command, until the connection is idle for too
+			// long, and then give it Read to arrive completely.
+			c.SetReadDeadline(s.idleDeadline(peer))
+			if _, err := r.Peek(1); err != nil {
+				if isTimeout(err) && time.Now().Before(s.idleDeadline(peer)) {
+					continue
+				}
+				peer.Close()
+				return
+			}
+			c.SetReadDeadline(s.readDeadline())
 			args, err := readArray(r)
 			if err != nil {
 				peer.Close()
 				return
 			}
+			peer.touch()
+			if len(args) == 0 {
+				// redis ignores "*0" and "*-1"
+				continue
+			}
 
-			readCh <- args
+			// If the next command of a pipeline is already in the buffer
+			// we can keep the turn. Not if it's only the start of it: the
+			// rest might never come.
+			readCh <- request{args: args, more: buffered(r)}
 		}
-	}()
+	})
 
-	for args := range readCh {
-		s.Dispatch(peer, args)
-		peer.Flush()
+	defer s.turns.release(peer)
+	n := 0 // commands in this turn
+	for req := range readCh {
+		sc := s.getSchedule()
+		if sc.on() && !s.turns.holds(peer) {
+			s.turns.acquire(peer)
+			n = 0
+		}
+		if s.busy(peer) {
+			peer.WriteError(MsgBusy)
+			peer.Flush()
+		} else {
+			s.run(peer, req.args)
+		}
+		n++
+		if !req.more || !sc.on() || (sc.Yield > 0 && n >= sc.Yield) {
+			s.turns.release(peer)
+		}
 
 		if peer.Closed() {
 			c.Close()
@@ -191,9 +584,44 @@ func (s *Server) servePeer(c net.Conn) {
 	}
 }
 
+// request is a command read from a connection.
+type request struct {
+	args []string
+	more bool // the next command is already there
+}
+
+// run runs a command from a connection, and sends the reply.
+func (s *Server) run(peer *Peer, args []string) {
+	cmdStart := time.Now()
+	s.setRunning(peer, true)
+	s.Dispatch(peer, args)
+	d := s.setRunning(peer, false)
+	start := time.Now()
+	peer.Flush()
+	s.setReplied(peer)
+	s.checkSlow(peer, args, d+time.Since(start))
+	s.trace(peer, args, cmdStart)
+}
+
 func (s *Server) Dispatch(c *Peer, args []string) {
 	cmd, args := args[0], args[1:]
 	cmdUp := strings.ToUpper(cmd)
+
+	c.mu.Lock()
+	c.errReply = ""
+	c.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		h := s.errorHook
+		s.mu.Unlock()
+		c.mu.Lock()
+		e := c.errReply
+		c.mu.Unlock()
+		if h != nil && e != "" {
+			h(c, cmdUp, e)
+		}
+	}()
+
 	s.mu.Lock()
 	h := s.preHook
 	s.mu.Unlock()
@@ -207,13 +635,19 @@ func (s *Server) Dispatch(c *Peer, args []string) {
 	cb, ok := s.cmds[cmdUp]
 	s.mu.Unlock()
 	if !ok {
-		c.WriteError(errUnknownCommand(cmd, args))
+		c.WriteError(MsgUnknownCommand(cmd, args))
 		return
 	}
 
 	s.mu.Lock()
 	s.infoCmds++
+	ah := s.attrHook
 	s.mu.Unlock()
+	if ah != nil && c.Resp3 {
+		if attrs := ah(c, cmdUp, args); len(attrs) > 0 {
+			c.WriteAttributes(attrs)
+		}
+	}
 	cb(c, cmdUp, args)
 }
 
@@ -231,6 +665,31 @@ func (s *Server) ClientsLen() int {
 	return len(s.peers)
 }
 
+// Peers gives the connected clients, ordered by ID.
+func (s *Server) Peers() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].id < res[j].id })
+	return res
+}
+
+// Kill disconnects a peer right away, without waiting for its running
+// command, if any. Blocking commands see the peer as Closed().
+func (s *Server) Kill(c *Peer) {
+	s.mu.Lock()
+	for conn, p := range s.peers {
+		if p == c {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+	c.Close()
+}
+
 // TotalConnections give the number of clients connected since the server
 // started, including the currently connected ones
 func (s *Server) TotalConnections() int {
@@ -243,32 +702,91 @@ func (s *Server) TotalConnections() int {
 type Peer struct {
 	w            *bufio.Writer
 	closed       bool
+	done         chan struct{} // closed by Close()
 	Resp3        bool
 	Ctx          interface{} // anything goes, server won't touch this
 	onDisconnect []func()    // list of callbacks
 	mu           sync.Mutex  // for Block()
+	id           int         // unique per server. 0 for NewPeer() peers.
+	addr         string      // remote address
+	laddr        string      // local address
+	created      time.Time   // when the client connected
+	sw           *slowWriter // nil for NewPeer() peers
+	errReply     string      // first error written by the running command
+	active       time.Time   // the last command, for the Idle timeout
+	noIdle       bool        // see SetNoIdle()
 }
 
 func NewPeer(w *bufio.Writer) *Peer {
 	return &Peer{
-		w: w,
+		w:    w,
+		done: make(chan struct{}),
 	}
 }
 
+// ID is the client ID, unique per server. 0 for peers made with NewPeer().
+func (c *Peer) ID() int {
+	return c.id
+}
+
+// RemoteAddr is the address of the client, as "host:port". Empty for peers
+// made with NewPeer().
+func (c *Peer) RemoteAddr() string {
+	return c.addr
+}
+
+// SetWriteDelay slows down the replies to this connection. It overrides the
+// delay set with Server.SetWriteDelay(). The zero value makes the connection
+// use the server delay again. Doesn't work on NewPeer() peers.
+func (c *Peer) SetWriteDelay(d WriteDelay) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sw != nil {
+		c.sw.own = d
+	}
+}
+
+// LocalAddr is the address of the server the client connected to, as
+// "host:port". Empty for peers made with NewPeer().
+func (c *Peer) LocalAddr() string {
+	return c.laddr
+}
+
+// Created is when the client connected. Zero for peers made with NewPeer().
+func (c *Peer) Created() time.Time {
+	return c.created
+}
+
 // Flush the write buffer. Called automatically after every redis command
 func (c *Peer) Flush() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.w.Flush()
+	if c.sw != nil {
+		// wait for the send() goroutine, which unlocks c.mu meanwhile.
+		for target := c.sw.queued; c.sw.sent < target; {
+			c.sw.cond.Wait()
+		}
+		c.sw.first = true
+	}
 }
 
 // Close the client connection after the current command is done.
 func (c *Peer) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if !c.closed && c.done != nil {
+		close(c.done)
+	}
 	c.closed = true
 }
 
+// Done is closed when the peer is Close()d, for example because the client
+// went away.
+func (c *Peer) Done() <-chan struct{} {
+	return c.done
+}
+
 // Return true if the peer connection closed.
 func (c *Peer) Closed() bool {
 	c.mu.Lock()
@@ -292,6 +810,9 @@ func (c *Peer) Block(f func(*Writer)) {
 // WriteError writes a redis 'Error'
 func (c *Peer) WriteError(e string) {
 	c.Block(func(w *Writer) {
+		if c.errReply == "" {
+			c.errReply = e
+		}
 		w.WriteError(e)
 	})
 }
@@ -322,7 +843,8 @@ func (c *Peer) WriteNull() {
 	})
 }
 
-// WriteLen starts an array with the given length
+// WriteLen starts an array with the given length. A length of -1 is the nil
+// array, which is a null in RESP3.
 func (c *Peer) WriteLen(n int) {
 	c.Block(func(w *Writer) {
 		w.WriteLen(n)
@@ -336,6 +858,28 @@ func (c *Peer) WriteMapLen(n int) {
 	})
 }
 
+// WritePairsLen starts n key/value pairs, see Writer.WritePairsLen()
+func (c *Peer) WritePairsLen(n int) {
+	c.Block(func(w *Writer) {
+		w.WritePairsLen(n)
+	})
+}
+
+// WritePair starts a key/value pair, see Writer.WritePairsLen()
+func (c *Peer) WritePair() {
+	c.Block(func(w *Writer) {
+		w.WritePair()
+	})
+}
+
+// WriteAttributes writes a RESP3 attribute, which goes before a reply. They
+// are not written for RESP2 clients, which don't know about attributes.
+func (c *Peer) WriteAttributes(attrs map[string]string) {
+	c.Block(func(w *Writer) {
+		w.WriteAttributes(attrs)
+	})
+}
+
 // WriteSetLen starts a set with the given length (number of elements)
 func (c *Peer) WriteSetLen(n int) {
 	c.Block(func(w *Writer) {
@@ -378,6 +922,123 @@ func (c *Peer) WriteStrings(strs []string) {
 	})
 }
 
+// slowWriter queues the replies of a Peer, which its send() goroutine writes
+// to the connection, with the delays of a WriteDelay. It's used between the
+// bufio.Writer of a Peer and the connection, and is protected by the mutex of
+// the Peer. Nothing waits for the connection while holding a lock, so a slow
+// client doesn't hold up others; only Peer.Flush() waits, and that runs from
+// the goroutine of the connection itself.
+type slowWriter struct {
+	w        io.Writer
+	delay    func() WriteDelay // the server delay
+	deadline func() time.Time  // see ConnTimeouts.Write
+	own      WriteDelay        // see Peer.SetWriteDelay()
+	first    bool              // nothing written yet since the last Flush()
+	queue    []byte            // not sent yet
+	queued   int64             // bytes queued, ever
+	sent     int64             // bytes sent, or dropped, ever
+	dead     bool              // a write failed, drop everything
+	wake     chan struct{}     // there is something in queue
+	cond     *sync.Cond        // on Peer.mu, after every send
+}
+
+// Write queues p. It never blocks.
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	sw.queued += int64(len(p))
+	if sw.dead {
+		sw.sent = sw.queued
+		return len(p), nil
+	}
+	sw.queue = append(sw.queue, p...)
+	select {
+	case sw.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// send writes everything queued to the connection, until stop is closed.
+// Called in its own goroutine.
+func (c *Peer) send(stop <-chan struct{}) {
+	sw := c.sw
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		sw.drop()
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-sw.wake:
+		}
+
+		c.mu.Lock()
+		p, first := sw.queue, sw.first
+		sw.queue, sw.first = nil, false
+		d := sw.own
+		c.mu.Unlock()
+		if d == (WriteDelay{}) {
+			d = sw.delay()
+		}
+
+		err := sw.write(p, d, first)
+		if conn, ok := sw.w.(net.Conn); ok && isTimeout(err) {
+			// The Write timeout of SetConnTimeouts() expired, so a
+			// client which stopped reading doesn't keep anything waiting
+			// forever.
+			conn.Close()
+		}
+
+		c.mu.Lock()
+		sw.sent += int64(len(p))
+		if err != nil {
+			sw.drop()
+		}
+		sw.cond.Broadcast()
+		c.mu.Unlock()
+	}
+}
+
+// drop gives up on the connection. Must hold the mutex of the Peer.
+func (sw *slowWriter) drop() {
+	sw.dead = true
+	sw.queue = nil
+	sw.sent = sw.queued
+	sw.cond.Broadcast()
+}
+
+func (sw *slowWriter) write(p []byte, d WriteDelay, first bool) error {
+	if len(p) == 0 {
+		return nil
+	}
+	if c, ok := sw.w.(net.Conn); ok && sw.deadline != nil {
+		c.SetWriteDeadline(sw.deadline())
+	}
+	if first && d.Delay > 0 {
+		time.Sleep(d.Delay)
+	}
+	if d.ChunkSize <= 0 {
+		_, err := sw.w.Write(p)
+		return err
+	}
+	for n := 0; len(p) > 0; n++ {
+		if n > 0 && d.ChunkDelay > 0 {
+			time.Sleep(d.ChunkDelay)
+		}
+		chunk := p
+		if len(chunk) > d.ChunkSize {
+			chunk = chunk[:d.ChunkSize]
+		}
+		m, err := sw.w.Write(chunk)
+		if err != nil {
+			return err
+		}
+		p = p[m:]
+	}
+	return nil
+}
+
 func toInline(s string) string {
 	return strings.Map(func(r rune) rune {
 		if unicode.IsSpace(r) {
@@ -399,6 +1060,10 @@ func (w *Writer) WriteError(e string) {
 }
 
 func (w *Writer) WriteLen(n int) {
+	if n < 0 && w.resp3 {
+		fmt.Fprint(w.w, "_\r\n")
+		return
+	}
 	fmt.Fprintf(w.w, "*%d\r\n", n)
 }
 
@@ -410,6 +1075,44 @@ func (w *Writer) WriteMapLen(n int) {
 	w.WriteLen(n * 2)
 }
 
+// WritePairsLen starts n key/value pairs, where every pair starts with
+// WritePair(). That's a map for RESP3, and an array of [key, value] arrays for
+// RESP2, as XREAD replies.
+func (w *Writer) WritePairsLen(n int) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "%%%d\r\n", n)
+		return
+	}
+	w.WriteLen(n)
+}
+
+// WritePair starts a key/value pair of WritePairsLen(). Nothing is written for
+// RESP3.
+func (w *Writer) WritePair() {
+	if w.resp3 {
+		return
+	}
+	w.WriteLen(2)
+}
+
+// WriteAttributes writes a RESP3 attribute, with the keys sorted. Nothing is
+// written for RESP2.
+func (w *Writer) WriteAttributes(attrs map[string]string) {
+	if !w.resp3 {
+		return
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w.w, "|%d\r\n", len(keys))
+	for _, k := range keys {
+		w.WriteBulk(k)
+		w.WriteBulk(attrs[k])
+	}
+}
+
 func (w *Writer) WriteSetLen(n int) {
 	if w.resp3 {
 		fmt.Fprintf(w.w, "~%d\r\n", n)
@@ -476,6 +1179,12 @@ func (w *Writer) Flush() {
 	w.w.Flush()
 }
 
+// FormatFloat formats a float the way WriteFloat() does, for replies which
+// are always strings.
+func FormatFloat(v float64) string {
+	return formatFloat(v)
+}
+
 // formatFloat formats a float the way redis does (sort-of)
 func formatFloat(v float64) string {
 	if math.IsInf(v, 1) {
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"bufio"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"strconv"
 	"strings"
 	"testing"
@@ -167,6 +169,33 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestEmptyRequest(t *testing.T) {
+	s, err := NewServer(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Register("PING", func(c *Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+
+	c, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("*0\r\n*-1\r\n*1\r\n$4\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	res, err := proto.Read(bufio.NewReader(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, proto.Inline("PONG"); have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+}
+
 func testServerTLS(t *testing.T) *tls.Config {
 	cert, err := tls.LoadX509KeyPair("../testdata/server.crt", "../testdata/server.key")
 	if err != nil {
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// ConnTimeouts are the timeouts and the TCP keepalive of client connections.
+// See SetConnTimeouts(). The zero value is the default: no timeouts, and the
+// keepalive Go uses.
+type ConnTimeouts struct {
+	// Idle closes connections which didn't send a command for this long, same
+	// as the "timeout" config of redis. Connections which run a command, or
+	// wait in a blocking one, are not idle, and neither are the ones which
+	// SetNoIdle(). 0 is never.
+	Idle time.Duration
+	// Read closes connections which started a command, but take longer than
+	// this to send the rest of it. 0 is no limit.
+	Read time.Duration
+	// Write closes connections which take longer than this to accept a
+	// reply, such as clients which stopped reading. 0 is no limit.
+	Write time.Duration
+	// KeepAlive is the period of the TCP keepalive probes of new connections.
+	// 0 is the Go default, negative is no keepalive.
+	KeepAlive time.Duration
+}
+
+// SetConnTimeouts changes the timeouts of connections. The keepalive only
+// changes for new connections.
+func (s *Server) SetConnTimeouts(t ConnTimeouts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connTimeouts = t
+}
+
+func (s *Server) getConnTimeouts() ConnTimeouts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connTimeouts
+}
+
+// setKeepAlive sets the TCP keepalive of a new connection. TLS connections
+// keep the default.
+func setKeepAlive(c net.Conn, d time.Duration) {
+	tc, ok := c.(*net.TCPConn)
+	if !ok || d == 0 {
+		return
+	}
+	if d < 0 {
+		tc.SetKeepAlive(false)
+		return
+	}
+	tc.SetKeepAlive(true)
+	tc.SetKeepAlivePeriod(d)
+}
+
+// idleDeadline is when the connection is idle for too long, if it doesn't
+// send a command before that. Zero if there is no Idle timeout.
+func (s *Server) idleDeadline(c *Peer) time.Time {
+	s.mu.Lock()
+	idle := s.connTimeouts.Idle
+	_, running := s.running[c]
+	_, replying := s.replying[c]
+	if idle <= 0 {
+		s.mu.Unlock()
+		return time.Time{}
+	}
+
+	// active is changed under s.mu when the reply is sent, see setReplied().
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer s.mu.Unlock()
+	if running || replying || c.noIdle {
+		return time.Now().Add(idle)
+	}
+	return c.active.Add(idle)
+}
+
+// readDeadline is the deadline to read the rest of a command. Zero if there
+// is no Read timeout.
+func (s *Server) readDeadline() time.Time {
+	if t := s.getConnTimeouts().Read; t > 0 {
+		return time.Now().Add(t)
+	}
+	return time.Time{}
+}
+
+// writeDeadline is the deadline to write a reply. Zero if there is no Write
+// timeout.
+func (s *Server) writeDeadline() time.Time {
+	if t := s.getConnTimeouts().Write; t > 0 {
+		return time.Now().Add(t)
+	}
+	return time.Time{}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// SetNoIdle makes the Idle timeout of SetConnTimeouts() skip the connection,
+// as redis does for pubsub connections.
+func (c *Peer) SetNoIdle(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noIdle = on
+}
+
+// touch marks the connection as active now, for the Idle timeout.
+func (c *Peer) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = time.Now()
+}
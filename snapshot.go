@@ -0,0 +1,158 @@
+package miniredis
+
+// Saving and restoring the complete state. See Miniredis.Snapshot().
+
+import (
+	"reflect"
+)
+
+// Snapshot is a copy of all keys in all DBs, and of the Lua script cache. Make
+// one with Miniredis.Snapshot(), and load it with Miniredis.Restore(). A
+// Snapshot is never changed, so it can be restored many times, and in other
+// Miniredis instances as well.
+//
+// FUNCTION libraries are not supported by miniredis, so there is nothing to
+// save for those.
+type Snapshot struct {
+	dbs     map[int]*RedisDB
+	scripts map[string]string // sha1 -> lua src
+}
+
+// Snapshot copies all keys, with their TTLs, and all scripts loaded with
+// SCRIPT LOAD or EVAL.
+func (m *Miniredis) Snapshot() *Snapshot {
+	m.Lock()
+	defer m.Unlock()
+
+	s := &Snapshot{
+		dbs:     map[int]*RedisDB{},
+		scripts: map[string]string{},
+	}
+	for id, db := range m.dbs {
+		cpy := newRedisDB(id, m)
+		copyDB(db, &cpy)
+		s.dbs[id] = &cpy
+	}
+	for sha, src := range m.scripts {
+		s.scripts[sha] = src
+	}
+	return s
+}
+
+// Restore replaces all keys in all DBs with the keys from the snapshot. Keys
+// which are not in the snapshot are gone, WATCHes on changed keys fail, and
+// DeterministicScan() cursors from before the Restore() are invalid.
+//
+// The scripts from the snapshot are added to the script cache, so EVALSHA
+// keeps working. Scripts already in the cache stay there: a real server keeps
+// them until SCRIPT FLUSH, and Restore() is more like loading data than like a
+// new server.
+func (m *Miniredis) Restore(s *Snapshot) {
+	m.Lock()
+	defer m.Unlock()
+	defer m.signal.Broadcast()
+
+	m.loadDBs(s.dbs)
+	m.scanEpoch++ // see scanPage()
+	for sha, src := range s.scripts {
+		m.scripts[sha] = src
+	}
+	m.writes++
+}
+
+// loadDBs replaces all keys in all DBs with copies of the keys in dbs. No
+// locks!
+func (m *Miniredis) loadDBs(dbs map[int]*RedisDB) {
+	for id := range m.allDBIDs(dbs) {
+		db := m.db(id)
+		db.flush()
+		if src, ok := dbs[id]; ok {
+			for _, k := range src.allKeys() {
+				m.copy(src, k, db, k)
+			}
+		}
+	}
+}
+
+// syncDBs is loadDBs() for replicas: only keys which are different change, so
+// WATCH, client tracking, and OnWrite() don't see the keys which stay the
+// same. No locks!
+func (m *Miniredis) syncDBs(dbs map[int]*RedisDB) {
+	for id := range m.allDBIDs(dbs) {
+		src, ok := dbs[id]
+		if !ok {
+			empty := newRedisDB(id, m)
+			src = &empty
+		}
+		syncDB(src, m.db(id))
+	}
+}
+
+// allDBIDs gives the IDs of our DBs and of dbs. No locks!
+func (m *Miniredis) allDBIDs(dbs map[int]*RedisDB) map[int]struct{} {
+	ids := map[int]struct{}{}
+	for id := range m.dbs {
+		ids[id] = struct{}{}
+	}
+	for id := range dbs {
+		ids[id] = struct{}{}
+	}
+	return ids
+}
+
+// copyDB copies all keys from src into an empty dst, without marking them as
+// changed. No locks!
+func copyDB(src, dst *RedisDB) {
+	for k := range src.keys {
+		cloneKey(src, k, dst, k)
+	}
+}
+
+// syncDB makes dst the same as src. Keys which are the same in both are not
+// touched. No locks!
+func syncDB(src, dst *RedisDB) {
+	for _, k := range dst.allKeys() {
+		if !src.exists(k) {
+			dst.del(k, true)
+		}
+	}
+	for _, k := range src.allKeys() {
+		if sameKey(src, dst, k) {
+			continue
+		}
+		dst.del(k, true)
+		cloneKey(src, k, dst, k)
+		dst.bump(k)
+	}
+}
+
+// sameKey is true if the key has the same type, value, and TTL in both DBs.
+// No locks!
+func sameKey(a, b *RedisDB, k string) bool {
+	if a.t(k) != b.t(k) {
+		return false
+	}
+	ta, oka := a.ttl.get(k)
+	tb, okb := b.ttl.get(k)
+	if oka != okb || ta != tb {
+		return false
+	}
+	switch a.t(k) {
+	case "string":
+		return a.stringKeys[k].String() == b.stringKeys[k].String()
+	case "hash":
+		return reflect.DeepEqual(a.hashKeys[k], b.hashKeys[k])
+	case "list":
+		return reflect.DeepEqual(a.listKeys[k], b.listKeys[k])
+	case "set":
+		return reflect.DeepEqual(a.setKeys[k], b.setKeys[k])
+	case "zset":
+		return reflect.DeepEqual(a.sortedsetKeys[k], b.sortedsetKeys[k])
+	case "stream":
+		return a.streamKeys[k].equal(b.streamKeys[k])
+	case "hll":
+		return reflect.DeepEqual(a.hllKeys[k], b.hllKeys[k])
+	default:
+		panic("missing case")
+	}
+}
@@ -0,0 +1,172 @@
+package miniredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("str", "value")
+	s.SetTTL("str", time.Minute)
+	s.Push("list", "a", "b", "c")
+	s.DB(2).HSet("hash", "f", "v")
+	_, err = s.XAdd("stream", "1-1", []string{"k", "v"})
+	ok(t, err)
+	mustDo(t, c, "XGROUP", "CREATE", "stream", "grp", "0", proto.Inline("OK"))
+	mustDo(t, c,
+		"SCRIPT", "LOAD", "return redis.call('GET', KEYS[1])",
+		proto.String("d3c21d0c2b9ca22f82737626a27bcaf5d288f99f"),
+	)
+	sha := "d3c21d0c2b9ca22f82737626a27bcaf5d288f99f"
+
+	snap := s.Snapshot()
+
+	t.Run("restore", func(t *testing.T) {
+		s.Set("str", "changed")
+		s.Set("new", "key")
+		mustDo(t, c, "LSET", "list", "0", "changed", proto.Inline("OK"))
+		_, err = s.XAdd("stream", "2-2", []string{"k", "v"})
+		ok(t, err)
+		mustDo(t, c, "SCRIPT", "FLUSH", proto.Inline("OK"))
+
+		s.Restore(snap)
+		equals(t, []string{"list", "str", "stream"}, s.Keys())
+		mustDo(t, c, "GET", "str", proto.String("value"))
+		equals(t, time.Minute, s.TTL("str"))
+		mustDo(t, c, "LRANGE", "list", "0", "-1", proto.Strings("a", "b", "c"))
+		mustDo(t, c, "XLEN", "stream", proto.Int(1))
+		mustDo(t, c,
+			"XREADGROUP", "GROUP", "grp", "alice", "STREAMS", "stream", ">",
+			proto.Array(
+				proto.Array(
+					proto.String("stream"),
+					proto.Array(
+						proto.Array(proto.String("1-1"), proto.Strings("k", "v")),
+					),
+				),
+			),
+		)
+		equals(t, "v", s.DB(2).HGet("hash", "f"))
+
+		mustDo(t, c, "EVALSHA", sha, "1", "str", proto.String("value"))
+	})
+
+	t.Run("restore twice", func(t *testing.T) {
+		s.Restore(snap)
+		mustDo(t, c, "XLEN", "stream", proto.Int(1))
+		mustDo(t, c,
+			"XPENDING", "stream", "grp",
+			proto.Array(
+				proto.Int(0),
+				proto.Nil,
+				proto.Nil,
+				proto.NilList,
+			),
+		)
+	})
+
+	t.Run("other instance", func(t *testing.T) {
+		s2 := RunT(t)
+		c2, err := proto.Dial(s2.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		s2.Set("gone", "soon")
+		mustDo(t, c2, "SCRIPT", "LOAD", "return 1", proto.String("e0e1f9fabfc9d4800c877a703b823ac0578ff8db"))
+		s2.Restore(snap)
+		equals(t, []string{"list", "str", "stream"}, s2.Keys())
+		mustDo(t, c2, "EVALSHA", sha, "1", "str", proto.String("value"))
+		mustDo(t, c2, "EVALSHA", "e0e1f9fabfc9d4800c877a703b823ac0578ff8db", "0", proto.Int(1))
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		mustOK(t, c, "WATCH", "str")
+		s.Restore(snap)
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SET", "str", "tx", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.NilList)
+	})
+}
+
+func TestSnapshotScan(t *testing.T) {
+	s := RunT(t)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.DeterministicScan(true)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		s.Set(k, "v")
+		s.HSet("h", k, "v")
+	}
+	snap := s.Snapshot()
+
+	t.Run("every key once", func(t *testing.T) {
+		var keys []string
+		cursor := "0"
+		for {
+			res, err := c.Do("SCAN", cursor, "COUNT", "2")
+			ok(t, err)
+			page, err := proto.Parse(res)
+			ok(t, err)
+			cursor = page.([]interface{})[0].(string)
+			for _, k := range page.([]interface{})[1].([]interface{}) {
+				keys = append(keys, k.(string))
+			}
+			if cursor == "0" {
+				break
+			}
+		}
+		equals(t, []string{"h", "k1", "k2", "k3", "k4", "k5"}, keys)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		mustDo(t, c, "SCAN", "0", "COUNT", "2",
+			proto.Array(proto.String("2"), proto.Strings("h", "k1")))
+		mustDo(t, c, "HSCAN", "h", "0", "COUNT", "2",
+			proto.Array(proto.String("2"), proto.Strings("k1", "v", "k2", "v")))
+
+		s.Del("k1")
+		s.Restore(snap)
+		mustDo(t, c, "SCAN", "2", "COUNT", "2",
+			proto.Error(msgInvalidCursor))
+		mustDo(t, c, "HSCAN", "h", "2", "COUNT", "2",
+			proto.Error(msgInvalidCursor))
+		mustDo(t, c, "SSCAN", "s", "2",
+			proto.Error(msgInvalidCursor))
+		mustDo(t, c, "ZSCAN", "z", "2",
+			proto.Error(msgInvalidCursor))
+
+		// new cursors have the number of restores
+		mustDo(t, c, "SCAN", "0", "COUNT", "2",
+			proto.Array(proto.String("4294967298"), proto.Strings("h", "k1")))
+		mustDo(t, c, "SCAN", "4294967298", "COUNT", "2",
+			proto.Array(proto.String("4294967300"), proto.Strings("k2", "k3")))
+		mustDo(t, c, "SCAN", "4294967300", "COUNT", "2",
+			proto.Array(proto.String("0"), proto.Strings("k4", "k5")))
+
+		s.Restore(snap)
+		mustDo(t, c, "SCAN", "4294967298", "COUNT", "2",
+			proto.Error(msgInvalidCursor))
+		mustDo(t, c, "SCAN", "8589934594", "COUNT", "2",
+			proto.Array(proto.String("8589934596"), proto.Strings("k2", "k3")))
+	})
+
+	t.Run("not deterministic", func(t *testing.T) {
+		// all keys come with cursor 0, and other cursors are the end
+		s.DeterministicScan(false)
+		defer s.DeterministicScan(true)
+		s.Restore(snap)
+		mustDo(t, c, "SCAN", "2",
+			proto.Array(proto.String("0"), proto.Strings()))
+		mustDo(t, c, "SCAN", "0",
+			proto.Array(proto.String("0"), proto.Strings("h", "k1", "k2", "k3", "k4", "k5")))
+	})
+}
@@ -0,0 +1,245 @@
+package miniredis
+
+// Access to the keys for custom commands. See Miniredis.RegisterCommand().
+
+import (
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Store gives custom commands access to the keys of the selected DB of the
+// connection. See RegisterCommand().
+//
+// A Store is only valid while the command runs. Miniredis is locked all that
+// time, so the command must not call any methods on the Miniredis itself, and
+// it must not keep the Store around after it returns. Changes made via a Store
+// invalidate WATCHes, and wake up blocking commands, same as normal commands.
+//
+// The methods work the same as the Miniredis methods with the same name.
+type Store interface {
+	// DB is the selected DB of the connection.
+	DB() int
+	// Keys gives all keys, sorted.
+	Keys() []string
+	Exists(k string) bool
+	// Type gives the type of a key, or "".
+	Type(k string) string
+	// Del deletes a key and its TTL. Returns whether there was a key.
+	Del(k string) bool
+	// TTL is the TTL of a key. 0 if it doesn't have one.
+	TTL(k string) time.Duration
+	// SetTTL sets the TTL of a key. A TTL <= 0 removes the key.
+	SetTTL(k string, ttl time.Duration)
+	// Persist removes the TTL of a key.
+	Persist(k string)
+
+	Get(k string) (string, error)
+	// Set sets a string key, and removes its TTL.
+	Set(k, v string) error
+	// HGet gives ErrKeyNotFound if either the key or the field doesn't exist.
+	HGet(k, f string) (string, error)
+	HSet(k string, fv ...string) error
+	HKeys(k string) ([]string, error)
+	List(k string) ([]string, error)
+	Push(k string, v ...string) (int, error)
+	Members(k string) ([]string, error)
+	SAdd(k string, elems ...string) (int, error)
+	ZAdd(k string, score float64, member string) (bool, error)
+	ZMembers(k string) ([]string, error)
+	ZScore(k, member string) (float64, error)
+}
+
+// CommandFunc is a custom command, see RegisterCommand(). args doesn't include
+// the command itself.
+type CommandFunc func(c *server.Peer, store Store, cmd string, args []string)
+
+// RegisterCommand adds a custom command. Unlike with Server().Register() the
+// command doesn't need to know about the internals of miniredis: it works
+// with AUTH, in MULTI transactions, and from Lua scripts, and it gets a Store
+// for the keys. Commands stay registered after a Restart().
+func (m *Miniredis) RegisterCommand(name string, f CommandFunc) error {
+	m.Lock()
+	defer m.Unlock()
+	name = strings.ToUpper(name)
+	if m.srv != nil {
+		if err := m.srv.Register(name, m.customCommand(f)); err != nil {
+			return err
+		}
+	}
+	m.customCommands[name] = f
+	return nil
+}
+
+// customCommand wraps a CommandFunc.
+func (m *Miniredis) customCommand(f CommandFunc) server.Cmd {
+	return func(c *server.Peer, cmd string, args []string) {
+		if !m.handleAuth(c) {
+			return
+		}
+		if m.checkPubsub(c, cmd) {
+			return
+		}
+
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			f(c, &store{db: m.db(ctx.selectedDB)}, cmd, args)
+		})
+	}
+}
+
+// store implements Store. No locks!
+type store struct {
+	db *RedisDB
+}
+
+func (s *store) DB() int {
+	return s.db.id
+}
+
+func (s *store) Keys() []string {
+	return s.db.allKeys()
+}
+
+func (s *store) Exists(k string) bool {
+	return s.db.exists(k)
+}
+
+func (s *store) Type(k string) string {
+	return s.db.t(k)
+}
+
+func (s *store) Del(k string) bool {
+	if !s.db.exists(k) {
+		return false
+	}
+	s.db.del(k, true)
+	return true
+}
+
+func (s *store) TTL(k string) time.Duration {
+	ttl, _ := s.db.ttl.get(k)
+	return ttl
+}
+
+func (s *store) SetTTL(k string, ttl time.Duration) {
+	if !s.db.exists(k) {
+		return
+	}
+	s.db.ttl.set(k, ttl)
+	s.db.bump(k)
+	s.db.checkTTL(k)
+}
+
+func (s *store) Persist(k string) {
+	if _, ok := s.db.ttl.get(k); !ok {
+		return
+	}
+	s.db.ttl.del(k)
+	s.db.bump(k)
+}
+
+// check gives ErrKeyNotFound or ErrWrongType, if needed.
+func (s *store) check(k, t string) error {
+	if !s.db.exists(k) {
+		return ErrKeyNotFound
+	}
+	if s.db.t(k) != t {
+		return ErrWrongType
+	}
+	return nil
+}
+
+func (s *store) Get(k string) (string, error) {
+	if err := s.check(k, "string"); err != nil {
+		return "", err
+	}
+	return s.db.stringGet(k), nil
+}
+
+func (s *store) Set(k, v string) error {
+	if s.db.wrongType(k, "string") {
+		return ErrWrongType
+	}
+	s.db.del(k, true)
+	s.db.stringSet(k, v)
+	return nil
+}
+
+func (s *store) HGet(k, f string) (string, error) {
+	if err := s.check(k, "hash"); err != nil {
+		return "", err
+	}
+	v, ok := s.db.hashKeys[k][f]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (s *store) HSet(k string, fv ...string) error {
+	if s.db.wrongType(k, "hash") {
+		return ErrWrongType
+	}
+	s.db.hashSet(k, fv...)
+	return nil
+}
+
+func (s *store) HKeys(k string) ([]string, error) {
+	if err := s.check(k, "hash"); err != nil {
+		return nil, err
+	}
+	return s.db.hashFields(k), nil
+}
+
+func (s *store) List(k string) ([]string, error) {
+	if err := s.check(k, "list"); err != nil {
+		return nil, err
+	}
+	return append([]string(nil), s.db.listKeys[k]...), nil
+}
+
+func (s *store) Push(k string, v ...string) (int, error) {
+	if s.db.wrongType(k, "list") {
+		return 0, ErrWrongType
+	}
+	return s.db.listPush(k, v...), nil
+}
+
+func (s *store) Members(k string) ([]string, error) {
+	if err := s.check(k, "set"); err != nil {
+		return nil, err
+	}
+	return s.db.setMembers(k), nil
+}
+
+func (s *store) SAdd(k string, elems ...string) (int, error) {
+	if s.db.wrongType(k, "set") {
+		return 0, ErrWrongType
+	}
+	return s.db.setAdd(k, elems...), nil
+}
+
+func (s *store) ZAdd(k string, score float64, member string) (bool, error) {
+	if s.db.wrongType(k, "zset") {
+		return false, ErrWrongType
+	}
+	return s.db.ssetAdd(k, score, member), nil
+}
+
+func (s *store) ZMembers(k string) ([]string, error) {
+	if err := s.check(k, "zset"); err != nil {
+		return nil, err
+	}
+	return s.db.ssetMembers(k), nil
+}
+
+func (s *store) ZScore(k, member string) (float64, error) {
+	if err := s.check(k, "zset"); err != nil {
+		return 0, err
+	}
+	if !s.db.ssetExists(k, member) {
+		return 0, ErrKeyNotFound
+	}
+	return s.db.ssetScore(k, member), nil
+}
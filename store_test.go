@@ -0,0 +1,166 @@
+package miniredis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestRegisterCommand(t *testing.T) {
+	s := RunT(t)
+	// APPENDALL key value [key ...]: appends value to string keys, creates them
+	// if needed, and returns number of changed keys.
+	ok(t, s.RegisterCommand("appendall", func(c *server.Peer, store Store, cmd string, args []string) {
+		if len(args) < 2 {
+			c.WriteError(errWrongNumber(cmd))
+			return
+		}
+		v := args[1]
+		keys := append([]string{args[0]}, args[2:]...)
+		for _, k := range keys {
+			old, err := store.Get(k)
+			if err != nil && err != ErrKeyNotFound {
+				c.WriteError(err.Error())
+				return
+			}
+			store.Set(k, old+v)
+		}
+		c.WriteInt(len(keys))
+	}))
+	ok(t, s.RegisterCommand("STOREINFO", func(c *server.Peer, store Store, cmd string, args []string) {
+		c.WriteStrings([]string{
+			strings.Join(store.Keys(), ","),
+			store.Type("h"),
+			store.TTL("h").String(),
+		})
+	}))
+	assert(t, s.RegisterCommand("GET", nil) != nil, "duplicate")
+
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustOK(t, c, "SET", "a", "x")
+	mustDo(t, c, "APPENDALL", "a", "y", "b", proto.Int(2))
+	s.CheckGet(t, "a", "xy")
+	s.CheckGet(t, "b", "y")
+	mustDo(t, c, "APPENDALL", "a", proto.Error(errWrongNumber("appendall")))
+
+	s.HSet("h", "f", "v")
+	s.SetTTL("h", time.Minute)
+	mustDo(t, c, "STOREINFO", proto.Strings("a,b,h", "hash", "1m0s"))
+	mustDo(t, c, "APPENDALL", "h", "z", proto.Error(msgWrongType))
+
+	t.Run("select", func(t *testing.T) {
+		mustOK(t, c, "SELECT", "3")
+		defer mustOK(t, c, "SELECT", "0")
+		mustDo(t, c, "APPENDALL", "a", "3", proto.Int(1))
+		v, err := s.DB(3).Get("a")
+		ok(t, err)
+		equals(t, "3", v)
+		s.CheckGet(t, "a", "xy")
+	})
+
+	t.Run("multi and watch", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "WATCH", "b")
+		mustDo(t, c2, "APPENDALL", "b", "!", proto.Int(1))
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "APPENDALL", "b", "?", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.NilList)
+		s.CheckGet(t, "b", "y!")
+
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "APPENDALL", "b", "?", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Int(1)))
+		s.CheckGet(t, "b", "y!?")
+	})
+
+	t.Run("lua", func(t *testing.T) {
+		mustDo(t, c, "EVAL", "return redis.call('APPENDALL', KEYS[1], 'l')", "1", "lua", proto.Int(1))
+		s.CheckGet(t, "lua", "l")
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		s.RequireAuth("pw")
+		defer s.RequireAuth("")
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustDo(t, c, "APPENDALL", "a", "b", proto.Error(msgNoAuth))
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		s.Close()
+		ok(t, s.Restart())
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustDo(t, c, "APPENDALL", "new", "1", proto.Int(1))
+	})
+}
+
+func TestStore(t *testing.T) {
+	m := NewMiniRedis()
+	m.Lock()
+	defer m.Unlock()
+	var st Store = &store{db: m.db(2)}
+
+	equals(t, 2, st.DB())
+	_, err := st.Get("nosuch")
+	equals(t, ErrKeyNotFound, err)
+	ok(t, st.Set("str", "v"))
+	ok(t, st.HSet("hash", "f", "v"))
+	_, err = st.HGet("hash", "nosuch")
+	equals(t, ErrKeyNotFound, err)
+	v, err := st.HGet("hash", "f")
+	ok(t, err)
+	equals(t, "v", v)
+	_, err = st.HKeys("str")
+	equals(t, ErrWrongType, err)
+
+	n, err := st.Push("list", "a", "b")
+	ok(t, err)
+	equals(t, 2, n)
+	l, err := st.List("list")
+	ok(t, err)
+	equals(t, []string{"a", "b"}, l)
+
+	n, err = st.SAdd("set", "a", "b", "a")
+	ok(t, err)
+	equals(t, 2, n)
+	members, err := st.Members("set")
+	ok(t, err)
+	equals(t, []string{"a", "b"}, members)
+
+	added, err := st.ZAdd("zset", 2, "two")
+	ok(t, err)
+	equals(t, true, added)
+	_, err = st.ZScore("zset", "nosuch")
+	equals(t, ErrKeyNotFound, err)
+	score, err := st.ZScore("zset", "two")
+	ok(t, err)
+	equals(t, 2.0, score)
+	_, err = st.ZAdd("str", 1, "one")
+	equals(t, ErrWrongType, err)
+
+	st.SetTTL("str", time.Second)
+	equals(t, time.Second, st.TTL("str"))
+	st.Persist("str")
+	equals(t, time.Duration(0), st.TTL("str"))
+	st.SetTTL("str", -time.Second)
+	equals(t, false, st.Exists("str"))
+	st.SetTTL("nosuch", time.Second)
+	equals(t, time.Duration(0), st.TTL("nosuch"))
+
+	equals(t, []string{"hash", "list", "set", "zset"}, st.Keys())
+	equals(t, true, st.Del("set"))
+	equals(t, false, st.Del("set"))
+	equals(t, "", st.Type("set"))
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,6 +19,9 @@ type streamKey struct {
 	entries         []StreamEntry
 	groups          map[string]*streamGroup
 	lastAllocatedID string
+	lastAddedID     string // see XINFO STREAM
+	maxDeletedID    string // see XINFO STREAM
+	entriesAdded    int    // see XINFO STREAM
 	mu              sync.Mutex
 }
 
@@ -96,7 +100,11 @@ func (s *streamKey) copy() *streamKey {
 	defer s.mu.Unlock()
 
 	cpy := &streamKey{
-		entries: s.entries,
+		entries:         append([]StreamEntry(nil), s.entries...),
+		lastAllocatedID: s.lastAllocatedID,
+		lastAddedID:     s.lastAddedID,
+		maxDeletedID:    s.maxDeletedID,
+		entriesAdded:    s.entriesAdded,
 	}
 	groups := map[string]*streamGroup{}
 	for k, v := range s.groups {
@@ -108,6 +116,42 @@ func (s *streamKey) copy() *streamKey {
 	return cpy
 }
 
+// equal is true if both streams have the same entries and groups.
+func (s *streamKey) equal(o *streamKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if s.lastAllocatedID != o.lastAllocatedID ||
+		s.lastAddedID != o.lastAddedID ||
+		s.maxDeletedID != o.maxDeletedID ||
+		s.entriesAdded != o.entriesAdded ||
+		!sameSlices(s.entries, o.entries) ||
+		len(s.groups) != len(o.groups) {
+		return false
+	}
+	for name, g := range s.groups {
+		og, ok := o.groups[name]
+		if !ok ||
+			g.lastID != og.lastID ||
+			!sameSlices(g.pending, og.pending) ||
+			!reflect.DeepEqual(g.consumers, og.consumers) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSlices is reflect.DeepEqual(), but nil and empty slices are the same.
+func sameSlices(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
 func parseStreamID(id string) ([2]uint64, error) {
 	var (
 		res [2]uint64
@@ -253,16 +297,43 @@ func (s *streamKey) add(entryID string, values []string, now time.Time) (string,
 		ID:     entryID,
 		Values: values,
 	})
+	s.lastAddedID = entryID
+	s.entriesAdded++
 	return entryID, nil
 }
 
-func (s *streamKey) trim(n int) {
+// trim keeps the last n entries, but deletes no more than limit entries.
+// limit 0 means no limit. Returns the number of deleted entries.
+func (s *streamKey) trim(n, limit int) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(s.entries) > n {
-		s.entries = s.entries[len(s.entries)-n:]
+	if len(s.entries) <= n {
+		return 0
+	}
+	return s.trimFirst(len(s.entries)-n, limit)
+}
+
+// trimBefore deletes all entries with an ID lower than id, but no more than
+// limit entries. limit 0 means no limit. Returns the number of deleted
+// entries.
+func (s *streamKey) trimBefore(id string, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := sort.Search(len(s.entries), func(i int) bool {
+		return streamCmp(id, s.entries[i].ID) <= 0
+	})
+	return s.trimFirst(n, limit)
+}
+
+// trimFirst deletes the first n entries. Doesn't lock the mutex.
+func (s *streamKey) trimFirst(n, limit int) int {
+	if limit > 0 && n > limit {
+		n = limit
 	}
+	s.entries = s.entries[n:]
+	return n
 }
 
 // all entries after "id"
@@ -415,12 +486,65 @@ func (s *streamKey) delete(ids []string) (int, error) {
 			continue
 		}
 
+		if s.maxDeletedID == "" || streamCmp(s.maxDeletedID, entry.ID) < 0 {
+			s.maxDeletedID = entry.ID
+		}
 		s.entries = append(s.entries[:i], s.entries[i+1:]...)
 		count++
 	}
 	return count, nil
 }
 
+// deleteWithPolicy deletes an existing entry, for XDELEX and XACKDEL. Returns
+// 1 if it got deleted, or 2 if it's still referenced with the "ACKED" policy.
+func (s *streamKey) deleteWithPolicy(id, policy string) int {
+	switch policy {
+	case "ACKED":
+		if s.referenced(id) {
+			return 2
+		}
+	case "DELREF":
+		s.deleteRefs(id)
+	}
+	s.delete([]string{id})
+	return 1
+}
+
+// referenced is true if any group still needs the entry: it's either pending
+// or not delivered yet.
+func (s *streamKey) referenced(id string) bool {
+	for _, g := range s.groups {
+		if streamCmp(g.lastID, id) < 0 {
+			return true
+		}
+		if _, e := g.searchPending(id); e != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteRefs removes an entry from the pending lists of all groups.
+func (s *streamKey) deleteRefs(id string) {
+	for _, g := range s.groups {
+		g.dropPending(id)
+	}
+}
+
+// dropPending removes an entry from the pending list. Returns whether it was
+// pending.
+func (g *streamGroup) dropPending(id string) bool {
+	pos, entry := g.searchPending(id)
+	if entry == nil {
+		return false
+	}
+	if c, ok := g.consumers[entry.consumer]; ok {
+		c.numPendingEntries--
+	}
+	g.pending = append(g.pending[:pos], g.pending[pos+1:]...)
+	return true
+}
+
 func (g *streamGroup) pendingAfter(id string) []pendingEntry {
 	pos := sort.Search(len(g.pending), func(i int) bool {
 		return streamCmp(id, g.pending[i].id) < 0
@@ -461,7 +585,7 @@ func (g *streamGroup) copy() *streamGroup {
 	return &streamGroup{
 		// don't copy stream
 		lastID:    g.lastID,
-		pending:   g.pending,
+		pending:   append([]pendingEntry(nil), g.pending...),
 		consumers: cns,
 	}
 }
@@ -0,0 +1,105 @@
+package miniredis
+
+// What XINFO STREAM reports. See Miniredis.SetStreamInfo().
+
+// the Redis 7 defaults for the nodes of a stream.
+const (
+	streamNodeMaxEntries = 100  // stream-node-max-entries
+	streamNodeMaxBytes   = 4096 // stream-node-max-bytes
+)
+
+// StreamInfo is what XINFO STREAM reports about a stream.
+//
+// Miniredis doesn't store streams in a radix tree of listpacks, but the
+// RadixTree* fields are what Redis would have with its default configs, so
+// they grow as Redis' would. They are stable: the same entries always give
+// the same numbers.
+type StreamInfo struct {
+	Length               int
+	RadixTreeKeys        int // the number of listpack nodes
+	RadixTreeNodes       int
+	LastGeneratedID      string
+	MaxDeletedEntryID    string
+	EntriesAdded         int
+	RecordedFirstEntryID string
+	Groups               int
+	FirstEntry           *StreamEntry // nil for an empty stream
+	LastEntry            *StreamEntry // nil for an empty stream
+}
+
+// StreamInfoFunc can change what XINFO STREAM reports, see SetStreamInfo().
+type StreamInfoFunc func(db int, key string, info *StreamInfo)
+
+// SetStreamInfo makes XINFO STREAM call f with what it's about to report, so
+// a test can change it, for example to see what a monitoring tool does with a
+// stream with a huge radix tree:
+//
+//	m.SetStreamInfo(func(db int, key string, info *miniredis.StreamInfo) {
+//		if key == "events" {
+//			info.RadixTreeKeys = 100000
+//		}
+//	})
+//
+// f is called with the lock held, so it must not call any methods on the
+// Miniredis. Use nil to remove it.
+func (m *Miniredis) SetStreamInfo(f StreamInfoFunc) {
+	m.Lock()
+	defer m.Unlock()
+	m.streamInfo = f
+}
+
+// info gives the XINFO STREAM values.
+func (s *streamKey) info() StreamInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, nodes := s.radixTree()
+	info := StreamInfo{
+		Length:               len(s.entries),
+		RadixTreeKeys:        keys,
+		RadixTreeNodes:       nodes,
+		LastGeneratedID:      s.lastAddedID,
+		MaxDeletedEntryID:    s.maxDeletedID,
+		EntriesAdded:         s.entriesAdded,
+		RecordedFirstEntryID: "0-0",
+		Groups:               len(s.groups),
+	}
+	if info.LastGeneratedID == "" {
+		info.LastGeneratedID = s.lastIDUnlocked()
+	}
+	if info.MaxDeletedEntryID == "" {
+		info.MaxDeletedEntryID = "0-0"
+	}
+	if n := len(s.entries); n > 0 {
+		first, last := s.entries[0], s.entries[n-1]
+		info.FirstEntry, info.LastEntry = &first, &last
+		info.RecordedFirstEntryID = first.ID
+	}
+	return info
+}
+
+// radixTree gives the number of keys (listpack nodes) and nodes of the radix
+// tree Redis would use for these entries. A listpack is full after
+// streamNodeMaxEntries entries, or streamNodeMaxBytes bytes. Doesn't lock the
+// mutex.
+func (s *streamKey) radixTree() (int, int) {
+	keys, n, size := 0, 0, 0
+	for _, e := range s.entries {
+		// roughly what an entry takes in a listpack: the values with their
+		// lengths, and the delta ID and flags.
+		es := 4
+		for _, v := range e.Values {
+			es += len(v) + 1
+		}
+		if n == 0 || n == streamNodeMaxEntries || size+es > streamNodeMaxBytes {
+			keys++
+			n, size = 0, 0
+		}
+		n++
+		size += es
+	}
+	if keys == 0 {
+		return 0, 1
+	}
+	return keys, keys + 1
+}
@@ -0,0 +1,234 @@
+package miniredis
+
+// Key namespaces in a shared miniredis. See Miniredis.Tenant().
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tenant is a namespace in a miniredis, so tests can share a single server
+// without seeing each other's keys. See Miniredis.Tenant().
+type Tenant struct {
+	m      *Miniredis
+	prefix string
+}
+
+// Tenant returns a namespace where every key gets the given prefix. Starting
+// a miniredis per test is cheap, but for very large test suites a single
+// process wide miniredis, with a Tenant per test, can be cheaper still.
+//
+// Connections use the tenant by authenticating with the tenant's Username()
+// and Password(), via AUTH or HELLO. After that the keys in all commands get the
+// prefix, and KEYS, SCAN, RANDOMKEY, DBSIZE, FLUSHDB, and FLUSHALL only see
+// the keys of the tenant. Keys in replies of KEYS, SCAN, RANDOMKEY, BLPOP, BRPOP,
+// XREAD, and XREADGROUP have the prefix removed again.
+// Keys in Lua scripts only get the prefix when they are passed as KEYS, and
+// pubsub channels are not namespaced.
+//
+// The methods on Tenant are the prefixed versions of the methods on Miniredis.
+//
+// A prefix can't be the start of the prefix of another tenant, since one
+// tenant would see the keys of the other. Tenant panics for "t1" when there
+// is a "t10" tenant, so use prefixes which end with a separator, such as
+// "t1:" and "t10:".
+func (m *Miniredis) Tenant(prefix string) *Tenant {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.tenants[prefix]; !ok {
+		for p := range m.tenants {
+			if strings.HasPrefix(p, prefix) || strings.HasPrefix(prefix, p) {
+				panic(fmt.Sprintf("tenant prefix %q overlaps with %q", prefix, p))
+			}
+		}
+		m.tenants[prefix] = tenantPassword()
+	}
+	return &Tenant{m: m, prefix: prefix}
+}
+
+// tenantPassword makes a random password for a new tenant.
+func tenantPassword() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "tenant-" + hex.EncodeToString(b)
+}
+
+// Prefix is the prefix of all keys of the tenant.
+func (t *Tenant) Prefix() string {
+	return t.prefix
+}
+
+// Addr returns the address of the shared miniredis.
+func (t *Tenant) Addr() string {
+	return t.m.Addr()
+}
+
+// Username to use in AUTH or HELLO, it is the prefix.
+func (t *Tenant) Username() string {
+	return t.prefix
+}
+
+// Password to use in AUTH or HELLO. Every tenant has its own random
+// password. A user with a password set, such as with RequireUserAuth(), wins
+// over a tenant with the same name.
+func (t *Tenant) Password() string {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.m.tenants[t.prefix]
+}
+
+// Key gives the key as it is stored in miniredis.
+func (t *Tenant) Key(k string) string {
+	return t.prefix + k
+}
+
+// Keys returns all keys of the tenant in the selected DB, without the prefix,
+// sorted.
+func (t *Tenant) Keys() []string {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.m.db(t.m.selectedDB).tenantKeys(t.prefix)
+}
+
+// FlushAll removes all keys of the tenant, in all DBs.
+func (t *Tenant) FlushAll() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	defer t.m.signal.Broadcast()
+	t.m.flushTenant(t.prefix)
+}
+
+// Get returns string keys added with SET.
+func (t *Tenant) Get(k string) (string, error) {
+	return t.m.Get(t.Key(k))
+}
+
+// Set sets a string key. Removes expire.
+func (t *Tenant) Set(k, v string) error {
+	return t.m.Set(t.Key(k), v)
+}
+
+// Del deletes a key and any expiration value. Returns whether there was a key.
+func (t *Tenant) Del(k string) bool {
+	return t.m.Del(t.Key(k))
+}
+
+// Exists tells whether a key exists.
+func (t *Tenant) Exists(k string) bool {
+	return t.m.Exists(t.Key(k))
+}
+
+// Type gives the type of a key, or "".
+func (t *Tenant) Type(k string) string {
+	return t.m.Type(t.Key(k))
+}
+
+// TTL is the left over time to live.
+func (t *Tenant) TTL(k string) time.Duration {
+	return t.m.TTL(t.Key(k))
+}
+
+// SetTTL sets the TTL of a key.
+func (t *Tenant) SetTTL(k string, ttl time.Duration) {
+	t.m.SetTTL(t.Key(k), ttl)
+}
+
+// HGet returns hash keys added with HSET.
+func (t *Tenant) HGet(k, f string) string {
+	return t.m.HGet(t.Key(k), f)
+}
+
+// HSet sets hash keys.
+func (t *Tenant) HSet(k string, fv ...string) {
+	t.m.HSet(t.Key(k), fv...)
+}
+
+// List returns the list k, or an error if it's not there or something else.
+func (t *Tenant) List(k string) ([]string, error) {
+	return t.m.List(t.Key(k))
+}
+
+// Push add element at the end. Returns the new length.
+func (t *Tenant) Push(k string, v ...string) (int, error) {
+	return t.m.Push(t.Key(k), v...)
+}
+
+// SAdd adds keys to a set. Returns the number of new keys.
+func (t *Tenant) SAdd(k string, elems ...string) (int, error) {
+	return t.m.SAdd(t.Key(k), elems...)
+}
+
+// Members returns all keys in a set, sorted.
+func (t *Tenant) Members(k string) ([]string, error) {
+	return t.m.Members(t.Key(k))
+}
+
+// ZAdd adds a score,member to a sorted set.
+func (t *Tenant) ZAdd(k string, score float64, member string) (bool, error) {
+	return t.m.ZAdd(t.Key(k), score, member)
+}
+
+// ZScore gives the score of a sorted set member.
+func (t *Tenant) ZScore(k, member string) (float64, error) {
+	return t.m.ZScore(t.Key(k), member)
+}
+
+// tenantKeys returns the keys with the prefix, without the prefix. Sorted.
+// With an empty prefix that's all keys. No locks!
+func (db *RedisDB) tenantKeys(prefix string) []string {
+	if prefix == "" {
+		return db.allKeys()
+	}
+	var res []string
+	for k := range db.keys {
+		if strings.HasPrefix(k, prefix) {
+			res = append(res, k[len(prefix):])
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// flushTenant removes all keys with the prefix, in all DBs. No locks!
+func (m *Miniredis) flushTenant(prefix string) {
+	for _, id := range m.dbIDs() {
+		m.dbs[id].flushTenant(prefix)
+	}
+}
+
+// flushTenant removes all keys with the prefix, and calls the OnFlush()
+// callback. No locks!
+func (db *RedisDB) flushTenant(prefix string) {
+	var removed map[string]string
+	if db.master.onFlush != nil {
+		removed = map[string]string{}
+		for _, k := range db.tenantKeys(prefix) {
+			if !db.expired(prefix + k) {
+				removed[k] = db.t(prefix + k)
+			}
+		}
+	}
+
+	if prefix == "" {
+		db.flush()
+	} else {
+		for _, k := range db.tenantKeys(prefix) {
+			db.del(prefix+k, true)
+		}
+	}
+
+	if removed != nil {
+		db.master.onFlush(db.id, removed)
+	}
+}
+
+// tenantKey removes the tenant prefix from a key, for replies.
+func (ctx *connCtx) tenantKey(k string) string {
+	return strings.TrimPrefix(k, ctx.tenant)
+}
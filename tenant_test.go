@@ -0,0 +1,139 @@
+package miniredis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestTenant(t *testing.T) {
+	s := RunT(t)
+	t1 := s.Tenant("t1:")
+	t2 := s.Tenant("t2:")
+	equals(t, "t1:foo", t1.Key("foo"))
+	equals(t, s.Addr(), t1.Addr())
+
+	dial := func(t *testing.T, tn *Tenant) *proto.Client {
+		t.Helper()
+		c, err := proto.Dial(tn.Addr())
+		ok(t, err)
+		t.Cleanup(func() { c.Close() })
+		mustOK(t, c, "AUTH", tn.Username(), tn.Password())
+		return c
+	}
+	c1 := dial(t, t1)
+	c2 := dial(t, t2)
+	c, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustOK(t, c1, "SET", "foo", "one")
+	mustOK(t, c2, "SET", "foo", "two")
+	mustOK(t, c2, "MSET", "bar", "2", "baz", "3")
+	mustOK(t, c, "SET", "foo", "plain")
+
+	mustDo(t, c1, "GET", "foo", proto.String("one"))
+	mustDo(t, c2, "GET", "foo", proto.String("two"))
+	mustDo(t, c, "GET", "foo", proto.String("plain"))
+	mustDo(t, c, "GET", "t1:foo", proto.String("one"))
+	mustDo(t, c2, "MGET", "foo", "bar", "nosuch", proto.Array(proto.String("two"), proto.String("2"), proto.Nil))
+
+	s.CheckGet(t, "t1:foo", "one")
+	v, err := t2.Get("bar")
+	ok(t, err)
+	equals(t, "2", v)
+	equals(t, []string{"bar", "baz", "foo"}, t2.Keys())
+
+	t.Run("keys", func(t *testing.T) {
+		mustDo(t, c1, "KEYS", "*", proto.Strings("foo"))
+		mustDo(t, c2, "KEYS", "ba*", proto.Strings("bar", "baz"))
+		mustDo(t, c2, "SCAN", "0", proto.Array(proto.String("0"), proto.Strings("bar", "baz", "foo")))
+		mustDo(t, c2, "SCAN", "0", "TYPE", "string", "MATCH", "f*", proto.Array(proto.String("0"), proto.Strings("foo")))
+		mustDo(t, c1, "RANDOMKEY", proto.String("foo"))
+		mustDo(t, c1, "DBSIZE", proto.Int(1))
+		mustDo(t, c2, "DBSIZE", proto.Int(3))
+		mustDo(t, c, "DBSIZE", proto.Int(5))
+		mustDo(t, c1, "EXISTS", "foo", "bar", proto.Int(1))
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		t1.Push("list", "a")
+		mustDo(t, c1, "BLPOP", "list", "1", proto.Strings("list", "a"))
+
+		mustDo(t, c2, "XADD", "stream", "1-1", "k", "v", proto.String("1-1"))
+		mustDo(t, c2, "XREAD", "STREAMS", "stream", "0",
+			proto.Array(
+				proto.Array(proto.String("stream"),
+					proto.Array(proto.Array(proto.String("1-1"), proto.Strings("k", "v")))),
+			),
+		)
+		equals(t, true, s.Exists("t2:stream"))
+	})
+
+	t.Run("eval", func(t *testing.T) {
+		mustDo(t, c1, "EVAL", "return redis.call('GET', KEYS[1])", "1", "foo", proto.String("one"))
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		mustOK(t, c1, "MULTI")
+		mustDo(t, c1, "SET", "multi", "1", proto.Inline("QUEUED"))
+		mustDo(t, c1, "EXEC", proto.Array(proto.Inline("OK")))
+		equals(t, true, t1.Exists("multi"))
+		equals(t, false, s.Exists("multi"))
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		mustOK(t, c1, "FLUSHDB")
+		equals(t, []string(nil), t1.Keys())
+		equals(t, []string{"bar", "baz", "foo", "stream"}, t2.Keys())
+		equals(t, true, s.Exists("foo"))
+
+		t2.FlushAll()
+		equals(t, []string{"foo"}, s.Keys())
+	})
+
+	t.Run("reauth", func(t *testing.T) {
+		s.RequireUserAuth("user", "pw")
+		defer s.RequireUserAuth("user", "")
+		c := dial(t, t1)
+		mustOK(t, c, "SET", "k", "v")
+		mustOK(t, c, "AUTH", "user", "pw")
+		mustDo(t, c, "GET", "k", proto.Nil)
+		mustDo(t, c, "GET", "t1:k", proto.String("v"))
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		for _, prefix := range []string{"t", "t1", "t1:x", ""} {
+			func() {
+				defer func() {
+					assert(t, recover() != nil, "no panic for "+prefix)
+				}()
+				s.Tenant(prefix)
+			}()
+		}
+		s.Tenant("t10:")
+	})
+
+	t.Run("passwords", func(t *testing.T) {
+		assert(t, t1.Password() != t2.Password(), "same passwords")
+		equals(t, t1.Password(), s.Tenant("t1:").Password())
+
+		s.RequireAuth("secret")
+		defer s.RequireAuth("")
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+		mustDo(t, c, "AUTH", t1.Username(), "wrong", proto.Error(msgWrongPass))
+		mustDo(t, c, "AUTH", t1.Username(), t2.Password(), proto.Error(msgWrongPass))
+		mustDo(t, c, "GET", "foo", proto.Error("NOAUTH Authentication required."))
+		mustOK(t, c, "AUTH", t1.Username(), t1.Password())
+		mustDo(t, c, "GET", "k", proto.String("v"))
+
+		// a user with the same name wins
+		s.RequireUserAuth("t1:", "userpw")
+		defer s.RequireUserAuth("t1:", "")
+		mustDo(t, c, "AUTH", t1.Username(), t1.Password(), proto.Error(msgWrongPass))
+		mustOK(t, c, "AUTH", "t1:", "userpw")
+		mustDo(t, c, "GET", "foo", proto.String("plain"))
+	})
+}
@@ -0,0 +1,74 @@
+package miniredis
+
+// Tracing of every command. See Miniredis.SetTracer().
+
+import (
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Span describes a single command, as given to a Tracer.
+type Span struct {
+	ClientID int
+	Name     string   // the command, in upper case
+	Args     []string // the arguments, without the command
+	Key      string   // the first key of the command, if any
+	DB       int      // the selected DB after the command
+	Start    time.Time
+	Duration time.Duration // including the time to write the reply
+	Error    string        // the first error in the reply, if any
+}
+
+// Tracer gets a Span for every command, see SetTracer().
+type Tracer func(Span)
+
+// SetTracer makes miniredis call t after every command it served over the
+// network. t is called from the goroutine of the connection, without any
+// locks, so it can use the Miniredis. Use nil to disable it.
+//
+// Span has all the fields to make an OpenTelemetry span, with the explicit
+// start and end timestamps, as:
+//
+//	_, sp := tracer.Start(ctx, s.Name, trace.WithTimestamp(s.Start))
+//	sp.End(trace.WithTimestamp(s.Start.Add(s.Duration)))
+func (m *Miniredis) SetTracer(t Tracer) {
+	m.Lock()
+	defer m.Unlock()
+	m.tracer = t
+	if m.srv != nil {
+		m.srv.SetTraceHook(m.traceHook)
+	}
+}
+
+func (m *Miniredis) traceHook(c *server.Peer, args []string, start time.Time, d time.Duration, errReply string) {
+	m.Lock()
+	t, cp := m.tracer, m.capture
+	m.Unlock()
+	if (t == nil && cp == nil) || len(args) == 0 {
+		return
+	}
+
+	cmd := strings.ToUpper(args[0])
+	s := Span{
+		ClientID: c.ID(),
+		Name:     cmd,
+		Args:     append([]string(nil), args[1:]...),
+		Start:    start,
+		Duration: d,
+		Error:    errReply,
+	}
+	if ctx, ok := c.Ctx.(*connCtx); ok {
+		s.DB = ctx.selectedDB
+	}
+	if keys := commandKeys(cmd, s.Args); len(keys) > 0 {
+		s.Key = keys[0]
+	}
+	if t != nil {
+		t(s)
+	}
+	if cp != nil {
+		cp.write(c.RemoteAddr(), s)
+	}
+}
@@ -0,0 +1,276 @@
+package miniredis
+
+// Client side caching: CLIENT TRACKING and friends.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// tracking is the CLIENT TRACKING state of a connection.
+type tracking struct {
+	redirect int      // client ID, 0 if there is none
+	broken   bool     // the redirect client is gone, and we said so
+	bcast    bool     // BCAST mode
+	prefixes []string // BCAST prefixes, sorted. "" is all keys.
+	optin    bool
+	optout   bool
+	noloop   bool
+	caching  string // "yes" or "no" after a CLIENT CACHING, for the next command
+}
+
+// invalidation is a changed key, and the connection which changed it.
+type invalidation struct {
+	key    string
+	writer *server.Peer // nil for Go methods
+}
+
+// startTracking turns CLIENT TRACKING on, or changes its options. No locks!
+func (m *Miniredis) startTracking(c *server.Peer, t *tracking) {
+	old, ok := m.trackers[c]
+	if !ok {
+		if m.trackers == nil {
+			m.trackers = map[*server.Peer]*tracking{}
+		}
+		c.OnDisconnect(func() {
+			m.Lock()
+			m.stopTracking(c)
+			m.Unlock()
+		})
+		if t.bcast && len(t.prefixes) == 0 {
+			t.prefixes = []string{""}
+		}
+		sort.Strings(t.prefixes)
+		m.trackers[c] = t
+		return
+	}
+	// ON again adds the prefixes, and the options
+	old.redirect = t.redirect
+	old.broken = false
+	old.optin = old.optin || t.optin
+	old.optout = old.optout || t.optout
+	old.noloop = old.noloop || t.noloop
+	old.prefixes = append(old.prefixes, t.prefixes...)
+	sort.Strings(old.prefixes)
+}
+
+// stopTracking turns CLIENT TRACKING off. No locks!
+func (m *Miniredis) stopTracking(c *server.Peer) {
+	delete(m.trackers, c)
+	for k, peers := range m.trackedKeys {
+		delete(peers, c)
+		if len(peers) == 0 {
+			delete(m.trackedKeys, k)
+		}
+	}
+}
+
+// prefixOverlap checks the new BCAST prefixes against the existing ones, and
+// against each other, and gives the error, if any.
+func prefixOverlap(existing, prefixes []string) string {
+	overlap := func(a, b string) bool {
+		return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+	}
+	for i, p := range prefixes {
+		for _, e := range existing {
+			if overlap(p, e) {
+				return "ERR Prefix '" + p + "' overlaps with an existing prefix '" + e + "'. Prefixes for a single client must not overlap."
+			}
+		}
+		for _, o := range prefixes[i+1:] {
+			if overlap(p, o) {
+				return "ERR Prefix '" + p + "' overlaps with another provided prefix '" + o + "'. Prefixes for a single client must not overlap."
+			}
+		}
+	}
+	return ""
+}
+
+// track remembers the keys of a read command, for the tracking connection c.
+// A CLIENT CACHING only counts for the next command (or MULTI), so next ends
+// it. No locks!
+func (m *Miniredis) track(c *server.Peer, cmd string, keys []string, next bool) {
+	t, ok := m.trackers[c]
+	if !ok {
+		return
+	}
+	caching := t.caching
+	if next && !inTx(getCtx(c)) && strings.ToLower(cmd) != "client" {
+		t.caching = ""
+	}
+	if t.bcast || !commandSpecs()[strings.ToLower(cmd)].hasFlag("readonly") {
+		return
+	}
+	if t.optin && caching != "yes" || t.optout && caching == "no" {
+		return
+	}
+	if m.trackedKeys == nil {
+		m.trackedKeys = map[string]map[*server.Peer]bool{}
+	}
+	for _, k := range keys {
+		peers, ok := m.trackedKeys[k]
+		if !ok {
+			peers = map[*server.Peer]bool{}
+			m.trackedKeys[k] = peers
+		}
+		peers[c] = true
+	}
+}
+
+// invalidate queues a changed key for the tracking connections. Tracking
+// doesn't care about the DB, same as redis. No locks!
+func (m *Miniredis) invalidate(k string) {
+	if len(m.trackers) == 0 {
+		return
+	}
+	m.invalidated = append(m.invalidated, invalidation{key: k, writer: m.writer})
+}
+
+// invalidateFlush queues a flush for the tracking connections, which makes
+// them drop all their keys. The keys the flush removed don't need their own
+// messages. No locks!
+func (m *Miniredis) invalidateFlush() {
+	if len(m.trackers) == 0 {
+		return
+	}
+	m.invalidated = nil
+	m.invalidateAll = true
+}
+
+// flushInvalidations sends the invalidation messages of the keys changed since
+// the last Lock(). Without BCAST there is a message for every key a
+// connection read, after which the key isn't tracked anymore. With BCAST
+// there is a message with all changed keys of a prefix. NOLOOP connections
+// don't get the messages of their own changes. No locks!
+func (m *Miniredis) flushInvalidations() {
+	if m.invalidateAll {
+		for c := range m.trackers {
+			m.sendInvalidation(c, nil)
+		}
+		m.trackedKeys = nil
+	}
+
+	var (
+		seen  = map[invalidation]bool{}
+		bcast = map[*server.Peer]map[string][]string{}
+	)
+	for _, inv := range m.invalidated {
+		if seen[inv] {
+			continue
+		}
+		seen[inv] = true
+
+		for c := range m.trackedKeys[inv.key] {
+			if t := m.trackers[c]; !(t.noloop && c == inv.writer) {
+				m.sendInvalidation(c, []string{inv.key})
+			}
+		}
+		delete(m.trackedKeys, inv.key)
+
+		for c, t := range m.trackers {
+			if !t.bcast || t.noloop && c == inv.writer {
+				continue
+			}
+			for _, p := range t.prefixes {
+				if strings.HasPrefix(inv.key, p) {
+					if bcast[c] == nil {
+						bcast[c] = map[string][]string{}
+					}
+					bcast[c][p] = append(bcast[c][p], inv.key)
+				}
+			}
+		}
+	}
+	for c, keys := range bcast {
+		for _, p := range m.trackers[c].prefixes {
+			if k := keys[p]; len(k) > 0 {
+				m.sendInvalidation(c, dedup(k))
+			}
+		}
+	}
+	m.invalidated = nil
+	m.invalidateAll = false
+}
+
+// dedup removes repeated strings, and keeps the order.
+func dedup(ss []string) []string {
+	var (
+		seen = map[string]bool{}
+		res  []string
+	)
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// sendInvalidation writes an "invalidate" message for the keys, or for all
+// keys if keys is nil, to the tracking connection c, or to its REDIRECT
+// connection. A RESP3 connection gets a push message. A RESP2 connection can
+// only get it via a REDIRECT, as a message on the __redis__:invalidate
+// channel, if it's in pubsub mode. No locks!
+func (m *Miniredis) sendInvalidation(c *server.Peer, keys []string) {
+	t := m.trackers[c]
+	to := c
+	if t.redirect != 0 {
+		to = m.peer(t.redirect)
+		if to == nil {
+			if c.Resp3 && !t.broken {
+				t.broken = true
+				c.Block(func(w *server.Writer) {
+					w.WritePushLen(2)
+					w.WriteBulk("tracking-redir-broken")
+					w.WriteInt(t.redirect)
+					w.Flush()
+				})
+			}
+			return
+		}
+	}
+
+	writeKeys := func(w *server.Writer) {
+		if keys == nil {
+			w.WriteNull()
+			return
+		}
+		w.WriteLen(len(keys))
+		for _, k := range keys {
+			w.WriteBulk(k)
+		}
+	}
+	switch {
+	case to.Resp3:
+		to.Block(func(w *server.Writer) {
+			w.WritePushLen(2)
+			w.WriteBulk("invalidate")
+			writeKeys(w)
+			w.Flush()
+		})
+	case to != c && getCtx(to).subscriber != nil:
+		to.Block(func(w *server.Writer) {
+			w.WritePushLen(3)
+			w.WriteBulk("message")
+			w.WriteBulk("__redis__:invalidate")
+			writeKeys(w)
+			w.Flush()
+		})
+	}
+}
+
+// peer finds a connection by its client ID. No locks!
+func (m *Miniredis) peer(id int) *server.Peer {
+	if m.srv == nil {
+		return nil
+	}
+	for _, p := range m.srv.Peers() {
+		if p.ID() == id {
+			return p
+		}
+	}
+	return nil
+}
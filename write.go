@@ -0,0 +1,248 @@
+package miniredis
+
+// Change callbacks. See Miniredis.OnWrite().
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// WriteOp describes the change of a single key, see OnWrite().
+type WriteOp struct {
+	DB         int
+	Key        string
+	Type       string        // the type after the change, such as "string" or "hash". "" if the key is gone.
+	Fields     []string      // the hash fields, or the set or sorted set members, which were added, changed, or removed. Sorted.
+	TTL        time.Duration // the TTL after the change, 0 if there is none
+	TTLChanged bool          // the TTL was set, changed, or removed
+}
+
+// writeState is what OnWrite() knows of a key, to see if the TTL changed. Only
+// keys with a TTL have one.
+type writeState struct {
+	deadline time.Duration // on the clock of the expireSet
+	hasTTL   bool
+}
+
+// fieldWrites has the hash fields, or the set or sorted set members, of a key
+// which changed since the Lock(), with what they were before.
+type fieldWrites struct {
+	old      map[string]fieldValue
+	replaced bool // the whole key changed, so all current fields count too
+}
+
+type fieldValue struct {
+	value  string // the hash value, or the score. "" for set members.
+	exists bool
+}
+
+// OnWrite makes miniredis call f after every change to a key, by commands
+// and by Go methods, so a test can apply the same changes to a model of what
+// it expects redis to have, and compare. There is a WriteOp for every changed
+// key, with the fields, members, and TTL which changed.
+//
+// f is called after the change is done, without any locks, so it can use the
+// Miniredis; its own changes are reported too. All the changes of a single
+// command (or MULTI, or script) are reported after that command, in the order
+// the keys first changed. Different connections can call f at the same time.
+// Use nil to remove it.
+func (m *Miniredis) OnWrite(f func(op WriteOp)) {
+	m.Lock()
+	defer m.Unlock()
+	m.onWrite = f
+	m.written = nil
+	m.writeStates = nil
+	m.writeFields = nil
+	if f == nil {
+		return
+	}
+	m.writeStates = map[dbKey]writeState{}
+	for id, db := range m.dbs {
+		for k := range db.ttl.items {
+			if st := db.writeState(k); st.hasTTL {
+				m.writeStates[dbKey{db: id, key: k}] = st
+			}
+		}
+	}
+}
+
+// Unlock sends the queued keyspace events, pubsub messages, and tracking
+// invalidations, unlocks the Miniredis, and then calls the OnWrite() callback for every change since the
+// Lock(), if any.
+func (m *Miniredis) Unlock() {
+	if len(m.outbox) > 0 {
+		m.flushOutbox()
+	}
+	if len(m.invalidated) > 0 || m.invalidateAll {
+		m.flushInvalidations()
+	}
+	if d := time.Since(m.lockedAt); d > m.maxLockHold {
+		m.maxLockHold = d
+	}
+	if len(m.written) == 0 {
+		m.Mutex.Unlock()
+		return
+	}
+	f, ops := m.onWrite, m.writeOps()
+	m.Mutex.Unlock()
+	for _, op := range ops {
+		f(op)
+	}
+}
+
+// wrote remembers a changed key for OnWrite(). No locks!
+func (db *RedisDB) wrote(k string) {
+	if m := db.master; m.onWrite != nil {
+		m.written = append(m.written, dbKey{db: db.id, key: k})
+	}
+}
+
+// before remembers what fields of a hash, set, or sorted set were before the
+// first change since the Lock(), for OnWrite(). Call it before the fields
+// change. No locks!
+func (db *RedisDB) before(k string, fields ...string) {
+	m := db.master
+	if m.onWrite == nil {
+		return
+	}
+	fw := m.fieldWrites(db.id, k)
+	for _, f := range fields {
+		if _, ok := fw.old[f]; !ok {
+			fw.old[f] = db.fieldValue(k, f)
+		}
+	}
+}
+
+// beforeAll is before() for changes to a whole key, which replace or delete
+// it. No locks!
+func (db *RedisDB) beforeAll(k string) {
+	m := db.master
+	if m.onWrite == nil {
+		return
+	}
+	db.before(k, db.fieldNames(k)...)
+	m.fieldWrites(db.id, k).replaced = true
+}
+
+// No locks!
+func (m *Miniredis) fieldWrites(db int, k string) *fieldWrites {
+	dk := dbKey{db: db, key: k}
+	if m.writeFields == nil {
+		m.writeFields = map[dbKey]*fieldWrites{}
+	}
+	fw, ok := m.writeFields[dk]
+	if !ok {
+		fw = &fieldWrites{old: map[string]fieldValue{}}
+		m.writeFields[dk] = fw
+	}
+	return fw
+}
+
+// fieldValue gives a hash field, or a (sorted) set member, of a key. No locks!
+func (db *RedisDB) fieldValue(k, f string) fieldValue {
+	switch db.t(k) {
+	case "hash":
+		v, ok := db.hashKeys[k][f]
+		return fieldValue{value: v, exists: ok}
+	case "set":
+		_, ok := db.setKeys[k][f]
+		return fieldValue{exists: ok}
+	case "zset":
+		score, ok := db.sortedsetKeys[k][f]
+		if !ok {
+			return fieldValue{}
+		}
+		return fieldValue{value: strconv.FormatFloat(score, 'g', -1, 64), exists: true}
+	}
+	return fieldValue{}
+}
+
+// fieldNames gives all fields of a hash, or all members of a (sorted) set. No
+// locks!
+func (db *RedisDB) fieldNames(k string) []string {
+	var res []string
+	switch db.t(k) {
+	case "hash":
+		for f := range db.hashKeys[k] {
+			res = append(res, f)
+		}
+	case "set":
+		for e := range db.setKeys[k] {
+			res = append(res, e)
+		}
+	case "zset":
+		for e := range db.sortedsetKeys[k] {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// writeOps lists what changed in all changed keys, and clears the lists. No
+// locks!
+func (m *Miniredis) writeOps() []WriteOp {
+	var ops []WriteOp
+	seen := map[dbKey]bool{}
+	for _, dk := range m.written {
+		if seen[dk] {
+			continue
+		}
+		seen[dk] = true
+
+		db := m.db(dk.db)
+		old := m.writeStates[dk]
+		cur := db.writeState(dk.key)
+		if cur.hasTTL {
+			m.writeStates[dk] = cur
+		} else {
+			delete(m.writeStates, dk)
+		}
+		op := WriteOp{
+			DB:         dk.db,
+			Key:        dk.key,
+			Type:       db.t(dk.key),
+			Fields:     db.changedFields(dk.key, m.writeFields[dk]),
+			TTLChanged: old.hasTTL != cur.hasTTL || old.deadline != cur.deadline,
+		}
+		if cur.hasTTL {
+			op.TTL, _ = db.ttl.get(dk.key)
+		}
+		ops = append(ops, op)
+	}
+	m.written = nil
+	m.writeFields = nil
+	return ops
+}
+
+// writeState gets the current state of a key. No locks!
+func (db *RedisDB) writeState(k string) writeState {
+	var st writeState
+	if it, ok := db.ttl.items[k]; ok && db.exists(k) {
+		st.deadline, st.hasTTL = it.deadline, true
+	}
+	return st
+}
+
+// changedFields gives the fields of fw which are not what they were, sorted.
+// No locks!
+func (db *RedisDB) changedFields(k string, fw *fieldWrites) []string {
+	if fw == nil {
+		return nil
+	}
+	var res []string
+	for f, v := range fw.old {
+		if db.fieldValue(k, f) != v {
+			res = append(res, f)
+		}
+	}
+	if fw.replaced {
+		for _, f := range db.fieldNames(k) {
+			if _, ok := fw.old[f]; !ok {
+				res = append(res, f)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
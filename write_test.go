@@ -0,0 +1,140 @@
+package miniredis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestOnWrite(t *testing.T) {
+	m := RunT(t)
+	m.HSet("h", "a", "1", "b", "2")
+	var (
+		mu  sync.Mutex
+		ops []WriteOp
+	)
+	m.OnWrite(func(op WriteOp) {
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, op)
+	})
+	got := func() []WriteOp {
+		mu.Lock()
+		defer mu.Unlock()
+		res := ops
+		ops = nil
+		return res
+	}
+	c, err := proto.Dial(m.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	mustDo(t, c, "HSET", "h", "b", "3", "c", "4", proto.Int(1))
+	equals(t, []WriteOp{{Key: "h", Type: "hash", Fields: []string{"b", "c"}}}, got())
+
+	mustDo(t, c, "HSET", "h", "b", "3", proto.Int(0))
+	equals(t, []WriteOp{{Key: "h", Type: "hash"}}, got())
+
+	mustOK(t, c, "SET", "str", "v", "EX", "10")
+	equals(t, []WriteOp{{Key: "str", Type: "string", TTL: 10 * time.Second, TTLChanged: true}}, got())
+
+	mustDo(t, c, "PERSIST", "str", proto.Int(1))
+	equals(t, []WriteOp{{Key: "str", Type: "string", TTLChanged: true}}, got())
+
+	mustDo(t, c, "ZADD", "z", "1", "one", "2", "two", proto.Int(2))
+	mustDo(t, c, "ZINCRBY", "z", "1", "one", proto.String("2"))
+	equals(t, []WriteOp{
+		{Key: "z", Type: "zset", Fields: []string{"one", "two"}},
+		{Key: "z", Type: "zset", Fields: []string{"one"}},
+	}, got())
+
+	t.Run("reads", func(t *testing.T) {
+		mustDo(t, c, "HGET", "h", "a", proto.String("1"))
+		mustNil(t, c, "GET", "nosuch")
+		equals(t, []WriteOp(nil), got())
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SADD", "s", "a", "b", proto.Inline("QUEUED"))
+		mustDo(t, c, "DEL", "h", proto.Inline("QUEUED"))
+		mustDo(t, c, "SREM", "s", "a", proto.Inline("QUEUED"))
+		equals(t, []WriteOp(nil), got())
+		mustDo(t, c, "EXEC", proto.Array(proto.Int(2), proto.Int(1), proto.Int(1)))
+		equals(t, []WriteOp{
+			{Key: "s", Type: "set", Fields: []string{"b"}},
+			{Key: "h", Fields: []string{"a", "b", "c"}},
+		}, got())
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		m.HSet("h2", "a", "1", "b", "2", "c", "3")
+		m.SetAdd("s2", "x", "y")
+		got()
+
+		mustDo(t, c, "HDEL", "h2", "a", "nosuch", proto.Int(1))
+		equals(t, []WriteOp{{Key: "h2", Type: "hash", Fields: []string{"a"}}}, got())
+		must1(t, c, "HSETNX", "h2", "d", "4")
+		must0(t, c, "HSETNX", "h2", "b", "5")
+		equals(t, []WriteOp{{Key: "h2", Type: "hash", Fields: []string{"d"}}}, got())
+
+		must1(t, c, "SMOVE", "s2", "s3", "x")
+		equals(t, []WriteOp{
+			{Key: "s2", Type: "set", Fields: []string{"x"}},
+			{Key: "s3", Type: "set", Fields: []string{"x"}},
+		}, got())
+
+		mustOK(t, c, "RENAME", "h2", "h3")
+		equals(t, []WriteOp{
+			{Key: "h3", Type: "hash", Fields: []string{"b", "c", "d"}},
+			{Key: "h2", Fields: []string{"b", "c", "d"}},
+		}, got())
+
+		mustDo(t, c, "SUNIONSTORE", "s3", "s2", "s3", proto.Int(2))
+		equals(t, []WriteOp{{Key: "s3", Type: "set", Fields: []string{"y"}}}, got())
+
+		must1(t, c, "COPY", "h3", "s3", "REPLACE")
+		equals(t, []WriteOp{{Key: "s3", Type: "hash", Fields: []string{"b", "c", "d", "x", "y"}}}, got())
+
+		mustDo(t, c, "ZADD", "z", "3", "one", "3", "three", proto.Int(1))
+		equals(t, []WriteOp{{Key: "z", Type: "zset", Fields: []string{"one", "three"}}}, got())
+		mustDo(t, c, "ZADD", "z", "3", "one", proto.Int(0))
+		equals(t, []WriteOp{{Key: "z", Type: "zset"}}, got())
+
+		for _, k := range []string{"h3", "s2", "s3"} {
+			must1(t, c, "DEL", k)
+		}
+		got()
+	})
+
+	t.Run("go", func(t *testing.T) {
+		m.DB(2).Set("foo", "bar")
+		m.FastForward(20 * time.Second)
+		equals(t, []WriteOp{{DB: 2, Key: "foo", Type: "string"}}, got())
+
+		m.SetTTL("s", time.Second)
+		m.FastForward(time.Second)
+		equals(t, []WriteOp{
+			{Key: "s", Type: "set", TTL: time.Second, TTLChanged: true},
+			{Key: "s", Fields: []string{"b"}, TTLChanged: true},
+		}, got())
+	})
+
+	t.Run("callback uses miniredis", func(t *testing.T) {
+		m.OnWrite(func(op WriteOp) {
+			if op.Key == "foo" {
+				m.Set("mirror", op.Type)
+			}
+		})
+		mustOK(t, c, "SET", "foo", "bar")
+		v, err := m.Get("mirror")
+		ok(t, err)
+		equals(t, "string", v)
+	})
+
+	m.OnWrite(nil)
+	mustOK(t, c, "SET", "foo", "bar")
+	equals(t, []WriteOp(nil), got())
+}